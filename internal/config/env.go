@@ -1,8 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -13,11 +17,114 @@ const (
 	ENV_PROD string = "prod"
 )
 
+const (
+	STORAGE_FILESYSTEM string = "filesystem"
+	STORAGE_S3         string = "s3"
+)
+
+const (
+	EVENT_BUS_MEMORY   string = "memory"
+	EVENT_BUS_POSTGRES string = "postgres"
+)
+
+const (
+	RATE_LIMIT_STORE_MEMORY   string = "memory"
+	RATE_LIMIT_STORE_POSTGRES string = "postgres"
+)
+
 type Config struct {
 	Env         string `required:"true"`
 	Port        string `required:"true"`
 	ServerUrl   string `required:"true" envconfig:"SERVER_URL"`
-	DatabaseUrl string `required:"true" envconfig:"DATABASE_URL"`
+	DatabaseUrl string `envconfig:"DATABASE_URL"` // only needed with the postgres storage
+
+	AnalysisWorkers int           `default:"2" envconfig:"ANALYSIS_WORKERS"`
+	MaxUploadSize   int64         `default:"1073741824" envconfig:"MAX_UPLOAD_SIZE"` // 1 GB
+	UploadTimeout   time.Duration `default:"30m" envconfig:"UPLOAD_TIMEOUT"`
+	UploadDir       string        `default:"./data/uploads" envconfig:"UPLOAD_DIR"`
+	UploadTTL       time.Duration `default:"24h" envconfig:"UPLOAD_TTL"` // incomplete resumable uploads expire after
+	// content types accepted for media, detected from the content itself
+	AllowedMimeTypes []string `default:"image/jpeg,image/png,image/gif,image/webp,image/bmp,video/mp4,video/webm,video/quicktime,video/avi,audio/mpeg,audio/wave,audio/flac,audio/aiff" envconfig:"ALLOWED_MIME_TYPES"`
+
+	// the detectors read the content of media in memory up to this size, larger videos are analysed
+	// frame by frame only and the analysis of other larger media fails
+	AnalysisMaxContentSize int64 `default:"268435456" envconfig:"ANALYSIS_MAX_CONTENT_SIZE"` // 256 MB
+
+	// bearer tokens are signed with the HS256 secret, or with one of the RS256/EdDSA keys of the JWKS file
+	JwtSecret      string `envconfig:"JWT_SECRET"`
+	JwtJwksFile    string `envconfig:"JWT_JWKS_FILE"`
+	JwtIssuer      string `envconfig:"JWT_ISSUER"`
+	JwtAudience    string `envconfig:"JWT_AUDIENCE"`
+	JwtAdminClaim  string `default:"admin" envconfig:"JWT_ADMIN_CLAIM"` // boolean claim granting the admin role
+	JwtTenantClaim string `default:"org" envconfig:"JWT_TENANT_CLAIM"`  // string claim naming the organization of the user
+	// role of the users who were not assigned one: viewer, analyst, reviewer or admin
+	DefaultRole string `default:"viewer" envconfig:"DEFAULT_ROLE"`
+
+	// token buckets per API key, user, or IP address before authentication, written <burst>/<period>
+	// e.g. 60/1m lets 60 requests through at once and gives one back every second, empty disables a limit
+	RateLimitStore  string    `default:"memory" envconfig:"RATE_LIMIT_STORE"` // memory, or postgres to share the limits between replicas
+	RateLimitPublic RateLimit `default:"60/1m" envconfig:"RATE_LIMIT_PUBLIC"`
+	RateLimitRead   RateLimit `default:"600/1m" envconfig:"RATE_LIMIT_READ"`
+	RateLimitWrite  RateLimit `default:"120/1m" envconfig:"RATE_LIMIT_WRITE"`
+	RateLimitUpload RateLimit `default:"20/1m" envconfig:"RATE_LIMIT_UPLOAD"`
+	RateLimitAdmin  RateLimit `default:"60/1m" envconfig:"RATE_LIMIT_ADMIN"`
+	RateLimitAuth   RateLimit `default:"1200/1m" envconfig:"RATE_LIMIT_AUTH"` // per IP address, bounds the credentials tried from it
+	// uploads a client may stream at the same time on one replica, 0 disables the limit
+	MaxConcurrentUploads int `default:"2" envconfig:"MAX_CONCURRENT_UPLOADS"`
+
+	// memory, or postgres for the websocket clients of every replica to hear of the changes made on the others
+	EventBus string `default:"memory" envconfig:"EVENT_BUS"`
+	// websocket clients that can't keep up with their queue are disconnected, the ones
+	// not answering pings within the pong timeout are considered gone
+	WsSendQueueSize int           `default:"64" envconfig:"WS_SEND_QUEUE_SIZE"`
+	WsWriteTimeout  time.Duration `default:"10s" envconfig:"WS_WRITE_TIMEOUT"`
+	WsPongTimeout   time.Duration `default:"60s" envconfig:"WS_PONG_TIMEOUT"`
+
+	// PEM file of the certificates C2PA manifests must be signed under, e.g. the C2PA trust list,
+	// without it the Content Credentials are verified but no signer is trusted
+	C2paTrustAnchors string `envconfig:"C2PA_TRUST_ANCHORS"`
+
+	// videos are analysed frame by frame when ffmpeg and ffprobe are installed, at their keyframes
+	// or at a fixed interval, longer videos have their frames sampled further apart
+	VideoSampling      string        `default:"keyframes" envconfig:"VIDEO_SAMPLING"` // keyframes or interval
+	VideoFrameInterval time.Duration `default:"2s" envconfig:"VIDEO_FRAME_INTERVAL"`
+	VideoMaxFrames     int           `default:"60" envconfig:"VIDEO_MAX_FRAMES"`
+	FfmpegPath         string        `default:"ffmpeg" envconfig:"FFMPEG_PATH"`
+	FfprobePath        string        `default:"ffprobe" envconfig:"FFPROBE_PATH"`
+
+	BlobStorage     string `default:"filesystem" envconfig:"BLOB_STORAGE"`
+	BlobStoragePath string `default:"./data/blobs" envconfig:"BLOB_STORAGE_PATH"`
+	S3Endpoint      string `envconfig:"S3_ENDPOINT"`
+	S3Region        string `default:"us-east-1" envconfig:"S3_REGION"`
+	S3Bucket        string `envconfig:"S3_BUCKET"`
+	S3AccessKey     string `envconfig:"S3_ACCESS_KEY"`
+	S3SecretKey     string `envconfig:"S3_SECRET_KEY"`
+}
+
+// RateLimit is a rate limit as configured, the API converts it to the limit its stores take.
+type RateLimit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// UnmarshalText reads limits written as <burst>/<period>, e.g. 60/1m. Empty text disables limiting.
+func (l *RateLimit) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	if value == "" {
+		*l = RateLimit{}
+		return nil
+	}
+	rawBurst, rawPeriod, ok := strings.Cut(value, "/")
+	burst, err := strconv.Atoi(rawBurst)
+	if !ok || err != nil || burst <= 0 {
+		return fmt.Errorf("invalid rate limit %q, expected <burst>/<period> e.g. 60/1m", value)
+	}
+	period, err := time.ParseDuration(rawPeriod)
+	if err != nil || period <= 0 {
+		return fmt.Errorf("invalid rate limit %q, expected <burst>/<period> e.g. 60/1m", value)
+	}
+	*l = RateLimit{Burst: burst, Period: period}
+	return nil
 }
 
 var globalConfig Config
@@ -41,9 +148,29 @@ func LoadConfig(logger *slog.Logger) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := globalConfig.validate(); err != nil {
+		return nil, err
+	}
 	return &globalConfig, nil
 }
 
+// minWsPongTimeout keeps the pings, sent every 9/10 of the pong timeout, from flooding the clients.
+const minWsPongTimeout = time.Second
+
+// validate refuses the settings the server could only fail on later, while serving.
+func (c *Config) validate() error {
+	if c.WsSendQueueSize <= 0 {
+		return fmt.Errorf("WS_SEND_QUEUE_SIZE must be positive, got %d", c.WsSendQueueSize)
+	}
+	if c.WsWriteTimeout <= 0 {
+		return fmt.Errorf("WS_WRITE_TIMEOUT must be positive, got %s", c.WsWriteTimeout)
+	}
+	if c.WsPongTimeout < minWsPongTimeout {
+		return fmt.Errorf("WS_PONG_TIMEOUT must be at least %s, got %s", minWsPongTimeout, c.WsPongTimeout)
+	}
+	return nil
+}
+
 func GetConfig() *Config {
 	return &globalConfig
 }
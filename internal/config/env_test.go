@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Config{WsSendQueueSize: 64, WsWriteTimeout: 10 * time.Second, WsPongTimeout: 60 * time.Second}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("expected the defaults to be valid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		env    string
+	}{
+		{"empty queue", func(c *Config) { c.WsSendQueueSize = 0 }, "WS_SEND_QUEUE_SIZE"},
+		{"no write timeout", func(c *Config) { c.WsWriteTimeout = 0 }, "WS_WRITE_TIMEOUT"},
+		{"no pong timeout", func(c *Config) { c.WsPongTimeout = 0 }, "WS_PONG_TIMEOUT"},
+		{"pong timeout too small for the pings", func(c *Config) { c.WsPongTimeout = time.Nanosecond }, "WS_PONG_TIMEOUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.change(&config)
+			if err := config.validate(); err == nil || !strings.Contains(err.Error(), tt.env) {
+				t.Errorf("expected an error naming %s, got %v", tt.env, err)
+			}
+		})
+	}
+}
+
+func TestRateLimitUnmarshalText(t *testing.T) {
+	var limit RateLimit
+	if err := limit.UnmarshalText([]byte("60/1m")); err != nil || limit != (RateLimit{Burst: 60, Period: time.Minute}) {
+		t.Errorf("expected 60 per minute, got %+v (%v)", limit, err)
+	}
+	if err := limit.UnmarshalText([]byte(" ")); err != nil || limit != (RateLimit{}) {
+		t.Errorf("expected an empty limit to disable limiting, got %+v (%v)", limit, err)
+	}
+	for _, invalid := range []string{"60", "0/1m", "60/0s", "a/1m", "60/minute"} {
+		if err := limit.UnmarshalText([]byte(invalid)); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
@@ -2,19 +2,50 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/cosmintimis/deepfake-guardian-api/internal/config"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/analysis"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/c2pa"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/filesystem"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/forensics"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/healthcheck"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/memory"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/metadata"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/postgresql"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/restful"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/s3"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/similarity"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/uploads"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/video"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/lmittmann/tint"
 )
 
+const (
+	STORAGE_POSTGRES string = "postgres"
+	STORAGE_MEMORY   string = "memory"
+)
+
+// requests still running after a shutdown signal get this long to finish
+const SHUTDOWN_TIMEOUT = 30 * time.Second
+
 func main() {
 	logger := slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: slog.LevelDebug}))
 	logger.Info("Starting server")
@@ -27,15 +58,181 @@ func main() {
 	}
 	logger.Info("Configuration loaded", "env", config.Env)
 
-	newConn, dbError := postgresql.InitDB()
-	if dbError != nil {
-		log.Fatal(dbError)
+	storage := flag.String("storage", STORAGE_POSTGRES, "where media records are kept: postgres, or memory to run without a database (nothing survives a restart)")
+	flag.Parse()
+
+	var pool *pgxpool.Pool
+	switch *storage {
+	case STORAGE_POSTGRES:
+		var dbError error
+		pool, dbError = postgresql.InitDB(context.Background())
+		if dbError != nil {
+			log.Fatal(dbError)
+		}
+		defer pool.Close()
+
+		if flag.Arg(0) == "migrate" {
+			if err := runMigrate(logger, pool, config, flag.Args()[1:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		if err := postgresql.MigrateUp(context.Background(), logger, pool); err != nil {
+			log.Fatal(err)
+		}
+		legacy, legacyError := postgresql.HasLegacyMediaData(context.Background(), pool)
+		if legacyError != nil {
+			log.Fatal(legacyError)
+		}
+		if legacy {
+			logger.Warn("The content of legacy media is still in the database, run `migrate legacy-content` to move it to the blob store")
+		}
+	case STORAGE_MEMORY:
+		if flag.Arg(0) == "migrate" {
+			log.Fatal("migrations need the postgres storage")
+		}
+		logger.Warn("Using in-memory storage, media records are lost on restart")
+	default:
+		log.Fatalf("unknown storage %q", *storage)
+	}
+
+	blobStore, blobStoreError := newBlobStore(logger, config)
+	if blobStoreError != nil {
+		log.Fatal(blobStoreError)
+	}
+
+	var mediaRepository repositories.MediaRepository
+	var analysisRepository repositories.AnalysisRepository
+	var uploadRepository repositories.UploadRepository
+	var apiKeyRepository repositories.ApiKeyRepository
+	var userRepository repositories.UserRepository
+	var reviewRepository repositories.ReviewRepository
+	var mediaHashRepository repositories.MediaHashRepository
+	var metadataRepository repositories.MediaMetadataRepository
+	var timelineRepository repositories.TimelineRepository
+	if pool != nil {
+		mediaRepository = postgresql.NewMediaRepository(logger, pool)
+		analysisRepository = postgresql.NewAnalysisRepository(logger, pool)
+		uploadRepository = postgresql.NewUploadRepository(logger, pool)
+		apiKeyRepository = postgresql.NewApiKeyRepository(logger, pool)
+		userRepository = postgresql.NewUserRepository(logger, pool)
+		reviewRepository = postgresql.NewReviewRepository(logger, pool)
+		mediaHashRepository = postgresql.NewMediaHashRepository(logger, pool)
+		metadataRepository = postgresql.NewMediaMetadataRepository(logger, pool)
+		timelineRepository = postgresql.NewTimelineRepository(logger, pool)
+	} else {
+		db := memory.NewDatabase()
+		mediaRepository = memory.NewMediaRepository(db)
+		analysisRepository = memory.NewAnalysisRepository(db)
+		uploadRepository = memory.NewUploadRepository(db)
+		apiKeyRepository = memory.NewApiKeyRepository(db)
+		userRepository = memory.NewUserRepository(db)
+		reviewRepository = memory.NewReviewRepository(db)
+		mediaHashRepository = memory.NewMediaHashRepository(db)
+		metadataRepository = memory.NewMediaMetadataRepository(db)
+		timelineRepository = memory.NewTimelineRepository(db)
 	}
-	defer newConn.Close(context.Background())
 
 	healthcheck := healthcheck.New()
 
-	restfulApi := restful.New(logger, healthcheck)
+	provenanceVerifier, provenanceVerifierError := newProvenanceVerifier(logger, config)
+	if provenanceVerifierError != nil {
+		log.Fatal(provenanceVerifierError)
+	}
+	// register deepfake detectors here, every one of them runs on new or replaced media
+	detectorRegistry := detectors.NewRegistry(metadata.NewDetector(), c2pa.NewDetector(provenanceVerifier), forensics.NewDetector())
+	// and here the ones reading pixels, they also run on the frames sampled from videos
+	frameRegistry := detectors.NewRegistry(forensics.NewDetector())
+	frameSampler, frameSamplerError := newFrameSampler(logger, config)
+	if frameSamplerError != nil {
+		log.Fatal(frameSamplerError)
+	}
+	// media changes and analysis progress are published here, websocket clients hear of them
+	eventBus, eventBusError := newEventBus(logger, config, pool)
+	if eventBusError != nil {
+		log.Fatal(eventBusError)
+	}
+	eventBus.Start()
+	defer eventBus.Stop()
+
+	// near-duplicates are searched in memory, the index follows the media hashed by every replica
+	// videos are hashed by their sampled frames, a nil sampler must not become a non-nil interface
+	var keyframes similarity.KeyframeExtractor
+	if frameSampler != nil {
+		keyframes = frameSampler
+	}
+	similarityIndex := similarity.NewIndex(logger, mediaHashRepository, similarity.NewHasher(keyframes))
+	if err := similarityIndex.Load(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	eventBus.Subscribe(similarityIndex.HandleEvent)
+	similarityIndex.Start()
+	defer similarityIndex.Stop()
+
+	analysisPipeline := analysis.New(logger, analysis.Dependencies{
+		Registry:           detectorRegistry,
+		MediaRepository:    mediaRepository,
+		AnalysisRepository: analysisRepository,
+		MetadataRepository: metadataRepository,
+		TimelineRepository: timelineRepository,
+		BlobStore:          blobStore,
+		Publisher:          eventBus,
+		SimilarityIndex:    similarityIndex,
+		ProvenanceVerifier: provenanceVerifier,
+		FrameRegistry:      frameRegistry,
+		FrameSampler:       frameSampler,
+		MaxContentSize:     config.AnalysisMaxContentSize,
+	})
+	analysisPipeline.Start(config.AnalysisWorkers)
+	defer analysisPipeline.Stop()
+
+	uploadService, uploadServiceError := uploads.New(logger, uploadRepository, mediaRepository, blobStore, &validator.MediaRules{AllowedMimeTypes: config.AllowedMimeTypes}, config.UploadDir, config.UploadTTL)
+	if uploadServiceError != nil {
+		log.Fatal(uploadServiceError)
+	}
+	uploadService.Start()
+	defer uploadService.Stop()
+
+	tokenVerifier, tokenVerifierError := auth.NewJWTVerifier(auth.JWTOptions{
+		Secret:      config.JwtSecret,
+		JWKSFile:    config.JwtJwksFile,
+		Issuer:      config.JwtIssuer,
+		Audience:    config.JwtAudience,
+		AdminClaim:  config.JwtAdminClaim,
+		TenantClaim: config.JwtTenantClaim,
+	})
+	if tokenVerifierError != nil {
+		log.Fatal(tokenVerifierError)
+	}
+
+	policy, policyError := auth.NewPolicy(logger, userRepository, models.Role(config.DefaultRole))
+	if policyError != nil {
+		log.Fatal(policyError)
+	}
+
+	rateLimitStore, rateLimitStoreError := newRateLimitStore(logger, config, pool)
+	if rateLimitStoreError != nil {
+		log.Fatal(rateLimitStoreError)
+	}
+
+	restfulApi := restful.New(logger, restful.Dependencies{
+		Healthcheck:        healthcheck,
+		MediaRepository:    mediaRepository,
+		AnalysisRepository: analysisRepository,
+		MetadataRepository: metadataRepository,
+		TimelineRepository: timelineRepository,
+		ReviewRepository:   reviewRepository,
+		UserRepository:     userRepository,
+		AnalysisPipeline:   analysisPipeline,
+		BlobStore:          blobStore,
+		UploadService:      uploadService,
+		TokenVerifier:      tokenVerifier,
+		ApiKeys:            auth.NewApiKeys(logger, apiKeyRepository),
+		Policy:             policy,
+		RateLimitStore:     rateLimitStore,
+		EventBus:           eventBus,
+		SimilarityIndex:    similarityIndex,
+	})
 	router := restfulApi.Routes()
 
 	port := config.Port
@@ -44,6 +241,96 @@ func main() {
 		Addr:    net.JoinHostPort("0.0.0.0", port),
 	}
 
-	logger.Info("Server started on port " + port)
-	log.Fatal(server.ListenAndServe())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		logger.Info("Server started on port " + port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
+
+	logger.Info("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Server did not shut down cleanly", slog.Any("error", err))
+	}
+	// websocket connections were handed over by the server, they are closed separately
+	restfulApi.Stop()
+}
+
+func newEventBus(logger *slog.Logger, cfg *config.Config, pool *pgxpool.Pool) (events.Bus, error) {
+	switch cfg.EventBus {
+	case config.EVENT_BUS_MEMORY:
+		return memory.NewEventBus(), nil
+	case config.EVENT_BUS_POSTGRES:
+		if pool == nil {
+			return nil, fmt.Errorf("the postgres event bus needs the postgres storage")
+		}
+		return postgresql.NewEventBus(logger, pool), nil
+	default:
+		return nil, fmt.Errorf("unknown event bus %q", cfg.EventBus)
+	}
+}
+
+func newRateLimitStore(logger *slog.Logger, cfg *config.Config, pool *pgxpool.Pool) (repositories.RateLimitStore, error) {
+	switch cfg.RateLimitStore {
+	case config.RATE_LIMIT_STORE_MEMORY:
+		return memory.NewRateLimitStore(), nil
+	case config.RATE_LIMIT_STORE_POSTGRES:
+		if pool == nil {
+			return nil, fmt.Errorf("the postgres rate limit store needs the postgres storage")
+		}
+		return postgresql.NewRateLimitStore(logger, pool), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+}
+
+func newProvenanceVerifier(logger *slog.Logger, cfg *config.Config) (*c2pa.Verifier, error) {
+	if cfg.C2paTrustAnchors == "" {
+		logger.Warn("No C2PA trust anchors configured, Content Credentials are never trusted")
+		return c2pa.NewVerifier(nil), nil
+	}
+	roots, err := c2pa.LoadTrustList(cfg.C2paTrustAnchors)
+	if err != nil {
+		return nil, err
+	}
+	return c2pa.NewVerifier(roots), nil
+}
+
+func newFrameSampler(logger *slog.Logger, cfg *config.Config) (*video.Sampler, error) {
+	sampling := models.FrameSampling(cfg.VideoSampling)
+	if sampling != models.SAMPLING_KEYFRAMES && sampling != models.SAMPLING_INTERVAL {
+		return nil, fmt.Errorf("unknown video sampling %q", cfg.VideoSampling)
+	}
+	decoder, err := video.NewFFmpeg(cfg.FfmpegPath, cfg.FfprobePath)
+	if err != nil {
+		logger.Warn("Videos are not analysed frame by frame", slog.Any("error", err))
+		return nil, nil
+	}
+	return video.NewSampler(decoder, video.Options{
+		Sampling:  sampling,
+		Interval:  cfg.VideoFrameInterval,
+		MaxFrames: cfg.VideoMaxFrames,
+	}), nil
+}
+
+func newBlobStore(logger *slog.Logger, cfg *config.Config) (repositories.BlobStore, error) {
+	switch cfg.BlobStorage {
+	case config.STORAGE_FILESYSTEM:
+		return filesystem.NewBlobStore(logger, cfg.BlobStoragePath)
+	case config.STORAGE_S3:
+		return s3.NewBlobStore(logger, s3.Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob storage %q", cfg.BlobStorage)
+	}
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/internal/config"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/postgresql"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status | legacy-content"
+
+// runMigrate handles the `migrate` subcommand, the server itself applies pending migrations on start.
+// The content of databases created before the blob store is only moved by `migrate legacy-content`.
+func runMigrate(logger *slog.Logger, pool *pgxpool.Pool, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return postgresql.MigrateUp(ctx, logger, pool)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			value, err := strconv.Atoi(args[1])
+			if err != nil || value < 1 {
+				return fmt.Errorf("steps must be a positive integer, %s", migrateUsage)
+			}
+			steps = value
+		}
+		return postgresql.MigrateDown(ctx, logger, pool, steps)
+	case "status":
+		statuses, err := postgresql.MigrationStatuses(ctx, pool)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(writer, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return writer.Flush()
+	case "legacy-content":
+		blobStore, err := newBlobStore(logger, cfg)
+		if err != nil {
+			return err
+		}
+		return postgresql.MoveLegacyMediaData(ctx, logger, pool, blobStore)
+	default:
+		return fmt.Errorf("unknown migrate command %q, %s", args[0], migrateUsage)
+	}
+}
@@ -0,0 +1,113 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+const (
+	// media whose hashing failed are hashed again on their own, the detectors don't run again
+	hashAttempts   = 3
+	hashRetryDelay = 30 * time.Second
+)
+
+var errContentTooLarge = errors.New("media content too large to analyse")
+
+type hashJob struct {
+	mediaId string
+	// attempt counts the failed attempts so far
+	attempt int
+	at      time.Time
+}
+
+// retryHash schedules the hashing of a media once the retry delay passed.
+func (p *pipeline) retryHash(mediaId string, attempt int) {
+	if attempt >= hashAttempts {
+		p.logger.Error("gave up hashing media", slog.String("mediaId", mediaId), slog.Int("attempts", attempt))
+		return
+	}
+	select {
+	case p.hashes <- hashJob{mediaId: mediaId, attempt: attempt, at: time.Now().Add(p.hashRetryDelay)}:
+	default:
+		p.logger.Error("hash queue is full", slog.String("mediaId", mediaId))
+	}
+}
+
+// rehash hashes the media scheduled by retryHash until the pipeline stops.
+func (p *pipeline) rehash() {
+	defer p.wg.Done()
+	for {
+		var job hashJob
+		select {
+		case <-p.ctx.Done():
+			return
+		case job = <-p.hashes:
+		}
+		// the jobs are queued with the same delay, they come due in order
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(time.Until(job.at)):
+		}
+
+		err := p.hashMedia(job.mediaId)
+		switch {
+		case err == nil:
+		case errors.Is(err, utils.ErrMediaNotFound):
+			// deleted meanwhile, nothing is left to hash
+		default:
+			p.logger.Error("failed to hash media", slog.String("mediaId", job.mediaId), slog.Int("attempt", job.attempt+1), slog.Any("error", err))
+			p.retryHash(job.mediaId, job.attempt+1)
+		}
+	}
+}
+
+func (p *pipeline) hashMedia(mediaId string) error {
+	ctx, cancel := context.WithTimeout(p.ctx, jobTimeout)
+	defer cancel()
+
+	media, err := p.mediaRepository.GetByID(ctx, repositories.SCOPE_ALL, mediaId, nil)
+	if err != nil {
+		return err
+	}
+	// videos are hashed from their frames like during the analysis, whatever their size
+	if p.frameSampler != nil && strings.HasPrefix(media.MimeType, "video/") {
+		sample, err := p.sample(ctx, media)
+		if err != nil {
+			return err
+		}
+		return p.similarity.UpdateFrames(ctx, media, sample.Images())
+	}
+	data, err := p.readContent(ctx, media)
+	if err != nil {
+		return err
+	}
+	return p.similarity.Update(ctx, media, data)
+}
+
+// readContent reads the whole content of a media, the detectors and the hasher work in memory.
+// Content past the max content size is an error rather than read.
+func (p *pipeline) readContent(ctx context.Context, media *models.Media) ([]byte, error) {
+	content, err := p.blobStore.Get(ctx, media.ContentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open media content: %w", err)
+	}
+	defer content.Close()
+	data, err := io.ReadAll(io.LimitReader(content, p.maxContentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media content: %w", err)
+	}
+	if int64(len(data)) > p.maxContentSize {
+		return nil, fmt.Errorf("%w: over %d bytes", errContentTooLarge, p.maxContentSize)
+	}
+	return data, nil
+}
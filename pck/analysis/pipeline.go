@@ -0,0 +1,359 @@
+package analysis
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/c2pa"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/metadata"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/similarity"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/video"
+)
+
+const (
+	queueSize   = 100
+	jobTimeout  = 5 * time.Minute
+	saveTimeout = 10 * time.Second
+	// the detectors read the content in memory, larger media are refused unless they are videos
+	// analysed from their frames
+	defaultMaxContentSize = 256 << 20
+)
+
+type Pipeline interface {
+	// Enqueue schedules a (re)analysis of the given media and returns immediately.
+	Enqueue(mediaId string)
+	Start(workers int)
+	// Stop waits for the running jobs to finish; queued jobs are dropped.
+	Stop()
+}
+
+type pipeline struct {
+	logger             *slog.Logger
+	registry           *detectors.Registry
+	mediaRepository    repositories.MediaRepository
+	analysisRepository repositories.AnalysisRepository
+	metadataRepository repositories.MediaMetadataRepository
+	blobStore          repositories.BlobStore
+	events             events.Publisher
+	similarity         *similarity.Index
+	provenance         *c2pa.Verifier
+	frameRegistry      *detectors.Registry
+	frameSampler       *video.Sampler
+	timelineRepository repositories.TimelineRepository
+	jobs               chan string
+	hashes             chan hashJob
+	hashRetryDelay     time.Duration
+	maxContentSize     int64
+	ctx                context.Context
+	cancel             context.CancelFunc
+	wg                 sync.WaitGroup
+}
+
+// Dependencies are what the pipeline analyses the media with. FrameSampler and MaxContentSize
+// are optional, the other ones are required.
+type Dependencies struct {
+	Registry           *detectors.Registry
+	MediaRepository    repositories.MediaRepository
+	AnalysisRepository repositories.AnalysisRepository
+	MetadataRepository repositories.MediaMetadataRepository
+	TimelineRepository repositories.TimelineRepository
+	BlobStore          repositories.BlobStore
+	Publisher          events.Publisher
+	SimilarityIndex    *similarity.Index
+	ProvenanceVerifier *c2pa.Verifier
+	// FrameRegistry holds the detectors run on the frames sampled by FrameSampler
+	FrameRegistry *detectors.Registry
+	FrameSampler  *video.Sampler
+	// MaxContentSize bounds the content read in memory by the detectors, 256 MB when 0
+	MaxContentSize int64
+}
+
+// New returns a pipeline telling the clients how the analyses go through the publisher. The
+// media are hashed into the similarity index, their metadata extracted and their C2PA manifests
+// verified before the detectors run. A failed hashing is retried on its own, so is the hashing
+// of the media the queue had no room for. The frames sampled from videos go through the frame detectors,
+// videos are analysed as a whole only when the sampler is nil.
+func New(logger *slog.Logger, deps Dependencies) Pipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pipeline{
+		logger:             logger,
+		registry:           deps.Registry,
+		mediaRepository:    deps.MediaRepository,
+		analysisRepository: deps.AnalysisRepository,
+		metadataRepository: deps.MetadataRepository,
+		blobStore:          deps.BlobStore,
+		events:             deps.Publisher,
+		similarity:         deps.SimilarityIndex,
+		provenance:         deps.ProvenanceVerifier,
+		frameRegistry:      deps.FrameRegistry,
+		frameSampler:       deps.FrameSampler,
+		timelineRepository: deps.TimelineRepository,
+		jobs:               make(chan string, queueSize),
+		hashes:             make(chan hashJob, queueSize),
+		hashRetryDelay:     hashRetryDelay,
+		maxContentSize:     cmp.Or(deps.MaxContentSize, defaultMaxContentSize),
+		ctx:                ctx,
+		cancel:             cancel,
+	}
+}
+
+func (p *pipeline) Enqueue(mediaId string) {
+	now := time.Now().UTC()
+	pending := &models.Analysis{
+		MediaId:   mediaId,
+		Status:    models.ANALYSIS_PENDING,
+		Verdict:   models.VERDICT_INCONCLUSIVE,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// the pending state is saved before queueing so it can't overwrite a worker's progress
+	if err := p.analysisRepository.Save(p.ctx, pending); err != nil {
+		p.logger.Error("failed to save pending analysis", slog.String("mediaId", mediaId), slog.Any("error", err))
+	}
+
+	select {
+	case p.jobs <- mediaId:
+	default:
+		p.logger.Error("analysis queue is full", slog.String("mediaId", mediaId))
+		pending.Status = models.ANALYSIS_FAILED
+		pending.Error = "analysis queue is full"
+		if err := p.analysisRepository.Save(p.ctx, pending); err != nil {
+			p.logger.Error("failed to save failed analysis", slog.String("mediaId", mediaId), slog.Any("error", err))
+		}
+		// the media is still found by its near-duplicates
+		p.retryHash(mediaId, 0)
+	}
+}
+
+func (p *pipeline) Start(workers int) {
+	for range workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+	p.wg.Add(1)
+	go p.rehash()
+}
+
+func (p *pipeline) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+func (p *pipeline) work() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case mediaId := <-p.jobs:
+			p.run(mediaId)
+		}
+	}
+}
+
+func (p *pipeline) run(mediaId string) {
+	ctx, cancel := context.WithTimeout(p.ctx, jobTimeout)
+	defer cancel()
+
+	analysis := &models.Analysis{
+		MediaId:   mediaId,
+		Status:    models.ANALYSIS_RUNNING,
+		Verdict:   models.VERDICT_INCONCLUSIVE,
+		CreatedAt: time.Now().UTC(),
+	}
+	analysis.UpdatedAt = analysis.CreatedAt
+	if err := p.analysisRepository.Save(ctx, analysis); err != nil {
+		p.logger.Error("failed to save running analysis", slog.String("mediaId", mediaId), slog.Any("error", err))
+	}
+
+	media, err := p.mediaRepository.GetByID(ctx, repositories.SCOPE_ALL, mediaId, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to load media: %w", err)
+	} else {
+		p.publish(ctx, media, events.ANALYSIS_STARTED, analysis, 0)
+		err = p.analyse(ctx, media, analysis)
+	}
+	if err != nil {
+		p.logger.Error("analysis failed", slog.String("mediaId", mediaId), slog.Any("error", err))
+		analysis.Status = models.ANALYSIS_FAILED
+		analysis.Error = err.Error()
+	} else {
+		analysis.Status = models.ANALYSIS_COMPLETED
+	}
+	analysis.UpdatedAt = time.Now().UTC()
+
+	// the outcome is recorded even when the job timed out or the pipeline is stopping
+	saveCtx, cancelSave := context.WithTimeout(context.WithoutCancel(ctx), saveTimeout)
+	defer cancelSave()
+	if err := p.analysisRepository.Save(saveCtx, analysis); err != nil {
+		p.logger.Error("failed to save analysis", slog.String("mediaId", mediaId), slog.Any("error", err))
+	}
+	// without its media nobody could be told
+	if media != nil {
+		p.publish(saveCtx, media, events.ANALYSIS_COMPLETED, analysis, 1)
+	}
+}
+
+func (p *pipeline) analyse(ctx context.Context, media *models.Media, analysis *models.Analysis) error {
+	// videos are sampled once, streamed to the sampler, their frames are hashed and go through
+	// the frame detectors
+	analyseFrames := p.frameSampler != nil && strings.HasPrefix(media.MimeType, "video/")
+	var sample *video.Sample
+	var sampleErr error
+	if analyseFrames {
+		sample, sampleErr = p.sample(ctx, media)
+	}
+	data, err := p.readContent(ctx, media)
+	if sample != nil && errors.Is(err, errContentTooLarge) {
+		// the frames are all that is analysed of the videos too large for the detectors
+		p.logger.Warn("video too large for the detectors of the whole video", slog.String("mediaId", media.Id), slog.Int("size", media.Size))
+		p.hash(ctx, media, nil, sample)
+		analysis.Results = append(analysis.Results, p.analyseFrames(ctx, media, sample, nil))
+		analysis.Score, analysis.Verdict = detectors.Aggregate(analysis.Results)
+		return ctx.Err()
+	}
+	// the analysis fails as a whole when the content can't be read, there is nothing to hash either
+	if err != nil {
+		if sampleErr != nil && errors.Is(err, errContentTooLarge) {
+			return fmt.Errorf("%w, its frames could not be sampled: %w", err, sampleErr)
+		}
+		return err
+	}
+	// near-duplicates are found by their hashes, the detectors run even when hashing failed and
+	// the hashing is retried on its own
+	p.hash(ctx, media, data, sample)
+
+	// the provenance is part of the analysis, the c2pa detector reads its verdict from it
+	analysis.Provenance = p.provenance.Verify(media.MimeType, data)
+	input := &detectors.Input{
+		MediaId:    media.Id,
+		MimeType:   media.MimeType,
+		Data:       data,
+		Location:   media.Location,
+		CreatedAt:  media.CreatedAt,
+		Metadata:   p.extractMetadata(ctx, media, data),
+		Provenance: analysis.Provenance,
+	}
+	registered := p.registry.For(media.MimeType)
+	steps := len(registered)
+	if analyseFrames {
+		steps++
+	}
+	for i, detector := range registered {
+		result, artifacts := runDetector(ctx, detector, input)
+		p.storeArtifacts(ctx, media, &result, artifacts)
+		analysis.Results = append(analysis.Results, result)
+		// progress events carry the score so far, the completed event the final one
+		analysis.Score, analysis.Verdict = detectors.Aggregate(analysis.Results)
+		if i < steps-1 {
+			p.publish(ctx, media, events.ANALYSIS_PROGRESS, analysis, float64(i+1)/float64(steps))
+		}
+	}
+	if analyseFrames {
+		analysis.Results = append(analysis.Results, p.analyseFrames(ctx, media, sample, sampleErr))
+		analysis.Score, analysis.Verdict = detectors.Aggregate(analysis.Results)
+	}
+	return ctx.Err()
+}
+
+// hash indexes the frames sampled from a video, or the content when there are none. A failed
+// hashing is retried on its own.
+func (p *pipeline) hash(ctx context.Context, media *models.Media, data []byte, sample *video.Sample) {
+	var err error
+	if sample != nil {
+		err = p.similarity.UpdateFrames(ctx, media, sample.Images())
+	} else {
+		err = p.similarity.Update(ctx, media, data)
+	}
+	if err != nil {
+		p.logger.Error("failed to hash media", slog.String("mediaId", media.Id), slog.Any("error", err))
+		p.retryHash(media.Id, 1)
+	}
+}
+
+// sample streams a video to the sampler, its content isn't held in memory.
+func (p *pipeline) sample(ctx context.Context, media *models.Media) (*video.Sample, error) {
+	content, err := p.blobStore.Get(ctx, media.ContentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open media content: %w", err)
+	}
+	defer content.Close()
+	return p.frameSampler.SampleReader(ctx, content)
+}
+
+// extractMetadata reads and saves the metadata of the content, nil for the formats it can't be read from.
+func (p *pipeline) extractMetadata(ctx context.Context, media *models.Media, data []byte) *models.MediaMetadata {
+	extracted, err := metadata.Extract(media.MimeType, data)
+	if err != nil {
+		return nil
+	}
+	extracted.MediaId = media.Id
+	if err := p.metadataRepository.Save(ctx, extracted); err != nil {
+		p.logger.Error("failed to save media metadata", slog.String("mediaId", media.Id), slog.Any("error", err))
+	}
+	return extracted
+}
+
+func (p *pipeline) publish(ctx context.Context, media *models.Media, eventType events.Type, analysis *models.Analysis, progress float64) {
+	err := p.events.Publish(ctx, &events.Event{
+		Type:     eventType,
+		TenantId: media.TenantId,
+		OwnerId:  media.OwnerId,
+		MediaId:  media.Id,
+		Actor:    events.ACTOR_SYSTEM,
+		Data:     events.SummarizeAnalysis(analysis, progress),
+	})
+	if err != nil {
+		p.logger.Error("failed to publish analysis event", slog.String("mediaId", media.Id), slog.String("type", string(eventType)), slog.Any("error", err))
+	}
+}
+
+// storeArtifacts puts the files of a detector in the blob store, the result lists the stored ones.
+func (p *pipeline) storeArtifacts(ctx context.Context, media *models.Media, result *models.DetectorResult, artifacts []detectors.Artifact) {
+	for _, artifact := range artifacts {
+		key := repositories.ArtifactKey(media.Id, result.Detector, artifact.Name)
+		if _, err := p.blobStore.Put(ctx, key, bytes.NewReader(artifact.Data)); err != nil {
+			p.logger.Error("failed to store detector artifact", slog.String("mediaId", media.Id), slog.String("detector", result.Detector), slog.String("artifact", artifact.Name), slog.Any("error", err))
+			continue
+		}
+		result.Artifacts = append(result.Artifacts, models.Artifact{Name: artifact.Name, ContentType: artifact.ContentType, Key: key})
+	}
+}
+
+func runDetector(ctx context.Context, detector detectors.Detector, input *detectors.Input) (result models.DetectorResult, artifacts []detectors.Artifact) {
+	result = models.DetectorResult{
+		Detector: detector.Name(),
+		Verdict:  models.VERDICT_INCONCLUSIVE,
+		Signals:  []models.Signal{},
+	}
+	// a misbehaving detector must not take the whole worker down
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result.Error = fmt.Sprintf("detector panicked: %v", recovered)
+		}
+	}()
+
+	detected, err := detector.Detect(ctx, input)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Score = detected.Score
+	result.Verdict = detected.Verdict
+	if detected.Signals != nil {
+		result.Signals = detected.Signals
+	}
+	return result, detected.Artifacts
+}
@@ -0,0 +1,464 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/c2pa"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/filesystem"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/memory"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/similarity"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/video"
+)
+
+// fakeDetector answers every media with the same score, or fails as told.
+type fakeDetector struct {
+	name      string
+	score     float64
+	err       error
+	panics    bool
+	artifacts []detectors.Artifact
+	calls     atomic.Int32
+}
+
+func (d *fakeDetector) Name() string {
+	return d.name
+}
+
+func (d *fakeDetector) Supports(mimeType string) bool {
+	return true
+}
+
+func (d *fakeDetector) Detect(ctx context.Context, input *detectors.Input) (*detectors.Result, error) {
+	d.calls.Add(1)
+	if d.panics {
+		panic("out of range")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return &detectors.Result{Score: d.score, Verdict: detectors.VerdictFromScore(d.score), Artifacts: d.artifacts}, nil
+}
+
+// recordingPublisher keeps the published events in order.
+type recordingPublisher struct {
+	lock   sync.Mutex
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event *events.Event) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.events = append(p.events, *event)
+	return nil
+}
+
+func (p *recordingPublisher) published() []events.Event {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return slices.Clone(p.events)
+}
+
+// failingHashes fails the given number of Save calls, the other calls reach the repository.
+type failingHashes struct {
+	repositories.MediaHashRepository
+	failures atomic.Int32
+}
+
+func (f *failingHashes) Save(ctx context.Context, mediaId string, hashes []models.MediaHash) error {
+	if f.failures.Add(-1) >= 0 {
+		return errors.New("connection lost")
+	}
+	return f.MediaHashRepository.Save(ctx, mediaId, hashes)
+}
+
+// recordingAnalyses keeps the statuses the analyses of every media went through.
+type recordingAnalyses struct {
+	repositories.AnalysisRepository
+	lock     sync.Mutex
+	statuses map[string][]models.AnalysisStatus
+}
+
+func (r *recordingAnalyses) Save(ctx context.Context, analysis *models.Analysis) error {
+	r.lock.Lock()
+	r.statuses[analysis.MediaId] = append(r.statuses[analysis.MediaId], analysis.Status)
+	r.lock.Unlock()
+	return r.AnalysisRepository.Save(ctx, analysis)
+}
+
+func (r *recordingAnalyses) statusesOf(mediaId string) []models.AnalysisStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return slices.Clone(r.statuses[mediaId])
+}
+
+type testPipeline struct {
+	*pipeline
+	mediaRepository repositories.MediaRepository
+	analyses        *recordingAnalyses
+	hashRepository  *failingHashes
+	publisher       *recordingPublisher
+}
+
+// newTestPipeline analyses with the given detectors, the frames of videos are sampled when sampler isn't nil.
+func newTestPipeline(t *testing.T, registry *detectors.Registry, frameRegistry *detectors.Registry, sampler *video.Sampler) *testPipeline {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := memory.NewDatabase()
+	mediaRepository := memory.NewMediaRepository(db)
+	analyses := &recordingAnalyses{AnalysisRepository: memory.NewAnalysisRepository(db), statuses: map[string][]models.AnalysisStatus{}}
+	blobStore, err := filesystem.NewBlobStore(logger, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashRepository := &failingHashes{MediaHashRepository: memory.NewMediaHashRepository(db)}
+	publisher := &recordingPublisher{}
+	created := New(logger, Dependencies{
+		Registry:           registry,
+		MediaRepository:    mediaRepository,
+		AnalysisRepository: analyses,
+		MetadataRepository: memory.NewMediaMetadataRepository(db),
+		TimelineRepository: memory.NewTimelineRepository(db),
+		BlobStore:          blobStore,
+		Publisher:          publisher,
+		SimilarityIndex:    similarity.NewIndex(logger, hashRepository, similarity.NewHasher(nil)),
+		ProvenanceVerifier: c2pa.NewVerifier(nil),
+		FrameRegistry:      frameRegistry,
+		FrameSampler:       sampler,
+	})
+	p := created.(*pipeline)
+	p.hashRetryDelay = time.Millisecond
+	t.Cleanup(p.Stop)
+	return &testPipeline{pipeline: p, mediaRepository: mediaRepository, analyses: analyses, hashRepository: hashRepository, publisher: publisher}
+}
+
+// gradient is an image with enough detail to be hashed.
+func gradient(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			img.SetGray(x, y, color.Gray{Y: uint8(x*4 ^ y*2)})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+func (p *testPipeline) createMedia(t *testing.T, mimeType string, data []byte) *models.Media {
+	t.Helper()
+	ctx := context.Background()
+	info, err := p.blobStore.Put(ctx, repositories.NewContentKey(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := &repositories.MediaPayload{Title: "Clip", MimeType: mimeType, Size: len(data), ContentKey: info.Key, Checksum: info.Checksum, TenantId: "acme", OwnerId: "alice"}
+	payload.SetDefaults()
+	media, err := p.mediaRepository.Create(ctx, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return media
+}
+
+// waitForAnalysis polls until the analysis of the media is completed or failed.
+func (p *testPipeline) waitForAnalysis(t *testing.T, mediaId string) *models.Analysis {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		analysis, err := p.analysisRepository.GetByMediaID(context.Background(), mediaId)
+		if err == nil && (analysis.Status == models.ANALYSIS_COMPLETED || analysis.Status == models.ANALYSIS_FAILED) {
+			return analysis
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the analysis of %s never finished, last %+v (%v)", mediaId, analysis, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForEvents polls until the completion of the analysis of the media was published, and returns
+// the events of the media.
+func (p *testPipeline) waitForEvents(t *testing.T, mediaId string) []events.Event {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var published []events.Event
+		for _, event := range p.publisher.published() {
+			if event.MediaId == mediaId {
+				published = append(published, event)
+			}
+		}
+		if len(published) > 0 && published[len(published)-1].Type == events.ANALYSIS_COMPLETED {
+			return published
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the analysis of %s was never announced as completed, got %+v", mediaId, published)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForHashes polls until the media has the given number of stored hashes.
+func (p *testPipeline) waitForHashes(t *testing.T, mediaId string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hashes, err := p.hashRepository.GetByMediaID(context.Background(), mediaId)
+		if err == nil && len(hashes) == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d hashes of %s, got %d (%v)", count, mediaId, len(hashes), err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	heatmap := detectors.Artifact{Name: "heatmap.png", ContentType: "image/png", Data: []byte("heatmap")}
+	first := &fakeDetector{name: "first", score: 0.2, artifacts: []detectors.Artifact{heatmap}}
+	second := &fakeDetector{name: "second", score: 0.9}
+	failing := &fakeDetector{name: "failing", err: errors.New("unsupported codec")}
+	p := newTestPipeline(t, detectors.NewRegistry(first, second, failing), detectors.NewRegistry(), nil)
+	p.Start(1)
+
+	media := p.createMedia(t, "image/png", gradient(t))
+	p.Enqueue(media.Id)
+	analysis := p.waitForAnalysis(t, media.Id)
+	if analysis.Status != models.ANALYSIS_COMPLETED || analysis.Error != "" || analysis.Score != 0.9 || analysis.Verdict != models.VERDICT_MANIPULATED {
+		t.Fatalf("expected the analysis to complete with the worst score, got %+v", analysis)
+	}
+	expected := []models.AnalysisStatus{models.ANALYSIS_PENDING, models.ANALYSIS_RUNNING, models.ANALYSIS_COMPLETED}
+	if statuses := p.analyses.statusesOf(media.Id); !slices.Equal(statuses, expected) {
+		t.Errorf("expected the analysis to go through %v, got %v", expected, statuses)
+	}
+
+	// the media is found by its near-duplicates
+	if hashes, err := p.hashRepository.GetByMediaID(context.Background(), media.Id); err != nil || len(hashes) != 1 {
+		t.Errorf("expected the media to be hashed, got %+v (%v)", hashes, err)
+	}
+
+	// every detector is recorded, the failed one without weighing in
+	if len(analysis.Results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", analysis.Results)
+	}
+	if failed := analysis.Results[2]; failed.Error != "unsupported codec" || failed.Verdict != models.VERDICT_INCONCLUSIVE {
+		t.Errorf("expected the error of the detector to be recorded, got %+v", failed)
+	}
+
+	// the artifacts are stored under their key, the result points at them
+	if len(analysis.Results[0].Artifacts) != 1 {
+		t.Fatalf("expected the artifact among the results, got %+v", analysis.Results)
+	}
+	artifact := analysis.Results[0].Artifacts[0]
+	if key := repositories.ArtifactKey(media.Id, "first", "heatmap.png"); artifact.Key != key || artifact.Name != heatmap.Name || artifact.ContentType != heatmap.ContentType {
+		t.Errorf("expected the artifact under %s, got %+v", key, artifact)
+	}
+	content, err := p.blobStore.Get(context.Background(), artifact.Key)
+	if err != nil {
+		t.Fatalf("failed to read the artifact: %v", err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); !bytes.Equal(data, heatmap.Data) {
+		t.Errorf("expected the artifact content to be stored, got %q", data)
+	}
+
+	// the clients are told of every detector but the last, then of the final outcome
+	published := p.waitForEvents(t, media.Id)
+	types := []events.Type{events.ANALYSIS_STARTED, events.ANALYSIS_PROGRESS, events.ANALYSIS_PROGRESS, events.ANALYSIS_COMPLETED}
+	summaries := []events.AnalysisSummary{
+		{Status: models.ANALYSIS_RUNNING, Progress: 0, Verdict: models.VERDICT_INCONCLUSIVE},
+		{Status: models.ANALYSIS_RUNNING, Progress: 1.0 / 3, Score: 0.2, Verdict: models.VERDICT_AUTHENTIC},
+		{Status: models.ANALYSIS_RUNNING, Progress: 2.0 / 3, Score: 0.9, Verdict: models.VERDICT_MANIPULATED},
+		{Status: models.ANALYSIS_COMPLETED, Progress: 1, Score: 0.9, Verdict: models.VERDICT_MANIPULATED},
+	}
+	if len(published) != len(types) {
+		t.Fatalf("expected %d events, got %+v", len(types), published)
+	}
+	for i, event := range published {
+		summary, ok := event.Data.(*events.AnalysisSummary)
+		if event.Type != types[i] || !ok || *summary != summaries[i] {
+			t.Errorf("expected the event %d to be %s with %+v, got %s with %+v", i, types[i], summaries[i], event.Type, event.Data)
+		}
+		if event.TenantId != "acme" || event.OwnerId != "alice" || event.Actor != events.ACTOR_SYSTEM {
+			t.Errorf("expected the event %d to reach the owner of the media, got %+v", i, event)
+		}
+	}
+}
+
+func TestPipelineFailed(t *testing.T) {
+	detector := &fakeDetector{name: "fake", score: 0.2}
+	p := newTestPipeline(t, detectors.NewRegistry(detector), detectors.NewRegistry(), nil)
+	p.Start(1)
+
+	// the content is gone before the analysis could read it
+	media := p.createMedia(t, "image/png", gradient(t))
+	if err := p.blobStore.Delete(context.Background(), media.ContentKey); err != nil {
+		t.Fatal(err)
+	}
+	p.Enqueue(media.Id)
+	analysis := p.waitForAnalysis(t, media.Id)
+	if analysis.Status != models.ANALYSIS_FAILED || analysis.Error == "" || len(analysis.Results) != 0 {
+		t.Fatalf("expected the analysis to fail, got %+v", analysis)
+	}
+	expected := []models.AnalysisStatus{models.ANALYSIS_PENDING, models.ANALYSIS_RUNNING, models.ANALYSIS_FAILED}
+	if statuses := p.analyses.statusesOf(media.Id); !slices.Equal(statuses, expected) {
+		t.Errorf("expected the analysis to go through %v, got %v", expected, statuses)
+	}
+	if calls := detector.calls.Load(); calls != 0 {
+		t.Errorf("expected the detector not to run, got %d calls", calls)
+	}
+
+	published := p.waitForEvents(t, media.Id)
+	completed, _ := published[len(published)-1].Data.(*events.AnalysisSummary)
+	if len(published) != 2 || published[0].Type != events.ANALYSIS_STARTED || completed == nil ||
+		completed.Status != models.ANALYSIS_FAILED || completed.Error != analysis.Error {
+		t.Errorf("expected the clients to be told of the failure, got %+v", published)
+	}
+}
+
+func TestUnreadableContentNotRehashed(t *testing.T) {
+	p := newTestPipeline(t, detectors.NewRegistry(&fakeDetector{name: "fake", score: 0.2}), detectors.NewRegistry(), nil)
+
+	media := p.createMedia(t, "image/png", gradient(t))
+	if err := p.blobStore.Delete(context.Background(), media.ContentKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.analyse(context.Background(), media, &models.Analysis{MediaId: media.Id}); err == nil {
+		t.Fatal("expected the analysis to fail without its content")
+	}
+	// only a failed hashing is retried, the read failure is the analysis's own
+	if queued := len(p.hashes); queued != 0 {
+		t.Errorf("expected no hash retry, got %d", queued)
+	}
+}
+
+func TestContentTooLarge(t *testing.T) {
+	detector := &fakeDetector{name: "fake", score: 0.2}
+	p := newTestPipeline(t, detectors.NewRegistry(detector), detectors.NewRegistry(), nil)
+	p.maxContentSize = 64
+	p.Start(1)
+
+	media := p.createMedia(t, "image/png", gradient(t))
+	p.Enqueue(media.Id)
+	analysis := p.waitForAnalysis(t, media.Id)
+	if analysis.Status != models.ANALYSIS_FAILED || !strings.Contains(analysis.Error, errContentTooLarge.Error()) {
+		t.Fatalf("expected the analysis to fail on the size of the content, got %+v", analysis)
+	}
+	if calls := detector.calls.Load(); calls != 0 {
+		t.Errorf("expected the detector not to run, got %d calls", calls)
+	}
+}
+
+func TestPipelineQueueFull(t *testing.T) {
+	p := newTestPipeline(t, detectors.NewRegistry(&fakeDetector{name: "fake", score: 0.2}), detectors.NewRegistry(), nil)
+
+	// nothing drains the queue before the workers start
+	for i := range queueSize {
+		p.Enqueue(fmt.Sprintf("queued-%d", i))
+	}
+	media := p.createMedia(t, "image/png", gradient(t))
+	p.Enqueue(media.Id)
+	analysis, err := p.analysisRepository.GetByMediaID(context.Background(), media.Id)
+	if err != nil || analysis.Status != models.ANALYSIS_FAILED || analysis.Error != "analysis queue is full" {
+		t.Fatalf("expected the analysis to fail at once, got %+v (%v)", analysis, err)
+	}
+	expected := []models.AnalysisStatus{models.ANALYSIS_PENDING, models.ANALYSIS_FAILED}
+	if statuses := p.analyses.statusesOf(media.Id); !slices.Equal(statuses, expected) {
+		t.Errorf("expected the analysis to go through %v, got %v", expected, statuses)
+	}
+
+	// the media left out is still hashed
+	p.Start(1)
+	p.waitForHashes(t, media.Id, 1)
+}
+
+func TestDetectorPanic(t *testing.T) {
+	panicking := &fakeDetector{name: "panicking", panics: true}
+	other := &fakeDetector{name: "other", score: 0.7}
+	p := newTestPipeline(t, detectors.NewRegistry(panicking, other), detectors.NewRegistry(), nil)
+	p.Start(1)
+
+	// the worker survives the panic and goes on with the next media
+	for range 2 {
+		media := p.createMedia(t, "image/png", gradient(t))
+		p.Enqueue(media.Id)
+		analysis := p.waitForAnalysis(t, media.Id)
+		if analysis.Status != models.ANALYSIS_COMPLETED || len(analysis.Results) != 2 {
+			t.Fatalf("expected the analysis to complete, got %+v", analysis)
+		}
+		failed := analysis.Results[0]
+		if failed.Detector != "panicking" || failed.Error != "detector panicked: out of range" || failed.Verdict != models.VERDICT_INCONCLUSIVE {
+			t.Errorf("expected the panic to be recorded as the error of the detector, got %+v", failed)
+		}
+		// the failed detector doesn't weigh in
+		if analysis.Score != 0.7 || analysis.Verdict != models.VERDICT_SUSPICIOUS {
+			t.Errorf("expected the score of the other detector, got %v and %s", analysis.Score, analysis.Verdict)
+		}
+	}
+	if calls := other.calls.Load(); calls != 2 {
+		t.Errorf("expected the other detector to run twice, got %d", calls)
+	}
+}
+
+func TestHashRetried(t *testing.T) {
+	detector := &fakeDetector{name: "fake", score: 0.2}
+	p := newTestPipeline(t, detectors.NewRegistry(detector), detectors.NewRegistry(), nil)
+	p.hashRepository.failures.Store(2)
+	p.Start(1)
+
+	media := p.createMedia(t, "image/png", gradient(t))
+	p.Enqueue(media.Id)
+	if analysis := p.waitForAnalysis(t, media.Id); analysis.Status != models.ANALYSIS_COMPLETED {
+		t.Fatalf("expected the analysis to complete without the hashes, got %+v", analysis)
+	}
+	// the hashing is retried until it goes through, the detectors don't run again
+	p.waitForHashes(t, media.Id, 1)
+	if calls := detector.calls.Load(); calls != 1 {
+		t.Errorf("expected the detector to run once, got %d", calls)
+	}
+}
+
+func TestHashGivenUp(t *testing.T) {
+	detector := &fakeDetector{name: "fake", score: 0.2}
+	p := newTestPipeline(t, detectors.NewRegistry(detector), detectors.NewRegistry(), nil)
+	p.hashRepository.failures.Store(hashAttempts + 1)
+	p.Start(1)
+
+	media := p.createMedia(t, "image/png", gradient(t))
+	p.Enqueue(media.Id)
+	p.waitForAnalysis(t, media.Id)
+	deadline := time.Now().Add(5 * time.Second)
+	for p.hashRepository.failures.Load() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d attempts, %d failures are left", hashAttempts, p.hashRepository.failures.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// no attempt comes after the last one
+	time.Sleep(20 * time.Millisecond)
+	if left := p.hashRepository.failures.Load(); left != 1 {
+		t.Errorf("expected %d attempts, got %d", hashAttempts, hashAttempts+1-left)
+	}
+}
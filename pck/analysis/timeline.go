@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/video"
+)
+
+// FRAMES_DETECTOR names the result summing up the timeline of a video among the detector results.
+const FRAMES_DETECTOR = "frames"
+
+// analyseFrames runs the frame detectors over the frames sampled from a video and saves their
+// timeline, the result flags the suspicious segments. The error is the one of the sampling.
+func (p *pipeline) analyseFrames(ctx context.Context, media *models.Media, sample *video.Sample, err error) models.DetectorResult {
+	result := models.DetectorResult{
+		Detector: FRAMES_DETECTOR,
+		Verdict:  models.VERDICT_INCONCLUSIVE,
+		Signals:  []models.Signal{},
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	timeline := &models.Timeline{
+		MediaId:   media.Id,
+		Sampling:  sample.Sampling,
+		Duration:  sample.Duration.Seconds(),
+		Segments:  make([]models.TimelineSegment, 0, len(sample.Frames)),
+		CreatedAt: time.Now().UTC(),
+	}
+	registered := p.frameRegistry.For("image/png")
+	for i, frame := range sample.Frames {
+		// every frame stands for the video until the next one, the first one from the start
+		segment := models.TimelineSegment{Frame: frame.Time.Seconds(), End: timeline.Duration}
+		if i > 0 {
+			segment.Start = segment.Frame
+		}
+		if i < len(sample.Frames)-1 {
+			segment.End = sample.Frames[i+1].Time.Seconds()
+		}
+
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, frame.Image); err != nil {
+			result.Error = fmt.Sprintf("failed to encode frame: %v", err)
+			return result
+		}
+		input := &detectors.Input{
+			MediaId:   media.Id,
+			MimeType:  "image/png",
+			Data:      encoded.Bytes(),
+			Location:  media.Location,
+			CreatedAt: media.CreatedAt,
+		}
+		for _, detector := range registered {
+			// the artifacts of single frames are not kept, the timeline points at the frame instead
+			detected, _ := runDetector(ctx, detector, input)
+			segment.Results = append(segment.Results, detected)
+		}
+		segment.Score, segment.Verdict = detectors.Aggregate(segment.Results)
+		timeline.Segments = append(timeline.Segments, segment)
+		if err := ctx.Err(); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+
+	if err := p.timelineRepository.Save(ctx, timeline); err != nil {
+		p.logger.Error("failed to save timeline", slog.String("mediaId", media.Id), slog.Any("error", err))
+	}
+	summarizeTimeline(&result, timeline)
+	return result
+}
+
+// summarizeTimeline scores the video with its most suspicious segment, the suspicious segments
+// that follow each other are reported as a single signal.
+func summarizeTimeline(result *models.DetectorResult, timeline *models.Timeline) {
+	for _, segment := range timeline.Segments {
+		result.Score = math.Max(result.Score, segment.Score)
+	}
+	// frames the detectors found nothing in don't make the video authentic
+	if result.Score >= detectors.SUSPICIOUS_THRESHOLD {
+		result.Verdict = detectors.VerdictFromScore(result.Score)
+	}
+	for i := 0; i < len(timeline.Segments); i++ {
+		segment := timeline.Segments[i]
+		if segment.Score < detectors.SUSPICIOUS_THRESHOLD {
+			continue
+		}
+		start, end, score := segment.Start, segment.End, segment.Score
+		for i+1 < len(timeline.Segments) && timeline.Segments[i+1].Score >= detectors.SUSPICIOUS_THRESHOLD {
+			i++
+			end, score = timeline.Segments[i].End, math.Max(score, timeline.Segments[i].Score)
+		}
+		result.Signals = append(result.Signals, models.Signal{
+			Name:        "suspicious_segment",
+			Score:       score,
+			Explanation: fmt.Sprintf("the frames from %.1fs to %.1fs scored up to %.2f", start, end, score),
+		})
+	}
+}
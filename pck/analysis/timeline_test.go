@@ -0,0 +1,202 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/video"
+)
+
+// fakeDecoder answers with the probe it was given, its frames are plain gray with the
+// brightness given for their time.
+type fakeDecoder struct {
+	probe      video.Probe
+	brightness map[time.Duration]uint8
+	probes     atomic.Int32
+}
+
+func (f *fakeDecoder) Probe(ctx context.Context, path string) (*video.Probe, error) {
+	f.probes.Add(1)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	probe := f.probe
+	return &probe, nil
+}
+
+func (f *fakeDecoder) Frame(ctx context.Context, path string, at time.Duration) (image.Image, error) {
+	frame := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range frame.Pix {
+		frame.Pix[i] = f.brightness[at]
+	}
+	return frame, nil
+}
+
+// brightnessDetector scores the frames with their brightness, the frames of fakeDecoder are plain.
+type brightnessDetector struct{}
+
+func (d *brightnessDetector) Name() string {
+	return "brightness"
+}
+
+func (d *brightnessDetector) Supports(mimeType string) bool {
+	return mimeType == "image/png"
+}
+
+func (d *brightnessDetector) Detect(ctx context.Context, input *detectors.Input) (*detectors.Result, error) {
+	frame, err := png.Decode(bytes.NewReader(input.Data))
+	if err != nil {
+		return nil, err
+	}
+	y, _, _, _ := frame.At(0, 0).RGBA()
+	score := float64(y) / 0xffff
+	return &detectors.Result{Score: score, Verdict: detectors.VerdictFromScore(score)}, nil
+}
+
+// newVideoPipeline analyses videos of the given duration sampled every two seconds, the detectors
+// of the whole video find nothing.
+func newVideoPipeline(t *testing.T, decoder *fakeDecoder, frameDetectors ...detectors.Detector) *testPipeline {
+	t.Helper()
+	sampler := video.NewSampler(decoder, video.Options{Sampling: models.SAMPLING_INTERVAL, Interval: 2 * time.Second, MaxFrames: 10, TempDir: t.TempDir()})
+	p := newTestPipeline(t, detectors.NewRegistry(&fakeDetector{name: "fake", score: 0.1}), detectors.NewRegistry(frameDetectors...), sampler)
+	p.Start(1)
+	return p
+}
+
+func TestVideoSampledOnce(t *testing.T) {
+	decoder := &fakeDecoder{probe: video.Probe{Duration: 8 * time.Second}}
+	frameDetector := &fakeDetector{name: "frame", score: 0.2}
+	p := newVideoPipeline(t, decoder, frameDetector)
+
+	media := p.createMedia(t, "video/mp4", []byte("video"))
+	p.Enqueue(media.Id)
+	if analysis := p.waitForAnalysis(t, media.Id); analysis.Status != models.ANALYSIS_COMPLETED {
+		t.Fatalf("expected the analysis to complete, got %+v", analysis)
+	}
+	// the frames the detectors looked at are the ones hashed
+	p.waitForHashes(t, media.Id, 4)
+	if probes := decoder.probes.Load(); probes != 1 {
+		t.Errorf("expected the video to be sampled once, it was probed %d times", probes)
+	}
+	if calls := frameDetector.calls.Load(); calls != 4 {
+		t.Errorf("expected the frame detector to run on 4 frames, got %d", calls)
+	}
+}
+
+func TestLargeVideoAnalysedFromFrames(t *testing.T) {
+	decoder := &fakeDecoder{probe: video.Probe{Duration: 8 * time.Second}}
+	p := newVideoPipeline(t, decoder, &fakeDetector{name: "frame", score: 0.2})
+	p.maxContentSize = 2
+
+	// the video is streamed to the sampler, the detectors of the whole video don't get it
+	media := p.createMedia(t, "video/mp4", []byte("video"))
+	p.Enqueue(media.Id)
+	analysis := p.waitForAnalysis(t, media.Id)
+	if analysis.Status != models.ANALYSIS_COMPLETED || len(analysis.Results) != 1 {
+		t.Fatalf("expected the analysis to complete with the frames only, got %+v", analysis)
+	}
+	if result := framesResult(t, analysis); result.Error != "" || result.Score != 0.2 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	p.waitForHashes(t, media.Id, 4)
+}
+
+// analyseVideo analyses a video of the given duration whose frames every two seconds have the given brightness.
+func analyseVideo(t *testing.T, duration time.Duration, brightness ...uint8) (*models.Analysis, *models.Timeline) {
+	t.Helper()
+	decoder := &fakeDecoder{probe: video.Probe{Duration: duration}, brightness: map[time.Duration]uint8{}}
+	for i, value := range brightness {
+		decoder.brightness[time.Duration(i)*2*time.Second] = value
+	}
+	p := newVideoPipeline(t, decoder, &brightnessDetector{})
+
+	media := p.createMedia(t, "video/mp4", []byte("video"))
+	p.Enqueue(media.Id)
+	analysis := p.waitForAnalysis(t, media.Id)
+	if analysis.Status != models.ANALYSIS_COMPLETED {
+		t.Fatalf("expected the analysis to complete, got %+v", analysis)
+	}
+	timeline, err := p.timelineRepository.GetByMediaID(context.Background(), media.Id)
+	if err != nil {
+		t.Fatalf("expected the timeline to be saved: %v", err)
+	}
+	return analysis, timeline
+}
+
+// framesResult finds the result summing up the timeline among the results of an analysis.
+func framesResult(t *testing.T, analysis *models.Analysis) models.DetectorResult {
+	t.Helper()
+	for _, result := range analysis.Results {
+		if result.Detector == FRAMES_DETECTOR {
+			return result
+		}
+	}
+	t.Fatalf("expected a %s result, got %+v", FRAMES_DETECTOR, analysis.Results)
+	return models.DetectorResult{}
+}
+
+func TestTimeline(t *testing.T) {
+	analysis, timeline := analyseVideo(t, 9*time.Second, 51, 204, 255, 51, 153)
+
+	expected := []models.TimelineSegment{
+		{Start: 0, End: 2, Frame: 0, Score: 0.2, Verdict: models.VERDICT_AUTHENTIC},
+		{Start: 2, End: 4, Frame: 2, Score: 0.8, Verdict: models.VERDICT_MANIPULATED},
+		{Start: 4, End: 6, Frame: 4, Score: 1, Verdict: models.VERDICT_MANIPULATED},
+		{Start: 6, End: 8, Frame: 6, Score: 0.2, Verdict: models.VERDICT_AUTHENTIC},
+		{Start: 8, End: 9, Frame: 8, Score: 0.6, Verdict: models.VERDICT_SUSPICIOUS},
+	}
+	if timeline.Sampling != models.SAMPLING_INTERVAL || timeline.Duration != 9 || len(timeline.Segments) != len(expected) {
+		t.Fatalf("unexpected timeline %+v", timeline)
+	}
+	for i, segment := range timeline.Segments {
+		want := expected[i]
+		if segment.Start != want.Start || segment.End != want.End || segment.Frame != want.Frame ||
+			math.Abs(segment.Score-want.Score) > 1e-9 || segment.Verdict != want.Verdict || len(segment.Results) != 1 {
+			t.Errorf("expected the segment %d to be %+v, got %+v", i, want, segment)
+		}
+	}
+
+	// the video scores as its worst segment, the suspicious segments following each other make a single signal
+	result := framesResult(t, analysis)
+	if result.Error != "" || result.Score != 1 || result.Verdict != models.VERDICT_MANIPULATED {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	signals := []string{
+		fmt.Sprintf("the frames from %.1fs to %.1fs scored up to %.2f", 2.0, 6.0, 1.0),
+		fmt.Sprintf("the frames from %.1fs to %.1fs scored up to %.2f", 8.0, 9.0, 0.6),
+	}
+	if len(result.Signals) != len(signals) {
+		t.Fatalf("expected %d signals, got %+v", len(signals), result.Signals)
+	}
+	for i, signal := range result.Signals {
+		if signal.Name != "suspicious_segment" || signal.Explanation != signals[i] {
+			t.Errorf("expected the signal %q, got %+v", signals[i], signal)
+		}
+	}
+	if analysis.Score != 1 || analysis.Verdict != models.VERDICT_MANIPULATED {
+		t.Errorf("expected the frames to decide the analysis, got %v and %s", analysis.Score, analysis.Verdict)
+	}
+}
+
+func TestTimelineWithoutSuspiciousSegments(t *testing.T) {
+	analysis, timeline := analyseVideo(t, 4*time.Second, 0, 51)
+	if len(timeline.Segments) != 2 {
+		t.Fatalf("expected 2 segments, got %+v", timeline.Segments)
+	}
+
+	// frames the detectors found nothing in don't make the video authentic
+	result := framesResult(t, analysis)
+	if math.Abs(result.Score-0.2) > 1e-9 || result.Verdict != models.VERDICT_INCONCLUSIVE || len(result.Signals) != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	// API_KEY_PREFIX makes leaked keys easy to spot, a key reads dfg_<id>.<secret>
+	API_KEY_PREFIX = "dfg_"
+
+	apiKeySecretLength = 32
+	apiKeySaltLength   = 16
+	// the last use is recorded at most this often, busy clients don't write on every request
+	lastUsedInterval = time.Minute
+)
+
+// ApiKeys issues and verifies the API keys of machine clients.
+type ApiKeys struct {
+	logger     *slog.Logger
+	repository repositories.ApiKeyRepository
+}
+
+func NewApiKeys(logger *slog.Logger, repository repositories.ApiKeyRepository) *ApiKeys {
+	return &ApiKeys{
+		logger:     logger,
+		repository: repository,
+	}
+}
+
+// Create issues a key of the tenant acting as subject, or as "apikey:<id>" when subject is empty.
+// The plain key is returned along the stored record, it can't be recovered afterwards.
+func (k *ApiKeys) Create(ctx context.Context, tenantId string, name string, subject string, scopes []string) (*models.ApiKey, string, error) {
+	secret, err := randomBytes(apiKeySecretLength)
+	if err != nil {
+		return nil, "", err
+	}
+	salt, err := randomBytes(apiKeySaltLength)
+	if err != nil {
+		return nil, "", err
+	}
+
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	key := &models.ApiKey{
+		Id:        uuid.NewString(),
+		Name:      name,
+		TenantId:  tenantId,
+		Subject:   subject,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		Salt:      salt,
+		Hash:      hashSecret(salt, encodedSecret),
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if key.Subject == "" {
+		key.Subject = "apikey:" + key.Id
+	}
+	if err := k.repository.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, API_KEY_PREFIX + key.Id + "." + encodedSecret, nil
+}
+
+func (k *ApiKeys) List(ctx context.Context, tenantId string) ([]models.ApiKey, error) {
+	return k.repository.List(ctx, tenantId)
+}
+
+// Revoke disables a key of the tenant for good and returns it.
+func (k *ApiKeys) Revoke(ctx context.Context, tenantId string, id string) (*models.ApiKey, error) {
+	key, err := k.repository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key.TenantId != tenantId {
+		return nil, utils.ErrApiKeyNotFound
+	}
+	if err := k.repository.Revoke(ctx, tenantId, id, time.Now().UTC().Truncate(time.Microsecond)); err != nil {
+		return nil, err
+	}
+	return k.repository.GetByID(ctx, id)
+}
+
+// Verify checks a plain key and returns the identity it acts as, limited to the scopes of the key.
+func (k *ApiKeys) Verify(ctx context.Context, plain string) (*Identity, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(plain, API_KEY_PREFIX), ".")
+	if !ok || !strings.HasPrefix(plain, API_KEY_PREFIX) || uuid.Validate(id) != nil {
+		return nil, fmt.Errorf("%w: malformed key", utils.ErrInvalidApiKey)
+	}
+	key, err := k.repository.GetByID(ctx, id)
+	if errors.Is(err, utils.ErrApiKeyNotFound) {
+		return nil, utils.ErrInvalidApiKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(hashSecret(key.Salt, secret), key.Hash) != 1 || key.Revoked() {
+		return nil, utils.ErrInvalidApiKey
+	}
+
+	now := time.Now().UTC()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedInterval {
+		// a failed bookkeeping write must not fail the request
+		if err := k.repository.UpdateLastUsed(context.WithoutCancel(ctx), key.TenantId, key.Id, now.Truncate(time.Microsecond)); err != nil {
+			k.logger.Error("failed to record api key use", slog.String("id", key.Id), slog.Any("error", err))
+		}
+	}
+	// never nil, which would grant every scope
+	scopes := append([]string{}, key.Scopes...)
+	return &Identity{TenantId: key.TenantId, Subject: key.Subject, Scopes: scopes, ApiKeyId: key.Id}, nil
+}
+
+// hashSecret salts the secret, a single SHA-256 is enough as the secret is random and long
+// rather than a password that could be guessed.
+func hashSecret(salt []byte, secret string) []byte {
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write([]byte(secret))
+	return hash.Sum(nil)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return b, nil
+}
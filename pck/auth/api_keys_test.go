@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/memory"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+func TestApiKeys(t *testing.T) {
+	ctx := context.Background()
+	repository := memory.NewApiKeyRepository(memory.NewDatabase())
+	apiKeys := NewApiKeys(slog.New(slog.NewTextHandler(io.Discard, nil)), repository)
+
+	key, plain, err := apiKeys.Create(ctx, "newsroom", "ingestion bot", "", []string{SCOPE_MEDIA_WRITE, SCOPE_MEDIA_READ, SCOPE_MEDIA_WRITE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plain, API_KEY_PREFIX+key.Id+".") || strings.Contains(string(key.Hash), plain) {
+		t.Errorf("unexpected plain key %q", plain)
+	}
+	if key.Subject != "apikey:"+key.Id || len(key.Scopes) != 2 {
+		t.Errorf("unexpected key: %+v", key)
+	}
+
+	identity, err := apiKeys.Verify(ctx, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != key.Subject || identity.TenantId != "newsroom" || identity.Admin || identity.ApiKeyId != key.Id {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+	if !identity.HasScope(SCOPE_MEDIA_READ) || identity.HasScope(SCOPE_ANALYSIS_RUN) {
+		t.Errorf("unexpected scopes: %v", identity.Scopes)
+	}
+	stored, err := repository.GetByID(ctx, key.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastUsedAt == nil {
+		t.Error("expected the last use to be recorded")
+	}
+
+	for name, candidate := range map[string]string{
+		"wrong secret": plain[:len(plain)-4] + "AAAA",
+		"no prefix":    strings.TrimPrefix(plain, API_KEY_PREFIX),
+		"unknown id":   API_KEY_PREFIX + "00000000-0000-0000-0000-000000000000.secret",
+		"garbage":      "dfg_garbage",
+	} {
+		if _, err := apiKeys.Verify(ctx, candidate); !errors.Is(err, utils.ErrInvalidApiKey) {
+			t.Errorf("%s: expected an invalid api key error, got %v", name, err)
+		}
+	}
+
+	// admins of another tenant can't tell the key exists
+	if _, err := apiKeys.Revoke(ctx, "other", key.Id); !errors.Is(err, utils.ErrApiKeyNotFound) {
+		t.Errorf("expected the key to be unknown to other tenants, got %v", err)
+	}
+	revoked, err := apiKeys.Revoke(ctx, "newsroom", key.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked.Revoked() {
+		t.Error("expected the key to be revoked")
+	}
+	if _, err := apiKeys.Verify(ctx, plain); !errors.Is(err, utils.ErrInvalidApiKey) {
+		t.Errorf("expected a revoked key to be rejected, got %v", err)
+	}
+	if _, err := apiKeys.Revoke(ctx, "newsroom", "missing"); !errors.Is(err, utils.ErrApiKeyNotFound) {
+		t.Errorf("expected an unknown key to be not found, got %v", err)
+	}
+}
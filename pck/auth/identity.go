@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// scopes an API key may carry, they tell which route groups it can call
+const (
+	SCOPE_MEDIA_READ   = "media:read"
+	SCOPE_MEDIA_WRITE  = "media:write"
+	SCOPE_ANALYSIS_RUN = "analysis:run"
+)
+
+var SCOPES = []string{SCOPE_MEDIA_READ, SCOPE_MEDIA_WRITE, SCOPE_ANALYSIS_RUN}
+
+// DEFAULT_TENANT is the organization of the callers whose credentials name none, it holds
+// every record created before organizations existed.
+const DEFAULT_TENANT = "default"
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// TenantId is the organization of the caller, they never reach the records of another one.
+	TenantId string
+	// Subject identifies the user, it is the owner recorded on the media they create.
+	Subject string
+	// Admin is set by the admin claim of a token, it always resolves to the admin role of the tenant.
+	Admin bool
+	// Role is resolved by the Policy once the caller is authenticated.
+	Role models.Role
+	// Scopes limits what the caller may do, nil grants every scope as for interactive users.
+	Scopes []string
+	// ApiKeyId is set when the caller authenticated with an API key.
+	ApiKeyId string
+}
+
+func (i *Identity) HasScope(scope string) bool {
+	return i.Scopes == nil || slices.Contains(i.Scopes, scope)
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the identity the authentication middleware stored, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(*Identity)
+	return identity, ok
+}
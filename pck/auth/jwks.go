@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// jsonWebKey holds the members of a RFC 7517 key needed for RSA and Ed25519 public keys.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+}
+
+// LoadJWKS reads the signing keys of a JSON Web Key Set file by key id. Keys meant for
+// encryption or of other types are skipped, a set without any usable key is an error.
+func LoadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	js, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(js, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS file: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		switch {
+		case jwk.Kty == "RSA":
+			key, err = rsaPublicKey(&jwk)
+		case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+			key, err = ed25519PublicKey(&jwk)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %w", jwk.Kid, err)
+		}
+		if _, exists := keys[jwk.Kid]; exists {
+			return nil, fmt.Errorf("the JWKS file contains the key id %q more than once", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the JWKS file contains no RSA or Ed25519 signing key")
+	}
+	return keys, nil
+}
+
+func rsaPublicKey(jwk *jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("the modulus must be base64url encoded")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("the exponent must be a base64url encoded 32 bit integer")
+	}
+	exponent := new(big.Int).SetBytes(e)
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func ed25519PublicKey(jwk *jsonWebKey) (ed25519.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil || len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("the public key must be %d base64url encoded bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(x), nil
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// clock skew tolerated between the token issuer and this server
+const jwtLeeway = 30 * time.Second
+
+type JWTOptions struct {
+	// Secret verifies HS256 tokens, empty disables them.
+	Secret string
+	// JWKSFile holds the public keys verifying RS256 and EdDSA tokens, empty disables them.
+	JWKSFile string
+	// Issuer and Audience are checked against the iss and aud claims when set.
+	Issuer   string
+	Audience string
+	// AdminClaim names the boolean claim granting the admin role.
+	AdminClaim string
+	// TenantClaim names the string claim holding the organization of the user, tokens
+	// without it belong to DEFAULT_TENANT.
+	TenantClaim string
+}
+
+// JWTVerifier authenticates bearer tokens. Every algorithm is bound to its own kind of
+// key, so a token can't pick HS256 to be checked against a public key used as secret.
+type JWTVerifier struct {
+	secret      []byte
+	keys        map[string]crypto.PublicKey
+	adminClaim  string
+	tenantClaim string
+	parser      *jwt.Parser
+}
+
+func NewJWTVerifier(options JWTOptions) (*JWTVerifier, error) {
+	verifier := &JWTVerifier{
+		secret:      []byte(options.Secret),
+		adminClaim:  options.AdminClaim,
+		tenantClaim: options.TenantClaim,
+	}
+
+	methods := []string{}
+	if options.Secret != "" {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if options.JWKSFile != "" {
+		keys, err := LoadJWKS(options.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier.keys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("authentication needs a JWT secret or a JWKS file")
+	}
+
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+	if options.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(options.Audience))
+	}
+	verifier.parser = jwt.NewParser(parserOptions...)
+	return verifier, nil
+}
+
+// Verify checks the signature and the registered claims of a token and returns the identity it carries.
+func (v *JWTVerifier) Verify(token string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.key); err != nil {
+		return nil, fmt.Errorf("%w: %s", utils.ErrInvalidToken, err)
+	}
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("%w: the sub claim is required", utils.ErrInvalidToken)
+	}
+	tenantId := DEFAULT_TENANT
+	if claim, ok := claims[v.tenantClaim]; ok && v.tenantClaim != "" {
+		tenantId, _ = claim.(string)
+		if tenantId == "" {
+			return nil, fmt.Errorf("%w: the %s claim must be a non empty string", utils.ErrInvalidToken, v.tenantClaim)
+		}
+	}
+	admin, _ := claims[v.adminClaim].(bool)
+	return &Identity{TenantId: tenantId, Subject: subject, Admin: admin}, nil
+}
+
+// key picks the verification key of a token, WithValidMethods already rejected the algorithms not configured.
+func (v *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		return v.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := v.keys[kid]
+	if !ok && kid == "" && len(v.keys) == 1 {
+		// a single key does not need to be named
+		for _, only := range v.keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey:
+		ok = token.Method.Alg() == jwt.SigningMethodRS256.Alg()
+	case ed25519.PublicKey:
+		ok = token.Method.Alg() == jwt.SigningMethodEdDSA.Alg()
+	}
+	if !ok {
+		return nil, fmt.Errorf("key %q can't verify %s tokens", kid, token.Method.Alg())
+	}
+	return key, nil
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// writeJWKS publishes the public halves of an RSA and an Ed25519 key in a JWKS file.
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, edKey ed25519.PrivateKey) string {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+	set := map[string][]map[string]string{"keys": {
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": encode(edKey.Public().(ed25519.PublicKey))},
+		{"kty": "RSA", "kid": "rsa-enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}}
+	js, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, js, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyHS256(t *testing.T) {
+	verifier, err := NewJWTVerifier(JWTOptions{Secret: testSecret, Issuer: "https://issuer.test", Audience: "api", AdminClaim: "admin", TenantClaim: "org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := verifier.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "aud": "api", "admin": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "alice" || !identity.Admin || identity.TenantId != DEFAULT_TENANT {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+	identity, err = verifier.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "aud": "api", "org": "newsroom"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.TenantId != "newsroom" {
+		t.Errorf("expected the tenant of the org claim, got %q", identity.TenantId)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong secret", sign(t, jwt.SigningMethodHS256, []byte("other"), "", jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "aud": "api"})},
+		{"expired", sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "aud": "api", "exp": time.Now().Add(-time.Hour).Unix()})},
+		{"no expiry", sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "aud": "api", "exp": nil})},
+		{"wrong issuer", sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", jwt.MapClaims{"sub": "alice", "iss": "https://other.test", "aud": "api"})},
+		{"wrong audience", sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "aud": "other"})},
+		{"missing subject", sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", jwt.MapClaims{"iss": "https://issuer.test", "aud": "api"})},
+		{"empty tenant", sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", jwt.MapClaims{"sub": "alice", "iss": "https://issuer.test", "aud": "api", "org": ""})},
+		{"garbage", "not.a.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.Verify(tt.token); !errors.Is(err, utils.ErrInvalidToken) {
+				t.Errorf("expected an invalid token error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewJWTVerifier(JWTOptions{JWKSFile: writeJWKS(t, rsaKey, edKey), AdminClaim: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{
+		"RS256": sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", jwt.MapClaims{"sub": "alice"}),
+		"EdDSA": sign(t, jwt.SigningMethodEdDSA, edKey, "ed-1", jwt.MapClaims{"sub": "alice"}),
+	} {
+		identity, err := verifier.Verify(token)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if identity.Subject != "alice" || identity.Admin {
+			t.Errorf("%s: unexpected identity %+v", name, identity)
+		}
+	}
+
+	rejected := map[string]string{
+		"unknown key":     sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-2", jwt.MapClaims{"sub": "alice"}),
+		"mismatched key":  sign(t, jwt.SigningMethodEdDSA, edKey, "rsa-1", jwt.MapClaims{"sub": "alice"}),
+		"encryption key":  sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-enc", jwt.MapClaims{"sub": "alice"}),
+		"no secret HS256": sign(t, jwt.SigningMethodHS256, []byte(""), "", jwt.MapClaims{"sub": "alice"}),
+	}
+	for name, token := range rejected {
+		if _, err := verifier.Verify(token); !errors.Is(err, utils.ErrInvalidToken) {
+			t.Errorf("%s: expected an invalid token error, got %v", name, err)
+		}
+	}
+}
+
+func TestNewJWTVerifierNeedsKeys(t *testing.T) {
+	if _, err := NewJWTVerifier(JWTOptions{}); err == nil {
+		t.Error("expected an error without secret and JWKS file")
+	}
+	if _, err := NewJWTVerifier(JWTOptions{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("expected an error for a missing JWKS file")
+	}
+}
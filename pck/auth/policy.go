@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+// Action is something a caller may be allowed to do. The actions API keys can be
+// granted share their names with the key scopes.
+type Action string
+
+const (
+	ACTION_MEDIA_READ      Action = SCOPE_MEDIA_READ
+	ACTION_MEDIA_WRITE     Action = SCOPE_MEDIA_WRITE
+	ACTION_ANALYSIS_RUN    Action = SCOPE_ANALYSIS_RUN
+	ACTION_REVIEW_WRITE    Action = "review:write"
+	ACTION_USERS_MANAGE    Action = "users:manage"
+	ACTION_API_KEYS_MANAGE Action = "api_keys:manage"
+)
+
+// roleActions are the actions every role adds to those of the roles below it.
+var roleActions = map[models.Role][]Action{
+	models.ROLE_VIEWER:   {ACTION_MEDIA_READ},
+	models.ROLE_ANALYST:  {ACTION_MEDIA_WRITE, ACTION_ANALYSIS_RUN},
+	models.ROLE_REVIEWER: {ACTION_REVIEW_WRITE},
+	models.ROLE_ADMIN:    {ACTION_USERS_MANAGE, ACTION_API_KEYS_MANAGE},
+}
+
+// Policy decides what every caller may do and which media they reach doing it.
+// Handlers consult it rather than checking roles themselves.
+type Policy struct {
+	logger         *slog.Logger
+	userRepository repositories.UserRepository
+	defaultRole    models.Role
+}
+
+func NewPolicy(logger *slog.Logger, userRepository repositories.UserRepository, defaultRole models.Role) (*Policy, error) {
+	if !slices.Contains(models.ROLES, defaultRole) {
+		return nil, fmt.Errorf("unknown default role %q", defaultRole)
+	}
+	return &Policy{
+		logger:         logger,
+		userRepository: userRepository,
+		defaultRole:    defaultRole,
+	}, nil
+}
+
+// Resolve sets the role of an identity. The admin claim makes an admin, which is how the
+// first admin comes to be, API keys act as analysts narrowed by their scopes, and everyone
+// else has the role stored for them or the default role.
+func (p *Policy) Resolve(ctx context.Context, identity *Identity) error {
+	switch {
+	case identity.Admin:
+		identity.Role = models.ROLE_ADMIN
+	case identity.ApiKeyId != "":
+		identity.Role = models.ROLE_ANALYST
+	default:
+		user, err := p.userRepository.GetBySubject(ctx, identity.TenantId, identity.Subject)
+		if errors.Is(err, utils.ErrUserNotFound) {
+			identity.Role = p.defaultRole
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		identity.Role = user.Role
+	}
+	return nil
+}
+
+// Permits tells whether the role, or one of the roles below it, grants the action.
+func (p *Policy) Permits(role models.Role, action Action) bool {
+	for _, candidate := range models.ROLES {
+		if slices.Contains(roleActions[candidate], action) {
+			return true
+		}
+		if candidate == role {
+			return false
+		}
+	}
+	return false
+}
+
+// Authorize returns the media the identity reaches for the action, or an error matching
+// utils.ErrInsufficientScope or utils.ErrForbidden when the action is not allowed.
+func (p *Policy) Authorize(identity *Identity, action Action) (repositories.Scope, error) {
+	if !identity.HasScope(string(action)) {
+		return repositories.Scope{}, fmt.Errorf("%w: %s", utils.ErrInsufficientScope, action)
+	}
+	if !p.Permits(identity.Role, action) {
+		return repositories.Scope{}, fmt.Errorf("%w: %s is not allowed for the %s role", utils.ErrForbidden, action, identity.Role)
+	}
+
+	// viewers can't upload, they observe the media of the whole tenant. Reviewers settle the
+	// verdict of media they did not upload, they read and review them all. Analysts work on
+	// the media they uploaded.
+	reviewing := action == ACTION_MEDIA_READ || action == ACTION_REVIEW_WRITE
+	switch {
+	case identity.Role == models.ROLE_ADMIN,
+		identity.Role == models.ROLE_REVIEWER && reviewing,
+		identity.Role == models.ROLE_VIEWER && action == ACTION_MEDIA_READ:
+		return repositories.TenantScope(identity.TenantId), nil
+	}
+	return repositories.OwnerScope(identity.TenantId, identity.Subject), nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/memory"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+func TestPolicy(t *testing.T) {
+	users := memory.NewUserRepository(memory.NewDatabase())
+	for subject, role := range map[string]models.Role{"rita": models.ROLE_REVIEWER, "ana": models.ROLE_ANALYST} {
+		if _, err := users.Save(context.Background(), &models.User{TenantId: DEFAULT_TENANT, Subject: subject, Role: role, UpdatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	policy, err := NewPolicy(slog.New(slog.NewTextHandler(io.Discard, nil)), users, models.ROLE_VIEWER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolve := func(identity *Identity) *Identity {
+		if err := policy.Resolve(context.Background(), identity); err != nil {
+			t.Fatal(err)
+		}
+		return identity
+	}
+	viewer := resolve(&Identity{TenantId: DEFAULT_TENANT, Subject: "vic"})
+	analyst := resolve(&Identity{TenantId: DEFAULT_TENANT, Subject: "ana"})
+	reviewer := resolve(&Identity{TenantId: DEFAULT_TENANT, Subject: "rita"})
+	admin := resolve(&Identity{TenantId: DEFAULT_TENANT, Subject: "root", Admin: true})
+	apiKey := resolve(&Identity{TenantId: DEFAULT_TENANT, Subject: "bot", ApiKeyId: "key", Scopes: []string{SCOPE_MEDIA_WRITE}})
+	// roles are assigned per tenant
+	if other := resolve(&Identity{TenantId: "other", Subject: "rita"}); other.Role != models.ROLE_VIEWER {
+		t.Errorf("expected the default role in another tenant, got %s", other.Role)
+	}
+	if viewer.Role != models.ROLE_VIEWER || analyst.Role != models.ROLE_ANALYST || reviewer.Role != models.ROLE_REVIEWER || admin.Role != models.ROLE_ADMIN || apiKey.Role != models.ROLE_ANALYST {
+		t.Fatalf("unexpected roles %s, %s, %s, %s, %s", viewer.Role, analyst.Role, reviewer.Role, admin.Role, apiKey.Role)
+	}
+
+	tests := []struct {
+		name     string
+		identity *Identity
+		action   Action
+		scope    repositories.Scope
+		err      error
+	}{
+		// viewers own no media, they read those of the whole tenant
+		{"viewer reads", viewer, ACTION_MEDIA_READ, repositories.TenantScope(DEFAULT_TENANT), nil},
+		{"viewer writes", viewer, ACTION_MEDIA_WRITE, repositories.Scope{}, utils.ErrForbidden},
+		{"analyst reads", analyst, ACTION_MEDIA_READ, repositories.OwnerScope(DEFAULT_TENANT, "ana"), nil},
+		{"analyst writes", analyst, ACTION_MEDIA_WRITE, repositories.OwnerScope(DEFAULT_TENANT, "ana"), nil},
+		{"reviewer reads", reviewer, ACTION_MEDIA_READ, repositories.TenantScope(DEFAULT_TENANT), nil},
+		{"reviewer reviews", reviewer, ACTION_REVIEW_WRITE, repositories.TenantScope(DEFAULT_TENANT), nil},
+		{"reviewer writes", reviewer, ACTION_MEDIA_WRITE, repositories.OwnerScope(DEFAULT_TENANT, "rita"), nil},
+		{"reviewer manages users", reviewer, ACTION_USERS_MANAGE, repositories.Scope{}, utils.ErrForbidden},
+		{"admin manages users", admin, ACTION_USERS_MANAGE, repositories.TenantScope(DEFAULT_TENANT), nil},
+		{"api key writes", apiKey, ACTION_MEDIA_WRITE, repositories.OwnerScope(DEFAULT_TENANT, "bot"), nil},
+		{"api key reads", apiKey, ACTION_MEDIA_READ, repositories.Scope{}, utils.ErrInsufficientScope},
+		{"anonymous", &Identity{Scopes: []string{}}, ACTION_MEDIA_READ, repositories.Scope{}, utils.ErrInsufficientScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := policy.Authorize(tt.identity, tt.action)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if scope != tt.scope {
+				t.Errorf("expected the scope %+v, got %+v", tt.scope, scope)
+			}
+		})
+	}
+}
+
+func TestNewPolicyRejectsUnknownRole(t *testing.T) {
+	if _, err := NewPolicy(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, "owner"); err == nil {
+		t.Error("expected an error for an unknown default role")
+	}
+}
@@ -0,0 +1,83 @@
+package detectors
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// Input is the decoded media handed to every detector.
+type Input struct {
+	MediaId  string
+	MimeType string
+	Data     []byte
+	// Location is the one declared when uploading, CreatedAt the time of the upload
+	Location  string
+	CreatedAt time.Time
+	// Metadata is what the content says about itself, nil when it couldn't be extracted
+	Metadata *models.MediaMetadata
+	// Provenance is the verified C2PA manifest chain, nil when it wasn't looked for
+	Provenance *models.Provenance
+}
+
+// Result is what a detector reports. Score is the likelihood, between 0 and 1,
+// that the media was generated or manipulated.
+type Result struct {
+	Score   float64
+	Verdict models.Verdict
+	Signals []models.Signal
+	// Artifacts are kept in the blob store and served with the analysis, e.g. a heatmap
+	Artifacts []Artifact
+}
+
+// Artifact is a file a detector produced besides its result.
+type Artifact struct {
+	// Name is unique among the artifacts of an analysis, it ends up in the URL of the file
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+type Detector interface {
+	// Name identifies the detector in the stored analysis results.
+	Name() string
+	// Supports reports whether the detector is able to analyse the given MIME type.
+	Supports(mimeType string) bool
+	Detect(ctx context.Context, input *Input) (*Result, error)
+}
+
+const (
+	SUSPICIOUS_THRESHOLD  = 0.5
+	MANIPULATED_THRESHOLD = 0.8
+)
+
+// VerdictFromScore maps a score to a verdict using the shared thresholds,
+// for detectors that have no opinion of their own.
+func VerdictFromScore(score float64) models.Verdict {
+	switch {
+	case score >= MANIPULATED_THRESHOLD:
+		return models.VERDICT_MANIPULATED
+	case score >= SUSPICIOUS_THRESHOLD:
+		return models.VERDICT_SUSPICIOUS
+	default:
+		return models.VERDICT_AUTHENTIC
+	}
+}
+
+// Aggregate combines the per-detector results into an overall score and verdict.
+// The most confident detector wins, failed detectors are ignored.
+func Aggregate(results []models.DetectorResult) (float64, models.Verdict) {
+	score := math.Inf(-1)
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		score = math.Max(score, result.Score)
+	}
+	if math.IsInf(score, -1) {
+		return 0, models.VERDICT_INCONCLUSIVE
+	}
+	return score, VerdictFromScore(score)
+}
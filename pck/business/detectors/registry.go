@@ -0,0 +1,34 @@
+package detectors
+
+import "sync"
+
+type Registry struct {
+	detectors []Detector
+	lock      sync.RWMutex
+}
+
+func NewRegistry(detectors ...Detector) *Registry {
+	return &Registry{
+		detectors: detectors,
+	}
+}
+
+func (r *Registry) Register(detector Detector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.detectors = append(r.detectors, detector)
+}
+
+// For returns the registered detectors able to analyse the given MIME type.
+func (r *Registry) For(mimeType string) []Detector {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var supported []Detector
+	for _, detector := range r.detectors {
+		if detector.Supports(mimeType) {
+			supported = append(supported, detector)
+		}
+	}
+	return supported
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+type AnalysisStatus string
+
+const (
+	ANALYSIS_PENDING   AnalysisStatus = "pending"
+	ANALYSIS_RUNNING   AnalysisStatus = "running"
+	ANALYSIS_COMPLETED AnalysisStatus = "completed"
+	ANALYSIS_FAILED    AnalysisStatus = "failed"
+)
+
+type Verdict string
+
+const (
+	VERDICT_AUTHENTIC    Verdict = "authentic"
+	VERDICT_SUSPICIOUS   Verdict = "suspicious"
+	VERDICT_MANIPULATED  Verdict = "manipulated"
+	VERDICT_INCONCLUSIVE Verdict = "inconclusive"
+)
+
+var VERDICTS = []Verdict{VERDICT_AUTHENTIC, VERDICT_SUSPICIOUS, VERDICT_MANIPULATED, VERDICT_INCONCLUSIVE}
+
+// Signal is a single piece of evidence a detector used to reach its verdict.
+type Signal struct {
+	Name        string  `json:"name"`
+	Score       float64 `json:"score"`
+	Explanation string  `json:"explanation"`
+}
+
+type DetectorResult struct {
+	Detector  string     `json:"detector"`
+	Score     float64    `json:"score"`
+	Verdict   Verdict    `json:"verdict"`
+	Signals   []Signal   `json:"signals"`
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Artifact is a file a detector produced besides its result, e.g. an error level heatmap.
+type Artifact struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	// Key locates the file in the blob store
+	Key string `json:"-"`
+}
+
+type Analysis struct {
+	MediaId   string           `json:"mediaId"`
+	Status    AnalysisStatus   `json:"status"`
+	Score     float64          `json:"score"`
+	Verdict   Verdict          `json:"verdict"`
+	Results   []DetectorResult `json:"results"`
+	Error     string           `json:"error,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+	// Provenance is the verification of the C2PA manifests, nil for the formats they aren't looked for in
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// ApiKey authenticates a machine client. Only a salted hash of its secret is stored,
+// the plain key is shown once when the key is created.
+type ApiKey struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// TenantId is the organization of the admin who created the key, its requests stay within it.
+	TenantId string `json:"tenantId"`
+	// Subject is who requests made with the key act as, e.g. the owner of the media they create.
+	Subject    string     `json:"subject"`
+	Scopes     []string   `json:"scopes"`
+	Salt       []byte     `json:"-"`
+	Hash       []byte     `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+func (k *ApiKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
@@ -1,13 +1,19 @@
 package models
 
+import "time"
+
 type Media struct {
-	Id          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Location    string `json:"location"`
-	Type        string `json:"type"`
-	MimeType    string `json:"mimeType"`
-	Size        int    `json:"size"`
-	Tags        string `json:"tags"`
-	MediaData   string `json:"mediaData"`
+	Id          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Location    string    `json:"location"`
+	Type        string    `json:"type"`
+	MimeType    string    `json:"mimeType"`
+	Size        int       `json:"size"`
+	Tags        string    `json:"tags"`
+	ContentKey  string    `json:"-"`
+	Checksum    string    `json:"checksum"`
+	TenantId    string    `json:"tenantId"`
+	OwnerId     string    `json:"ownerId"`
+	CreatedAt   time.Time `json:"createdAt"`
 }
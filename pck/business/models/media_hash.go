@@ -0,0 +1,13 @@
+package models
+
+// MediaHash holds the perceptual hashes of an image, or of one keyframe of a video.
+type MediaHash struct {
+	MediaId string `json:"mediaId"`
+	// tenant and owner of the media, the index filters the matches with them
+	TenantId string `json:"tenantId"`
+	OwnerId  string `json:"ownerId"`
+	// Frame numbers the keyframes of a video, images only have frame 0
+	Frame int    `json:"frame"`
+	PHash uint64 `json:"pHash"`
+	DHash uint64 `json:"dHash"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// layout of the dates without time zone, as most EXIF dates are
+	localTimeLayout = "2006-01-02T15:04:05"
+)
+
+// MediaMetadata is what the content of a media says about itself, read from its EXIF, XMP and
+// IPTC metadata or from the boxes of its container. Whatever the content doesn't tell is left empty.
+type MediaMetadata struct {
+	MediaId string `json:"mediaId"`
+	// Format is jpeg, png, webp, mp4 or quicktime
+	Format string `json:"format"`
+	// Sources are the metadata blocks found in the content: exif, xmp, iptc, png or quicktime
+	Sources     []string      `json:"sources"`
+	Make        string        `json:"make,omitempty"`
+	Model       string        `json:"model,omitempty"`
+	Software    string        `json:"software,omitempty"`
+	CreatorTool string        `json:"creatorTool,omitempty"`
+	CapturedAt  *MetadataTime `json:"capturedAt,omitempty"`
+	DigitizedAt *MetadataTime `json:"digitizedAt,omitempty"`
+	ModifiedAt  *MetadataTime `json:"modifiedAt,omitempty"`
+	GPS         *GPSPosition  `json:"gps,omitempty"`
+	City        string        `json:"city,omitempty"`
+	Country     string        `json:"country,omitempty"`
+	Keywords    []string      `json:"keywords,omitempty"`
+	// DigitalSourceType is the IPTC code telling how the media was made, e.g. trainedAlgorithmicMedia
+	DigitalSourceType string `json:"digitalSourceType,omitempty"`
+	// GenerationParameters are the prompt and settings image generators write in their PNG text chunks
+	GenerationParameters string          `json:"generationParameters,omitempty"`
+	History              []MetadataEvent `json:"history,omitempty"`
+	ExtractedAt          time.Time       `json:"extractedAt"`
+}
+
+type GPSPosition struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
+
+// MetadataEvent is a step of the editing history of XMP, e.g. saved by Adobe Photoshop.
+type MetadataEvent struct {
+	Action        string        `json:"action"`
+	SoftwareAgent string        `json:"softwareAgent,omitempty"`
+	When          *MetadataTime `json:"when,omitempty"`
+	Changed       string        `json:"changed,omitempty"`
+}
+
+// MetadataTime is a date of the metadata. Most EXIF dates have no time zone, those are kept
+// as UTC with Local set and written without an offset.
+type MetadataTime struct {
+	Time  time.Time
+	Local bool
+}
+
+func (t MetadataTime) MarshalJSON() ([]byte, error) {
+	if t.Local {
+		return json.Marshal(t.Time.Format(localTimeLayout))
+	}
+	return json.Marshal(t.Time.Format(time.RFC3339))
+}
+
+func (t *MetadataTime) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if parsed, err := time.Parse(localTimeLayout, value); err == nil {
+		*t = MetadataTime{Time: parsed, Local: true}
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return err
+	}
+	*t = MetadataTime{Time: parsed}
+	return nil
+}
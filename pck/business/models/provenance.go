@@ -0,0 +1,64 @@
+package models
+
+type ProvenanceState string
+
+const (
+	// every manifest of the chain is signed by a trusted credential and its hashes match
+	PROVENANCE_VALID ProvenanceState = "valid"
+	// a manifest was found but failed verification, the issues tell why
+	PROVENANCE_INVALID ProvenanceState = "invalid"
+	// the content carries no C2PA manifest
+	PROVENANCE_ABSENT ProvenanceState = "absent"
+)
+
+// Provenance is the outcome of verifying the C2PA manifests (Content Credentials) embedded in a media.
+type Provenance struct {
+	State ProvenanceState `json:"state"`
+	// Manifests is the claim chain, from the active manifest to the manifests of its ingredients
+	Manifests []ProvenanceManifest `json:"manifests"`
+	// Issues are the problems of the manifest store itself, the ones of a manifest are listed with it
+	Issues []ProvenanceIssue `json:"issues,omitempty"`
+}
+
+type ProvenanceManifest struct {
+	Label          string                 `json:"label"`
+	State          ProvenanceState        `json:"state"`
+	Title          string                 `json:"title,omitempty"`
+	Format         string                 `json:"format,omitempty"`
+	ClaimGenerator string                 `json:"claimGenerator,omitempty"`
+	Generators     []ProvenanceGenerator  `json:"generators,omitempty"`
+	Signer         string                 `json:"signer,omitempty"`
+	Issuer         string                 `json:"issuer,omitempty"`
+	Trusted        bool                   `json:"trusted"`
+	Actions        []ProvenanceAction     `json:"actions,omitempty"`
+	Ingredients    []ProvenanceIngredient `json:"ingredients,omitempty"`
+	Issues         []ProvenanceIssue      `json:"issues,omitempty"`
+}
+
+// ProvenanceGenerator is the software that wrote a claim, e.g. a camera firmware or an image generator.
+type ProvenanceGenerator struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// ProvenanceAction is an entry of the c2pa.actions assertion, e.g. c2pa.created or c2pa.edited.
+type ProvenanceAction struct {
+	Action            string `json:"action"`
+	SoftwareAgent     string `json:"softwareAgent,omitempty"`
+	DigitalSourceType string `json:"digitalSourceType,omitempty"`
+	When              string `json:"when,omitempty"`
+}
+
+type ProvenanceIngredient struct {
+	Title        string `json:"title,omitempty"`
+	Format       string `json:"format,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+	// Manifest is the label of the manifest of the ingredient, when it had one
+	Manifest string `json:"manifest,omitempty"`
+}
+
+// ProvenanceIssue is a failed check, its code is the C2PA validation status code, e.g. claimSignature.mismatch.
+type ProvenanceIssue struct {
+	Code        string `json:"code"`
+	Explanation string `json:"explanation"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Review is the final verdict a reviewer settled on for a media, it outlives re-analyses.
+type Review struct {
+	MediaId    string    `json:"mediaId"`
+	Verdict    Verdict   `json:"verdict"`
+	Note       string    `json:"note"`
+	ReviewerId string    `json:"reviewerId"`
+	ReviewedAt time.Time `json:"reviewedAt"`
+}
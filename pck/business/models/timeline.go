@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type FrameSampling string
+
+const (
+	// SAMPLING_KEYFRAMES decodes the keyframes of the video, where the encoder saw a new scene
+	SAMPLING_KEYFRAMES FrameSampling = "keyframes"
+	// SAMPLING_INTERVAL decodes a frame every fixed interval
+	SAMPLING_INTERVAL FrameSampling = "interval"
+)
+
+// Timeline is the analysis of a video frame by frame. Every sampled frame stands for the segment
+// until the next one, so reviewers can jump to the suspicious seconds.
+type Timeline struct {
+	MediaId  string        `json:"mediaId"`
+	Sampling FrameSampling `json:"sampling"`
+	// Duration is in seconds, like the times of the segments
+	Duration  float64           `json:"duration"`
+	Segments  []TimelineSegment `json:"segments"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+type TimelineSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// Frame is the time of the frame the image detectors analysed
+	Frame   float64          `json:"frame"`
+	Score   float64          `json:"score"`
+	Verdict Verdict          `json:"verdict"`
+	Results []DetectorResult `json:"results"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Upload is a resumable upload in progress, once all bytes arrived it turns into a Media.
+type Upload struct {
+	Id        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata"`
+	MediaId   string            `json:"mediaId"`
+	TenantId  string            `json:"tenantId"`
+	OwnerId   string            `json:"ownerId"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+func (u *Upload) Completed() bool {
+	return u.MediaId != ""
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Role grants a user the permissions of its own level and of every level below it.
+type Role string
+
+const (
+	ROLE_VIEWER   Role = "viewer"
+	ROLE_ANALYST  Role = "analyst"
+	ROLE_REVIEWER Role = "reviewer"
+	ROLE_ADMIN    Role = "admin"
+)
+
+// ROLES lists the roles from the least to the most privileged.
+var ROLES = []Role{ROLE_VIEWER, ROLE_ANALYST, ROLE_REVIEWER, ROLE_ADMIN}
+
+// User records the role assigned to an authenticated subject within a tenant, subjects
+// without a record get the default role.
+type User struct {
+	TenantId  string    `json:"tenantId"`
+	Subject   string    `json:"subject"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+type AnalysisRepository interface {
+	GetByMediaID(ctx context.Context, mediaId string) (*models.Analysis, error)
+	// Save replaces the stored analysis of a media, including its detector results.
+	Save(ctx context.Context, analysis *models.Analysis) error
+}
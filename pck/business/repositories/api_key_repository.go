@@ -0,0 +1,19 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+type ApiKeyRepository interface {
+	// GetByID finds a key of any tenant, the id of a key comes before its tenant is known.
+	GetByID(ctx context.Context, id string) (*models.ApiKey, error)
+	// List returns every key of the tenant, revoked ones included, the newest first.
+	List(ctx context.Context, tenantId string) ([]models.ApiKey, error)
+	Create(ctx context.Context, key *models.ApiKey) error
+	// Revoke keeps the time of the first revocation when a key is revoked again.
+	Revoke(ctx context.Context, tenantId string, id string, revokedAt time.Time) error
+	UpdateLastUsed(ctx context.Context, tenantId string, id string, lastUsedAt time.Time) error
+}
@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"context"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+type BlobInfo struct {
+	Key  string
+	Size int64
+	// Checksum is the hex encoded SHA-256 of the content.
+	Checksum string
+}
+
+// BlobStore keeps the raw media content, the media rows only reference it by key.
+type BlobStore interface {
+	Put(ctx context.Context, key string, content io.Reader) (*BlobInfo, error)
+	// Get opens the content for reading, seeking lets HTTP range requests skip to any offset.
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewContentKey returns a fresh key, content is never overwritten in place
+// so a failed replacement can't corrupt the current blob.
+func NewContentKey() string {
+	return "media/" + uuid.NewString()
+}
+
+// ArtifactKey returns the key of a file produced by a detector, the analyses of a media
+// overwrite the files of the previous ones.
+func ArtifactKey(mediaId string, detector string, name string) string {
+	return "artifacts/" + mediaId + "/" + detector + "/" + name
+}
@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MediaFields are the JSON names of every field a client may select with ?fields=.
+var MediaFields = []string{"id", "title", "description", "location", "type", "mimeType", "size", "tags", "checksum", "tenantId", "ownerId", "createdAt"}
+
+// SummaryFields is the default projection of list endpoints, enough to render a library overview.
+var SummaryFields = []string{"id", "title", "type", "mimeType", "size", "createdAt"}
+
+// ParseFields validates a comma separated field selection, "*" selects every field.
+// The id is always part of the projection.
+func ParseFields(raw string) ([]string, error) {
+	if raw == "*" {
+		return MediaFields, nil
+	}
+	fields := []string{"id"}
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || slices.Contains(fields, field) {
+			continue
+		}
+		if !slices.Contains(MediaFields, field) {
+			return nil, fmt.Errorf("unknown field %q, use any of %s", field, strings.Join(MediaFields, ", "))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
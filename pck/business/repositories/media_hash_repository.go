@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// MediaHashRepository keeps the perceptual hashes of the media, they are deleted with their media.
+// The hashes are returned with the tenant and owner of their media.
+type MediaHashRepository interface {
+	// Save replaces every hash of a media, the media must exist.
+	Save(ctx context.Context, mediaId string, hashes []models.MediaHash) error
+	GetByMediaID(ctx context.Context, mediaId string) ([]models.MediaHash, error)
+	// List returns the hashes of every media of every tenant, to build an index.
+	List(ctx context.Context) ([]models.MediaHash, error)
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type SortField string
+
+const (
+	SORT_CREATED_AT SortField = "createdAt"
+	SORT_SIZE       SortField = "size"
+	SORT_TITLE      SortField = "title"
+)
+
+type ListOptions struct {
+	Limit int
+	// Cursor is the opaque position returned with a previous page, empty for the first page.
+	Cursor     string
+	Type       string
+	MimeType   string
+	Tag        string
+	MinSize    *int
+	MaxSize    *int
+	Verdict    models.Verdict
+	SortBy     SortField
+	Descending bool
+	// Fields limits the loaded fields, see MediaFields. Empty loads every field.
+	Fields []string
+}
+
+type MediaPage struct {
+	Items      []models.Media
+	NextCursor string
+	PrevCursor string
+}
+
+// MediaCursor is a keyset position: the sort value and id of the item next to the requested page.
+type MediaCursor struct {
+	SortBy     SortField `json:"s"`
+	Descending bool      `json:"d"`
+	Value      string    `json:"v"`
+	Id         string    `json:"i"`
+	// Before selects the page preceding the position instead of the one following it.
+	Before bool `json:"b,omitempty"`
+}
+
+func (c *MediaCursor) Encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// DecodeCursor parses a cursor and makes sure it was issued for the same ordering.
+func DecodeCursor(encoded string, options *ListOptions) (*MediaCursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, utils.ErrInvalidCursor
+	}
+	var cursor MediaCursor
+	if err := json.Unmarshal(js, &cursor); err != nil || cursor.Id == "" {
+		return nil, utils.ErrInvalidCursor
+	}
+	if cursor.SortBy != options.SortBy || cursor.Descending != options.Descending {
+		return nil, utils.ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// NewMediaPage trims the extra row a repository fetched to detect further pages and
+// computes the cursors of the neighbouring pages.
+func NewMediaPage(items []models.Media, options *ListOptions, cursor *MediaCursor) *MediaPage {
+	hasMore := len(items) > options.Limit
+	if hasMore {
+		items = items[:options.Limit]
+	}
+	backwards := cursor != nil && cursor.Before
+	if backwards {
+		slices.Reverse(items)
+	}
+
+	page := &MediaPage{Items: items}
+	if len(items) == 0 {
+		return page
+	}
+
+	// coming from a later page there is always a next one, the extra row tells about the other side
+	hasNext, hasPrev := hasMore, cursor != nil
+	if backwards {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		page.NextCursor = newCursor(&items[len(items)-1], options, false).Encode()
+	}
+	if hasPrev {
+		page.PrevCursor = newCursor(&items[0], options, true).Encode()
+	}
+	return page
+}
+
+func newCursor(media *models.Media, options *ListOptions, before bool) *MediaCursor {
+	return &MediaCursor{
+		SortBy:     options.SortBy,
+		Descending: options.Descending,
+		Value:      SortValue(media, options.SortBy),
+		Id:         media.Id,
+		Before:     before,
+	}
+}
+
+// SortValue renders the value a media is sorted by the way cursors carry it.
+func SortValue(media *models.Media, sortBy SortField) string {
+	switch sortBy {
+	case SORT_SIZE:
+		return strconv.Itoa(media.Size)
+	case SORT_TITLE:
+		return media.Title
+	default:
+		return media.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
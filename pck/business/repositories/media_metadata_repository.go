@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// MediaMetadataRepository keeps the metadata extracted from the content of the media.
+type MediaMetadataRepository interface {
+	GetByMediaID(ctx context.Context, mediaId string) (*models.MediaMetadata, error)
+	// Save replaces the metadata of a media, the media must exist.
+	Save(ctx context.Context, metadata *models.MediaMetadata) error
+}
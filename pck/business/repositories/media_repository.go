@@ -1,13 +1,21 @@
 package repositories
 
-import "github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+import (
+	"context"
+	"strings"
 
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// MediaRepository reports media outside the scope of a call as not found, their
+// existence is not revealed to other owners.
 type MediaRepository interface {
-	GetByID(id string) (*models.Media, error)
-	Create(media *MediaPayload) (*models.Media, error)
-	Update(id string, media *MediaPayload) (*models.Media, error)
-	Delete(id string) (bool, error)
-	GetAll() ([]models.Media, error)
+	// GetByID loads the given fields of a media, see MediaFields. Nil loads every field.
+	GetByID(ctx context.Context, scope Scope, id string, fields []string) (*models.Media, error)
+	Create(ctx context.Context, media *MediaPayload) (*models.Media, error)
+	Update(ctx context.Context, scope Scope, id string, media *MediaPayload) (*models.Media, error)
+	Delete(ctx context.Context, scope Scope, id string) (bool, error)
+	List(ctx context.Context, scope Scope, options ListOptions) (*MediaPage, error)
 }
 
 type MediaPayload struct {
@@ -18,5 +26,22 @@ type MediaPayload struct {
 	MimeType    string `json:"mimeType"`
 	Size        int    `json:"size"`
 	Tags        string `json:"tags"`
-	MediaData   string `json:"mediaData"`
+	// MediaData is the base64 encoded content, it is moved to the blob store before reaching the repository
+	MediaData string `json:"mediaData"`
+
+	ContentKey string `json:"-"`
+	Checksum   string `json:"-"`
+	// TenantId and OwnerId come from the authenticated creator, clients can't set them
+	TenantId string `json:"-"`
+	OwnerId  string `json:"-"`
+}
+
+// SetDefaults derives what an upload left out from the MIME type, e.g. "video" from "video/mp4".
+func (p *MediaPayload) SetDefaults() {
+	if p.MimeType == "" {
+		p.MimeType = "application/octet-stream"
+	}
+	if p.Type == "" {
+		p.Type, _, _ = strings.Cut(p.MimeType, "/")
+	}
 }
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+)
+
+// RateLimit lets Burst requests through at once and gives them back over Period, one
+// token at a time. The zero value disables limiting.
+type RateLimit struct {
+	Burst  int
+	Period time.Duration
+}
+
+func (l RateLimit) Enabled() bool {
+	return l.Burst > 0 && l.Period > 0
+}
+
+// rate is the number of tokens given back every second.
+func (l RateLimit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+func (l RateLimit) String() string {
+	if !l.Enabled() {
+		return ""
+	}
+	return strconv.Itoa(l.Burst) + "/" + l.Period.String()
+}
+
+// RateLimitBucket is the token bucket of one client, the stores only persist it.
+type RateLimitBucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+func NewRateLimitBucket(limit RateLimit, now time.Time) RateLimitBucket {
+	return RateLimitBucket{Tokens: float64(limit.Burst), UpdatedAt: now}
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long a rejected client waits for its next token.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Take gives back the tokens earned since the last request and takes one when there is one left.
+func (b *RateLimitBucket) Take(limit RateLimit, now time.Time) RateLimitResult {
+	elapsed := max(now.Sub(b.UpdatedAt), 0)
+	b.Tokens = min(float64(limit.Burst), b.Tokens+elapsed.Seconds()*limit.rate())
+	b.UpdatedAt = now
+
+	result := RateLimitResult{}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.Tokens) / limit.rate())
+	}
+	result.Remaining = int(math.Floor(b.Tokens))
+	result.Reset = b.FullAt(limit).Sub(now)
+	return result
+}
+
+// FullAt is when the bucket is full again, a bucket left alone until then can be forgotten.
+func (b *RateLimitBucket) FullAt(limit RateLimit) time.Time {
+	return b.UpdatedAt.Add(seconds((float64(limit.Burst) - b.Tokens) / limit.rate()))
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(math.Ceil(value * float64(time.Second)))
+}
+
+// RateLimitStore keeps the token buckets of the clients. The in-memory store limits every
+// replica on its own, the Postgres store shares the buckets between replicas.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of the key, creating a full bucket when there is none.
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (*RateLimitResult, error)
+}
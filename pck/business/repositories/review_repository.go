@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+type ReviewRepository interface {
+	GetByMediaID(ctx context.Context, mediaId string) (*models.Review, error)
+	// Save replaces the review of a media, the media must exist.
+	Save(ctx context.Context, review *models.Review) error
+}
@@ -0,0 +1,30 @@
+package repositories
+
+// Scope restricts the media a repository call reaches to those of one tenant, or of one
+// owner within a tenant. SCOPE_ALL lifts every restriction. The zero value reaches nothing,
+// not even media without owner.
+type Scope struct {
+	TenantId string
+	OwnerId  string
+	All      bool
+}
+
+// SCOPE_ALL crosses tenants, it is meant for background jobs acting on behalf of the system.
+var SCOPE_ALL = Scope{All: true}
+
+// TenantScope reaches every media of the tenant, as its admins do.
+func TenantScope(tenantId string) Scope {
+	return Scope{TenantId: tenantId, All: true}
+}
+
+func OwnerScope(tenantId string, ownerId string) Scope {
+	return Scope{TenantId: tenantId, OwnerId: ownerId}
+}
+
+// Allows tells whether a record of the tenant owned by ownerId is within the scope.
+func (s Scope) Allows(tenantId string, ownerId string) bool {
+	if s.All {
+		return s.TenantId == "" || s.TenantId == tenantId
+	}
+	return s.TenantId != "" && s.TenantId == tenantId && s.OwnerId != "" && s.OwnerId == ownerId
+}
@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// TimelineRepository keeps the frame by frame analyses of the videos.
+type TimelineRepository interface {
+	GetByMediaID(ctx context.Context, mediaId string) (*models.Timeline, error)
+	// Save replaces the timeline of a media, the media must exist.
+	Save(ctx context.Context, timeline *models.Timeline) error
+}
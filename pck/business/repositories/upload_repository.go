@@ -0,0 +1,20 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// UploadRepository only reaches the uploads of the given tenant, the uploads of another one
+// are not found.
+type UploadRepository interface {
+	GetByID(ctx context.Context, tenantId string, id string) (*models.Upload, error)
+	Create(ctx context.Context, upload *models.Upload) error
+	UpdateOffset(ctx context.Context, tenantId string, id string, offset int64, expiresAt time.Time) error
+	Complete(ctx context.Context, tenantId string, id string, mediaId string) error
+	Delete(ctx context.Context, tenantId string, id string) error
+	// GetExpired returns the expired uploads of every tenant.
+	GetExpired(ctx context.Context, now time.Time) ([]models.Upload, error)
+}
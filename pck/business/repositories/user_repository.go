@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// UserRepository keeps the roles of users, a subject has a separate role in every tenant.
+type UserRepository interface {
+	GetBySubject(ctx context.Context, tenantId string, subject string) (*models.User, error)
+	List(ctx context.Context, tenantId string) ([]models.User, error)
+	// Save assigns the role of a user, creating the user when needed.
+	Save(ctx context.Context, user *models.User) (*models.User, error)
+	Delete(ctx context.Context, tenantId string, subject string) error
+}
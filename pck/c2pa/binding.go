@@ -0,0 +1,148 @@
+package c2pa
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"slices"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// checkHardBinding compares the hash of the content with the one of the c2pa.hash.data or
+// c2pa.hash.bmff assertion, nil when they match.
+func checkHardBinding(binding *assertion, asset []byte, claimAlgorithm string) *models.ProvenanceIssue {
+	algorithm := text(binding.content["alg"])
+	if algorithm == "" {
+		algorithm = claimAlgorithm
+	}
+	hasher, ok := newHash(algorithm)
+	if !ok {
+		unsupported := issue(statusAlgorithmUnsupported, "the hash algorithm %q of the hard binding is not supported", algorithm)
+		return &unsupported
+	}
+	expected, _ := binding.content["hash"].([]byte)
+	exclusions, _ := binding.content["exclusions"].([]any)
+
+	label := baseLabel(binding.label)
+	if label == "c2pa.hash.data" {
+		ranges, ok := dataExclusions(exclusions, len(asset))
+		if !ok {
+			malformed := issue(statusDataHashMalformed, "the exclusions of the data hash are not within the content")
+			return &malformed
+		}
+		position := 0
+		for _, excluded := range ranges {
+			hasher.Write(asset[position:excluded[0]])
+			position = excluded[1]
+		}
+		hasher.Write(asset[position:])
+		if !bytes.Equal(hasher.Sum(nil), expected) {
+			mismatch := issue(statusDataHashMismatch, "the content was modified after it was signed")
+			return &mismatch
+		}
+		return nil
+	}
+
+	// fragmented files are hashed box by box into a Merkle tree, which isn't supported
+	if _, found := binding.content["merkle"]; found {
+		unsupported := issue(statusBMFFHashUnsupported, "Merkle tree hashes of fragmented files are not supported")
+		return &unsupported
+	}
+	matchers, ok := bmffExclusions(exclusions)
+	if !ok {
+		unsupported := issue(statusBMFFHashUnsupported, "only exclusions of top level boxes are supported")
+		return &unsupported
+	}
+	boxes, err := readBoxes(asset)
+	if err != nil {
+		mismatch := issue(statusBMFFHashMismatch, "the boxes of the content can't be read: %v", err)
+		return &mismatch
+	}
+	// from version 2 the offsets of the excluded boxes are hashed in their place, moving them breaks the hash
+	withOffsets := label != "c2pa.hash.bmff"
+	for _, box := range boxes {
+		whole := asset[box.offset : box.offset+box.size]
+		if !slices.ContainsFunc(matchers, func(matcher bmffExclusion) bool { return matcher.matches(box.kind, whole) }) {
+			hasher.Write(whole)
+		} else if withOffsets {
+			hasher.Write(binary.BigEndian.AppendUint64(nil, uint64(box.offset)))
+		}
+	}
+	if !bytes.Equal(hasher.Sum(nil), expected) {
+		mismatch := issue(statusBMFFHashMismatch, "the content was modified after it was signed")
+		return &mismatch
+	}
+	return nil
+}
+
+// dataExclusions sorts the start and length exclusions into start and end ranges, false when
+// they overlap or leave the content.
+func dataExclusions(exclusions []any, size int) ([][2]int, bool) {
+	ranges := make([][2]int, 0, len(exclusions))
+	for _, item := range exclusions {
+		exclusion, _ := item.(map[any]any)
+		start, startOk := exclusion["start"].(int64)
+		length, lengthOk := exclusion["length"].(int64)
+		if !startOk || !lengthOk || start < 0 || length < 0 || start > int64(size) || length > int64(size)-start {
+			return nil, false
+		}
+		ranges = append(ranges, [2]int{int(start), int(start + length)})
+	}
+	slices.SortFunc(ranges, func(a, b [2]int) int { return cmp.Compare(a[0], b[0]) })
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i][0] < ranges[i-1][1] {
+			return nil, false
+		}
+	}
+	return ranges, true
+}
+
+// bmffExclusion leaves out the top level boxes of a type, optionally only the ones holding given bytes at given offsets.
+type bmffExclusion struct {
+	kind string
+	data []bmffExclusionData
+}
+
+type bmffExclusionData struct {
+	offset int
+	value  []byte
+}
+
+func (e bmffExclusion) matches(kind string, whole []byte) bool {
+	if e.kind != kind {
+		return false
+	}
+	for _, data := range e.data {
+		if data.offset > len(whole) || !bytes.HasPrefix(whole[data.offset:], data.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// bmffExclusions reads the exclusions of a BMFF hash, false when one of them is not a top level box, e.g. /moov/trak.
+func bmffExclusions(exclusions []any) ([]bmffExclusion, bool) {
+	result := make([]bmffExclusion, 0, len(exclusions))
+	for _, item := range exclusions {
+		exclusion, _ := item.(map[any]any)
+		kind, found := strings.CutPrefix(text(exclusion["xpath"]), "/")
+		if !found || len(kind) != 4 {
+			return nil, false
+		}
+		matcher := bmffExclusion{kind: kind}
+		data, _ := exclusion["data"].([]any)
+		for _, entry := range data {
+			entry, _ := entry.(map[any]any)
+			offset, offsetOk := entry["offset"].(int64)
+			value, valueOk := entry["value"].([]byte)
+			if !offsetOk || !valueOk || offset < 0 {
+				return nil, false
+			}
+			matcher.data = append(matcher.data, bmffExclusionData{offset: int(offset), value: value})
+		}
+		result = append(result, matcher)
+	}
+	return result, true
+}
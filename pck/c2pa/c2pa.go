@@ -0,0 +1,159 @@
+package c2pa
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// validation status codes of the C2PA specification reported as issues
+const (
+	statusManifestMalformed      = "manifest.malformed"
+	statusClaimMissing           = "claim.missing"
+	statusClaimMalformed         = "claim.malformed"
+	statusSignatureMissing       = "claimSignature.missing"
+	statusSignatureMalformed     = "claimSignature.malformed"
+	statusSignatureMismatch      = "claimSignature.mismatch"
+	statusAlgorithmUnsupported   = "algorithm.unsupported"
+	statusCredentialInvalid      = "signingCredential.invalid"
+	statusCredentialUntrusted    = "signingCredential.untrusted"
+	statusCredentialExpired      = "signingCredential.expired"
+	statusAssertionMissing       = "assertion.missing"
+	statusHashedURIMismatch      = "assertion.hashedURI.mismatch"
+	statusHardBindingsMissing    = "claim.hardBindings.missing"
+	statusDataHashMismatch       = "assertion.dataHash.mismatch"
+	statusDataHashMalformed      = "assertion.dataHash.malformed"
+	statusBMFFHashMismatch       = "assertion.bmffHash.mismatch"
+	statusBMFFHashUnsupported    = "assertion.bmffHash.unsupported"
+	statusIngredientMissing      = "ingredient.manifest.missing"
+	statusIngredientChainTooLong = "ingredient.chain.tooLong"
+)
+
+// ingredients of ingredients are followed this deep
+const maxChainLength = 16
+
+// assertions added more than once get a __<n> suffix, e.g. c2pa.ingredient__1
+var instanceSuffix = regexp.MustCompile(`__\d+$`)
+
+// Verifier checks the C2PA manifests (Content Credentials) embedded in the media: the claim
+// signatures against a local list of trust anchors, the hashes of the assertions, and the hard
+// binding of the active manifest to the content.
+type Verifier struct {
+	roots *x509.CertPool
+	now   func() time.Time
+}
+
+// NewVerifier returns a verifier trusting the given anchors, nil trusts no signer.
+func NewVerifier(roots *x509.CertPool) *Verifier {
+	return &Verifier{roots: roots, now: time.Now}
+}
+
+// LoadTrustList reads the PEM certificates of the trust anchors, e.g. the C2PA trust list.
+func LoadTrustList(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust list: %w", err)
+	}
+	roots := x509.NewCertPool()
+	count := 0
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trust anchor: %w", err)
+		}
+		roots.AddCert(certificate)
+		count++
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no certificate found in trust list %s", path)
+	}
+	return roots, nil
+}
+
+// Supports reports whether manifests can be looked for in the given MIME type.
+func (v *Verifier) Supports(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "video/mp4", "video/quicktime":
+		return true
+	}
+	return false
+}
+
+// Verify returns the provenance of a content, nil for the formats manifests aren't looked for in.
+func (v *Verifier) Verify(mimeType string, data []byte) *models.Provenance {
+	if !v.Supports(mimeType) {
+		return nil
+	}
+	found, err := locate(mimeType, data)
+	if errors.Is(err, errNoManifest) {
+		return &models.Provenance{State: models.PROVENANCE_ABSENT, Manifests: []models.ProvenanceManifest{}}
+	}
+	provenance := &models.Provenance{State: models.PROVENANCE_INVALID, Manifests: []models.ProvenanceManifest{}}
+	var store *superbox
+	if err == nil {
+		store, err = parseManifestStore(found.store)
+	}
+	if err != nil {
+		provenance.Issues = append(provenance.Issues, issue(statusManifestMalformed, "the manifest store can't be read: %v", err))
+		return provenance
+	}
+	if len(store.children) == 0 {
+		provenance.Issues = append(provenance.Issues, issue(statusClaimMissing, "the manifest store holds no manifest"))
+		return provenance
+	}
+
+	// the active manifest is the last one, its ingredients lead to the manifests before
+	pending := []string{store.children[len(store.children)-1].label}
+	visited := map[string]bool{pending[0]: true}
+	for len(pending) > 0 {
+		if len(provenance.Manifests) == maxChainLength {
+			provenance.Issues = append(provenance.Issues, issue(statusIngredientChainTooLong, "only the first %d manifests of the chain were verified", maxChainLength))
+			break
+		}
+		label := pending[0]
+		pending = pending[1:]
+		manifest := v.verifyManifest(store, store.child(label), data, len(provenance.Manifests) == 0)
+		for i, ingredient := range manifest.Ingredients {
+			if ingredient.Manifest == "" || visited[ingredient.Manifest] {
+				continue
+			}
+			if store.child(ingredient.Manifest) == nil {
+				manifest.Issues = append(manifest.Issues, issue(statusIngredientMissing, "the manifest of ingredient %d is not in the store", i+1))
+				manifest.State = models.PROVENANCE_INVALID
+				continue
+			}
+			visited[ingredient.Manifest] = true
+			pending = append(pending, ingredient.Manifest)
+		}
+		provenance.Manifests = append(provenance.Manifests, manifest)
+	}
+
+	provenance.State = models.PROVENANCE_VALID
+	if len(provenance.Issues) > 0 {
+		provenance.State = models.PROVENANCE_INVALID
+	}
+	for _, manifest := range provenance.Manifests {
+		if manifest.State != models.PROVENANCE_VALID {
+			provenance.State = models.PROVENANCE_INVALID
+		}
+	}
+	return provenance
+}
+
+func issue(code string, format string, args ...any) models.ProvenanceIssue {
+	return models.ProvenanceIssue{Code: code, Explanation: fmt.Sprintf(format, args...)}
+}
+
+// baseLabel drops the instance suffix of an assertion label.
+func baseLabel(label string) string {
+	return instanceSuffix.ReplaceAllString(label, "")
+}
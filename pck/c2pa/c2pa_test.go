@@ -0,0 +1,464 @@
+package c2pa
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"hash/crc32"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+const (
+	sourceTypeCapture   = "http://cv.iptc.org/newscodes/digitalsourcetype/digitalCapture"
+	sourceTypeGenerated = "http://cv.iptc.org/newscodes/digitalsourcetype/trainedAlgorithmicMedia"
+)
+
+// testCA is a root certificate and a signing credential it issued.
+type testCA struct {
+	root   *x509.Certificate
+	roots  *x509.CertPool
+	leaf   *x509.Certificate
+	signer *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+
+	signerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Signer", Organization: []string{"Test Org"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &signerKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(leafDER)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &testCA{root: root, roots: roots, leaf: leaf, signer: signerKey}
+}
+
+type testAssertion struct {
+	label   string
+	content map[any]any
+}
+
+type testManifest struct {
+	label      string
+	assertions []testAssertion
+}
+
+// jumbfType is a JUMBF description type: four characters then the ISO suffix.
+func jumbfType(name string) []byte {
+	return append([]byte(name), manifestStoreType[4:]...)
+}
+
+func testBox(kind string, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+	return append(binary.BigEndian.AppendUint32([]byte(nil), uint32(8+len(payload))), append([]byte(kind), payload...)...)
+}
+
+func testSuperbox(kind []byte, label string, contents ...[]byte) []byte {
+	description := append(append(slices.Clone(kind), 0x03), append([]byte(label), 0)...)
+	return testBox("jumb", append([][]byte{testBox("jumd", description)}, contents...)...)
+}
+
+func mustCBOR(t *testing.T, value any) []byte {
+	t.Helper()
+	encoded, err := encodeCBOR(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+// sign writes a manifest: the assertions, the claim referencing them by hashed URI and its COSE_Sign1 signature.
+func (ca *testCA) sign(t *testing.T, manifest testManifest) []byte {
+	t.Helper()
+	var assertionBoxes [][]byte
+	var references []any
+	for _, assertion := range manifest.assertions {
+		assertionBox := testSuperbox(jumbfType("cbor"), assertion.label, testBox("cbor", mustCBOR(t, assertion.content)))
+		hash := sha256.Sum256(assertionBox[8:])
+		assertionBoxes = append(assertionBoxes, assertionBox)
+		references = append(references, map[any]any{"url": jumbfURIPrefix + "c2pa.assertions/" + assertion.label, "hash": hash[:]})
+	}
+	claim := mustCBOR(t, map[any]any{
+		"instanceID":           "xmp:iid:" + manifest.label,
+		"claim_generator_info": map[any]any{"name": "Test Generator", "version": "1.0"},
+		"signature":            jumbfURIPrefix + "c2pa.signature",
+		"created_assertions":   references,
+		"alg":                  "sha256",
+		"dc:title":             "test",
+	})
+
+	protected := mustCBOR(t, map[any]any{int64(coseHeaderAlgorithm): int64(coseES256), int64(coseHeaderX5Chain): []any{ca.leaf.Raw}})
+	digest := sha256.Sum256(mustCBOR(t, []any{"Signature1", protected, []byte{}, claim}))
+	r, s, err := ecdsa.Sign(rand.Reader, ca.signer, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	sign1 := mustCBOR(t, []any{protected, map[any]any{}, nil, signature})
+
+	return testSuperbox(jumbfType("c2ma"), manifest.label,
+		testSuperbox(jumbfType("c2as"), "c2pa.assertions", assertionBoxes...),
+		testSuperbox(jumbfType("c2cl"), "c2pa.claim.v2", testBox("cbor", claim)),
+		testSuperbox(jumbfType("c2cs"), "c2pa.signature", testBox("cbor", sign1)),
+	)
+}
+
+func testStore(manifests ...[]byte) []byte {
+	return testSuperbox(manifestStoreType, "c2pa", manifests...)
+}
+
+func pngChunk(kind string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(append(chunk, kind...), data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// testContent is a media split around its manifest store: the bytes before, the ones holding the store, the ones after.
+type testContent struct {
+	mimeType string
+	before   []byte
+	after    []byte
+	wrap     func(store []byte) []byte
+}
+
+var testContents = []testContent{
+	{
+		mimeType: "image/jpeg",
+		before:   []byte{0xFF, 0xD8},
+		after:    []byte{0xFF, 0xDA, 0x00, 0x04, 0x01, 0x02, 0x10, 0x20, 0x30, 0x40, 0xFF, 0xD9},
+		wrap: func(store []byte) []byte {
+			segment := binary.BigEndian.AppendUint16([]byte{0xFF, 0xEB}, uint16(2+8+len(store)))
+			segment = append(append(segment, "JP"...), 0x00, 0x01, 0x00, 0x00, 0x00, 0x01)
+			return append(segment, store...)
+		},
+	},
+	{
+		mimeType: "image/png",
+		before:   append(slices.Clone(pngSignature), pngChunk("IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0})...),
+		after:    append(pngChunk("IDAT", []byte{0x78, 0x9C, 0x63, 0x60, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01}), pngChunk("IEND", nil)...),
+		wrap: func(store []byte) []byte {
+			return pngChunk("caBX", store)
+		},
+	},
+	{
+		mimeType: "video/mp4",
+		before:   testBox("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41")),
+		after:    append(testBox("moov", testBox("mvhd", make([]byte, 100))), testBox("mdat", []byte("frames of the video"))...),
+		wrap: func(store []byte) []byte {
+			return testBox("uuid", bmffManifestUUID, []byte{0, 0, 0, 0}, []byte("manifest\x00"), make([]byte, 8), store)
+		},
+	},
+}
+
+// hardBinding hashes the content without the bytes of the manifest store, which take length bytes.
+func (c testContent) hardBinding(length int) testAssertion {
+	hash := sha256.New()
+	hash.Write(c.before)
+	if c.mimeType == "video/mp4" {
+		hash.Write(binary.BigEndian.AppendUint64(nil, uint64(len(c.before))))
+		hash.Write(c.after)
+		return testAssertion{label: "c2pa.hash.bmff.v2", content: map[any]any{
+			"exclusions": []any{map[any]any{"xpath": "/uuid", "data": []any{map[any]any{"offset": int64(8), "value": bmffManifestUUID}}}},
+			"alg":        "sha256",
+			"hash":       hash.Sum(nil),
+			"name":       "jumbf manifest",
+		}}
+	}
+	hash.Write(c.after)
+	return testAssertion{label: "c2pa.hash.data", content: map[any]any{
+		"exclusions": []any{map[any]any{"start": int64(len(c.before)), "length": int64(length)}},
+		"alg":        "sha256",
+		"hash":       hash.Sum(nil),
+		"name":       "jumbf manifest",
+		"pad":        []byte{},
+	}}
+}
+
+// build signs the active manifest with a hard binding to the content and embeds the store, the
+// ingredient manifests first. The exclusion is sized until the store stops growing with it.
+func (c testContent) build(t *testing.T, ca *testCA, active testManifest, ingredients ...[]byte) []byte {
+	t.Helper()
+	length := 0
+	for range 4 {
+		manifest := active
+		manifest.assertions = append(slices.Clone(active.assertions), c.hardBinding(length))
+		wrapped := c.wrap(testStore(append(slices.Clone(ingredients), ca.sign(t, manifest))...))
+		if len(wrapped) == length {
+			return slices.Concat(c.before, wrapped, c.after)
+		}
+		length = len(wrapped)
+	}
+	t.Fatal("the size of the manifest store doesn't settle")
+	return nil
+}
+
+func actionsAssertion(action string, sourceType string) testAssertion {
+	return testAssertion{label: "c2pa.actions.v2", content: map[any]any{"actions": []any{
+		map[any]any{"action": action, "digitalSourceType": sourceType, "softwareAgent": map[any]any{"name": "Test Camera", "version": "2.1"}},
+	}}}
+}
+
+func capturedManifest() testManifest {
+	return testManifest{label: "urn:c2pa:active", assertions: []testAssertion{actionsAssertion("c2pa.created", sourceTypeCapture)}}
+}
+
+func codes(provenance *models.Provenance) []string {
+	var result []string
+	for _, problem := range allIssues(provenance) {
+		result = append(result, problem.Code)
+	}
+	return result
+}
+
+func TestVerifyValid(t *testing.T) {
+	ca := newTestCA(t)
+	verifier := NewVerifier(ca.roots)
+	for _, content := range testContents {
+		t.Run(content.mimeType, func(t *testing.T) {
+			provenance := verifier.Verify(content.mimeType, content.build(t, ca, capturedManifest()))
+			if provenance.State != models.PROVENANCE_VALID {
+				t.Fatalf("expected a valid provenance, got %s with %v", provenance.State, codes(provenance))
+			}
+			if len(provenance.Manifests) != 1 {
+				t.Fatalf("expected 1 manifest, got %d", len(provenance.Manifests))
+			}
+			manifest := provenance.Manifests[0]
+			if manifest.Label != "urn:c2pa:active" || manifest.Signer != "Test Signer" || manifest.Issuer != "Test Root CA" || !manifest.Trusted {
+				t.Errorf("unexpected signer of %+v", manifest)
+			}
+			expectedGenerators := []models.ProvenanceGenerator{{Name: "Test Generator", Version: "1.0"}}
+			if !reflect.DeepEqual(manifest.Generators, expectedGenerators) {
+				t.Errorf("expected generators %v, got %v", expectedGenerators, manifest.Generators)
+			}
+			expectedActions := []models.ProvenanceAction{{Action: "c2pa.created", SoftwareAgent: "Test Camera 2.1", DigitalSourceType: sourceTypeCapture}}
+			if !reflect.DeepEqual(manifest.Actions, expectedActions) {
+				t.Errorf("expected actions %v, got %v", expectedActions, manifest.Actions)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedContent(t *testing.T) {
+	ca := newTestCA(t)
+	verifier := NewVerifier(ca.roots)
+	expected := map[string]string{"image/jpeg": statusDataHashMismatch, "image/png": statusDataHashMismatch, "video/mp4": statusBMFFHashMismatch}
+	for _, content := range testContents {
+		t.Run(content.mimeType, func(t *testing.T) {
+			data := content.build(t, ca, capturedManifest())
+			// the byte before the last chunk or box, always out of the manifest store
+			data[len(data)-len(content.after)+9] ^= 0xFF
+			provenance := verifier.Verify(content.mimeType, data)
+			if provenance.State != models.PROVENANCE_INVALID || !slices.Equal(codes(provenance), []string{expected[content.mimeType]}) {
+				t.Errorf("expected an invalid provenance with %s, got %s with %v", expected[content.mimeType], provenance.State, codes(provenance))
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedManifest(t *testing.T) {
+	ca := newTestCA(t)
+	verifier := NewVerifier(ca.roots)
+	content := testContents[0]
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		expected string
+	}{
+		{"assertion", "Test Camera", "Fake Camera", statusHashedURIMismatch},
+		{"claim", "Test Generator", "Fake Generator", statusSignatureMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Replace(content.build(t, ca, capturedManifest()), []byte(tt.from), []byte(tt.to), 1)
+			provenance := verifier.Verify(content.mimeType, data)
+			if provenance.State != models.PROVENANCE_INVALID || !slices.Contains(codes(provenance), tt.expected) {
+				t.Errorf("expected an invalid provenance with %s, got %s with %v", tt.expected, provenance.State, codes(provenance))
+			}
+		})
+	}
+}
+
+func TestVerifyTrust(t *testing.T) {
+	ca := newTestCA(t)
+	data := testContents[0].build(t, ca, capturedManifest())
+
+	expired := NewVerifier(ca.roots)
+	expired.now = func() time.Time { return time.Now().Add(2 * 365 * 24 * time.Hour) }
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		expected string
+	}{
+		{"no trust anchors", NewVerifier(nil), statusCredentialUntrusted},
+		{"other trust anchor", NewVerifier(newTestCA(t).roots), statusCredentialUntrusted},
+		{"expired", expired, statusCredentialExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provenance := tt.verifier.Verify("image/jpeg", data)
+			if provenance.State != models.PROVENANCE_INVALID || !slices.Equal(codes(provenance), []string{tt.expected}) {
+				t.Fatalf("expected an invalid provenance with %s, got %s with %v", tt.expected, provenance.State, codes(provenance))
+			}
+			manifest := provenance.Manifests[0]
+			if manifest.Trusted || manifest.Signer != "Test Signer" {
+				t.Errorf("expected the untrusted signer to be named, got %+v", manifest)
+			}
+		})
+	}
+}
+
+func TestVerifyIngredients(t *testing.T) {
+	ca := newTestCA(t)
+	verifier := NewVerifier(ca.roots)
+	parent := ca.sign(t, testManifest{label: "urn:c2pa:parent", assertions: []testAssertion{actionsAssertion("c2pa.created", sourceTypeGenerated)}})
+	active := testManifest{label: "urn:c2pa:active", assertions: []testAssertion{
+		actionsAssertion("c2pa.edited", ""),
+		{label: "c2pa.ingredient.v3", content: map[any]any{
+			"dc:title":       "parent.png",
+			"dc:format":      "image/png",
+			"relationship":   "parentOf",
+			"activeManifest": map[any]any{"url": jumbfURIPrefix + "/c2pa/urn:c2pa:parent", "hash": []byte{}},
+		}},
+	}}
+
+	provenance := verifier.Verify("image/jpeg", testContents[0].build(t, ca, active, parent))
+	if provenance.State != models.PROVENANCE_VALID {
+		t.Fatalf("expected a valid provenance, got %s with %v", provenance.State, codes(provenance))
+	}
+	labels := []string{}
+	for _, manifest := range provenance.Manifests {
+		labels = append(labels, manifest.Label)
+	}
+	if !slices.Equal(labels, []string{"urn:c2pa:active", "urn:c2pa:parent"}) {
+		t.Fatalf("expected the chain from the active manifest to its parent, got %v", labels)
+	}
+	expectedIngredient := models.ProvenanceIngredient{Title: "parent.png", Format: "image/png", Relationship: "parentOf", Manifest: "urn:c2pa:parent"}
+	if !reflect.DeepEqual(provenance.Manifests[0].Ingredients, []models.ProvenanceIngredient{expectedIngredient}) {
+		t.Errorf("expected ingredient %+v, got %+v", expectedIngredient, provenance.Manifests[0].Ingredients)
+	}
+	if source := provenance.Manifests[1].Actions[0].DigitalSourceType; source != sourceTypeGenerated {
+		t.Errorf("expected the parent to be generated, got %s", source)
+	}
+
+	// without the manifest of the ingredient the chain is broken
+	provenance = verifier.Verify("image/jpeg", testContents[0].build(t, ca, active))
+	if provenance.State != models.PROVENANCE_INVALID || !slices.Equal(codes(provenance), []string{statusIngredientMissing}) {
+		t.Errorf("expected an invalid provenance with %s, got %s with %v", statusIngredientMissing, provenance.State, codes(provenance))
+	}
+}
+
+func TestVerifyAbsentOrMalformed(t *testing.T) {
+	verifier := NewVerifier(nil)
+	content := testContents[0]
+	if provenance := verifier.Verify("image/gif", []byte("GIF89a")); provenance != nil {
+		t.Errorf("expected no provenance for a GIF, got %+v", provenance)
+	}
+	plain := slices.Concat(content.before, content.after)
+	if provenance := verifier.Verify(content.mimeType, plain); provenance.State != models.PROVENANCE_ABSENT {
+		t.Errorf("expected an absent provenance, got %s", provenance.State)
+	}
+
+	// a store cut short is reported, not mistaken for an absent one
+	store := testStore(newTestCA(t).sign(t, capturedManifest()))
+	truncated := slices.Concat(content.before, content.wrap(store[:len(store)/2]), content.after)
+	provenance := verifier.Verify(content.mimeType, truncated)
+	if provenance.State != models.PROVENANCE_INVALID || !slices.Equal(codes(provenance), []string{statusManifestMalformed}) {
+		t.Errorf("expected an invalid provenance with %s, got %s with %v", statusManifestMalformed, provenance.State, codes(provenance))
+	}
+}
+
+func TestLoadTrustList(t *testing.T) {
+	ca := newTestCA(t)
+	path := filepath.Join(t.TempDir(), "trust.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	roots, err := LoadTrustList(path)
+	if err != nil {
+		t.Fatalf("failed to load trust list: %v", err)
+	}
+	provenance := NewVerifier(roots).Verify("image/png", testContents[1].build(t, ca, capturedManifest()))
+	if provenance.State != models.PROVENANCE_VALID {
+		t.Errorf("expected a valid provenance, got %s with %v", provenance.State, codes(provenance))
+	}
+
+	if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTrustList(path); err == nil {
+		t.Error("expected an error for a trust list without certificates")
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	value := map[any]any{
+		"text":           "héllo",
+		"bytes":          []byte{0, 1, 2},
+		int64(-7):        int64(-300),
+		int64(33):        []any{int64(0), int64(23), int64(24), int64(65536), int64(1) << 40},
+		"nested":         map[any]any{"flag": true, "none": nil},
+		"false":          false,
+		"empty array":    []any{},
+		"very long text": string(bytes.Repeat([]byte("a"), 300)),
+	}
+	decoded, err := decodeCBOR(mustCBOR(t, value))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("expected %v, got %v", value, decoded)
+	}
+
+	for _, invalid := range [][]byte{{0x18}, {0x62, 'a'}, {0x9F, 0x01}, {0x01, 0x02}, bytes.Repeat([]byte{0x81}, maxCBORDepth+2)} {
+		if _, err := decodeCBOR(invalid); err == nil {
+			t.Errorf("expected an error decoding % x", invalid)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package c2pa
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// CBOR major types
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborTag      = 6
+	cborSimple   = 7
+)
+
+// claims and signatures nest a few levels, anything deeper is hostile
+const maxCBORDepth = 32
+
+var errInvalidCBOR = errors.New("invalid CBOR")
+
+// decodeCBOR decodes a single CBOR item. Integers are int64, byte strings []byte, maps
+// map[any]any keyed by int64 or string, tags are dropped and simple values become bool, nil or float64.
+func decodeCBOR(data []byte) (any, error) {
+	decoder := &cborDecoder{data: data}
+	value, err := decoder.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.offset != len(data) {
+		return nil, fmt.Errorf("%w: %d trailing bytes", errInvalidCBOR, len(data)-decoder.offset)
+	}
+	return value, nil
+}
+
+type cborDecoder struct {
+	data   []byte
+	offset int
+}
+
+// header reads the major type, additional information and argument of the next item. The
+// argument of an indefinite length is -1, the one of a float its bits.
+func (d *cborDecoder) header() (byte, byte, int64, error) {
+	if d.offset >= len(d.data) {
+		return 0, 0, 0, errInvalidCBOR
+	}
+	initial := d.data[d.offset]
+	d.offset++
+	major, info := initial>>5, initial&0x1F
+	var size int
+	switch {
+	case info < 24:
+		return major, info, int64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31 && major != cborUnsigned && major != cborNegative && major != cborTag:
+		return major, info, -1, nil
+	default:
+		return 0, 0, 0, errInvalidCBOR
+	}
+	if d.offset+size > len(d.data) {
+		return 0, 0, 0, errInvalidCBOR
+	}
+	var argument uint64
+	for _, b := range d.data[d.offset : d.offset+size] {
+		argument = argument<<8 | uint64(b)
+	}
+	d.offset += size
+	// a double may use every bit, every other argument must fit an int64
+	if argument > math.MaxInt64 && !(major == cborSimple && info == 27) {
+		return 0, 0, 0, errInvalidCBOR
+	}
+	return major, info, int64(argument), nil
+}
+
+func (d *cborDecoder) decode(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", errInvalidCBOR)
+	}
+	major, info, argument, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUnsigned:
+		return argument, nil
+	case cborNegative:
+		return -1 - argument, nil
+	case cborBytes, cborText:
+		var value []byte
+		if argument < 0 {
+			value, err = d.chunks(major)
+		} else {
+			value, err = d.bytes(argument)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(value), nil
+		}
+		return value, nil
+	case cborArray:
+		array := []any{}
+		for i := int64(0); argument < 0 || i < argument; i++ {
+			if argument < 0 && d.atBreak() {
+				break
+			}
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		return array, nil
+	case cborMap:
+		object := map[any]any{}
+		for i := int64(0); argument < 0 || i < argument; i++ {
+			if argument < 0 && d.atBreak() {
+				break
+			}
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+				object[key] = value
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key", errInvalidCBOR)
+			}
+		}
+		return object, nil
+	case cborTag:
+		// COSE_Sign1 and the dates are tagged, the tags carry nothing the verifier needs
+		return d.decode(depth + 1)
+	}
+
+	switch {
+	case info == 20:
+		return false, nil
+	case info == 21:
+		return true, nil
+	case info == 22 || info == 23:
+		return nil, nil
+	case info == 25:
+		return halfFloat(uint16(argument)), nil
+	case info == 26:
+		return float64(math.Float32frombits(uint32(argument))), nil
+	case info == 27:
+		return math.Float64frombits(uint64(argument)), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported simple value", errInvalidCBOR)
+}
+
+func halfFloat(bits uint16) float64 {
+	exponent, mantissa := int(bits>>10&0x1F), float64(bits&0x3FF)
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 31:
+		value = math.Inf(1)
+		if mantissa != 0 {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if bits&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
+
+func (d *cborDecoder) bytes(n int64) ([]byte, error) {
+	if n > int64(len(d.data)-d.offset) {
+		return nil, errInvalidCBOR
+	}
+	value := d.data[d.offset : d.offset+int(n)]
+	d.offset += int(n)
+	return value, nil
+}
+
+// chunks joins the definite chunks of an indefinite byte or text string.
+func (d *cborDecoder) chunks(major byte) ([]byte, error) {
+	var value []byte
+	for !d.atBreak() {
+		chunkMajor, _, n, err := d.header()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || n < 0 {
+			return nil, errInvalidCBOR
+		}
+		chunk, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, chunk...)
+	}
+	return value, nil
+}
+
+// atBreak consumes the break ending an indefinite item, reporting whether it was there.
+func (d *cborDecoder) atBreak() bool {
+	if d.offset < len(d.data) && d.data[d.offset] == 0xFF {
+		d.offset++
+		return true
+	}
+	return false
+}
+
+// encodeCBOR encodes the few kinds of items the verifier writes: integers, strings, byte strings, arrays, maps, booleans and null.
+func encodeCBOR(value any) ([]byte, error) {
+	return appendCBOR(nil, value)
+}
+
+func appendCBOR(data []byte, value any) ([]byte, error) {
+	var err error
+	switch value := value.(type) {
+	case int:
+		return appendCBOR(data, int64(value))
+	case int64:
+		if value < 0 {
+			return appendHeader(data, cborNegative, uint64(-1-value)), nil
+		}
+		return appendHeader(data, cborUnsigned, uint64(value)), nil
+	case string:
+		return append(appendHeader(data, cborText, uint64(len(value))), value...), nil
+	case []byte:
+		return append(appendHeader(data, cborBytes, uint64(len(value))), value...), nil
+	case []any:
+		data = appendHeader(data, cborArray, uint64(len(value)))
+		for _, item := range value {
+			if data, err = appendCBOR(data, item); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	case map[any]any:
+		// keys are sorted as deterministic CBOR requires, shorter encodings first
+		entries := make([][2][]byte, 0, len(value))
+		for key, item := range value {
+			encodedKey, err := appendCBOR(nil, key)
+			if err != nil {
+				return nil, err
+			}
+			encodedItem, err := appendCBOR(nil, item)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, [2][]byte{encodedKey, encodedItem})
+		}
+		slices.SortFunc(entries, func(a, b [2][]byte) int {
+			return cmp.Or(cmp.Compare(len(a[0]), len(b[0])), bytes.Compare(a[0], b[0]))
+		})
+		data = appendHeader(data, cborMap, uint64(len(value)))
+		for _, entry := range entries {
+			data = append(append(data, entry[0]...), entry[1]...)
+		}
+		return data, nil
+	case bool:
+		if value {
+			return append(data, 0xF5), nil
+		}
+		return append(data, 0xF4), nil
+	case nil:
+		return append(data, 0xF6), nil
+	}
+	return nil, fmt.Errorf("can't encode %T as CBOR", value)
+}
+
+func appendHeader(data []byte, major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return append(data, major<<5|byte(argument))
+	case argument <= math.MaxUint8:
+		return append(data, major<<5|24, byte(argument))
+	case argument <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(data, major<<5|25), uint16(argument))
+	case argument <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(data, major<<5|26), uint32(argument))
+	}
+	return binary.BigEndian.AppendUint64(append(data, major<<5|27), argument)
+}
@@ -0,0 +1,224 @@
+package c2pa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// COSE header labels and algorithms, RFC 9052 and 9053
+const (
+	coseHeaderAlgorithm = 1
+	coseHeaderX5Chain   = 33
+
+	coseES256 = -7
+	coseES384 = -35
+	coseES512 = -36
+	cosePS256 = -37
+	cosePS384 = -38
+	cosePS512 = -39
+	coseEdDSA = -8
+)
+
+var coseHashes = map[int64]crypto.Hash{
+	coseES256: crypto.SHA256,
+	coseES384: crypto.SHA384,
+	coseES512: crypto.SHA512,
+	cosePS256: crypto.SHA256,
+	cosePS384: crypto.SHA384,
+	cosePS512: crypto.SHA512,
+}
+
+// signer is the credential a claim was signed with.
+type signer struct {
+	name    string
+	issuer  string
+	trusted bool
+}
+
+// verifySignature checks the COSE_Sign1 signature of a claim, its payload being the detached claim,
+// and whether the certificate chain leads to one of the trust anchors.
+func (v *Verifier) verifySignature(signature []byte, claim []byte) (*signer, []models.ProvenanceIssue) {
+	decoded, err := decodeCBOR(signature)
+	sign1, ok := decoded.([]any)
+	if err != nil || !ok || len(sign1) != 4 {
+		return nil, []models.ProvenanceIssue{issue(statusSignatureMalformed, "the claim signature is not a COSE_Sign1 structure")}
+	}
+	protectedBytes, ok := sign1[0].([]byte)
+	unprotected, _ := sign1[1].(map[any]any)
+	value, valueOk := sign1[3].([]byte)
+	if !ok || !valueOk {
+		return nil, []models.ProvenanceIssue{issue(statusSignatureMalformed, "the claim signature is not a COSE_Sign1 structure")}
+	}
+	protected := map[any]any{}
+	if len(protectedBytes) > 0 {
+		decoded, err := decodeCBOR(protectedBytes)
+		if protected, ok = decoded.(map[any]any); err != nil || !ok {
+			return nil, []models.ProvenanceIssue{issue(statusSignatureMalformed, "the protected header of the signature can't be read")}
+		}
+	}
+
+	algorithm, ok := protected[int64(coseHeaderAlgorithm)].(int64)
+	if !ok {
+		return nil, []models.ProvenanceIssue{issue(statusAlgorithmUnsupported, "the signature names no algorithm")}
+	}
+	certificates, err := parseChain(protected, unprotected)
+	if err != nil {
+		return nil, []models.ProvenanceIssue{issue(statusCredentialInvalid, "the signing certificates can't be read: %v", err)}
+	}
+	result := &signer{name: certificateName(certificates[0]), issuer: certificateIssuer(certificates[0])}
+
+	// Sig_structure of COSE_Sign1, with an empty external AAD
+	toBeSigned, err := encodeCBOR([]any{"Signature1", protectedBytes, []byte{}, claim})
+	if err != nil {
+		return result, []models.ProvenanceIssue{issue(statusSignatureMalformed, "the signed content can't be encoded: %v", err)}
+	}
+	if err := verifyWith(certificates[0].PublicKey, algorithm, toBeSigned, value); err != nil {
+		if errors.Is(err, errUnsupportedAlgorithm) {
+			return result, []models.ProvenanceIssue{issue(statusAlgorithmUnsupported, "%v", err)}
+		}
+		return result, []models.ProvenanceIssue{issue(statusSignatureMismatch, "the claim signature doesn't match: %v", err)}
+	}
+
+	if trustIssue := v.checkTrust(certificates); trustIssue != nil {
+		return result, []models.ProvenanceIssue{*trustIssue}
+	}
+	result.trusted = true
+	return result, nil
+}
+
+var errUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+
+func verifyWith(publicKey crypto.PublicKey, algorithm int64, toBeSigned []byte, signature []byte) error {
+	if algorithm == coseEdDSA {
+		key, ok := publicKey.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("an EdDSA signature needs an Ed25519 key, not %T", publicKey)
+		}
+		if !ed25519.Verify(key, toBeSigned, signature) {
+			return errors.New("invalid Ed25519 signature")
+		}
+		return nil
+	}
+	hash, ok := coseHashes[algorithm]
+	if !ok {
+		return fmt.Errorf("%w %d", errUnsupportedAlgorithm, algorithm)
+	}
+	hasher := hash.New()
+	hasher.Write(toBeSigned)
+	digest := hasher.Sum(nil)
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if algorithm != coseES256 && algorithm != coseES384 && algorithm != coseES512 {
+			return fmt.Errorf("algorithm %d doesn't take an ECDSA key", algorithm)
+		}
+		// COSE writes r and s side by side, each as long as the curve order
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("an ECDSA signature of %d bytes, %d expected", len(signature), 2*size)
+		}
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid ECDSA signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if algorithm != cosePS256 && algorithm != cosePS384 && algorithm != cosePS512 {
+			return fmt.Errorf("algorithm %d doesn't take an RSA key", algorithm)
+		}
+		return rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+	return fmt.Errorf("%w for a %T key", errUnsupportedAlgorithm, publicKey)
+}
+
+// parseChain reads the x5chain header, the signing certificate first. It belongs in the protected
+// header, older claims put it in the unprotected one.
+func parseChain(protected map[any]any, unprotected map[any]any) ([]*x509.Certificate, error) {
+	chain, found := protected[int64(coseHeaderX5Chain)]
+	if !found {
+		chain, found = unprotected[int64(coseHeaderX5Chain)]
+	}
+	if !found {
+		return nil, errors.New("no x5chain header")
+	}
+	var encoded [][]byte
+	switch chain := chain.(type) {
+	case []byte:
+		encoded = [][]byte{chain}
+	case []any:
+		for _, item := range chain {
+			certificate, ok := item.([]byte)
+			if !ok {
+				return nil, errors.New("the x5chain holds something else than certificates")
+			}
+			encoded = append(encoded, certificate)
+		}
+	}
+	if len(encoded) == 0 {
+		return nil, errors.New("empty x5chain")
+	}
+	certificates := make([]*x509.Certificate, 0, len(encoded))
+	for _, der := range encoded {
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+// checkTrust verifies the chain up to the trust anchors, nil when it leads to one.
+func (v *Verifier) checkTrust(certificates []*x509.Certificate) *models.ProvenanceIssue {
+	// without anchors the system roots would be used, those are for TLS, not for content
+	if v.roots == nil {
+		untrusted := issue(statusCredentialUntrusted, "no trust anchors are configured")
+		return &untrusted
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := certificates[0].Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		CurrentTime:   v.now(),
+	})
+	if err == nil {
+		return nil
+	}
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		expired := issue(statusCredentialExpired, "the signing certificate is not valid on %s", v.now().UTC().Format(time.DateOnly))
+		return &expired
+	}
+	untrusted := issue(statusCredentialUntrusted, "the signing certificate doesn't lead to a trust anchor: %v", err)
+	return &untrusted
+}
+
+func certificateName(certificate *x509.Certificate) string {
+	if certificate.Subject.CommonName != "" {
+		return certificate.Subject.CommonName
+	}
+	if len(certificate.Subject.Organization) > 0 {
+		return certificate.Subject.Organization[0]
+	}
+	return certificate.Subject.String()
+}
+
+func certificateIssuer(certificate *x509.Certificate) string {
+	if certificate.Issuer.CommonName != "" {
+		return certificate.Issuer.CommonName
+	}
+	return certificate.Issuer.String()
+}
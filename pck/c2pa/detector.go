@@ -0,0 +1,148 @@
+package c2pa
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// signal scores, a generator declaring its output is the strongest evidence there is
+const (
+	SCORE_AI_SOURCE_TYPE        = 0.95
+	SCORE_COMPOSITE_SOURCE_TYPE = 0.8
+	SCORE_INVALID_MANIFEST      = 0.6
+	SCORE_UNTRUSTED_SIGNER      = 0.3
+)
+
+// IPTC digital source types of generated media, with the score of each
+var aiSourceTypes = map[string]float64{
+	"trainedalgorithmicmedia":              SCORE_AI_SOURCE_TYPE,
+	"algorithmicmedia":                     SCORE_AI_SOURCE_TYPE,
+	"compositewithtrainedalgorithmicmedia": SCORE_COMPOSITE_SOURCE_TYPE,
+}
+
+// the issues of a manifest that is intact but signed by a credential that isn't, or no longer, trusted
+var trustIssues = map[string]bool{
+	statusCredentialUntrusted: true,
+	statusCredentialExpired:   true,
+}
+
+// Detector reads the verdict of the Content Credentials: the digital source types the generators
+// declared, and the manifests that fail verification.
+type Detector struct {
+	verifier *Verifier
+}
+
+// NewDetector returns a detector verifying the manifests with the given verifier when the input
+// doesn't carry the provenance already.
+func NewDetector(verifier *Verifier) *Detector {
+	return &Detector{verifier: verifier}
+}
+
+func (d *Detector) Name() string {
+	return "c2pa"
+}
+
+func (d *Detector) Supports(mimeType string) bool {
+	return d.verifier.Supports(mimeType)
+}
+
+func (d *Detector) Detect(ctx context.Context, input *detectors.Input) (*detectors.Result, error) {
+	provenance := input.Provenance
+	if provenance == nil {
+		provenance = d.verifier.Verify(input.MimeType, input.Data)
+	}
+	result := &detectors.Result{Verdict: models.VERDICT_INCONCLUSIVE, Signals: []models.Signal{}}
+	// most media carry no manifest, that says nothing about them
+	if provenance == nil || provenance.State == models.PROVENANCE_ABSENT {
+		return result, nil
+	}
+
+	// a generator has no reason to declare generated media it didn't make, the declaration is
+	// taken even from a manifest failing verification
+	for _, manifest := range provenance.Manifests {
+		for _, action := range manifest.Actions {
+			sourceType := strings.ToLower(action.DigitalSourceType)
+			// the source type is the URI of the IPTC vocabulary
+			sourceType = sourceType[strings.LastIndex(sourceType, "/")+1:]
+			if score, found := aiSourceTypes[sourceType]; found {
+				result.Signals = append(result.Signals, models.Signal{
+					Name:        "ai_source_type",
+					Score:       score,
+					Explanation: fmt.Sprintf("the manifest %s declares the %s action of %s as %s", manifest.Label, action.Action, agentName(action, manifest), action.DigitalSourceType),
+				})
+			}
+		}
+	}
+
+	if provenance.State == models.PROVENANCE_INVALID {
+		codes := []string{}
+		onlyTrust := true
+		for _, problem := range allIssues(provenance) {
+			codes = append(codes, problem.Code)
+			onlyTrust = onlyTrust && trustIssues[problem.Code]
+		}
+		signal := models.Signal{
+			Name:        "invalid_manifest",
+			Score:       SCORE_INVALID_MANIFEST,
+			Explanation: fmt.Sprintf("the Content Credentials fail verification: %s", strings.Join(codes, ", ")),
+		}
+		if onlyTrust && len(codes) > 0 {
+			signal.Name, signal.Score = "untrusted_signer", SCORE_UNTRUSTED_SIGNER
+			signal.Explanation = fmt.Sprintf("the Content Credentials are intact but not signed by a trusted credential: %s", strings.Join(codes, ", "))
+		}
+		result.Signals = append(result.Signals, signal)
+	}
+
+	for _, signal := range result.Signals {
+		result.Score = math.Max(result.Score, signal.Score)
+	}
+	switch {
+	case result.Score >= detectors.SUSPICIOUS_THRESHOLD:
+		result.Verdict = detectors.VerdictFromScore(result.Score)
+	case provenance.State == models.PROVENANCE_VALID && len(result.Signals) == 0 && captured(provenance.Manifests[0]):
+		// a trusted signer vouches for the capture, e.g. a camera signing its pictures
+		result.Verdict = models.VERDICT_AUTHENTIC
+		result.Signals = append(result.Signals, models.Signal{
+			Name:        "trusted_capture",
+			Explanation: fmt.Sprintf("%s signed the capture of the media", provenance.Manifests[0].Signer),
+		})
+	}
+	return result, nil
+}
+
+// captured reports whether the manifest records the creation of the media by a capture device.
+func captured(manifest models.ProvenanceManifest) bool {
+	for _, action := range manifest.Actions {
+		if action.Action == "c2pa.created" && strings.HasSuffix(strings.ToLower(action.DigitalSourceType), "digitalcapture") {
+			return true
+		}
+	}
+	return false
+}
+
+func allIssues(provenance *models.Provenance) []models.ProvenanceIssue {
+	issues := append([]models.ProvenanceIssue{}, provenance.Issues...)
+	for _, manifest := range provenance.Manifests {
+		issues = append(issues, manifest.Issues...)
+	}
+	return issues
+}
+
+// agentName names the software of an action, the claim generator when the action doesn't.
+func agentName(action models.ProvenanceAction, manifest models.ProvenanceManifest) string {
+	if action.SoftwareAgent != "" {
+		return action.SoftwareAgent
+	}
+	if len(manifest.Generators) > 0 {
+		return manifest.Generators[0].Name
+	}
+	if manifest.ClaimGenerator != "" {
+		return manifest.ClaimGenerator
+	}
+	return "an unnamed software"
+}
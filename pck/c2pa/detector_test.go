@@ -0,0 +1,66 @@
+package c2pa
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+func TestDetector(t *testing.T) {
+	ca := newTestCA(t)
+	content := testContents[0]
+	generated := testManifest{label: "urn:c2pa:active", assertions: []testAssertion{actionsAssertion("c2pa.created", sourceTypeGenerated)}}
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		data     []byte
+		score    float64
+		verdict  models.Verdict
+		signal   string
+	}{
+		{"trusted capture", NewVerifier(ca.roots), content.build(t, ca, capturedManifest()), 0, models.VERDICT_AUTHENTIC, "trusted_capture"},
+		{"generated", NewVerifier(ca.roots), content.build(t, ca, generated), SCORE_AI_SOURCE_TYPE, models.VERDICT_MANIPULATED, "ai_source_type"},
+		{"generated and untrusted", NewVerifier(nil), content.build(t, ca, generated), SCORE_AI_SOURCE_TYPE, models.VERDICT_MANIPULATED, "ai_source_type"},
+		{"untrusted capture", NewVerifier(nil), content.build(t, ca, capturedManifest()), SCORE_UNTRUSTED_SIGNER, models.VERDICT_INCONCLUSIVE, "untrusted_signer"},
+		{"tampered", NewVerifier(ca.roots), append(content.build(t, ca, capturedManifest()), 0x00), SCORE_INVALID_MANIFEST, models.VERDICT_SUSPICIOUS, "invalid_manifest"},
+		{"absent", NewVerifier(ca.roots), slices.Concat(content.before, content.after), 0, models.VERDICT_INCONCLUSIVE, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := NewDetector(tt.verifier)
+			result, err := detector.Detect(context.Background(), &detectors.Input{MimeType: content.mimeType, Data: tt.data})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Score != tt.score || result.Verdict != tt.verdict {
+				t.Errorf("expected %v with score %v, got %v with score %v (%+v)", tt.verdict, tt.score, result.Verdict, result.Score, result.Signals)
+			}
+			found := tt.signal == ""
+			for _, signal := range result.Signals {
+				found = found || signal.Name == tt.signal
+			}
+			if !found {
+				t.Errorf("expected signal %s, got %+v", tt.signal, result.Signals)
+			}
+		})
+	}
+}
+
+func TestDetectorUsesInputProvenance(t *testing.T) {
+	provenance := &models.Provenance{State: models.PROVENANCE_VALID, Manifests: []models.ProvenanceManifest{{
+		Label:   "urn:c2pa:active",
+		State:   models.PROVENANCE_VALID,
+		Actions: []models.ProvenanceAction{{Action: "c2pa.created", DigitalSourceType: "compositeWithTrainedAlgorithmicMedia"}},
+	}}}
+	result, err := NewDetector(NewVerifier(nil)).Detect(context.Background(), &detectors.Input{MimeType: "image/jpeg", Provenance: provenance})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Score != SCORE_COMPOSITE_SOURCE_TYPE || result.Verdict != models.VERDICT_MANIPULATED {
+		t.Errorf("expected a composite to be manipulated, got %v with score %v", result.Verdict, result.Score)
+	}
+}
@@ -0,0 +1,150 @@
+package c2pa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// manifest stores nest a few superboxes deep: store, manifest, assertion store, assertion
+const maxJUMBFDepth = 8
+
+var errInvalidJUMBF = errors.New("invalid JUMBF")
+
+// the type of the description box of a C2PA manifest store, "c2pa" followed by the ISO suffix
+var manifestStoreType = []byte{0x63, 0x32, 0x70, 0x61, 0x00, 0x11, 0x00, 0x10, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+type box struct {
+	kind string
+	// offset and size of the box in the data it was read from, header included
+	offset int
+	size   int
+	// payload is the content of the box after its header
+	payload []byte
+}
+
+// superbox is a JUMBF superbox: a description box naming it, then content boxes and other superboxes.
+type superbox struct {
+	label string
+	uuid  []byte
+	// payload is the description box and the content, the part of an assertion its hash covers
+	payload  []byte
+	children []*superbox
+	contents []box
+}
+
+// readBoxes splits data into ISO BMFF style boxes, a size of 1 announces a 64 bit size and 0 a box
+// running to the end. On error the boxes read before are returned with it.
+func readBoxes(data []byte) ([]box, error) {
+	var boxes []box
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < 8 {
+			return boxes, fmt.Errorf("%w: truncated box header", errInvalidJUMBF)
+		}
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		kind := string(data[offset+4 : offset+8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data) - offset)
+		case 1:
+			if len(data)-offset < 16 {
+				return boxes, fmt.Errorf("%w: truncated box header", errInvalidJUMBF)
+			}
+			size, header = binary.BigEndian.Uint64(data[offset+8:]), 16
+		}
+		if size < header || size > uint64(len(data)-offset) {
+			return boxes, fmt.Errorf("%w: box %q overflows its parent", errInvalidJUMBF, kind)
+		}
+		boxes = append(boxes, box{kind: kind, offset: offset, size: int(size), payload: data[offset+int(header) : offset+int(size)]})
+		offset += int(size)
+	}
+	return boxes, nil
+}
+
+// parseSuperbox reads the payload of a jumb box.
+func parseSuperbox(payload []byte, depth int) (*superbox, error) {
+	if depth > maxJUMBFDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", errInvalidJUMBF)
+	}
+	boxes, err := readBoxes(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(boxes) == 0 || boxes[0].kind != "jumd" {
+		return nil, fmt.Errorf("%w: superbox without description", errInvalidJUMBF)
+	}
+	result := &superbox{payload: payload}
+	if err := result.describe(boxes[0].payload); err != nil {
+		return nil, err
+	}
+	for _, child := range boxes[1:] {
+		if child.kind != "jumb" {
+			result.contents = append(result.contents, child)
+			continue
+		}
+		nested, err := parseSuperbox(child.payload, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result.children = append(result.children, nested)
+	}
+	return result, nil
+}
+
+// describe reads the type and label of a description box: a 16 byte type, toggles, then the optional label.
+func (s *superbox) describe(description []byte) error {
+	if len(description) < 17 {
+		return fmt.Errorf("%w: truncated description", errInvalidJUMBF)
+	}
+	s.uuid = description[:16]
+	// the label is present when the second toggle bit is set
+	if description[16]&0x02 == 0 {
+		return nil
+	}
+	label, _, found := bytes.Cut(description[17:], []byte{0})
+	if !found {
+		return fmt.Errorf("%w: unterminated label", errInvalidJUMBF)
+	}
+	s.label = string(label)
+	return nil
+}
+
+func (s *superbox) child(label string) *superbox {
+	for _, child := range s.children {
+		if child.label == label {
+			return child
+		}
+	}
+	return nil
+}
+
+// content returns the payload of the first content box of the given type.
+func (s *superbox) content(kind string) ([]byte, bool) {
+	for _, content := range s.contents {
+		if content.kind == kind {
+			return content.payload, true
+		}
+	}
+	return nil, false
+}
+
+// parseManifestStore reads a jumb box holding a C2PA manifest store.
+func parseManifestStore(data []byte) (*superbox, error) {
+	boxes, err := readBoxes(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(boxes) == 0 || boxes[0].kind != "jumb" {
+		return nil, fmt.Errorf("%w: no superbox", errInvalidJUMBF)
+	}
+	store, err := parseSuperbox(boxes[0].payload, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(store.uuid, manifestStoreType) {
+		return nil, fmt.Errorf("%w: not a C2PA manifest store", errInvalidJUMBF)
+	}
+	return store, nil
+}
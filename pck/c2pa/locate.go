@@ -0,0 +1,144 @@
+package c2pa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// the uuid box of BMFF files holding a C2PA manifest store
+var bmffManifestUUID = []byte{0xD8, 0xFE, 0xC3, 0xD6, 0x1B, 0x0E, 0x48, 0x3C, 0x92, 0x97, 0x58, 0x28, 0x87, 0x7E, 0xC4, 0x81}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+var errNoManifest = errors.New("no C2PA manifest store")
+
+// embedded is a manifest store found in a content, with the bytes it takes, which the hard binding excludes.
+type embedded struct {
+	store []byte
+	start int
+	end   int
+}
+
+// locate finds the manifest store of a JPEG, PNG or BMFF content, errNoManifest when there is none.
+// A container broken after the manifest store doesn't prevent finding it.
+func locate(mimeType string, data []byte) (*embedded, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return locateJPEG(data)
+	case "image/png":
+		return locatePNG(data)
+	default:
+		return locateBMFF(data)
+	}
+}
+
+// locateJPEG joins the APP11 segments of the JUMBF box of the manifest store. Every segment starts
+// with "JP", the box instance and the sequence number; the ones after the first repeat the box header.
+func locateJPEG(data []byte) (*embedded, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errNoManifest
+	}
+	instances := map[uint16]*embedded{}
+	var order []uint16
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			break
+		}
+		marker := data[offset+1]
+		if marker == 0xFF {
+			offset++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			offset += 2
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			break
+		}
+		segment := data[offset+4 : offset+2+length]
+		end := offset + 2 + length
+		if marker == 0xEB && len(segment) >= 16 && bytes.HasPrefix(segment, []byte("JP")) {
+			instance := binary.BigEndian.Uint16(segment[2:4])
+			box := segment[8:]
+			found, ok := instances[instance]
+			if !ok {
+				found = &embedded{start: offset}
+				instances[instance] = found
+				order = append(order, instance)
+				found.store = append(found.store, box...)
+			} else {
+				header := 8
+				if binary.BigEndian.Uint32(box) == 1 {
+					header = 16
+				}
+				if len(box) < header {
+					break
+				}
+				found.store = append(found.store, box[header:]...)
+			}
+			found.end = end
+		}
+		offset = end
+	}
+	for _, instance := range order {
+		if isManifestStore(instances[instance].store) {
+			return instances[instance], nil
+		}
+	}
+	return nil, errNoManifest
+}
+
+// isManifestStore tells a broken C2PA store from the other JUMBF boxes, e.g. JPEG 360 metadata.
+func isManifestStore(data []byte) bool {
+	// box header, description box header, then its type
+	return len(data) >= 32 && string(data[4:8]) == "jumb" && bytes.Equal(data[16:32], manifestStoreType)
+}
+
+// locatePNG finds the caBX chunk.
+func locatePNG(data []byte) (*embedded, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errNoManifest
+	}
+	for offset := len(pngSignature); offset+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		kind := string(data[offset+4 : offset+8])
+		if length < 0 || offset+12+length > len(data) {
+			break
+		}
+		if kind == "caBX" {
+			return &embedded{store: data[offset+8 : offset+8+length], start: offset, end: offset + 12 + length}, nil
+		}
+		if kind == "IEND" {
+			break
+		}
+		offset += 12 + length
+	}
+	return nil, errNoManifest
+}
+
+// locateBMFF finds the top level uuid box of the manifest: the C2PA uuid, a full box header,
+// the purpose "manifest" and the offset of the Merkle tree, then the manifest store.
+func locateBMFF(data []byte) (*embedded, error) {
+	boxes, _ := readBoxes(data)
+	for _, box := range boxes {
+		if box.kind != "uuid" || !bytes.HasPrefix(box.payload, bmffManifestUUID) {
+			continue
+		}
+		rest := box.payload[len(bmffManifestUUID):]
+		if len(rest) < 4 {
+			continue
+		}
+		purpose, rest, found := bytes.Cut(rest[4:], []byte{0})
+		if !found || string(purpose) != "manifest" || len(rest) < 8 {
+			continue
+		}
+		return &embedded{store: rest[8:], start: box.offset, end: box.offset + box.size}, nil
+	}
+	return nil, errNoManifest
+}
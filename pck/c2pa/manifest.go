@@ -0,0 +1,235 @@
+package c2pa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+const jumbfURIPrefix = "self#jumbf="
+
+// assertion is a verified assertion of a claim, with its decoded CBOR content.
+type assertion struct {
+	label   string
+	content map[any]any
+}
+
+// verifyManifest checks the claim of a manifest: its signature, the hashes of its assertions and,
+// for the active manifest, its hard binding to the content. The manifests of the ingredients are
+// bound to contents that are not at hand.
+func (v *Verifier) verifyManifest(store *superbox, manifest *superbox, asset []byte, active bool) models.ProvenanceManifest {
+	result := models.ProvenanceManifest{Label: manifest.label, State: models.PROVENANCE_INVALID}
+	claimBox := manifest.child("c2pa.claim.v2")
+	if claimBox == nil {
+		claimBox = manifest.child("c2pa.claim")
+	}
+	if claimBox == nil {
+		result.Issues = append(result.Issues, issue(statusClaimMissing, "the manifest has no claim"))
+		return result
+	}
+	claimBytes, _ := claimBox.content("cbor")
+	decoded, err := decodeCBOR(claimBytes)
+	claim, ok := decoded.(map[any]any)
+	if err != nil || !ok {
+		result.Issues = append(result.Issues, issue(statusClaimMalformed, "the claim is not a CBOR map"))
+		return result
+	}
+	result.Title = text(claim["dc:title"])
+	result.Format = text(claim["dc:format"])
+	result.ClaimGenerator = text(claim["claim_generator"])
+	result.Generators = generators(claim["claim_generator_info"])
+
+	if signatureBox := manifest.child("c2pa.signature"); signatureBox == nil {
+		result.Issues = append(result.Issues, issue(statusSignatureMissing, "the claim is not signed"))
+	} else {
+		signature, _ := signatureBox.content("cbor")
+		signer, issues := v.verifySignature(signature, claimBytes)
+		if signer != nil {
+			result.Signer, result.Issuer, result.Trusted = signer.name, signer.issuer, signer.trusted
+		}
+		result.Issues = append(result.Issues, issues...)
+	}
+
+	algorithm := text(claim["alg"])
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	// claims of version 2 split the assertions the claim generator made from the gathered ones
+	var references []any
+	for _, key := range []string{"assertions", "created_assertions", "gathered_assertions"} {
+		list, _ := claim[key].([]any)
+		references = append(references, list...)
+	}
+	var hardBinding *assertion
+	for _, reference := range references {
+		verified, verifyIssue := verifyAssertion(store, manifest, reference, algorithm)
+		if verifyIssue != nil {
+			result.Issues = append(result.Issues, *verifyIssue)
+			continue
+		}
+		switch label := baseLabel(verified.label); {
+		case label == "c2pa.actions" || label == "c2pa.actions.v2":
+			result.Actions = append(result.Actions, actions(verified.content)...)
+		case strings.HasPrefix(label, "c2pa.ingredient"):
+			result.Ingredients = append(result.Ingredients, ingredient(verified.content))
+		case label == "c2pa.hash.data" || strings.HasPrefix(label, "c2pa.hash.bmff"):
+			hardBinding = verified
+		}
+	}
+
+	if active {
+		if hardBinding == nil {
+			result.Issues = append(result.Issues, issue(statusHardBindingsMissing, "the claim has no hard binding to the content"))
+		} else if bindingIssue := checkHardBinding(hardBinding, asset, algorithm); bindingIssue != nil {
+			result.Issues = append(result.Issues, *bindingIssue)
+		}
+	}
+	if len(result.Issues) == 0 {
+		result.State = models.PROVENANCE_VALID
+	}
+	return result
+}
+
+// verifyAssertion resolves a hashed URI of the claim and checks the hash of the assertion it points to,
+// computed over the description and content boxes of its superbox.
+func verifyAssertion(store *superbox, manifest *superbox, reference any, claimAlgorithm string) (*assertion, *models.ProvenanceIssue) {
+	hashedURI, _ := reference.(map[any]any)
+	url := text(hashedURI["url"])
+	expected, _ := hashedURI["hash"].([]byte)
+	target := resolve(store, manifest, url)
+	if target == nil {
+		missing := issue(statusAssertionMissing, "the assertion %s is not in the manifest", url)
+		return nil, &missing
+	}
+	algorithm := text(hashedURI["alg"])
+	if algorithm == "" {
+		algorithm = claimAlgorithm
+	}
+	hasher, ok := newHash(algorithm)
+	if !ok {
+		unsupported := issue(statusAlgorithmUnsupported, "the hash algorithm %q of %s is not supported", algorithm, url)
+		return nil, &unsupported
+	}
+	hasher.Write(target.payload)
+	if !bytes.Equal(hasher.Sum(nil), expected) {
+		mismatch := issue(statusHashedURIMismatch, "the assertion %s doesn't match its hash in the claim", target.label)
+		return nil, &mismatch
+	}
+	result := &assertion{label: target.label, content: map[any]any{}}
+	// assertions written as JSON, e.g. schema.org ones, carry nothing read here
+	if content, found := target.content("cbor"); found {
+		if decoded, err := decodeCBOR(content); err == nil {
+			if object, ok := decoded.(map[any]any); ok {
+				result.content = object
+			}
+		}
+	}
+	return result, nil
+}
+
+// resolve finds the superbox of a JUMBF URI, absolute from the store or relative to the manifest,
+// e.g. self#jumbf=c2pa.assertions/c2pa.actions.
+func resolve(store *superbox, manifest *superbox, url string) *superbox {
+	path, found := strings.CutPrefix(url, jumbfURIPrefix)
+	if !found || path == "" {
+		return nil
+	}
+	current := manifest
+	if absolute, isAbsolute := strings.CutPrefix(path, "/"); isAbsolute {
+		first, rest, _ := strings.Cut(absolute, "/")
+		if first != store.label {
+			return nil
+		}
+		current, path = store, rest
+	}
+	for _, label := range strings.Split(strings.Trim(path, "/"), "/") {
+		if label == "" {
+			continue
+		}
+		if current = current.child(label); current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+func newHash(algorithm string) (hash.Hash, bool) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), true
+	case "sha384":
+		return sha512.New384(), true
+	case "sha512":
+		return sha512.New(), true
+	}
+	return nil, false
+}
+
+func actions(content map[any]any) []models.ProvenanceAction {
+	list, _ := content["actions"].([]any)
+	result := make([]models.ProvenanceAction, 0, len(list))
+	for _, item := range list {
+		action, _ := item.(map[any]any)
+		if text(action["action"]) == "" {
+			continue
+		}
+		// the software agent is a string in version 1 and a generator info map in version 2
+		agent := text(action["softwareAgent"])
+		if info, ok := action["softwareAgent"].(map[any]any); ok {
+			agent = strings.TrimSpace(text(info["name"]) + " " + text(info["version"]))
+		}
+		result = append(result, models.ProvenanceAction{
+			Action:            text(action["action"]),
+			SoftwareAgent:     agent,
+			DigitalSourceType: text(action["digitalSourceType"]),
+			When:              text(action["when"]),
+		})
+	}
+	return result
+}
+
+func ingredient(content map[any]any) models.ProvenanceIngredient {
+	result := models.ProvenanceIngredient{
+		Title:        text(content["dc:title"]),
+		Format:       text(content["dc:format"]),
+		Relationship: text(content["relationship"]),
+	}
+	if result.Title == "" {
+		result.Title = text(content["title"])
+	}
+	// version 3 ingredients name their manifest activeManifest
+	reference, ok := content["c2pa_manifest"].(map[any]any)
+	if !ok {
+		reference, _ = content["activeManifest"].(map[any]any)
+	}
+	if url := text(reference["url"]); url != "" {
+		path := strings.TrimSuffix(strings.TrimPrefix(url, jumbfURIPrefix), "/")
+		result.Manifest = path[strings.LastIndex(path, "/")+1:]
+	}
+	return result
+}
+
+// generators reads the claim generator info, a list in claims of version 1 and a single map in version 2.
+func generators(value any) []models.ProvenanceGenerator {
+	list, ok := value.([]any)
+	if !ok && value != nil {
+		list = []any{value}
+	}
+	var result []models.ProvenanceGenerator
+	for _, item := range list {
+		info, _ := item.(map[any]any)
+		if name := text(info["name"]); name != "" {
+			result = append(result, models.ProvenanceGenerator{Name: name, Version: text(info["version"])})
+		}
+	}
+	return result
+}
+
+func text(value any) string {
+	text, _ := value.(string)
+	return text
+}
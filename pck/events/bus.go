@@ -0,0 +1,19 @@
+package events
+
+import "context"
+
+type Publisher interface {
+	// Publish numbers and timestamps the event, then hands it to the listeners of the bus.
+	Publish(ctx context.Context, event *Event) error
+}
+
+// Bus carries the events of every replica to the listeners of every replica, each listener
+// gets the events in the order of their sequence. Listeners must return quickly, they hold
+// up the delivery of the following events.
+type Bus interface {
+	Publisher
+	Subscribe(listener func(event *Event))
+	// Start receives the events published by the replicas until Stop.
+	Start()
+	Stop()
+}
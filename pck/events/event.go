@@ -0,0 +1,90 @@
+package events
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// Type tells what happened, clients rely on these values, see schema.json.
+type Type string
+
+const (
+	MEDIA_CREATED      Type = "media.created"
+	MEDIA_UPDATED      Type = "media.updated"
+	MEDIA_DELETED      Type = "media.deleted"
+	ANALYSIS_STARTED   Type = "analysis.started"
+	ANALYSIS_PROGRESS  Type = "analysis.progress"
+	ANALYSIS_COMPLETED Type = "analysis.completed"
+)
+
+// ACTOR_SYSTEM acts for the background jobs, as the analyses, no user asked for.
+const ACTOR_SYSTEM = "system"
+
+// Event is the envelope of every change clients are told about.
+type Event struct {
+	Type Type `json:"type"`
+	// Sequence increases with every event, clients seeing a gap missed the events of other clients
+	// or of other tenants
+	Sequence  uint64    `json:"sequence"`
+	MediaId   string    `json:"mediaId"`
+	Actor     string    `json:"actor"`
+	Timestamp time.Time `json:"timestamp"`
+	// MediaSummary for media events, AnalysisSummary for analysis events
+	Data any `json:"data"`
+	// only the clients of the tenant allowed to see the media hear of the event
+	TenantId string `json:"-"`
+	OwnerId  string `json:"-"`
+}
+
+// Kind is the part of the type before the dot, e.g. "media" for media.created.
+func (e *Event) Kind() string {
+	kind, _, _ := strings.Cut(string(e.Type), ".")
+	return kind
+}
+
+// MediaSummary is the part of a media lists show, clients fetch the rest when they need it.
+type MediaSummary struct {
+	Id        string    `json:"id"`
+	Title     string    `json:"title"`
+	Type      string    `json:"type"`
+	MimeType  string    `json:"mimeType"`
+	Size      int       `json:"size"`
+	Tags      string    `json:"tags"`
+	OwnerId   string    `json:"ownerId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func SummarizeMedia(media *models.Media) *MediaSummary {
+	return &MediaSummary{
+		Id:        media.Id,
+		Title:     media.Title,
+		Type:      media.Type,
+		MimeType:  media.MimeType,
+		Size:      media.Size,
+		Tags:      media.Tags,
+		OwnerId:   media.OwnerId,
+		CreatedAt: media.CreatedAt,
+	}
+}
+
+// AnalysisSummary tells how far an analysis is, the detector results stay behind the analysis endpoint.
+type AnalysisSummary struct {
+	Status models.AnalysisStatus `json:"status"`
+	// Progress is the share of the detectors that ran, from 0 to 1
+	Progress float64        `json:"progress"`
+	Score    float64        `json:"score"`
+	Verdict  models.Verdict `json:"verdict"`
+	Error    string         `json:"error,omitempty"`
+}
+
+func SummarizeAnalysis(analysis *models.Analysis, progress float64) *AnalysisSummary {
+	return &AnalysisSummary{
+		Status:   analysis.Status,
+		Progress: progress,
+		Score:    analysis.Score,
+		Verdict:  analysis.Verdict,
+		Error:    analysis.Error,
+	}
+}
@@ -0,0 +1,8 @@
+package events
+
+import _ "embed"
+
+// Schema is the JSON schema of the Event envelope, served to the clients.
+//
+//go:embed schema.json
+var Schema []byte
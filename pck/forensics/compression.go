@@ -0,0 +1,131 @@
+package forensics
+
+import (
+	"image"
+	"math"
+	"slices"
+)
+
+const (
+	// DCT coefficients of at most this many blocks, spread over the picture, are histogrammed
+	maxSampledBlocks = 20000
+	// histograms go up to this absolute quantized value
+	histogramBins = 24
+	// bins emptier than this say nothing about periodicity
+	minBinCount = 30
+	// a bin below this share of the fullest bins on both sides, within the window, is a valley
+	valleyRatio  = 0.6
+	valleyWindow = 4
+	// a share of valleys above this is the mark of a second quantization
+	doubleCompressionRatio = 0.15
+	minValleys             = 3
+)
+
+// the low frequencies, where most coefficients aren't quantized to zero, as row and column
+var sampledFrequencies = [][2]int{{0, 1}, {1, 0}, {2, 0}, {1, 1}, {0, 2}, {0, 3}, {1, 2}, {2, 1}, {3, 0}}
+
+// dctBasis[x][u] is the cosine of the forward DCT, scaled by C(u)/2
+var dctBasis = func() [8][8]float64 {
+	var basis [8][8]float64
+	for x := range 8 {
+		for u := range 8 {
+			scale := 0.5
+			if u == 0 {
+				scale = 0.5 / math.Sqrt2
+			}
+			basis[x][u] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return basis
+}()
+
+// compressionHistory is the outcome of looking for a second quantization in the luminance.
+type compressionHistory struct {
+	// valleys is the number of histogram bins emptier than both their surroundings, out of the checked ones
+	valleys int
+	checked int
+}
+
+func (h compressionHistory) ratio() float64 {
+	if h.checked == 0 {
+		return 0
+	}
+	return float64(h.valleys) / float64(h.checked)
+}
+
+func (h compressionHistory) doublyCompressed() bool {
+	return h.valleys >= minValleys && h.ratio() >= doubleCompressionRatio
+}
+
+// analyseCompression recomputes the quantized DCT coefficients of the luminance blocks. Quantized
+// once, their histograms decay smoothly from zero; quantized twice with different steps, some
+// bins collect the values of two first-pass bins and others of none, leaving periodic valleys.
+func analyseCompression(img image.Image, luminance [64]uint16) (compressionHistory, bool) {
+	plane, stride, ok := lumaPlane(img)
+	if !ok {
+		return compressionHistory{}, false
+	}
+	bounds := img.Bounds()
+	columns, rows := bounds.Dx()/8, bounds.Dy()/8
+	step := 1
+	for ((columns+step-1)/step)*((rows+step-1)/step) > maxSampledBlocks {
+		step++
+	}
+
+	histograms := make([][histogramBins + 2]int, len(sampledFrequencies))
+	var block [8][8]float64
+	for row := 0; row < rows; row += step {
+		for column := 0; column < columns; column += step {
+			for y := range 8 {
+				for x := range 8 {
+					block[y][x] = float64(plane[(row*8+y)*stride+column*8+x]) - 128
+				}
+			}
+			for i, frequency := range sampledFrequencies {
+				v, u := frequency[0], frequency[1]
+				quantizer := luminance[v*8+u]
+				// with a step of one the rounding of the decoder drowns any periodicity
+				if quantizer < 2 {
+					continue
+				}
+				sum := 0.0
+				for y := range 8 {
+					for x := range 8 {
+						sum += block[y][x] * dctBasis[x][u] * dctBasis[y][v]
+					}
+				}
+				bin := int(math.Abs(math.Round(sum / float64(quantizer))))
+				histograms[i][min(bin, histogramBins+1)]++
+			}
+		}
+	}
+
+	var history compressionHistory
+	for _, histogram := range histograms {
+		for bin := 1; bin < histogramBins; bin++ {
+			// a decaying histogram has its fullest bin on the left next to it, on the right it has none fuller
+			left := slices.Max(histogram[max(bin-valleyWindow, 0):bin])
+			right := slices.Max(histogram[bin+1 : min(bin+1+valleyWindow, histogramBins+1)])
+			neighbours := min(left, right)
+			if neighbours < minBinCount {
+				continue
+			}
+			history.checked++
+			if float64(histogram[bin]) < valleyRatio*float64(neighbours) {
+				history.valleys++
+			}
+		}
+	}
+	return history, true
+}
+
+// lumaPlane returns the luminance samples of a decoded JPEG and their stride.
+func lumaPlane(img image.Image) ([]uint8, int, bool) {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return img.Y, img.YStride, img.Rect.Min == image.Point{}
+	case *image.Gray:
+		return img.Pix, img.Stride, img.Rect.Min == image.Point{}
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,129 @@
+package forensics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// ELA_ARTIFACT is the name of the error level heatmap among the artifacts of the analysis.
+const ELA_ARTIFACT = "ela.png"
+
+// signal scores, classical forensics point at a recompression or an edit, rarely at a generation
+const (
+	SCORE_DOUBLE_COMPRESSION = 0.6
+	SCORE_ELA_MAX            = 0.6
+	SCORE_RESAVED_CAMERA     = 0.4
+)
+
+const (
+	// below this contrast the error levels are even, above the maximum they count fully
+	minElaContrast = 3.0
+	maxElaContrast = 10.0
+	// pictures are decoded whole, larger ones would take too much memory
+	maxPixels = 40_000_000
+)
+
+// Detector runs classical forensics on pictures: the error level analysis, and for JPEGs the
+// fingerprint of their quantization tables and the traces of a double compression.
+type Detector struct{}
+
+func NewDetector() *Detector {
+	return &Detector{}
+}
+
+func (d *Detector) Name() string {
+	return "forensics"
+}
+
+func (d *Detector) Supports(mimeType string) bool {
+	return mimeType == "image/jpeg" || mimeType == "image/png"
+}
+
+func (d *Detector) Detect(ctx context.Context, input *detectors.Input) (*detectors.Result, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(input.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode picture: %w", err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("the picture has more than %d pixels", maxPixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(input.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode picture: %w", err)
+	}
+
+	var signals []models.Signal
+	if input.MimeType == "image/jpeg" {
+		signals = append(signals, jpegSignals(img, input)...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	levels, err := computeErrorLevels(img)
+	if err != nil {
+		return nil, err
+	}
+	contrast := levels.contrast()
+	if contrast > minElaContrast {
+		signals = append(signals, models.Signal{
+			Name:        "error_level",
+			Score:       SCORE_ELA_MAX * math.Min((contrast-minElaContrast)/(maxElaContrast-minElaContrast), 1),
+			Explanation: fmt.Sprintf("some regions lose %.1f times more than the median one when recompressed, as regions edited after the last save do", contrast),
+		})
+	}
+	heatmap, err := levels.heatmap()
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing found by classical forensics isn't evidence of authenticity
+	result := &detectors.Result{
+		Verdict:   models.VERDICT_INCONCLUSIVE,
+		Signals:   signals,
+		Artifacts: []detectors.Artifact{{Name: ELA_ARTIFACT, ContentType: "image/png", Data: heatmap}},
+	}
+	for _, signal := range signals {
+		result.Score = math.Max(result.Score, signal.Score)
+	}
+	if result.Score >= detectors.SUSPICIOUS_THRESHOLD {
+		result.Verdict = detectors.VerdictFromScore(result.Score)
+	}
+	return result, nil
+}
+
+func jpegSignals(img image.Image, input *detectors.Input) []models.Signal {
+	tables, err := readQuantizationTables(input.Data)
+	if err != nil {
+		return nil
+	}
+	encoder := identifyEncoder(tables)
+	signals := []models.Signal{{
+		Name:        "quantization_tables",
+		Explanation: fmt.Sprintf("the JPEG was written with %s", encoder),
+	}}
+	// cameras tune their tables, the standard ones mean a library wrote the picture last
+	if encoder.Standard && input.Metadata != nil && input.Metadata.Make != "" {
+		signals = append(signals, models.Signal{
+			Name:        "resaved_camera_picture",
+			Score:       SCORE_RESAVED_CAMERA,
+			Explanation: fmt.Sprintf("the picture names a %s camera but was saved with the standard libjpeg tables, as editors and web services do", input.Metadata.Make),
+		})
+	}
+	if history, ok := analyseCompression(img, tables[0]); ok && history.doublyCompressed() {
+		signals = append(signals, models.Signal{
+			Name:        "double_compression",
+			Score:       SCORE_DOUBLE_COMPRESSION,
+			Explanation: fmt.Sprintf("%d of %d DCT coefficient histogram bins are periodic valleys, the trace of a JPEG compressed twice with different qualities", history.valleys, history.checked),
+		})
+	}
+	return signals
+}
@@ -0,0 +1,68 @@
+package forensics
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+func TestDetector(t *testing.T) {
+	picture := testPicture(512, 384, 1)
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, picture); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		mimeType string
+		data     []byte
+		metadata *models.MediaMetadata
+		score    float64
+		verdict  models.Verdict
+		signals  []string
+	}{
+		{"saved once", "image/jpeg", encodeJPEG(t, picture, 90), nil, 0, models.VERDICT_INCONCLUSIVE, []string{"quantization_tables"}},
+		{"resaved", "image/jpeg", resave(t, picture, 60, 90), nil, SCORE_DOUBLE_COMPRESSION, models.VERDICT_SUSPICIOUS, []string{"quantization_tables", "double_compression"}},
+		{"camera picture resaved", "image/jpeg", encodeJPEG(t, picture, 90), &models.MediaMetadata{Make: "Canon"}, SCORE_RESAVED_CAMERA, models.VERDICT_INCONCLUSIVE, []string{"quantization_tables", "resaved_camera_picture"}},
+		{"png", "image/png", pngData.Bytes(), nil, 0, models.VERDICT_INCONCLUSIVE, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewDetector().Detect(context.Background(), &detectors.Input{MimeType: tt.mimeType, Data: tt.data, Metadata: tt.metadata})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Score != tt.score || result.Verdict != tt.verdict {
+				t.Errorf("expected %v with score %v, got %v with score %v (%+v)", tt.verdict, tt.score, result.Verdict, result.Score, result.Signals)
+			}
+			names := []string{}
+			for _, signal := range result.Signals {
+				names = append(names, signal.Name)
+			}
+			if len(names) != len(tt.signals) {
+				t.Errorf("expected signals %v, got %v", tt.signals, names)
+			}
+			for i := range min(len(names), len(tt.signals)) {
+				if names[i] != tt.signals[i] {
+					t.Errorf("expected signals %v, got %v", tt.signals, names)
+					break
+				}
+			}
+			if len(result.Artifacts) != 1 || result.Artifacts[0].Name != ELA_ARTIFACT || result.Artifacts[0].ContentType != "image/png" {
+				t.Fatalf("expected the ELA heatmap, got %+v", result.Artifacts)
+			}
+			if _, err := png.DecodeConfig(bytes.NewReader(result.Artifacts[0].Data)); err != nil {
+				t.Errorf("expected a PNG heatmap: %v", err)
+			}
+		})
+	}
+
+	if _, err := NewDetector().Detect(context.Background(), &detectors.Input{MimeType: "image/jpeg", Data: []byte("not a picture")}); err == nil {
+		t.Error("expected an error for a content that isn't a picture")
+	}
+}
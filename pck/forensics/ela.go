@@ -0,0 +1,115 @@
+package forensics
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"slices"
+)
+
+const (
+	// the content is recompressed at this quality, the parts that were already lose little
+	elaQuality = 90
+	// error levels are multiplied by this in the heatmap, the same for every picture so they compare
+	elaAmplification = 16
+	// the heatmap is downsampled to at most this many pixels on its longest side
+	maxHeatmapSide = 1024
+	// error levels are averaged over blocks of this size to compare regions
+	elaBlockSize = 16
+	// a flat picture has levels close to zero, they are compared against at least this
+	minMedianLevel = 1.0
+)
+
+// errorLevels is the difference between a picture and its recompression, the largest of the
+// channels for every pixel.
+type errorLevels struct {
+	width  int
+	height int
+	levels []uint8
+}
+
+// computeErrorLevels recompresses the picture at a known quality. Regions pasted from another
+// picture, or edited after the last save, don't lose as much as the rest and stand out.
+func computeErrorLevels(img image.Image) (*errorLevels, error) {
+	bounds := img.Bounds()
+	original := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(original, original.Rect, img, bounds.Min, draw.Src)
+
+	var recompressed bytes.Buffer
+	if err := jpeg.Encode(&recompressed, original, &jpeg.Options{Quality: elaQuality}); err != nil {
+		return nil, fmt.Errorf("failed to recompress: %w", err)
+	}
+	decoded, err := jpeg.Decode(&recompressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode recompressed picture: %w", err)
+	}
+	resaved := image.NewRGBA(original.Rect)
+	draw.Draw(resaved, resaved.Rect, decoded, decoded.Bounds().Min, draw.Src)
+
+	result := &errorLevels{width: original.Rect.Dx(), height: original.Rect.Dy(), levels: make([]uint8, original.Rect.Dx()*original.Rect.Dy())}
+	for i := range result.levels {
+		level := uint8(0)
+		for channel := range 3 {
+			a, b := original.Pix[4*i+channel], resaved.Pix[4*i+channel]
+			level = max(level, max(a, b)-min(a, b))
+		}
+		result.levels[i] = level
+	}
+	return result, nil
+}
+
+// contrast compares the most altered blocks, the 99th percentile of the block means, with the median block.
+func (e *errorLevels) contrast() float64 {
+	var means []float64
+	for top := 0; top+elaBlockSize <= e.height; top += elaBlockSize {
+		for left := 0; left+elaBlockSize <= e.width; left += elaBlockSize {
+			sum := 0
+			for y := top; y < top+elaBlockSize; y++ {
+				for _, level := range e.levels[y*e.width+left : y*e.width+left+elaBlockSize] {
+					sum += int(level)
+				}
+			}
+			means = append(means, float64(sum)/(elaBlockSize*elaBlockSize))
+		}
+	}
+	if len(means) == 0 {
+		return 0
+	}
+	slices.Sort(means)
+	median := max(means[len(means)/2], minMedianLevel)
+	return means[len(means)*99/100] / median
+}
+
+// heatmap renders the amplified levels from black through red and yellow to white, every pixel
+// of a downsampled heatmap showing the largest level it covers.
+func (e *errorLevels) heatmap() ([]byte, error) {
+	cell := max((max(e.width, e.height)+maxHeatmapSide-1)/maxHeatmapSide, 1)
+	width, height := (e.width+cell-1)/cell, (e.height+cell-1)/cell
+	heatmap := image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+	for y := range height {
+		for x := range width {
+			level := 0
+			for sy := y * cell; sy < min((y+1)*cell, e.height); sy++ {
+				for _, value := range e.levels[sy*e.width+x*cell : sy*e.width+min((x+1)*cell, e.width)] {
+					level = max(level, int(value))
+				}
+			}
+			heat := min(level*elaAmplification, 255) * 3
+			heatmap.SetRGBA(x, y, color.RGBA{
+				R: uint8(min(heat, 255)),
+				G: uint8(min(max(heat-255, 0), 255)),
+				B: uint8(min(max(heat-510, 0), 255)),
+				A: 255,
+			})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, heatmap); err != nil {
+		return nil, fmt.Errorf("failed to encode heatmap: %w", err)
+	}
+	return encoded.Bytes(), nil
+}
@@ -0,0 +1,195 @@
+package forensics
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testPicture has the smooth gradients and the sensor noise of a photograph, the noise making the
+// DCT coefficients spread like the ones of a real picture.
+func testPicture(width int, height int, seed int64) *image.RGBA {
+	random := rand.New(rand.NewSource(seed))
+	picture := image.NewRGBA(image.Rect(0, 0, width, height))
+	clamp := func(value float64) uint8 { return uint8(math.Max(0, math.Min(255, value))) }
+	for y := range height {
+		for x := range width {
+			red := 128 + 50*math.Sin(float64(x)/23) + 40*math.Cos(float64(y)/17+float64(x)/41) + random.NormFloat64()*12
+			green := 100 + 60*math.Sin(float64(x+y)/31) + random.NormFloat64()*12
+			picture.SetRGBA(x, y, color.RGBA{R: clamp(red), G: clamp(green), B: clamp((red + green) / 2), A: 255})
+		}
+	}
+	return picture
+}
+
+func encodeJPEG(t *testing.T, picture image.Image, quality int) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, picture, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+func decodeJPEG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// resave compresses the picture at every quality in turn.
+func resave(t *testing.T, picture image.Image, qualities ...int) []byte {
+	t.Helper()
+	var data []byte
+	for _, quality := range qualities {
+		data = encodeJPEG(t, picture, quality)
+		picture = decodeJPEG(t, data)
+	}
+	return data
+}
+
+// withTables rewrites the DQT segments of a JPEG, the picture data stays the same.
+func withTables(t *testing.T, data []byte, tables map[int][64]uint16) []byte {
+	t.Helper()
+	result := []byte{0xFF, 0xD8}
+	for offset := 2; ; {
+		marker, length := data[offset+1], int(data[offset+2])<<8|int(data[offset+3])
+		if marker == 0xDA {
+			return append(result, data[offset:]...)
+		}
+		if marker != 0xDB {
+			result = append(result, data[offset:offset+2+length]...)
+		} else if destination := int(data[offset+4] & 0x0F); tables[destination] != [64]uint16{} {
+			result = append(result, 0xFF, 0xDB, 0x00, 67, byte(destination))
+			for i := range 64 {
+				result = append(result, byte(tables[destination][unzig[i]]))
+			}
+		}
+		offset += 2 + length
+	}
+}
+
+func TestIdentifyEncoder(t *testing.T) {
+	picture := testPicture(64, 64, 1)
+	for _, quality := range []int{10, 50, 75, 90, 100} {
+		tables, err := readQuantizationTables(encodeJPEG(t, picture, quality))
+		if err != nil {
+			t.Fatalf("failed to read tables: %v", err)
+		}
+		if encoder := identifyEncoder(tables); !encoder.Standard || encoder.Quality != quality {
+			t.Errorf("expected the standard tables at quality %d, got %+v", quality, encoder)
+		}
+	}
+
+	// camera makers tune the tables, they stay close to a standard quality
+	tuned := scaleTable(standardLuminance, 92)
+	tuned[0], tuned[63] = tuned[0]+1, tuned[63]-2
+	tables, err := readQuantizationTables(withTables(t, encodeJPEG(t, picture, 92), map[int][64]uint16{0: tuned}))
+	if err != nil {
+		t.Fatalf("failed to read tables: %v", err)
+	}
+	if encoder := identifyEncoder(tables); encoder.Standard || encoder.Quality != 92 {
+		t.Errorf("expected custom tables close to quality 92, got %+v", encoder)
+	}
+
+	for _, invalid := range [][]byte{nil, []byte("not a jpeg"), {0xFF, 0xD8, 0xFF, 0xDB, 0x00, 0x10, 0x00}, {0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}} {
+		if _, err := readQuantizationTables(invalid); err == nil {
+			t.Errorf("expected an error reading % x", invalid)
+		}
+	}
+}
+
+func TestAnalyseCompression(t *testing.T) {
+	picture := testPicture(512, 384, 1)
+	tests := []struct {
+		name      string
+		qualities []int
+		double    bool
+	}{
+		{"saved once", []int{90}, false},
+		{"saved once at a low quality", []int{75}, false},
+		{"resaved at a higher quality", []int{60, 90}, true},
+		{"resaved at a slightly higher quality", []int{50, 80}, true},
+		{"resaved at the same quality", []int{90, 90}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := resave(t, picture, tt.qualities...)
+			tables, err := readQuantizationTables(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			history, ok := analyseCompression(decodeJPEG(t, data), tables[0])
+			if !ok {
+				t.Fatal("expected the luminance of the JPEG to be analysed")
+			}
+			if history.doublyCompressed() != tt.double {
+				t.Errorf("expected doubly compressed to be %v, got %d valleys of %d bins", tt.double, history.valleys, history.checked)
+			}
+		})
+	}
+
+	if _, ok := analyseCompression(picture, standardLuminance); ok {
+		t.Error("expected an RGB picture not to be analysed")
+	}
+}
+
+func TestErrorLevels(t *testing.T) {
+	// a picture saved at a low quality, then a never compressed region pasted and saved at a high one
+	base := decodeJPEG(t, encodeJPEG(t, testPicture(512, 384, 1), 60))
+	spliced := image.NewRGBA(base.Bounds())
+	draw.Draw(spliced, spliced.Rect, base, image.Point{}, draw.Src)
+	region := image.Rect(200, 96, 320, 208)
+	draw.Draw(spliced, region, testPicture(512, 384, 7), region.Min, draw.Src)
+
+	plainLevels, err := computeErrorLevels(decodeJPEG(t, encodeJPEG(t, base, 95)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	splicedLevels, err := computeErrorLevels(decodeJPEG(t, encodeJPEG(t, spliced, 95)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contrast := plainLevels.contrast(); contrast > minElaContrast {
+		t.Errorf("expected even error levels, got a contrast of %.2f", contrast)
+	}
+	if contrast := splicedLevels.contrast(); contrast < 5 {
+		t.Errorf("expected the pasted region to stand out, got a contrast of %.2f", contrast)
+	}
+
+	encoded, err := splicedLevels.heatmap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	heatmap, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("failed to decode heatmap: %v", err)
+	}
+	if heatmap.Bounds() != spliced.Rect {
+		t.Errorf("expected a heatmap of %v, got %v", spliced.Rect, heatmap.Bounds())
+	}
+	// the pasted region burns brighter than the rest
+	inside, _, _, _ := heatmap.At(260, 150).RGBA()
+	outside, _, _, _ := heatmap.At(60, 300).RGBA()
+	if inside <= outside {
+		t.Errorf("expected the pasted region to be hotter, got %d inside and %d outside", inside, outside)
+	}
+
+	large := &errorLevels{width: 3000, height: 1000, levels: make([]uint8, 3000*1000)}
+	encoded, err = large.heatmap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config, err := png.DecodeConfig(bytes.NewReader(encoded)); err != nil || config.Width != 1000 || config.Height != 334 {
+		t.Errorf("expected a heatmap downsampled to 1000x334, got %+v (%v)", config, err)
+	}
+}
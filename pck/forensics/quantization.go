@@ -0,0 +1,161 @@
+package forensics
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errInvalidJPEG = errors.New("invalid JPEG")
+
+// the tables of Annex K of the JPEG standard, in natural order, which libjpeg scales by quality
+var (
+	standardLuminance = [64]uint16{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	}
+	standardChrominance = [64]uint16{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	}
+)
+
+// unzig maps the zigzag order tables are written in to the natural order
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// Encoder is what the quantization tables of a JPEG tell of the software that wrote it.
+type Encoder struct {
+	// Standard is true for the scaled Annex K tables of libjpeg, which most libraries, editors
+	// and web services use. Cameras tune their own.
+	Standard bool
+	// Quality is the libjpeg quality the tables match, or come closest to
+	Quality int
+}
+
+func (e Encoder) String() string {
+	if e.Standard {
+		return fmt.Sprintf("the standard libjpeg tables at quality %d", e.Quality)
+	}
+	return fmt.Sprintf("custom tables close to libjpeg quality %d", e.Quality)
+}
+
+// readQuantizationTables returns the tables of the DQT segments in natural order, keyed by their
+// destination. The ones defined before the first scan are the ones the content was written with.
+func readQuantizationTables(data []byte) (map[int][64]uint16, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, fmt.Errorf("%w: no start of image", errInvalidJPEG)
+	}
+	tables := map[int][64]uint16{}
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			return nil, fmt.Errorf("%w: no marker at %d", errInvalidJPEG, offset)
+		}
+		marker := data[offset+1]
+		if marker == 0xFF {
+			offset++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			offset += 2
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			return nil, fmt.Errorf("%w: truncated segment", errInvalidJPEG)
+		}
+		if marker == 0xDB {
+			if err := readDQT(data[offset+4:offset+2+length], tables); err != nil {
+				return nil, err
+			}
+		}
+		offset += 2 + length
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("%w: no quantization table", errInvalidJPEG)
+	}
+	return tables, nil
+}
+
+// readDQT reads the tables of a DQT segment, 8 or 16 bit values each.
+func readDQT(segment []byte, tables map[int][64]uint16) error {
+	for len(segment) > 0 {
+		precision, destination := segment[0]>>4, int(segment[0]&0x0F)
+		size := 64
+		if precision == 1 {
+			size = 128
+		}
+		if destination > 3 || len(segment) < 1+size {
+			return fmt.Errorf("%w: malformed quantization table", errInvalidJPEG)
+		}
+		var table [64]uint16
+		for i := range 64 {
+			if precision == 1 {
+				table[unzig[i]] = binary.BigEndian.Uint16(segment[1+2*i:])
+			} else {
+				table[unzig[i]] = uint16(segment[1+i])
+			}
+		}
+		tables[destination] = table
+		segment = segment[1+size:]
+	}
+	return nil
+}
+
+// scaleTable scales a standard table to a quality between 1 and 100 the way libjpeg does.
+func scaleTable(standard [64]uint16, quality int) [64]uint16 {
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var scaled [64]uint16
+	for i, value := range standard {
+		scaled[i] = uint16(min(max((int(value)*scale+50)/100, 1), 255))
+	}
+	return scaled
+}
+
+// identifyEncoder compares the luminance table, and the chrominance one when there is one, with
+// the standard tables at every quality.
+func identifyEncoder(tables map[int][64]uint16) Encoder {
+	// the first table quantizes the luminance in practically every JPEG, the second the chrominance
+	luminance, found := tables[0]
+	if !found {
+		return Encoder{}
+	}
+	chrominance, hasChrominance := tables[1]
+	best, bestDistance := Encoder{}, -1
+	for quality := 1; quality <= 100; quality++ {
+		scaled := scaleTable(standardLuminance, quality)
+		distance := 0
+		for i := range scaled {
+			distance += max(int(scaled[i])-int(luminance[i]), int(luminance[i])-int(scaled[i]))
+		}
+		if distance == 0 && (!hasChrominance || chrominance == scaleTable(standardChrominance, quality)) {
+			return Encoder{Standard: true, Quality: quality}
+		}
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = Encoder{Quality: quality}, distance
+		}
+	}
+	return best
+}
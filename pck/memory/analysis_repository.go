@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type analysisRepository struct {
+	db *Database
+}
+
+func NewAnalysisRepository(db *Database) repositories.AnalysisRepository {
+	return &analysisRepository{
+		db: db,
+	}
+}
+
+func (ar *analysisRepository) GetByMediaID(ctx context.Context, mediaId string) (*models.Analysis, error) {
+	ar.db.lock.RLock()
+	defer ar.db.lock.RUnlock()
+
+	analysis, ok := ar.db.analyses[mediaId]
+	if !ok {
+		return nil, utils.ErrAnalysisNotFound
+	}
+	analysis = cloneAnalysis(analysis)
+	if analysis.Results == nil {
+		analysis.Results = []models.DetectorResult{}
+	}
+	return &analysis, nil
+}
+
+func (ar *analysisRepository) Save(ctx context.Context, analysis *models.Analysis) error {
+	ar.db.lock.Lock()
+	defer ar.db.lock.Unlock()
+
+	if _, ok := ar.db.media[analysis.MediaId]; !ok {
+		return fmt.Errorf("failed to save analysis: media %s does not exist", analysis.MediaId)
+	}
+	ar.db.analyses[analysis.MediaId] = cloneAnalysis(*analysis)
+	return nil
+}
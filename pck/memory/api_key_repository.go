@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type apiKeyRepository struct {
+	db *Database
+}
+
+func NewApiKeyRepository(db *Database) repositories.ApiKeyRepository {
+	return &apiKeyRepository{
+		db: db,
+	}
+}
+
+func (kr *apiKeyRepository) GetByID(ctx context.Context, id string) (*models.ApiKey, error) {
+	kr.db.lock.RLock()
+	defer kr.db.lock.RUnlock()
+
+	key, ok := kr.db.apiKeys[id]
+	if !ok {
+		return nil, utils.ErrApiKeyNotFound
+	}
+	key = cloneApiKey(key)
+	return &key, nil
+}
+
+func (kr *apiKeyRepository) List(ctx context.Context, tenantId string) ([]models.ApiKey, error) {
+	kr.db.lock.RLock()
+	keys := []models.ApiKey{}
+	for _, key := range kr.db.apiKeys {
+		if key.TenantId == tenantId {
+			keys = append(keys, cloneApiKey(key))
+		}
+	}
+	kr.db.lock.RUnlock()
+
+	slices.SortFunc(keys, func(a, b models.ApiKey) int {
+		if order := b.CreatedAt.Compare(a.CreatedAt); order != 0 {
+			return order
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+	return keys, nil
+}
+
+func (kr *apiKeyRepository) Create(ctx context.Context, key *models.ApiKey) error {
+	kr.db.lock.Lock()
+	defer kr.db.lock.Unlock()
+
+	kr.db.apiKeys[key.Id] = cloneApiKey(*key)
+	return nil
+}
+
+func (kr *apiKeyRepository) Revoke(ctx context.Context, tenantId string, id string, revokedAt time.Time) error {
+	kr.db.lock.Lock()
+	defer kr.db.lock.Unlock()
+
+	key, ok := kr.db.apiKeys[id]
+	if !ok || key.TenantId != tenantId {
+		return utils.ErrApiKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+	}
+	kr.db.apiKeys[id] = key
+	return nil
+}
+
+func (kr *apiKeyRepository) UpdateLastUsed(ctx context.Context, tenantId string, id string, lastUsedAt time.Time) error {
+	kr.db.lock.Lock()
+	defer kr.db.lock.Unlock()
+
+	key, ok := kr.db.apiKeys[id]
+	if !ok || key.TenantId != tenantId {
+		return utils.ErrApiKeyNotFound
+	}
+	key.LastUsedAt = &lastUsedAt
+	kr.db.apiKeys[id] = key
+	return nil
+}
+
+// cloneApiKey copies the slices and times so callers never share memory with the stored record.
+func cloneApiKey(key models.ApiKey) models.ApiKey {
+	key.Scopes = slices.Clone(key.Scopes)
+	key.Salt = slices.Clone(key.Salt)
+	key.Hash = slices.Clone(key.Hash)
+	if key.LastUsedAt != nil {
+		lastUsedAt := *key.LastUsedAt
+		key.LastUsedAt = &lastUsedAt
+	}
+	if key.RevokedAt != nil {
+		revokedAt := *key.RevokedAt
+		key.RevokedAt = &revokedAt
+	}
+	return key
+}
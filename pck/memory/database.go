@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// Database holds the records of the in-memory repositories. They share it so that,
+// like the foreign keys of the Postgres schema, deleting a media removes its analysis, review, hashes, metadata and timeline.
+// Nothing survives a restart, it is meant for tests and local development.
+type Database struct {
+	lock     sync.RWMutex
+	media    map[string]models.Media
+	analyses map[string]models.Analysis
+	uploads  map[string]models.Upload
+	apiKeys  map[string]models.ApiKey
+	users    map[userKey]models.User
+	reviews  map[string]models.Review
+	// hashes of every frame of a media, keyed by media id
+	mediaHashes map[string][]models.MediaHash
+	// metadata of the media as JSON, keyed by media id
+	metadata map[string][]byte
+	// frame by frame analyses of the videos as JSON, keyed by media id
+	timelines map[string][]byte
+}
+
+func NewDatabase() *Database {
+	return &Database{
+		media:       map[string]models.Media{},
+		analyses:    map[string]models.Analysis{},
+		uploads:     map[string]models.Upload{},
+		apiKeys:     map[string]models.ApiKey{},
+		users:       map[userKey]models.User{},
+		reviews:     map[string]models.Review{},
+		mediaHashes: map[string][]models.MediaHash{},
+		metadata:    map[string][]byte{},
+		timelines:   map[string][]byte{},
+	}
+}
+
+// userKey identifies a user, like the primary key of the users table.
+type userKey struct {
+	tenantId string
+	subject  string
+}
+
+// cloneAnalysis copies the nested slices so callers never share memory with the stored record.
+func cloneAnalysis(analysis models.Analysis) models.Analysis {
+	analysis.Results = slices.Clone(analysis.Results)
+	for i := range analysis.Results {
+		analysis.Results[i].Signals = slices.Clone(analysis.Results[i].Signals)
+		analysis.Results[i].Artifacts = slices.Clone(analysis.Results[i].Artifacts)
+	}
+	if analysis.Provenance != nil {
+		provenance := *analysis.Provenance
+		provenance.Issues = slices.Clone(provenance.Issues)
+		provenance.Manifests = slices.Clone(provenance.Manifests)
+		for i := range provenance.Manifests {
+			manifest := &provenance.Manifests[i]
+			manifest.Generators = slices.Clone(manifest.Generators)
+			manifest.Actions = slices.Clone(manifest.Actions)
+			manifest.Ingredients = slices.Clone(manifest.Ingredients)
+			manifest.Issues = slices.Clone(manifest.Issues)
+		}
+		analysis.Provenance = &provenance
+	}
+	return analysis
+}
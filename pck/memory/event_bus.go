@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+)
+
+type eventBus struct {
+	lock      sync.Mutex
+	sequence  uint64
+	listeners []func(event *events.Event)
+}
+
+// NewEventBus hands the events to the listeners of this replica only, as they are published.
+func NewEventBus() events.Bus {
+	return &eventBus{}
+}
+
+func (b *eventBus) Subscribe(listener func(event *events.Event)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.listeners = append(b.listeners, listener)
+}
+
+func (b *eventBus) Publish(ctx context.Context, event *events.Event) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.sequence++
+	event.Sequence = b.sequence
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	for _, listener := range b.listeners {
+		listener(event)
+	}
+	return nil
+}
+
+func (b *eventBus) Start() {}
+
+func (b *eventBus) Stop() {}
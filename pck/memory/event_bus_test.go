@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	var first, second []*events.Event
+	bus.Subscribe(func(event *events.Event) { first = append(first, event) })
+	bus.Subscribe(func(event *events.Event) { second = append(second, event) })
+
+	at := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	published := []*events.Event{
+		{Type: events.MEDIA_CREATED, MediaId: "a", TenantId: "acme", OwnerId: "alice"},
+		{Type: events.MEDIA_UPDATED, MediaId: "a", TenantId: "acme", OwnerId: "alice", Timestamp: at},
+	}
+	for _, event := range published {
+		if err := bus.Publish(context.Background(), event); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	if len(first) != 2 || len(second) != 2 {
+		t.Fatalf("expected every listener to get both events, got %d and %d", len(first), len(second))
+	}
+	for i, event := range published {
+		if first[i] != event || second[i] != event || event.Sequence != uint64(i+1) {
+			t.Errorf("expected the event %d to be delivered as published with the sequence %d, got %+v", i, i+1, event)
+		}
+	}
+	// the bus stamps the events published without a timestamp only
+	if published[0].Timestamp.IsZero() || !published[1].Timestamp.Equal(at) {
+		t.Errorf("unexpected timestamps %v and %v", published[0].Timestamp, published[1].Timestamp)
+	}
+}
+
+func TestEventBusOrder(t *testing.T) {
+	bus := NewEventBus()
+	var sequences []uint64
+	bus.Subscribe(func(event *events.Event) { sequences = append(sequences, event.Sequence) })
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				bus.Publish(context.Background(), &events.Event{Type: events.ANALYSIS_PROGRESS})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// publishers racing each other still deliver the events in the order of their sequence
+	if len(sequences) != 400 {
+		t.Fatalf("expected 400 events, got %d", len(sequences))
+	}
+	for i, sequence := range sequences {
+		if sequence != uint64(i+1) {
+			t.Fatalf("expected the sequence %d at %d, got %d", i+1, i, sequence)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type mediaHashRepository struct {
+	db *Database
+}
+
+func NewMediaHashRepository(db *Database) repositories.MediaHashRepository {
+	return &mediaHashRepository{
+		db: db,
+	}
+}
+
+func (hr *mediaHashRepository) Save(ctx context.Context, mediaId string, hashes []models.MediaHash) error {
+	hr.db.lock.Lock()
+	defer hr.db.lock.Unlock()
+
+	if _, ok := hr.db.media[mediaId]; !ok {
+		return utils.ErrMediaNotFound
+	}
+	hr.db.mediaHashes[mediaId] = slices.Clone(hashes)
+	return nil
+}
+
+func (hr *mediaHashRepository) GetByMediaID(ctx context.Context, mediaId string) ([]models.MediaHash, error) {
+	hr.db.lock.RLock()
+	defer hr.db.lock.RUnlock()
+
+	return hr.withMedia(mediaId), nil
+}
+
+func (hr *mediaHashRepository) List(ctx context.Context) ([]models.MediaHash, error) {
+	hr.db.lock.RLock()
+	defer hr.db.lock.RUnlock()
+
+	hashes := []models.MediaHash{}
+	for mediaId := range hr.db.mediaHashes {
+		hashes = append(hashes, hr.withMedia(mediaId)...)
+	}
+	return hashes, nil
+}
+
+// withMedia copies the hashes of a media and fills in its tenant and owner, like the join of the Postgres repository.
+func (hr *mediaHashRepository) withMedia(mediaId string) []models.MediaHash {
+	media := hr.db.media[mediaId]
+	hashes := make([]models.MediaHash, 0, len(hr.db.mediaHashes[mediaId]))
+	for _, hash := range hr.db.mediaHashes[mediaId] {
+		hash.MediaId = mediaId
+		hash.TenantId = media.TenantId
+		hash.OwnerId = media.OwnerId
+		hashes = append(hashes, hash)
+	}
+	slices.SortFunc(hashes, func(a, b models.MediaHash) int { return a.Frame - b.Frame })
+	return hashes
+}
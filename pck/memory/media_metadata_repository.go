@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type mediaMetadataRepository struct {
+	db *Database
+}
+
+// NewMediaMetadataRepository keeps the metadata as JSON, like the Postgres repository, so
+// callers never share memory with the stored record.
+func NewMediaMetadataRepository(db *Database) repositories.MediaMetadataRepository {
+	return &mediaMetadataRepository{
+		db: db,
+	}
+}
+
+func (mr *mediaMetadataRepository) GetByMediaID(ctx context.Context, mediaId string) (*models.MediaMetadata, error) {
+	mr.db.lock.RLock()
+	defer mr.db.lock.RUnlock()
+
+	data, ok := mr.db.metadata[mediaId]
+	if !ok {
+		return nil, utils.ErrMetadataNotFound
+	}
+	var metadata models.MediaMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+func (mr *mediaMetadataRepository) Save(ctx context.Context, metadata *models.MediaMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	mr.db.lock.Lock()
+	defer mr.db.lock.Unlock()
+
+	if _, ok := mr.db.media[metadata.MediaId]; !ok {
+		return utils.ErrMediaNotFound
+	}
+	mr.db.metadata[metadata.MediaId] = data
+	return nil
+}
@@ -0,0 +1,236 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/google/uuid"
+)
+
+type mediaRepository struct {
+	db *Database
+}
+
+func NewMediaRepository(db *Database) repositories.MediaRepository {
+	return &mediaRepository{
+		db: db,
+	}
+}
+
+// GetByID loads every field whatever fields asks for, like List.
+func (mr *mediaRepository) GetByID(ctx context.Context, scope repositories.Scope, id string, fields []string) (*models.Media, error) {
+	mr.db.lock.RLock()
+	defer mr.db.lock.RUnlock()
+
+	media, ok := mr.db.media[id]
+	if !ok || !scope.Allows(media.TenantId, media.OwnerId) {
+		return nil, utils.ErrMediaNotFound
+	}
+	return &media, nil
+}
+
+func (mr *mediaRepository) Create(ctx context.Context, payload *repositories.MediaPayload) (*models.Media, error) {
+	media := models.Media{
+		Id:          uuid.NewString(),
+		Title:       payload.Title,
+		Description: payload.Description,
+		Location:    payload.Location,
+		Type:        payload.Type,
+		MimeType:    payload.MimeType,
+		Size:        payload.Size,
+		Tags:        payload.Tags,
+		ContentKey:  payload.ContentKey,
+		Checksum:    payload.Checksum,
+		TenantId:    payload.TenantId,
+		OwnerId:     payload.OwnerId,
+		// same precision as a Postgres timestamp, so cursors behave the same way
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	mr.db.lock.Lock()
+	defer mr.db.lock.Unlock()
+	mr.db.media[media.Id] = media
+	return &media, nil
+}
+
+func (mr *mediaRepository) Update(ctx context.Context, scope repositories.Scope, id string, payload *repositories.MediaPayload) (*models.Media, error) {
+	mr.db.lock.Lock()
+	defer mr.db.lock.Unlock()
+
+	media, ok := mr.db.media[id]
+	if !ok || !scope.Allows(media.TenantId, media.OwnerId) {
+		return nil, utils.ErrMediaNotFound
+	}
+
+	// only the non-empty fields are updated
+	if payload.Title != "" {
+		media.Title = payload.Title
+	}
+	if payload.Description != "" {
+		media.Description = payload.Description
+	}
+	if payload.Location != "" {
+		media.Location = payload.Location
+	}
+	if payload.Type != "" {
+		media.Type = payload.Type
+	}
+	if payload.MimeType != "" {
+		media.MimeType = payload.MimeType
+	}
+	if payload.Size != 0 {
+		media.Size = payload.Size
+	}
+	if payload.Tags != "" {
+		media.Tags = payload.Tags
+	}
+	if payload.ContentKey != "" {
+		media.ContentKey = payload.ContentKey
+		media.Checksum = payload.Checksum
+	}
+
+	mr.db.media[id] = media
+	return &media, nil
+}
+
+func (mr *mediaRepository) Delete(ctx context.Context, scope repositories.Scope, id string) (bool, error) {
+	mr.db.lock.Lock()
+	defer mr.db.lock.Unlock()
+
+	if media, ok := mr.db.media[id]; !ok || !scope.Allows(media.TenantId, media.OwnerId) {
+		return false, utils.ErrMediaNotFound
+	}
+	delete(mr.db.media, id)
+	delete(mr.db.analyses, id)
+	delete(mr.db.reviews, id)
+	delete(mr.db.mediaHashes, id)
+	delete(mr.db.metadata, id)
+	delete(mr.db.timelines, id)
+	return true, nil
+}
+
+// List mirrors the keyset pagination of the Postgres repository. Every field is loaded
+// whatever options.Fields asks for, the handlers project the response anyway.
+func (mr *mediaRepository) List(ctx context.Context, scope repositories.Scope, options repositories.ListOptions) (*repositories.MediaPage, error) {
+	if _, ok := sortComparators[options.SortBy]; !ok {
+		return nil, fmt.Errorf("unknown sort field %q", options.SortBy)
+	}
+
+	var cursor *repositories.MediaCursor
+	var pivot *models.Media
+	if options.Cursor != "" {
+		decoded, err := repositories.DecodeCursor(options.Cursor, &options)
+		if err != nil {
+			return nil, err
+		}
+		pivot, err = cursorMedia(decoded)
+		if err != nil {
+			return nil, err
+		}
+		cursor = decoded
+	}
+
+	// walking backwards flips both the ordering and the keyset comparison, the items are reversed afterwards
+	backwards := cursor != nil && cursor.Before
+	descending := options.Descending != backwards
+	compare := func(a, b *models.Media) int {
+		order := cmp.Or(sortComparators[options.SortBy](a, b), strings.Compare(a.Id, b.Id))
+		if descending {
+			return -order
+		}
+		return order
+	}
+
+	mr.db.lock.RLock()
+	mediaList := []models.Media{}
+	for _, media := range mr.db.media {
+		if scope.Allows(media.TenantId, media.OwnerId) && mr.matches(&media, &options) && (pivot == nil || compare(&media, pivot) > 0) {
+			mediaList = append(mediaList, media)
+		}
+	}
+	mr.db.lock.RUnlock()
+
+	slices.SortFunc(mediaList, func(a, b models.Media) int {
+		return compare(&a, &b)
+	})
+	if len(mediaList) > options.Limit+1 {
+		mediaList = mediaList[:options.Limit+1]
+	}
+	return repositories.NewMediaPage(mediaList, &options, cursor), nil
+}
+
+// matches applies the list filters, the caller holds the read lock.
+func (mr *mediaRepository) matches(media *models.Media, options *repositories.ListOptions) bool {
+	if options.Type != "" && media.Type != options.Type {
+		return false
+	}
+	if options.MimeType != "" && media.MimeType != options.MimeType {
+		return false
+	}
+	if options.Tag != "" && !hasTag(media.Tags, options.Tag) {
+		return false
+	}
+	if options.MinSize != nil && media.Size < *options.MinSize {
+		return false
+	}
+	if options.MaxSize != nil && media.Size > *options.MaxSize {
+		return false
+	}
+	if options.Verdict != "" {
+		// media that were never analysed are inconclusive
+		verdict := models.VERDICT_INCONCLUSIVE
+		if analysis, ok := mr.db.analyses[media.Id]; ok {
+			verdict = analysis.Verdict
+		}
+		if verdict != options.Verdict {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTag looks for the tag in the comma separated list of a media.
+func hasTag(tags string, tag string) bool {
+	for _, candidate := range strings.Split(tags, ",") {
+		if strings.TrimSpace(candidate) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+var sortComparators = map[repositories.SortField]func(a, b *models.Media) int{
+	repositories.SORT_CREATED_AT: func(a, b *models.Media) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	repositories.SORT_SIZE:       func(a, b *models.Media) int { return cmp.Compare(a.Size, b.Size) },
+	repositories.SORT_TITLE:      func(a, b *models.Media) int { return strings.Compare(a.Title, b.Title) },
+}
+
+// cursorMedia turns a cursor into a media holding the position, to compare items against.
+func cursorMedia(cursor *repositories.MediaCursor) (*models.Media, error) {
+	media := &models.Media{Id: cursor.Id}
+	switch cursor.SortBy {
+	case repositories.SORT_CREATED_AT:
+		createdAt, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		media.CreatedAt = createdAt
+	case repositories.SORT_SIZE:
+		size, err := strconv.Atoi(cursor.Value)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		media.Size = size
+	default:
+		media.Title = cursor.Value
+	}
+	return media, nil
+}
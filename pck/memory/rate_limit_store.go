@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+)
+
+// sweepInterval is how often the buckets that filled up again are forgotten.
+const sweepInterval = time.Minute
+
+type rateLimitEntry struct {
+	bucket repositories.RateLimitBucket
+	fullAt time.Time
+}
+
+type rateLimitStore struct {
+	lock      sync.Mutex
+	buckets   map[string]*rateLimitEntry
+	lastSweep time.Time
+}
+
+// NewRateLimitStore keeps the buckets of this replica only, every replica limits the clients on its own.
+func NewRateLimitStore() repositories.RateLimitStore {
+	return &rateLimitStore{
+		buckets: map[string]*rateLimitEntry{},
+	}
+}
+
+func (s *rateLimitStore) Take(ctx context.Context, key string, limit repositories.RateLimit, now time.Time) (*repositories.RateLimitResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for key, entry := range s.buckets {
+			if !now.Before(entry.fullAt) {
+				delete(s.buckets, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	entry, ok := s.buckets[key]
+	if !ok {
+		entry = &rateLimitEntry{bucket: repositories.NewRateLimitBucket(limit, now)}
+		s.buckets[key] = entry
+	}
+	result := entry.bucket.Take(limit, now)
+	entry.fullAt = entry.bucket.FullAt(limit)
+	return &result, nil
+}
@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type reviewRepository struct {
+	db *Database
+}
+
+func NewReviewRepository(db *Database) repositories.ReviewRepository {
+	return &reviewRepository{
+		db: db,
+	}
+}
+
+func (rr *reviewRepository) GetByMediaID(ctx context.Context, mediaId string) (*models.Review, error) {
+	rr.db.lock.RLock()
+	defer rr.db.lock.RUnlock()
+
+	review, ok := rr.db.reviews[mediaId]
+	if !ok {
+		return nil, utils.ErrReviewNotFound
+	}
+	return &review, nil
+}
+
+func (rr *reviewRepository) Save(ctx context.Context, review *models.Review) error {
+	rr.db.lock.Lock()
+	defer rr.db.lock.Unlock()
+
+	if _, ok := rr.db.media[review.MediaId]; !ok {
+		return utils.ErrMediaNotFound
+	}
+	rr.db.reviews[review.MediaId] = *review
+	return nil
+}
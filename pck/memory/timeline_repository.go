@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type timelineRepository struct {
+	db *Database
+}
+
+// NewTimelineRepository keeps the timelines as JSON, like the metadata, so callers never share
+// memory with the stored record.
+func NewTimelineRepository(db *Database) repositories.TimelineRepository {
+	return &timelineRepository{
+		db: db,
+	}
+}
+
+func (tr *timelineRepository) GetByMediaID(ctx context.Context, mediaId string) (*models.Timeline, error) {
+	tr.db.lock.RLock()
+	defer tr.db.lock.RUnlock()
+
+	data, ok := tr.db.timelines[mediaId]
+	if !ok {
+		return nil, utils.ErrTimelineNotFound
+	}
+	var timeline models.Timeline
+	if err := json.Unmarshal(data, &timeline); err != nil {
+		return nil, fmt.Errorf("failed to decode timeline: %w", err)
+	}
+	return &timeline, nil
+}
+
+func (tr *timelineRepository) Save(ctx context.Context, timeline *models.Timeline) error {
+	data, err := json.Marshal(timeline)
+	if err != nil {
+		return fmt.Errorf("failed to encode timeline: %w", err)
+	}
+
+	tr.db.lock.Lock()
+	defer tr.db.lock.Unlock()
+
+	if _, ok := tr.db.media[timeline.MediaId]; !ok {
+		return utils.ErrMediaNotFound
+	}
+	tr.db.timelines[timeline.MediaId] = data
+	return nil
+}
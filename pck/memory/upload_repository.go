@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type uploadRepository struct {
+	db *Database
+}
+
+func NewUploadRepository(db *Database) repositories.UploadRepository {
+	return &uploadRepository{
+		db: db,
+	}
+}
+
+func (ur *uploadRepository) GetByID(ctx context.Context, tenantId string, id string) (*models.Upload, error) {
+	ur.db.lock.RLock()
+	defer ur.db.lock.RUnlock()
+
+	upload, ok := ur.db.uploads[id]
+	if !ok || upload.TenantId != tenantId {
+		return nil, utils.ErrUploadNotFound
+	}
+	upload.Metadata = maps.Clone(upload.Metadata)
+	return &upload, nil
+}
+
+func (ur *uploadRepository) Create(ctx context.Context, upload *models.Upload) error {
+	ur.db.lock.Lock()
+	defer ur.db.lock.Unlock()
+
+	stored := *upload
+	stored.Metadata = maps.Clone(upload.Metadata)
+	ur.db.uploads[upload.Id] = stored
+	return nil
+}
+
+func (ur *uploadRepository) UpdateOffset(ctx context.Context, tenantId string, id string, offset int64, expiresAt time.Time) error {
+	ur.db.lock.Lock()
+	defer ur.db.lock.Unlock()
+
+	upload, ok := ur.db.uploads[id]
+	if !ok || upload.TenantId != tenantId {
+		return utils.ErrUploadNotFound
+	}
+	upload.Offset = offset
+	upload.ExpiresAt = expiresAt
+	ur.db.uploads[id] = upload
+	return nil
+}
+
+func (ur *uploadRepository) Complete(ctx context.Context, tenantId string, id string, mediaId string) error {
+	ur.db.lock.Lock()
+	defer ur.db.lock.Unlock()
+
+	upload, ok := ur.db.uploads[id]
+	if !ok || upload.TenantId != tenantId {
+		return utils.ErrUploadNotFound
+	}
+	upload.MediaId = mediaId
+	ur.db.uploads[id] = upload
+	return nil
+}
+
+func (ur *uploadRepository) Delete(ctx context.Context, tenantId string, id string) error {
+	ur.db.lock.Lock()
+	defer ur.db.lock.Unlock()
+
+	if upload, ok := ur.db.uploads[id]; !ok || upload.TenantId != tenantId {
+		return utils.ErrUploadNotFound
+	}
+	delete(ur.db.uploads, id)
+	return nil
+}
+
+func (ur *uploadRepository) GetExpired(ctx context.Context, now time.Time) ([]models.Upload, error) {
+	ur.db.lock.RLock()
+	defer ur.db.lock.RUnlock()
+
+	var uploads []models.Upload
+	for _, upload := range ur.db.uploads {
+		if upload.ExpiresAt.Before(now) {
+			upload.Metadata = maps.Clone(upload.Metadata)
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type userRepository struct {
+	db *Database
+}
+
+func NewUserRepository(db *Database) repositories.UserRepository {
+	return &userRepository{
+		db: db,
+	}
+}
+
+func (ur *userRepository) GetBySubject(ctx context.Context, tenantId string, subject string) (*models.User, error) {
+	ur.db.lock.RLock()
+	defer ur.db.lock.RUnlock()
+
+	user, ok := ur.db.users[userKey{tenantId, subject}]
+	if !ok {
+		return nil, utils.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (ur *userRepository) List(ctx context.Context, tenantId string) ([]models.User, error) {
+	ur.db.lock.RLock()
+	users := []models.User{}
+	for key, user := range ur.db.users {
+		if key.tenantId == tenantId {
+			users = append(users, user)
+		}
+	}
+	ur.db.lock.RUnlock()
+
+	slices.SortFunc(users, func(a, b models.User) int {
+		return strings.Compare(a.Subject, b.Subject)
+	})
+	return users, nil
+}
+
+func (ur *userRepository) Save(ctx context.Context, user *models.User) (*models.User, error) {
+	ur.db.lock.Lock()
+	defer ur.db.lock.Unlock()
+
+	key := userKey{user.TenantId, user.Subject}
+	saved, ok := ur.db.users[key]
+	if !ok {
+		saved = models.User{TenantId: user.TenantId, Subject: user.Subject, CreatedAt: user.UpdatedAt}
+	}
+	saved.Role = user.Role
+	saved.UpdatedAt = user.UpdatedAt
+	ur.db.users[key] = saved
+	return &saved, nil
+}
+
+func (ur *userRepository) Delete(ctx context.Context, tenantId string, subject string) error {
+	ur.db.lock.Lock()
+	defer ur.db.lock.Unlock()
+
+	key := userKey{tenantId, subject}
+	if _, ok := ur.db.users[key]; !ok {
+		return utils.ErrUserNotFound
+	}
+	delete(ur.db.users, key)
+	return nil
+}
@@ -0,0 +1,181 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+var (
+	jpegExifHeader      = []byte("Exif\x00\x00")
+	jpegXMPHeader       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegPhotoshopHeader = []byte("Photoshop 3.0\x00")
+	pngSignature        = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// keywords of the PNG text chunks image generators write their prompt and settings in:
+// AUTOMATIC1111 and Forge, ComfyUI and InvokeAI
+var generationKeywords = map[string]bool{
+	"parameters":        true,
+	"prompt":            true,
+	"workflow":          true,
+	"invokeai_metadata": true,
+	"sd-metadata":       true,
+	"Dream":             true,
+}
+
+// readJPEG reads the APP1 and APP13 segments found before the image data.
+func readJPEG(data []byte, metadata *models.MediaMetadata) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return
+	}
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			return
+		}
+		marker := data[offset+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			offset++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			offset += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			// the metadata segments come before the scan
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			return
+		}
+		segment := data[offset+4 : offset+2+length]
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment, jpegExifHeader):
+			readExif(segment[len(jpegExifHeader):], metadata)
+		case marker == 0xE1 && bytes.HasPrefix(segment, jpegXMPHeader):
+			readXMP(segment[len(jpegXMPHeader):], metadata)
+		case marker == 0xED && bytes.HasPrefix(segment, jpegPhotoshopHeader):
+			readPhotoshop(segment[len(jpegPhotoshopHeader):], metadata)
+		}
+		offset += 2 + length
+	}
+}
+
+// readPNG reads the eXIf, text and tIME chunks.
+func readPNG(data []byte, metadata *models.MediaMetadata) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return
+	}
+	for offset := len(pngSignature); offset+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		kind := string(data[offset+4 : offset+8])
+		if length < 0 || offset+12+length > len(data) || kind == "IEND" {
+			return
+		}
+		chunk := data[offset+8 : offset+8+length]
+		offset += 12 + length
+
+		switch kind {
+		case "eXIf":
+			readExif(chunk, metadata)
+		case "tIME":
+			if len(chunk) == 7 {
+				modified := time.Date(int(binary.BigEndian.Uint16(chunk)), time.Month(chunk[2]), int(chunk[3]), int(chunk[4]), int(chunk[5]), int(chunk[6]), 0, time.UTC)
+				setTime(&metadata.ModifiedAt, &models.MetadataTime{Time: modified})
+			}
+		case "tEXt", "zTXt", "iTXt":
+			keyword, text, ok := pngText(kind, chunk)
+			if !ok {
+				continue
+			}
+			readPNGText(keyword, text, metadata)
+		}
+	}
+}
+
+// pngText decodes the keyword and text of a text chunk, inflating it when compressed.
+func pngText(kind string, chunk []byte) (string, string, bool) {
+	keyword, rest, found := bytes.Cut(chunk, []byte{0})
+	if !found {
+		return "", "", false
+	}
+	compressed := false
+	switch kind {
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		compressed, rest = true, rest[1:]
+	case "iTXt":
+		// compression flag and method, then the language tag and the translated keyword
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed = rest[0] == 1
+		parts := bytes.SplitN(rest[2:], []byte{0}, 3)
+		if len(parts) != 3 {
+			return "", "", false
+		}
+		rest = parts[2]
+	}
+	if compressed {
+		reader, err := zlib.NewReader(bytes.NewReader(rest))
+		if err != nil {
+			return "", "", false
+		}
+		defer reader.Close()
+		inflated, err := io.ReadAll(io.LimitReader(reader, maxInflatedText))
+		if err != nil {
+			return "", "", false
+		}
+		rest = inflated
+	}
+	return string(keyword), string(rest), true
+}
+
+func readPNGText(keyword string, text string, metadata *models.MediaMetadata) {
+	addSource(metadata, SOURCE_PNG)
+	switch {
+	case keyword == "XML:com.adobe.xmp":
+		readXMP([]byte(text), metadata)
+	case keyword == "Software":
+		setString(&metadata.Software, text)
+	case keyword == "Creation Time":
+		setTime(&metadata.CapturedAt, parseTime(text))
+	case generationKeywords[keyword], keyword == "Comment" && strings.Contains(text, "\"prompt\""):
+		// NovelAI writes its settings as JSON in the comment
+		setString(&metadata.GenerationParameters, truncate(keyword+": "+clean(text), maxGenerationParameters))
+	}
+}
+
+// readWebP reads the EXIF and XMP chunks of the RIFF container.
+func readWebP(data []byte, metadata *models.MediaMetadata) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return
+	}
+	for offset := 12; offset+8 <= len(data); {
+		kind := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if size < 0 || offset+8+size > len(data) {
+			return
+		}
+		chunk := data[offset+8 : offset+8+size]
+		// chunks are padded to an even size
+		offset += 8 + size + size%2
+
+		switch kind {
+		case "EXIF":
+			// some writers keep the JPEG header
+			readExif(bytes.TrimPrefix(chunk, jpegExifHeader), metadata)
+		case "XMP ":
+			readXMP(chunk, metadata)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// signal scores, the evidence of generation is strong, the one of editing weak as most pictures are edited
+const (
+	SCORE_AI_SOFTWARE           = 0.95
+	SCORE_AI_SOURCE_TYPE        = 0.95
+	SCORE_COMPOSITE_SOURCE_TYPE = 0.8
+	SCORE_GENERATION_PARAMETERS = 0.9
+	SCORE_TIMESTAMP_ORDER       = 0.6
+	SCORE_TIMESTAMP_FUTURE      = 0.6
+	SCORE_LOCATION_DISTANCE     = 0.6
+	SCORE_TIMESTAMP_MISMATCH    = 0.4
+	SCORE_EDITING_SOFTWARE      = 0.4
+	SCORE_EDITING_HISTORY       = 0.4
+	SCORE_LOCATION_NAME         = 0.4
+	SCORE_STRIPPED_EXIF         = 0.3
+)
+
+const (
+	// a position further than this from the declared location disagrees with it
+	maxLocationDistanceKm = 50
+	// dates without time zone may be off by this much from the zoned ones
+	localTimeTolerance = 14 * time.Hour
+	// the capture and the digitization of a camera picture happen within this
+	maxDigitizeDelay = time.Minute
+	earthRadiusKm    = 6371
+)
+
+// names the generators write in the software tags, lowercase
+var aiSoftware = []string{
+	"midjourney", "dall-e", "dall·e", "dalle", "stable diffusion", "stablediffusion", "sdxl", "comfyui",
+	"automatic1111", "invokeai", "novelai", "fooocus", "dreamstudio", "adobe firefly", "imagen", "leonardo.ai",
+	"runway", "sora", "ideogram", "nightcafe", "bing image creator", "chatgpt", "openai", "gpt-4o", "krea",
+}
+
+// names of the editors written in the software tags, lowercase
+var editingSoftware = []string{
+	"photoshop", "lightroom", "gimp", "affinity photo", "pixelmator", "snapseed", "facetune", "picsart",
+	"canva", "capture one", "darktable", "luminar", "after effects", "premiere", "final cut", "davinci resolve",
+}
+
+// IPTC digital source types of generated media, with the score of each
+var aiSourceTypes = map[string]float64{
+	"trainedalgorithmicmedia":              SCORE_AI_SOURCE_TYPE,
+	"algorithmicmedia":                     SCORE_AI_SOURCE_TYPE,
+	"compositewithtrainedalgorithmicmedia": SCORE_COMPOSITE_SOURCE_TYPE,
+}
+
+// coordinates declared as "latitude, longitude"
+var coordinatesPattern = regexp.MustCompile(`^\s*([+-]?\d{1,2}(?:\.\d+)?)\s*[,; ]\s*([+-]?\d{1,3}(?:\.\d+)?)\s*$`)
+
+// Detector looks for signs of generation or editing in the metadata of the content, and for
+// metadata disagreeing with the media it was uploaded as.
+type Detector struct{}
+
+func NewDetector() *Detector {
+	return &Detector{}
+}
+
+func (d *Detector) Name() string {
+	return "metadata"
+}
+
+func (d *Detector) Supports(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/webp", "video/mp4", "video/quicktime":
+		return true
+	}
+	return false
+}
+
+func (d *Detector) Detect(ctx context.Context, input *detectors.Input) (*detectors.Result, error) {
+	metadata := input.Metadata
+	if metadata == nil {
+		extracted, err := Extract(input.MimeType, input.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract metadata: %w", err)
+		}
+		metadata = extracted
+	}
+
+	var signals []models.Signal
+	signals = append(signals, softwareSignals(metadata)...)
+	signals = append(signals, timestampSignals(metadata, input.CreatedAt)...)
+	signals = append(signals, locationSignals(metadata, input.Location)...)
+	if metadata.Format == "jpeg" && !slices.Contains(metadata.Sources, SOURCE_EXIF) {
+		signals = append(signals, models.Signal{
+			Name:        "stripped_exif",
+			Score:       SCORE_STRIPPED_EXIF,
+			Explanation: "the JPEG has no EXIF metadata, cameras always write it",
+		})
+	}
+
+	// metadata only proves something when it is there, its absence isn't authenticity
+	result := &detectors.Result{Verdict: models.VERDICT_INCONCLUSIVE, Signals: signals}
+	for _, signal := range signals {
+		result.Score = math.Max(result.Score, signal.Score)
+	}
+	if result.Score >= detectors.SUSPICIOUS_THRESHOLD {
+		result.Verdict = detectors.VerdictFromScore(result.Score)
+	}
+	return result, nil
+}
+
+func softwareSignals(metadata *models.MediaMetadata) []models.Signal {
+	var signals []models.Signal
+	tools := []string{metadata.Software, metadata.CreatorTool}
+	for _, event := range metadata.History {
+		tools = append(tools, event.SoftwareAgent)
+	}
+	if tool, name := findTool(tools, aiSoftware); tool != "" {
+		signals = append(signals, models.Signal{
+			Name:        "ai_software",
+			Score:       SCORE_AI_SOFTWARE,
+			Explanation: fmt.Sprintf("the metadata names %s as the software that wrote the media (%q)", name, tool),
+		})
+	} else if tool, name := findTool(tools, editingSoftware); tool != "" {
+		signals = append(signals, models.Signal{
+			Name:        "editing_software",
+			Score:       SCORE_EDITING_SOFTWARE,
+			Explanation: fmt.Sprintf("the media went through %s (%q)", name, tool),
+		})
+	}
+
+	sourceType := strings.ToLower(metadata.DigitalSourceType)
+	// the source type is either a term or the URI of the IPTC vocabulary
+	sourceType = sourceType[strings.LastIndex(sourceType, "/")+1:]
+	if score, found := aiSourceTypes[sourceType]; found {
+		signals = append(signals, models.Signal{
+			Name:        "ai_source_type",
+			Score:       score,
+			Explanation: fmt.Sprintf("the IPTC digital source type is %s", metadata.DigitalSourceType),
+		})
+	}
+	if metadata.GenerationParameters != "" {
+		signals = append(signals, models.Signal{
+			Name:        "generation_parameters",
+			Score:       SCORE_GENERATION_PARAMETERS,
+			Explanation: "the content carries the prompt and settings of an image generator",
+		})
+	}
+
+	edits := 0
+	for _, event := range metadata.History {
+		if event.Action != "" && event.Action != "created" {
+			edits++
+		}
+	}
+	if edits > 0 {
+		signals = append(signals, models.Signal{
+			Name:        "editing_history",
+			Score:       SCORE_EDITING_HISTORY,
+			Explanation: fmt.Sprintf("the XMP history records %d edits after the creation", edits),
+		})
+	}
+	return signals
+}
+
+// findTool returns the first tool naming one of the known names, and that name.
+func findTool(tools []string, names []string) (string, string) {
+	for _, tool := range tools {
+		lower := strings.ToLower(tool)
+		for _, name := range names {
+			if strings.Contains(lower, name) {
+				return tool, name
+			}
+		}
+	}
+	return "", ""
+}
+
+func timestampSignals(metadata *models.MediaMetadata, uploadedAt time.Time) []models.Signal {
+	var signals []models.Signal
+	captured := metadata.CapturedAt
+	if captured != nil && !uploadedAt.IsZero() && after(captured, &models.MetadataTime{Time: uploadedAt}, 0) {
+		signals = append(signals, models.Signal{
+			Name:        "timestamp_future",
+			Score:       SCORE_TIMESTAMP_FUTURE,
+			Explanation: fmt.Sprintf("the media claims to be captured on %s, after it was uploaded", captured.Time.Format(time.RFC3339)),
+		})
+	}
+	if captured != nil && metadata.ModifiedAt != nil && after(captured, metadata.ModifiedAt, 0) {
+		signals = append(signals, models.Signal{
+			Name:        "timestamp_order",
+			Score:       SCORE_TIMESTAMP_ORDER,
+			Explanation: "the media was modified before it was captured",
+		})
+	}
+	digitized := metadata.DigitizedAt
+	if captured != nil && digitized != nil && (after(captured, digitized, maxDigitizeDelay) || after(digitized, captured, maxDigitizeDelay)) {
+		signals = append(signals, models.Signal{
+			Name:        "timestamp_mismatch",
+			Score:       SCORE_TIMESTAMP_MISMATCH,
+			Explanation: "the capture and digitization dates disagree, as when a picture is scanned or its dates are rewritten",
+		})
+	}
+	return signals
+}
+
+// after reports whether a is later than b by more than the tolerance, widened when one of them has no time zone.
+func after(a *models.MetadataTime, b *models.MetadataTime, tolerance time.Duration) bool {
+	if a.Local != b.Local {
+		tolerance += localTimeTolerance
+	}
+	return a.Time.Sub(b.Time) > tolerance
+}
+
+func locationSignals(metadata *models.MediaMetadata, location string) []models.Signal {
+	location = strings.TrimSpace(location)
+	if location == "" {
+		return nil
+	}
+	if latitude, longitude, ok := parseCoordinates(location); ok {
+		if metadata.GPS == nil {
+			return nil
+		}
+		distance := distanceKm(latitude, longitude, metadata.GPS.Latitude, metadata.GPS.Longitude)
+		if distance <= maxLocationDistanceKm {
+			return nil
+		}
+		return []models.Signal{{
+			Name:        "location_mismatch",
+			Score:       SCORE_LOCATION_DISTANCE,
+			Explanation: fmt.Sprintf("the GPS position of the content is %.0f km away from the declared location", distance),
+		}}
+	}
+
+	// a place name can only be compared with the place names of the metadata
+	lower := strings.ToLower(location)
+	places := []string{}
+	for _, place := range []string{metadata.City, metadata.Country} {
+		if place != "" {
+			places = append(places, place)
+		}
+	}
+	if len(places) == 0 {
+		return nil
+	}
+	for _, place := range places {
+		if strings.Contains(lower, strings.ToLower(place)) {
+			return nil
+		}
+	}
+	return []models.Signal{{
+		Name:        "location_mismatch",
+		Score:       SCORE_LOCATION_NAME,
+		Explanation: fmt.Sprintf("the metadata places the media in %s, not in %q", strings.Join(places, ", "), location),
+	}}
+}
+
+func parseCoordinates(location string) (float64, float64, bool) {
+	match := coordinatesPattern.FindStringSubmatch(location)
+	if match == nil {
+		return 0, 0, false
+	}
+	latitude, latErr := strconv.ParseFloat(match[1], 64)
+	longitude, lonErr := strconv.ParseFloat(match[2], 64)
+	if latErr != nil || lonErr != nil || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+		return 0, 0, false
+	}
+	return latitude, longitude, true
+}
+
+// distanceKm is the great-circle distance between two positions.
+func distanceKm(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat, dLon := toRadians(lat2-lat1), toRadians(lon2-lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
@@ -0,0 +1,97 @@
+package metadata
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/detectors"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+func TestDetector(t *testing.T) {
+	uploadedAt := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	at := func(day int, hour int, local bool) *models.MetadataTime {
+		return &models.MetadataTime{Time: time.Date(2024, time.May, day, hour, 0, 0, 0, time.UTC), Local: local}
+	}
+	camera := func() *models.MediaMetadata {
+		return &models.MediaMetadata{
+			Format:      "jpeg",
+			Sources:     []string{SOURCE_EXIF},
+			Make:        "Canon",
+			Model:       "Canon EOS R6",
+			CapturedAt:  at(4, 10, true),
+			DigitizedAt: at(4, 10, true),
+			GPS:         &models.GPSPosition{Latitude: 46.77, Longitude: 23.59},
+			City:        "Cluj-Napoca",
+			Country:     "Romania",
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		change   func(metadata *models.MediaMetadata)
+		location string
+		signals  []string
+		verdict  models.Verdict
+	}{
+		{"camera picture", func(metadata *models.MediaMetadata) {}, "Cluj-Napoca, Romania", nil, models.VERDICT_INCONCLUSIVE},
+		{"generator software", func(metadata *models.MediaMetadata) { metadata.Software = "Midjourney v6" }, "", []string{"ai_software"}, models.VERDICT_MANIPULATED},
+		{"generator in the history", func(metadata *models.MediaMetadata) {
+			metadata.History = []models.MetadataEvent{{Action: "created", SoftwareAgent: "Adobe Firefly"}}
+		}, "", []string{"ai_software"}, models.VERDICT_MANIPULATED},
+		{"generation parameters", func(metadata *models.MediaMetadata) { metadata.GenerationParameters = "prompt: {}" }, "", []string{"generation_parameters"}, models.VERDICT_MANIPULATED},
+		{"composite source type", func(metadata *models.MediaMetadata) {
+			metadata.DigitalSourceType = "http://cv.iptc.org/newscodes/digitalsourcetype/compositeWithTrainedAlgorithmicMedia"
+		}, "", []string{"ai_source_type"}, models.VERDICT_MANIPULATED},
+		{"edited", func(metadata *models.MediaMetadata) {
+			metadata.Software = "Adobe Photoshop 25.0"
+			metadata.History = []models.MetadataEvent{{Action: "created"}, {Action: "saved"}}
+		}, "", []string{"editing_software", "editing_history"}, models.VERDICT_INCONCLUSIVE},
+		{"stripped", func(metadata *models.MediaMetadata) { metadata.Sources = []string{SOURCE_XMP} }, "", []string{"stripped_exif"}, models.VERDICT_INCONCLUSIVE},
+		{"captured after the upload", func(metadata *models.MediaMetadata) {
+			metadata.CapturedAt = &models.MetadataTime{Time: uploadedAt.Add(48 * time.Hour)}
+			metadata.DigitizedAt = metadata.CapturedAt
+		}, "", []string{"timestamp_future"}, models.VERDICT_SUSPICIOUS},
+		{"modified before the capture", func(metadata *models.MediaMetadata) { metadata.ModifiedAt = at(3, 10, true) }, "", []string{"timestamp_order"}, models.VERDICT_SUSPICIOUS},
+		// a local date may be hours away from a zoned one
+		{"local and zoned dates", func(metadata *models.MediaMetadata) { metadata.ModifiedAt = at(4, 2, false) }, "", nil, models.VERDICT_INCONCLUSIVE},
+		{"digitized later", func(metadata *models.MediaMetadata) { metadata.DigitizedAt = at(20, 10, true) }, "", []string{"timestamp_mismatch"}, models.VERDICT_INCONCLUSIVE},
+		{"far from the declared position", func(metadata *models.MediaMetadata) {}, "44.43, 26.10", []string{"location_mismatch"}, models.VERDICT_SUSPICIOUS},
+		{"near the declared position", func(metadata *models.MediaMetadata) {}, "46.8;23.6", nil, models.VERDICT_INCONCLUSIVE},
+		{"another declared place", func(metadata *models.MediaMetadata) {}, "Paris", []string{"location_mismatch"}, models.VERDICT_INCONCLUSIVE},
+		{"place without metadata", func(metadata *models.MediaMetadata) { metadata.City, metadata.Country = "", "" }, "Paris", nil, models.VERDICT_INCONCLUSIVE},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			metadata := camera()
+			test.change(metadata)
+			result, err := NewDetector().Detect(context.Background(), &detectors.Input{MimeType: "image/jpeg", Location: test.location, CreatedAt: uploadedAt, Metadata: metadata})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, signal := range result.Signals {
+				names = append(names, signal.Name)
+			}
+			if !slices.Equal(names, test.signals) || result.Verdict != test.verdict {
+				t.Errorf("expected %v and %s, got %+v", test.signals, test.verdict, result)
+			}
+		})
+	}
+}
+
+func TestDetectorExtracts(t *testing.T) {
+	detector := NewDetector()
+	if !detector.Supports("video/quicktime") || detector.Supports("audio/mpeg") {
+		t.Fatal("unexpected supported types")
+	}
+	// without extracted metadata the detector reads the content itself
+	result, err := detector.Detect(context.Background(), &detectors.Input{MimeType: "image/jpeg", Data: testJPEG()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Verdict != models.VERDICT_MANIPULATED || result.Score != SCORE_COMPOSITE_SOURCE_TYPE {
+		t.Errorf("expected the composite source type to decide, got %+v", result)
+	}
+}
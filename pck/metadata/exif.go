@@ -0,0 +1,201 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// EXIF tags read, by IFD
+const (
+	tagMake       = 0x010F
+	tagModel      = 0x0110
+	tagSoftware   = 0x0131
+	tagDateTime   = 0x0132
+	tagExifIFD    = 0x8769
+	tagGPSIFD     = 0x8825
+	tagOriginal   = 0x9003
+	tagDigitized  = 0x9004
+	tagOffset     = 0x9010
+	tagOffsetOrig = 0x9011
+	tagOffsetDig  = 0x9012
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// TIFF field types read
+const (
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeSRational = 10
+)
+
+// a directory with more entries than this is corrupt
+const maxIFDEntries = 512
+
+var errInvalidTIFF = errors.New("invalid TIFF structure")
+
+var typeSizes = map[uint16]int{1: 1, typeASCII: 1, typeShort: 2, typeLong: 4, typeRational: 8, 6: 1, 7: 1, 8: 2, 9: 4, typeSRational: 8, 11: 4, 12: 8}
+
+type tiffValue struct {
+	kind  uint16
+	count int
+	raw   []byte
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// readExif reads the camera, dates and position of a TIFF structure, as embedded in JPEG, PNG and WebP.
+func readExif(data []byte, metadata *models.MediaMetadata) error {
+	if len(data) < 8 {
+		return errInvalidTIFF
+	}
+	reader := &tiffReader{data: data}
+	switch string(data[:4]) {
+	case "II*\x00":
+		reader.order = binary.LittleEndian
+	case "MM\x00*":
+		reader.order = binary.BigEndian
+	default:
+		return errInvalidTIFF
+	}
+
+	ifd0, err := reader.readIFD(reader.order.Uint32(data[4:8]))
+	if err != nil {
+		return err
+	}
+	addSource(metadata, SOURCE_EXIF)
+	setString(&metadata.Make, reader.ascii(ifd0[tagMake]))
+	setString(&metadata.Model, reader.ascii(ifd0[tagModel]))
+	setString(&metadata.Software, reader.ascii(ifd0[tagSoftware]))
+
+	var exif map[uint16]tiffValue
+	if offset, ok := reader.uint(ifd0[tagExifIFD]); ok {
+		// a broken sub-directory leaves the main one usable
+		exif, _ = reader.readIFD(offset)
+	}
+	setTime(&metadata.CapturedAt, withOffset(parseTime(reader.ascii(exif[tagOriginal])), reader.ascii(exif[tagOffsetOrig])))
+	setTime(&metadata.DigitizedAt, withOffset(parseTime(reader.ascii(exif[tagDigitized])), reader.ascii(exif[tagOffsetDig])))
+	setTime(&metadata.ModifiedAt, withOffset(parseTime(reader.ascii(ifd0[tagDateTime])), reader.ascii(exif[tagOffset])))
+
+	if offset, ok := reader.uint(ifd0[tagGPSIFD]); ok {
+		if gps, err := reader.readIFD(offset); err == nil && metadata.GPS == nil {
+			metadata.GPS = reader.position(gps)
+		}
+	}
+	return nil
+}
+
+func (r *tiffReader) readIFD(offset uint32) (map[uint16]tiffValue, error) {
+	start := int(offset)
+	if start < 8 || start+2 > len(r.data) {
+		return nil, errInvalidTIFF
+	}
+	count := int(r.order.Uint16(r.data[start:]))
+	if count > maxIFDEntries || start+2+count*12 > len(r.data) {
+		return nil, errInvalidTIFF
+	}
+
+	values := make(map[uint16]tiffValue, count)
+	for i := range count {
+		entry := r.data[start+2+i*12 : start+2+(i+1)*12]
+		kind := r.order.Uint16(entry[2:4])
+		size, known := typeSizes[kind]
+		if !known {
+			continue
+		}
+		n := int(r.order.Uint32(entry[4:8]))
+		length := size * n
+		if n < 0 || length/size != n {
+			continue
+		}
+		raw := entry[8:12]
+		if length > 4 {
+			valueOffset := int(r.order.Uint32(entry[8:12]))
+			if valueOffset < 0 || valueOffset+length > len(r.data) || valueOffset+length < valueOffset {
+				continue
+			}
+			raw = r.data[valueOffset : valueOffset+length]
+		}
+		values[r.order.Uint16(entry[0:2])] = tiffValue{kind: kind, count: n, raw: raw[:min(length, len(raw))]}
+	}
+	return values, nil
+}
+
+func (r *tiffReader) ascii(value tiffValue) string {
+	if value.kind != typeASCII {
+		return ""
+	}
+	return clean(string(value.raw))
+}
+
+func (r *tiffReader) uint(value tiffValue) (uint32, bool) {
+	switch {
+	case value.kind == typeLong && len(value.raw) >= 4:
+		return r.order.Uint32(value.raw), true
+	case value.kind == typeShort && len(value.raw) >= 2:
+		return uint32(r.order.Uint16(value.raw)), true
+	}
+	return 0, false
+}
+
+func (r *tiffReader) rationals(value tiffValue) []float64 {
+	if value.kind != typeRational && value.kind != typeSRational {
+		return nil
+	}
+	rationals := make([]float64, 0, value.count)
+	for i := 0; i+8 <= len(value.raw); i += 8 {
+		numerator, denominator := r.order.Uint32(value.raw[i:]), r.order.Uint32(value.raw[i+4:])
+		if denominator == 0 {
+			return nil
+		}
+		if value.kind == typeSRational {
+			rationals = append(rationals, float64(int32(numerator))/float64(int32(denominator)))
+		} else {
+			rationals = append(rationals, float64(numerator)/float64(denominator))
+		}
+	}
+	return rationals
+}
+
+// position reads the degrees, minutes and seconds of the GPS directory, nil when they are missing or out of range.
+func (r *tiffReader) position(gps map[uint16]tiffValue) *models.GPSPosition {
+	latitude, latOk := degrees(r.rationals(gps[tagGPSLatitude]), r.ascii(gps[tagGPSLatitudeRef]), "S")
+	longitude, lonOk := degrees(r.rationals(gps[tagGPSLongitude]), r.ascii(gps[tagGPSLongitudeRef]), "W")
+	if !latOk || !lonOk || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+		return nil
+	}
+	position := &models.GPSPosition{Latitude: latitude, Longitude: longitude}
+	if altitude := r.rationals(gps[tagGPSAltitude]); len(altitude) == 1 {
+		value := altitude[0]
+		// a reference of 1 is below sea level
+		if ref := gps[tagGPSAltitudeRef].raw; len(ref) > 0 && ref[0] == 1 {
+			value = -value
+		}
+		position.Altitude = &value
+	}
+	return position
+}
+
+func degrees(parts []float64, ref string, negative string) (float64, bool) {
+	if len(parts) != 3 {
+		return 0, false
+	}
+	value := parts[0] + parts[1]/60 + parts[2]/3600
+	if ref == negative {
+		value = -value
+	}
+	return value, true
+}
@@ -0,0 +1,105 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// IPTC-IIM datasets of the application record read
+const (
+	iptcKeywords           = 25
+	iptcDateCreated        = 55
+	iptcTimeCreated        = 60
+	iptcOriginatingProgram = 65
+	iptcCity               = 90
+	iptcCountry            = 101
+)
+
+// photoshopIPTC is the image resource of Photoshop holding the IPTC-IIM datasets.
+const photoshopIPTC = 0x0404
+
+var errInvalidIPTC = errors.New("invalid IPTC structure")
+
+// readPhotoshop finds the IPTC-IIM datasets among the image resources of a Photoshop APP13 segment.
+func readPhotoshop(data []byte, metadata *models.MediaMetadata) error {
+	for len(data) >= 12 {
+		if !bytes.HasPrefix(data, []byte("8BIM")) {
+			return errInvalidIPTC
+		}
+		id := binary.BigEndian.Uint16(data[4:6])
+		// the name is a Pascal string padded to an even length
+		nameLength := int(data[6]) + 1
+		nameLength += nameLength % 2
+		if 6+nameLength+4 > len(data) {
+			return errInvalidIPTC
+		}
+		size := int(binary.BigEndian.Uint32(data[6+nameLength:]))
+		start := 6 + nameLength + 4
+		if size < 0 || start+size > len(data) {
+			return errInvalidIPTC
+		}
+		if id == photoshopIPTC {
+			return readIPTC(data[start:start+size], metadata)
+		}
+		data = data[min(start+size+size%2, len(data)):]
+	}
+	return nil
+}
+
+// readIPTC reads the datasets of the IPTC-IIM application record, e.g. 2:25 keywords.
+func readIPTC(data []byte, metadata *models.MediaMetadata) error {
+	var date, clock string
+	for len(data) >= 5 {
+		if data[0] != 0x1C {
+			return errInvalidIPTC
+		}
+		record, dataset := data[1], data[2]
+		size := int(binary.BigEndian.Uint16(data[3:5]))
+		// extended datasets are larger than anything read here
+		if size&0x8000 != 0 || 5+size > len(data) {
+			return errInvalidIPTC
+		}
+		value := string(data[5 : 5+size])
+		data = data[5+size:]
+		if record != 2 {
+			continue
+		}
+		switch dataset {
+		case iptcKeywords:
+			metadata.Keywords = appendKeyword(metadata.Keywords, value)
+		case iptcDateCreated:
+			date = value
+		case iptcTimeCreated:
+			clock = value
+		case iptcOriginatingProgram:
+			setString(&metadata.Software, value)
+		case iptcCity:
+			setString(&metadata.City, value)
+		case iptcCountry:
+			setString(&metadata.Country, value)
+		}
+	}
+	addSource(metadata, SOURCE_IPTC)
+	setTime(&metadata.CapturedAt, iptcTime(date, clock))
+	return nil
+}
+
+// iptcTime combines the CCYYMMDD date and the optional HHMMSS±HHMM time of IPTC.
+func iptcTime(date string, clock string) *models.MetadataTime {
+	if len(date) != 8 {
+		return nil
+	}
+	if parsed, err := time.Parse("20060102150405-0700", date+clock); err == nil {
+		return &models.MetadataTime{Time: parsed.UTC()}
+	}
+	if len(clock) >= 6 {
+		if parsed, err := time.Parse("20060102150405", date+clock[:6]); err == nil {
+			return &models.MetadataTime{Time: parsed, Local: true}
+		}
+	}
+	return parseTime(date)
+}
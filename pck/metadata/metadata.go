@@ -0,0 +1,127 @@
+package metadata
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// metadata blocks a content may carry
+const (
+	SOURCE_EXIF      = "exif"
+	SOURCE_XMP       = "xmp"
+	SOURCE_IPTC      = "iptc"
+	SOURCE_PNG       = "png"
+	SOURCE_QUICKTIME = "quicktime"
+)
+
+const (
+	// generation parameters may hold whole workflows, only their beginning is kept
+	maxGenerationParameters = 4096
+	// compressed PNG text chunks are not inflated beyond this
+	maxInflatedText = 1 << 20
+)
+
+// ErrUnsupported is returned for the formats the extractor doesn't read, e.g. audio.
+var ErrUnsupported = errors.New("metadata can't be extracted from this format")
+
+// Extract reads the metadata of a JPEG, PNG, WebP, MP4 or QuickTime content. Malformed blocks
+// are skipped, the metadata holds whatever could be read from the others.
+func Extract(mimeType string, data []byte) (*models.MediaMetadata, error) {
+	metadata := &models.MediaMetadata{Sources: []string{}, ExtractedAt: time.Now().UTC()}
+	switch mimeType {
+	case "image/jpeg":
+		metadata.Format = "jpeg"
+		readJPEG(data, metadata)
+	case "image/png":
+		metadata.Format = "png"
+		readPNG(data, metadata)
+	case "image/webp":
+		metadata.Format = "webp"
+		readWebP(data, metadata)
+	case "video/mp4":
+		metadata.Format = "mp4"
+		readMP4(data, metadata)
+	case "video/quicktime":
+		metadata.Format = "quicktime"
+		readMP4(data, metadata)
+	default:
+		return nil, ErrUnsupported
+	}
+	return metadata, nil
+}
+
+// addSource records that a metadata block was found, once.
+func addSource(metadata *models.MediaMetadata, source string) {
+	for _, existing := range metadata.Sources {
+		if existing == source {
+			return
+		}
+	}
+	metadata.Sources = append(metadata.Sources, source)
+}
+
+// setString fills a field the blocks read before left empty, EXIF comes first and wins.
+func setString(field *string, value string) {
+	value = clean(value)
+	if *field == "" && value != "" {
+		*field = value
+	}
+}
+
+func setTime(field **models.MetadataTime, value *models.MetadataTime) {
+	if *field == nil && value != nil {
+		*field = value
+	}
+}
+
+// clean drops the padding and invalid characters the writers leave around strings.
+func clean(value string) string {
+	value = strings.ToValidUTF8(value, "")
+	return strings.TrimSpace(strings.Trim(value, "\x00"))
+}
+
+// truncate cuts a string to at most n bytes without splitting a character.
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
+
+// parseTime reads the dates written by EXIF, XMP, IPTC and the containers, with or without time zone.
+func parseTime(value string) *models.MetadataTime {
+	value = clean(value)
+	if value == "" || strings.HasPrefix(value, "0000") {
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05-0700", "2006-01-02T15:04Z07:00", "2006:01:02 15:04:05Z07:00", "2006-01-02 15:04:05Z07:00", "Mon, 02 Jan 2006 15:04:05 -0700", time.RFC1123} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &models.MetadataTime{Time: parsed.UTC()}
+		}
+	}
+	for _, layout := range []string{"2006:01:02 15:04:05", "2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02", "20060102"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &models.MetadataTime{Time: parsed, Local: true}
+		}
+	}
+	return nil
+}
+
+// withOffset applies an EXIF offset such as +02:00 to a local date.
+func withOffset(date *models.MetadataTime, offset string) *models.MetadataTime {
+	if date == nil || !date.Local {
+		return date
+	}
+	zoned, err := time.Parse("2006-01-02T15:04:05-07:00", date.Time.Format("2006-01-02T15:04:05")+clean(offset))
+	if err != nil {
+		return date
+	}
+	return &models.MetadataTime{Time: zoned.UTC()}
+}
@@ -0,0 +1,380 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+type tiffEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+func asciiEntry(tag uint16, value string) tiffEntry {
+	return tiffEntry{tag: tag, kind: typeASCII, count: uint32(len(value) + 1), value: append([]byte(value), 0)}
+}
+
+func rationalEntry(tag uint16, values ...uint32) tiffEntry {
+	raw := make([]byte, 0, len(values)*4)
+	for _, value := range values {
+		raw = binary.LittleEndian.AppendUint32(raw, value)
+	}
+	return tiffEntry{tag: tag, kind: typeRational, count: uint32(len(values) / 2), value: raw}
+}
+
+// tiff lays out a little-endian TIFF structure with its Exif and GPS directories after the main one.
+func tiff(ifd0 []tiffEntry, exif []tiffEntry, gps []tiffEntry) []byte {
+	size := func(entries []tiffEntry) uint32 {
+		n := uint32(2 + 12*len(entries) + 4)
+		for _, entry := range entries {
+			if len(entry.value) > 4 {
+				n += uint32(len(entry.value))
+			}
+		}
+		return n
+	}
+	pointer := func(tag uint16, offset uint32) tiffEntry {
+		return tiffEntry{tag: tag, kind: typeLong, count: 1, value: binary.LittleEndian.AppendUint32(nil, offset)}
+	}
+	ifd0 = slices.Clone(ifd0)
+	if exif != nil {
+		ifd0 = append(ifd0, pointer(tagExifIFD, 0))
+	}
+	if gps != nil {
+		ifd0 = append(ifd0, pointer(tagGPSIFD, 0))
+	}
+	exifOffset := 8 + size(ifd0)
+	gpsOffset := exifOffset + size(exif)
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case tagExifIFD:
+			ifd0[i] = pointer(tagExifIFD, exifOffset)
+		case tagGPSIFD:
+			ifd0[i] = pointer(tagGPSIFD, gpsOffset)
+		}
+	}
+
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	for _, entries := range [][]tiffEntry{ifd0, exif, gps} {
+		if entries == nil {
+			continue
+		}
+		valuesOffset := uint32(len(data)) + 2 + 12*uint32(len(entries)) + 4
+		var values []byte
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(entries)))
+		for _, entry := range entries {
+			data = binary.LittleEndian.AppendUint16(data, entry.tag)
+			data = binary.LittleEndian.AppendUint16(data, entry.kind)
+			data = binary.LittleEndian.AppendUint32(data, entry.count)
+			if len(entry.value) > 4 {
+				data = binary.LittleEndian.AppendUint32(data, valuesOffset+uint32(len(values)))
+				values = append(values, entry.value...)
+			} else {
+				data = append(data, entry.value...)
+				data = append(data, make([]byte, 4-len(entry.value))...)
+			}
+		}
+		data = binary.LittleEndian.AppendUint32(data, 0)
+		data = append(data, values...)
+	}
+	return data
+}
+
+func cameraExif() []byte {
+	return tiff(
+		[]tiffEntry{asciiEntry(tagMake, "Canon"), asciiEntry(tagModel, "Canon EOS R6"), asciiEntry(tagSoftware, "Firmware 1.8.1"), asciiEntry(tagDateTime, "2024:05:04 12:00:00")},
+		[]tiffEntry{asciiEntry(tagOriginal, "2024:05:04 10:30:00"), asciiEntry(tagOffsetOrig, "+02:00"), asciiEntry(tagDigitized, "2024:05:04 10:30:00")},
+		[]tiffEntry{asciiEntry(tagGPSLatitudeRef, "N"), rationalEntry(tagGPSLatitude, 46, 1, 46, 1, 1200, 100), asciiEntry(tagGPSLongitudeRef, "E"), rationalEntry(tagGPSLongitude, 23, 1, 35, 1, 0, 1)},
+	)
+}
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"
+    xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:Iptc4xmpExt="http://iptc.org/std/Iptc4xmpExt/2008-02-29/"
+    xmp:CreatorTool="Adobe Photoshop 25.0 (Windows)"
+    xmp:ModifyDate="2024-05-06T09:00:00+02:00"
+    photoshop:City="Cluj-Napoca"
+    exif:GPSLatitude="44,25.8N"
+    exif:GPSLongitude="26,6.1E">
+   <Iptc4xmpExt:DigitalSourceType>http://cv.iptc.org/newscodes/digitalsourcetype/compositeWithTrainedAlgorithmicMedia</Iptc4xmpExt:DigitalSourceType>
+   <dc:subject>
+    <rdf:Bag><rdf:li>cat</rdf:li><rdf:li>Cat</rdf:li><rdf:li>sunset</rdf:li></rdf:Bag>
+   </dc:subject>
+   <xmpMM:History>
+    <rdf:Seq>
+     <rdf:li stEvt:action="created" stEvt:softwareAgent="Adobe Photoshop 25.0 (Windows)" stEvt:when="2024-05-06T08:00:00+02:00"/>
+     <rdf:li rdf:parseType="Resource">
+      <stEvt:action>saved</stEvt:action>
+      <stEvt:when>2024-05-06T09:00:00+02:00</stEvt:when>
+      <stEvt:softwareAgent>Adobe Photoshop 25.0 (Windows)</stEvt:softwareAgent>
+      <stEvt:changed>/</stEvt:changed>
+     </rdf:li>
+    </rdf:Seq>
+   </xmpMM:History>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func iptcDataset(dataset byte, value string) []byte {
+	return append([]byte{0x1C, 2, dataset, byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+func photoshopIPTCResource() []byte {
+	var iptc []byte
+	iptc = append(iptc, iptcDataset(iptcKeywords, "sunset")...)
+	iptc = append(iptc, iptcDataset(iptcKeywords, "beach")...)
+	iptc = append(iptc, iptcDataset(iptcOriginatingProgram, "Photo Mechanic")...)
+	iptc = append(iptc, iptcDataset(iptcCountry, "Romania")...)
+	resource := append([]byte("Photoshop 3.0\x008BIM\x04\x04\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(iptc)))...)
+	return append(resource, iptc...)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	return append([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+}
+
+func testJPEG() []byte {
+	data := []byte{0xFF, 0xD8}
+	data = append(data, jpegSegment(0xE1, append(slices.Clone(jpegExifHeader), cameraExif()...))...)
+	data = append(data, jpegSegment(0xE1, append(slices.Clone(jpegXMPHeader), testXMP...))...)
+	data = append(data, jpegSegment(0xED, photoshopIPTCResource())...)
+	data = append(data, jpegSegment(0xDA, []byte{1, 2, 3})...)
+	return append(data, 0x55, 0xFF, 0xD9)
+}
+
+func pngChunk(kind string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// testPNG encodes a pixel and inserts the given chunks after the header.
+func testPNG(t *testing.T, chunks ...[]byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buffer.Bytes()
+	// the signature and the 25 bytes of the IHDR chunk
+	data := slices.Clone(encoded[:33])
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return append(data, encoded[33:]...)
+}
+
+func deflate(t *testing.T, text string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zlib.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func mp4Box(kind string, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	return append(append(binary.BigEndian.AppendUint32(nil, uint32(8+len(body))), kind...), body...)
+}
+
+func quickTimeItem(kind string, value string) []byte {
+	return mp4Box(kind, []byte{byte(len(value) >> 8), byte(len(value)), 0x15, 0xC7}, []byte(value))
+}
+
+func testMP4() []byte {
+	created := uint32(time.Date(2024, time.May, 4, 8, 30, 0, 0, time.UTC).Sub(mp4Epoch) / time.Second)
+	header := binary.BigEndian.AppendUint32(make([]byte, 4), created)
+	header = binary.BigEndian.AppendUint32(header, created+60)
+	header = append(header, make([]byte, 88)...)
+
+	var keys []byte
+	keys = binary.BigEndian.AppendUint32(keys, 0)
+	keys = binary.BigEndian.AppendUint32(keys, 2)
+	keys = append(keys, mp4Box("mdta", []byte("com.apple.quicktime.make"))...)
+	keys = append(keys, mp4Box("mdta", []byte("com.apple.quicktime.creationdate"))...)
+	value := func(text string) []byte {
+		return mp4Box("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(text))
+	}
+	items := mp4Box("ilst",
+		mp4Box("\x00\x00\x00\x01", value("Apple")),
+		mp4Box("\x00\x00\x00\x02", value("2024-05-04T10:30:00+0200")),
+	)
+
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("qt  \x00\x00\x00\x00")),
+		mp4Box("moov",
+			mp4Box("mvhd", header),
+			mp4Box("udta", quickTimeItem("\xa9xyz", "+46.7700+023.5900+350.000/"), quickTimeItem("\xa9mod", "iPhone 15")),
+			mp4Box("meta", mp4Box("hdlr", make([]byte, 24)), mp4Box("keys", keys), items),
+		),
+		mp4Box("uuid", mp4XMPUUID, []byte(testXMP)),
+		mp4Box("mdat", []byte{1, 2, 3, 4}),
+	}, nil)
+}
+
+func TestExtractJPEG(t *testing.T) {
+	metadata, err := Extract("image/jpeg", testJPEG())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(metadata.Sources, []string{SOURCE_EXIF, SOURCE_XMP, SOURCE_IPTC}) {
+		t.Errorf("unexpected sources %v", metadata.Sources)
+	}
+	// EXIF is read first and wins over the other blocks
+	if metadata.Make != "Canon" || metadata.Model != "Canon EOS R6" || metadata.Software != "Firmware 1.8.1" || metadata.CreatorTool != "Adobe Photoshop 25.0 (Windows)" {
+		t.Errorf("unexpected tools %+v", metadata)
+	}
+	if captured := metadata.CapturedAt; captured == nil || captured.Local || !captured.Time.Equal(time.Date(2024, time.May, 4, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("expected the capture date with its offset, got %+v", captured)
+	}
+	if digitized := metadata.DigitizedAt; digitized == nil || !digitized.Local || digitized.Time != time.Date(2024, time.May, 4, 10, 30, 0, 0, time.UTC) {
+		t.Errorf("expected a local digitization date, got %+v", digitized)
+	}
+	if gps := metadata.GPS; gps == nil || math.Abs(gps.Latitude-46.77) > 1e-6 || math.Abs(gps.Longitude-(23+35.0/60)) > 1e-6 {
+		t.Errorf("expected the EXIF position, got %+v", gps)
+	}
+	if metadata.City != "Cluj-Napoca" || metadata.Country != "Romania" {
+		t.Errorf("unexpected place %q, %q", metadata.City, metadata.Country)
+	}
+	if !slices.Equal(metadata.Keywords, []string{"cat", "sunset", "beach"}) {
+		t.Errorf("unexpected keywords %v", metadata.Keywords)
+	}
+	if metadata.DigitalSourceType != "http://cv.iptc.org/newscodes/digitalsourcetype/compositeWithTrainedAlgorithmicMedia" {
+		t.Errorf("unexpected source type %q", metadata.DigitalSourceType)
+	}
+	if len(metadata.History) != 2 || metadata.History[0].Action != "created" || metadata.History[1].Action != "saved" || metadata.History[1].Changed != "/" || metadata.History[1].When == nil {
+		t.Errorf("unexpected history %+v", metadata.History)
+	}
+
+	// the metadata survives being stored as JSON
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["capturedAt"] != "2024-05-04T08:30:00Z" || decoded["digitizedAt"] != "2024-05-04T10:30:00" {
+		t.Errorf("unexpected dates in %s", encoded)
+	}
+}
+
+func TestExtractPNG(t *testing.T) {
+	data := testPNG(t,
+		pngChunk("tEXt", []byte("parameters\x00a cat on a beach\nSteps: 20, Sampler: Euler a, CFG scale: 7")),
+		pngChunk("zTXt", append([]byte("Software\x00\x00"), deflate(t, "ComfyUI")...)),
+		pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), testXMP...)),
+		pngChunk("tIME", []byte{0x07, 0xE8, 5, 6, 7, 0, 0}),
+	)
+	metadata, err := Extract("image/png", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.GenerationParameters != "parameters: a cat on a beach\nSteps: 20, Sampler: Euler a, CFG scale: 7" {
+		t.Errorf("unexpected generation parameters %q", metadata.GenerationParameters)
+	}
+	if metadata.Software != "ComfyUI" || metadata.City != "Cluj-Napoca" || !slices.Contains(metadata.Sources, SOURCE_XMP) {
+		t.Errorf("expected the text chunks to be read, got %+v", metadata)
+	}
+	if metadata.ModifiedAt == nil || !metadata.ModifiedAt.Time.Equal(time.Date(2024, time.May, 6, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the tIME date, got %+v", metadata.ModifiedAt)
+	}
+
+	long := testPNG(t, pngChunk("zTXt", append([]byte("workflow\x00\x00"), deflate(t, string(bytes.Repeat([]byte("é"), maxGenerationParameters)))...)))
+	metadata, err = Extract("image/png", long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata.GenerationParameters) > maxGenerationParameters || metadata.GenerationParameters[len(metadata.GenerationParameters)-2:] != "é" {
+		t.Errorf("expected the parameters to be cut between characters, got %d bytes", len(metadata.GenerationParameters))
+	}
+}
+
+func TestExtractWebP(t *testing.T) {
+	exif := append(slices.Clone(jpegExifHeader), cameraExif()...)
+	// an odd chunk is padded, the next one is found after the padding
+	if len(exif)%2 == 0 {
+		exif = append(exif, 0)
+	}
+	chunk := func(kind string, data []byte) []byte {
+		chunk := append(binary.LittleEndian.AppendUint32([]byte(kind), uint32(len(data))), data...)
+		if len(data)%2 == 1 {
+			chunk = append(chunk, 0)
+		}
+		return chunk
+	}
+	body := append([]byte("WEBP"), chunk("VP8X", make([]byte, 10))...)
+	body = append(body, chunk("EXIF", exif)...)
+	body = append(body, chunk("XMP ", []byte(testXMP))...)
+	data := append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+
+	metadata, err := Extract("image/webp", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Make != "Canon" || metadata.CreatorTool != "Adobe Photoshop 25.0 (Windows)" || !slices.Equal(metadata.Sources, []string{SOURCE_EXIF, SOURCE_XMP}) {
+		t.Errorf("expected the EXIF and XMP chunks to be read, got %+v", metadata)
+	}
+}
+
+func TestExtractMP4(t *testing.T) {
+	metadata, err := Extract("video/quicktime", testMP4())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Make != "Apple" || metadata.Model != "iPhone 15" || metadata.CreatorTool != "Adobe Photoshop 25.0 (Windows)" {
+		t.Errorf("unexpected tools %+v", metadata)
+	}
+	// the capture date of the keys wins over the one of the movie header
+	if captured := metadata.CapturedAt; captured == nil || !captured.Time.Equal(time.Date(2024, time.May, 4, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected capture date %+v", captured)
+	}
+	if modified := metadata.ModifiedAt; modified == nil || !modified.Time.Equal(time.Date(2024, time.May, 4, 8, 31, 0, 0, time.UTC)) {
+		t.Errorf("unexpected modification date %+v", modified)
+	}
+	if gps := metadata.GPS; gps == nil || gps.Latitude != 46.77 || gps.Longitude != 23.59 || gps.Altitude == nil || *gps.Altitude != 350 {
+		t.Errorf("expected the ISO 6709 position, got %+v", gps)
+	}
+	if !slices.Equal(metadata.Sources, []string{SOURCE_QUICKTIME, SOURCE_XMP}) {
+		t.Errorf("unexpected sources %v", metadata.Sources)
+	}
+}
+
+func TestExtractMalformed(t *testing.T) {
+	if _, err := Extract("audio/mpeg", []byte("ID3")); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	// whatever was cut off, the extractor reads what it can without failing
+	for mimeType, data := range map[string][]byte{"image/jpeg": testJPEG(), "image/png": testPNG(t, pngChunk("eXIf", cameraExif())), "video/mp4": testMP4()} {
+		for n := range len(data) {
+			if _, err := Extract(mimeType, data[:n]); err != nil {
+				t.Fatalf("%s cut at %d: %v", mimeType, n, err)
+			}
+		}
+	}
+}
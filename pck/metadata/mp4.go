@@ -0,0 +1,255 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// the uuid box Adobe writes the XMP packet of MP4 files in
+var mp4XMPUUID = []byte{0xBE, 0x7A, 0xCF, 0xCB, 0x97, 0xA9, 0x42, 0xE8, 0x9C, 0x71, 0x99, 0x94, 0x91, 0xE3, 0xAF, 0xAC}
+
+// the dates of the movie header count the seconds since 1904
+var mp4Epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// ISO 6709 positions as written by cameras and phones, e.g. +48.8584+002.2945+035.000/
+var iso6709Pattern = regexp.MustCompile(`^([+-]\d{1,2}(?:\.\d+)?)([+-]\d{1,3}(?:\.\d+)?)([+-]\d+(?:\.\d+)?)?`)
+
+// readMP4 reads the movie header, the user data, the metadata keys and the XMP box of an MP4 or QuickTime file.
+func readMP4(data []byte, metadata *models.MediaMetadata) {
+	walkBoxes(data, func(kind string, body []byte) {
+		switch kind {
+		case "moov":
+			readMovie(body, metadata)
+		case "uuid":
+			if bytes.HasPrefix(body, mp4XMPUUID) {
+				readXMP(body[len(mp4XMPUUID):], metadata)
+			}
+		}
+	})
+}
+
+func readMovie(data []byte, metadata *models.MediaMetadata) {
+	walkBoxes(data, func(kind string, body []byte) {
+		switch kind {
+		case "mvhd":
+			readMovieHeader(body, metadata)
+		case "udta":
+			readUserData(body, metadata)
+		case "meta":
+			readMetadataKeys(body, metadata)
+		}
+	})
+}
+
+// readMovieHeader reads the creation and modification dates of the movie, left at zero by many encoders.
+func readMovieHeader(data []byte, metadata *models.MediaMetadata) {
+	var created, modified uint64
+	switch {
+	case len(data) >= 20 && data[0] == 1:
+		created, modified = binary.BigEndian.Uint64(data[4:]), binary.BigEndian.Uint64(data[12:])
+	case len(data) >= 12 && data[0] == 0:
+		created, modified = uint64(binary.BigEndian.Uint32(data[4:])), uint64(binary.BigEndian.Uint32(data[8:]))
+	default:
+		return
+	}
+	addSource(metadata, SOURCE_QUICKTIME)
+	setTime(&metadata.CapturedAt, mp4Time(created))
+	setTime(&metadata.ModifiedAt, mp4Time(modified))
+}
+
+func mp4Time(seconds uint64) *models.MetadataTime {
+	// anything beyond a few centuries is garbage
+	if seconds == 0 || seconds > math.MaxInt32*4 {
+		return nil
+	}
+	return &models.MetadataTime{Time: mp4Epoch.Add(time.Duration(seconds) * time.Second)}
+}
+
+// readUserData reads the QuickTime text items of the user data, e.g. ©too, and the iTunes style list some muxers nest in it.
+func readUserData(data []byte, metadata *models.MediaMetadata) {
+	walkBoxes(data, func(kind string, body []byte) {
+		switch kind {
+		case "meta":
+			readMetadataKeys(body, metadata)
+		case "XMP_":
+			readXMP(body, metadata)
+		default:
+			if value, ok := quickTimeText(body); ok {
+				setUserData(kind, value, metadata)
+			}
+		}
+	})
+}
+
+func setUserData(kind string, value string, metadata *models.MediaMetadata) {
+	switch kind {
+	case "\xa9too", "\xa9swr":
+		addSource(metadata, SOURCE_QUICKTIME)
+		setString(&metadata.Software, value)
+	case "\xa9mak":
+		addSource(metadata, SOURCE_QUICKTIME)
+		setString(&metadata.Make, value)
+	case "\xa9mod":
+		addSource(metadata, SOURCE_QUICKTIME)
+		setString(&metadata.Model, value)
+	case "\xa9day":
+		addSource(metadata, SOURCE_QUICKTIME)
+		// the user data date is the one of the capture, the movie header one may be the muxing date
+		if captured := parseTime(value); captured != nil {
+			metadata.CapturedAt = captured
+		}
+	case "\xa9xyz":
+		addSource(metadata, SOURCE_QUICKTIME)
+		if metadata.GPS == nil {
+			metadata.GPS = parseISO6709(value)
+		}
+	}
+}
+
+// quickTimeText decodes an international text item: a 16 bit size and language code followed by the text.
+func quickTimeText(data []byte) (string, bool) {
+	if len(data) < 4 {
+		return "", false
+	}
+	size := int(binary.BigEndian.Uint16(data))
+	if 4+size > len(data) {
+		return "", false
+	}
+	return clean(string(data[4 : 4+size])), true
+}
+
+// readMetadataKeys reads a meta box: its item list is either indexed by the names of a keys box,
+// as written by Apple and Android, or by the four character codes of iTunes.
+func readMetadataKeys(data []byte, metadata *models.MediaMetadata) {
+	// the ISO meta box is a full box, the QuickTime one isn't
+	if len(data) >= 8 && string(data[4:8]) != "hdlr" {
+		data = data[4:]
+	}
+	var keys []string
+	walkBoxes(data, func(kind string, body []byte) {
+		if kind == "keys" {
+			keys = readKeys(body)
+		}
+	})
+	walkBoxes(data, func(kind string, body []byte) {
+		if kind != "ilst" {
+			return
+		}
+		walkBoxes(body, func(item string, body []byte) {
+			value, ok := itemValue(body)
+			if !ok {
+				return
+			}
+			index := int(binary.BigEndian.Uint32([]byte(item)))
+			if index >= 1 && index <= len(keys) {
+				setKey(keys[index-1], value, metadata)
+				return
+			}
+			setUserData(item, value, metadata)
+		})
+	})
+}
+
+func readKeys(data []byte) []string {
+	if len(data) < 8 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint32(data[4:]))
+	data = data[8:]
+	keys := make([]string, 0, min(count, 256))
+	for range count {
+		if len(data) < 8 {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 8 || size > len(data) {
+			break
+		}
+		keys = append(keys, string(data[8:size]))
+		data = data[size:]
+	}
+	return keys
+}
+
+// itemValue decodes the data box of a list item when it holds UTF-8 text.
+func itemValue(data []byte) (string, bool) {
+	value, ok := "", false
+	walkBoxes(data, func(kind string, body []byte) {
+		// a type of 1 is UTF-8, after the type comes a locale
+		if kind == "data" && len(body) >= 8 && binary.BigEndian.Uint32(body) == 1 && !ok {
+			value, ok = clean(string(body[8:])), true
+		}
+	})
+	return value, ok
+}
+
+func setKey(key string, value string, metadata *models.MediaMetadata) {
+	addSource(metadata, SOURCE_QUICKTIME)
+	switch key {
+	case "com.apple.quicktime.make":
+		setString(&metadata.Make, value)
+	case "com.apple.quicktime.model":
+		setString(&metadata.Model, value)
+	case "com.apple.quicktime.software":
+		setString(&metadata.Software, value)
+	case "com.apple.quicktime.creationdate":
+		if captured := parseTime(value); captured != nil {
+			metadata.CapturedAt = captured
+		}
+	case "com.apple.quicktime.location.ISO6709":
+		if metadata.GPS == nil {
+			metadata.GPS = parseISO6709(value)
+		}
+	}
+}
+
+// parseISO6709 reads a position in decimal degrees, nil when it can't be read or is out of range.
+func parseISO6709(value string) *models.GPSPosition {
+	match := iso6709Pattern.FindStringSubmatch(clean(value))
+	if match == nil {
+		return nil
+	}
+	latitude, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || math.Abs(latitude) > 90 {
+		return nil
+	}
+	longitude, err := strconv.ParseFloat(match[2], 64)
+	if err != nil || math.Abs(longitude) > 180 {
+		return nil
+	}
+	position := &models.GPSPosition{Latitude: latitude, Longitude: longitude}
+	if altitude, err := strconv.ParseFloat(match[3], 64); err == nil {
+		position.Altitude = &altitude
+	}
+	return position
+}
+
+// walkBoxes calls visit with the type and body of each box of a level, stopping at the first malformed one.
+func walkBoxes(data []byte, visit func(kind string, body []byte)) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		kind := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			// the box extends to the end of the file
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return
+		}
+		visit(kind, data[header:size])
+		data = data[size:]
+	}
+}
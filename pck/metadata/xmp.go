@@ -0,0 +1,223 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// XMP namespaces read
+const (
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsXMP       = "http://ns.adobe.com/xap/1.0/"
+	nsXMPMM     = "http://ns.adobe.com/xap/1.0/mm/"
+	nsEvent     = "http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+	nsTIFF      = "http://ns.adobe.com/tiff/1.0/"
+	nsEXIF      = "http://ns.adobe.com/exif/1.0/"
+	nsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsIPTCExt   = "http://iptc.org/std/Iptc4xmpExt/2008-02-29/"
+)
+
+// xmpReader walks the RDF of an XMP packet. Properties are written either as attributes of
+// rdf:Description or as elements, arrays as rdf:li items of an rdf:Bag, rdf:Seq or rdf:Alt.
+type xmpReader struct {
+	metadata *models.MediaMetadata
+	stack    []xml.Name
+	text     strings.Builder
+	// index of the history event the properties of the stEvt namespace belong to, -1 before the first
+	event int
+}
+
+// readXMP reads the tools, dates, position, keywords, source type and history of an XMP packet.
+func readXMP(data []byte, metadata *models.MediaMetadata) error {
+	reader := &xmpReader{metadata: metadata, event: -1}
+	// a position needs both its coordinates, even when the packet is cut short
+	defer func() {
+		if metadata.GPS != nil && (math.IsNaN(metadata.GPS.Latitude) || math.IsNaN(metadata.GPS.Longitude)) {
+			metadata.GPS = nil
+		}
+	}()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			reader.start(token)
+		case xml.CharData:
+			reader.text.Write(token)
+		case xml.EndElement:
+			reader.end()
+		}
+	}
+	addSource(metadata, SOURCE_XMP)
+	return nil
+}
+
+func (x *xmpReader) start(element xml.StartElement) {
+	x.stack = append(x.stack, element.Name)
+	x.text.Reset()
+	// every item of the history is an event
+	if element.Name.Space == nsRDF && element.Name.Local == "li" && x.property() == (xml.Name{Space: nsXMPMM, Local: "History"}) {
+		x.metadata.History = append(x.metadata.History, models.MetadataEvent{})
+		x.event = len(x.metadata.History) - 1
+	}
+	for _, attr := range element.Attr {
+		if attr.Name.Space != nsRDF && attr.Name.Space != "xmlns" && attr.Name.Space != "" {
+			x.set(attr.Name, attr.Value)
+		}
+	}
+}
+
+func (x *xmpReader) end() {
+	if value := strings.TrimSpace(x.text.String()); value != "" {
+		x.set(x.property(), value)
+	}
+	x.text.Reset()
+	x.stack = x.stack[:len(x.stack)-1]
+}
+
+// property is the innermost element that is not RDF syntax, the one an rdf:li belongs to.
+func (x *xmpReader) property() xml.Name {
+	for i := len(x.stack) - 1; i >= 0; i-- {
+		if x.stack[i].Space != nsRDF {
+			return x.stack[i]
+		}
+	}
+	return xml.Name{}
+}
+
+func (x *xmpReader) set(name xml.Name, value string) {
+	metadata := x.metadata
+	switch name.Space {
+	case nsEvent:
+		if x.event < 0 {
+			return
+		}
+		event := &metadata.History[x.event]
+		switch name.Local {
+		case "action":
+			event.Action = clean(value)
+		case "softwareAgent":
+			event.SoftwareAgent = clean(value)
+		case "when":
+			event.When = parseTime(value)
+		case "changed":
+			event.Changed = clean(value)
+		}
+	case nsXMP:
+		switch name.Local {
+		case "CreatorTool":
+			setString(&metadata.CreatorTool, value)
+		case "CreateDate":
+			setTime(&metadata.CapturedAt, parseTime(value))
+		case "ModifyDate":
+			setTime(&metadata.ModifiedAt, parseTime(value))
+		}
+	case nsTIFF:
+		switch name.Local {
+		case "Make":
+			setString(&metadata.Make, value)
+		case "Model":
+			setString(&metadata.Model, value)
+		case "Software":
+			setString(&metadata.Software, value)
+		}
+	case nsEXIF:
+		switch name.Local {
+		case "DateTimeOriginal":
+			setTime(&metadata.CapturedAt, parseTime(value))
+		case "DateTimeDigitized":
+			setTime(&metadata.DigitizedAt, parseTime(value))
+		case "GPSLatitude", "GPSLongitude":
+			x.setCoordinate(name.Local, value)
+		}
+	case nsPhotoshop:
+		switch name.Local {
+		case "DateCreated":
+			setTime(&metadata.CapturedAt, parseTime(value))
+		case "City":
+			setString(&metadata.City, value)
+		case "Country":
+			setString(&metadata.Country, value)
+		}
+	case nsDC:
+		if name.Local == "subject" {
+			metadata.Keywords = appendKeyword(metadata.Keywords, value)
+		}
+	case nsIPTCExt:
+		if name.Local == "DigitalSourceType" {
+			setString(&metadata.DigitalSourceType, value)
+		}
+	}
+}
+
+// setCoordinate fills the GPS position once both its coordinates were read.
+func (x *xmpReader) setCoordinate(name string, value string) {
+	coordinate, ok := parseXMPCoordinate(value)
+	if !ok {
+		return
+	}
+	if x.metadata.GPS == nil {
+		x.metadata.GPS = &models.GPSPosition{Latitude: math.NaN(), Longitude: math.NaN()}
+	}
+	if name == "GPSLatitude" && math.IsNaN(x.metadata.GPS.Latitude) && math.Abs(coordinate) <= 90 {
+		x.metadata.GPS.Latitude = coordinate
+	}
+	if name == "GPSLongitude" && math.IsNaN(x.metadata.GPS.Longitude) && math.Abs(coordinate) <= 180 {
+		x.metadata.GPS.Longitude = coordinate
+	}
+}
+
+// parseXMPCoordinate reads the "DDD,MM,SSk" and "DDD,MM.mmk" forms of XMP, k being N, S, E or W.
+func parseXMPCoordinate(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return 0, false
+	}
+	direction := value[len(value)-1]
+	parts := strings.Split(value[:len(value)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	coordinate := 0.0
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil || number < 0 {
+			return 0, false
+		}
+		coordinate += number / math.Pow(60, float64(i))
+	}
+	switch direction {
+	case 'N', 'E':
+		return coordinate, true
+	case 'S', 'W':
+		return -coordinate, true
+	}
+	return 0, false
+}
+
+func appendKeyword(keywords []string, keyword string) []string {
+	keyword = clean(keyword)
+	if keyword == "" {
+		return keywords
+	}
+	for _, existing := range keywords {
+		if strings.EqualFold(existing, keyword) {
+			return keywords
+		}
+	}
+	return append(keywords, keyword)
+}
@@ -0,0 +1,144 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// storedArtifact is the JSON of an artifact in the detector_results table, the key included.
+type storedArtifact struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Key         string `json:"key"`
+}
+
+type analysisRepository struct {
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+}
+
+func NewAnalysisRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.AnalysisRepository {
+	return &analysisRepository{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+func (ar *analysisRepository) GetByMediaID(ctx context.Context, mediaId string) (*models.Analysis, error) {
+	var analysis models.Analysis
+	var provenance []byte
+	err := ar.pool.QueryRow(ctx, "SELECT mediaId, status, score, verdict, provenance, error, createdAt, updatedAt FROM media_analysis WHERE mediaId = $1", mediaId).Scan(&analysis.MediaId, &analysis.Status, &analysis.Score, &analysis.Verdict, &provenance, &analysis.Error, &analysis.CreatedAt, &analysis.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrAnalysisNotFound
+		}
+		ar.logger.Error("failed to get analysis by media id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get analysis by media id: %w", err)
+	}
+	// the column is NULL for the formats manifests aren't looked for in
+	if provenance != nil {
+		if err := json.Unmarshal(provenance, &analysis.Provenance); err != nil {
+			return nil, fmt.Errorf("failed to decode provenance: %w", err)
+		}
+	}
+
+	rows, err := ar.pool.Query(ctx, "SELECT detector, score, verdict, signals, artifacts, error FROM detector_results WHERE mediaId = $1 ORDER BY detector", mediaId)
+	if err != nil {
+		ar.logger.Error("failed to get detector results", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get detector results: %w", err)
+	}
+	defer rows.Close()
+
+	analysis.Results = []models.DetectorResult{}
+	for rows.Next() {
+		var result models.DetectorResult
+		var signals, artifacts []byte
+		err := rows.Scan(&result.Detector, &result.Score, &result.Verdict, &signals, &artifacts, &result.Error)
+		if err != nil {
+			ar.logger.Error("failed to scan detector result row", slog.Any("error", err))
+			return nil, fmt.Errorf("failed to scan detector result row: %w", err)
+		}
+		if err := json.Unmarshal(signals, &result.Signals); err != nil {
+			return nil, fmt.Errorf("failed to decode detector signals: %w", err)
+		}
+		var stored []storedArtifact
+		if err := json.Unmarshal(artifacts, &stored); err != nil {
+			return nil, fmt.Errorf("failed to decode detector artifacts: %w", err)
+		}
+		for _, artifact := range stored {
+			result.Artifacts = append(result.Artifacts, models.Artifact{Name: artifact.Name, ContentType: artifact.ContentType, Key: artifact.Key})
+		}
+		analysis.Results = append(analysis.Results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		ar.logger.Error("error occurred during rows iteration", slog.Any("error", err))
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	return &analysis, nil
+}
+
+func (ar *analysisRepository) Save(ctx context.Context, analysis *models.Analysis) error {
+	tx, err := ar.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var provenance []byte
+	if analysis.Provenance != nil {
+		if provenance, err = json.Marshal(analysis.Provenance); err != nil {
+			return fmt.Errorf("failed to encode provenance: %w", err)
+		}
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO media_analysis (mediaId, status, score, verdict, provenance, error, createdAt, updatedAt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (mediaId) DO UPDATE SET status = $2, score = $3, verdict = $4, provenance = $5, error = $6, createdAt = $7, updatedAt = $8`,
+		analysis.MediaId, analysis.Status, analysis.Score, analysis.Verdict, provenance, analysis.Error, analysis.CreatedAt, analysis.UpdatedAt)
+	if err != nil {
+		ar.logger.Error("failed to save analysis", slog.Any("error", err))
+		return fmt.Errorf("failed to save analysis: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM detector_results WHERE mediaId = $1", analysis.MediaId)
+	if err != nil {
+		ar.logger.Error("failed to clear detector results", slog.Any("error", err))
+		return fmt.Errorf("failed to clear detector results: %w", err)
+	}
+
+	for _, result := range analysis.Results {
+		signals, err := json.Marshal(result.Signals)
+		if err != nil {
+			return fmt.Errorf("failed to encode detector signals: %w", err)
+		}
+		stored := make([]storedArtifact, 0, len(result.Artifacts))
+		for _, artifact := range result.Artifacts {
+			stored = append(stored, storedArtifact{Name: artifact.Name, ContentType: artifact.ContentType, Key: artifact.Key})
+		}
+		artifacts, err := json.Marshal(stored)
+		if err != nil {
+			return fmt.Errorf("failed to encode detector artifacts: %w", err)
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO detector_results (mediaId, detector, score, verdict, signals, artifacts, error) VALUES ($1, $2, $3, $4, $5, $6, $7)", analysis.MediaId, result.Detector, result.Score, result.Verdict, signals, artifacts, result.Error)
+		if err != nil {
+			ar.logger.Error("failed to save detector result", slog.Any("error", err))
+			return fmt.Errorf("failed to save detector result: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit analysis: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type apiKeyRepository struct {
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+}
+
+func NewApiKeyRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.ApiKeyRepository {
+	return &apiKeyRepository{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+const apiKeyColumns = "id, name, tenantId, subject, scopes, salt, hash, createdAt, lastUsedAt, revokedAt"
+
+// apiKeyFields returns the scan destinations matching apiKeyColumns.
+func apiKeyFields(key *models.ApiKey) []interface{} {
+	return []interface{}{&key.Id, &key.Name, &key.TenantId, &key.Subject, &key.Scopes, &key.Salt, &key.Hash, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt}
+}
+
+func (kr *apiKeyRepository) GetByID(ctx context.Context, id string) (*models.ApiKey, error) {
+	var key models.ApiKey
+	// the key is looked up by its id to verify it, its tenant is only known from the row
+	err := inTenant(ctx, kr.pool, systemTenant, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1", id).Scan(apiKeyFields(&key)...)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrApiKeyNotFound
+		}
+		kr.logger.Error("failed to get api key by id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get api key by id: %w", err)
+	}
+	return &key, nil
+}
+
+func (kr *apiKeyRepository) List(ctx context.Context, tenantId string) ([]models.ApiKey, error) {
+	keys := []models.ApiKey{}
+	err := inTenant(ctx, kr.pool, tenantId, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE tenantId = $1 ORDER BY createdAt DESC, id", tenantId)
+		if err != nil {
+			return fmt.Errorf("failed to list api keys: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key models.ApiKey
+			if err := rows.Scan(apiKeyFields(&key)...); err != nil {
+				return fmt.Errorf("failed to scan api key row: %w", err)
+			}
+			keys = append(keys, key)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error occurred during rows iteration: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		kr.logger.Error("failed to list api keys", slog.Any("error", err))
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (kr *apiKeyRepository) Create(ctx context.Context, key *models.ApiKey) error {
+	_, err := execInTenant(ctx, kr.pool, key.TenantId, "INSERT INTO api_keys ("+apiKeyColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)", apiKeyFields(key)...)
+	if err != nil {
+		kr.logger.Error("failed to create api key", slog.Any("error", err))
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	return nil
+}
+
+func (kr *apiKeyRepository) Revoke(ctx context.Context, tenantId string, id string, revokedAt time.Time) error {
+	tag, err := execInTenant(ctx, kr.pool, tenantId, "UPDATE api_keys SET revokedAt = COALESCE(revokedAt, $1) WHERE id = $2 AND tenantId = $3", revokedAt, id, tenantId)
+	if err != nil {
+		kr.logger.Error("failed to revoke api key", slog.Any("error", err))
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrApiKeyNotFound
+	}
+	return nil
+}
+
+func (kr *apiKeyRepository) UpdateLastUsed(ctx context.Context, tenantId string, id string, lastUsedAt time.Time) error {
+	tag, err := execInTenant(ctx, kr.pool, tenantId, "UPDATE api_keys SET lastUsedAt = $1 WHERE id = $2 AND tenantId = $3", lastUsedAt, id, tenantId)
+	if err != nil {
+		kr.logger.Error("failed to update api key last use", slog.Any("error", err))
+		return fmt.Errorf("failed to update api key last use: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrApiKeyNotFound
+	}
+	return nil
+}
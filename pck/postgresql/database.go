@@ -2,46 +2,66 @@ package postgresql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/cosmintimis/deepfake-guardian-api/internal/config"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var dbConnection *pgx.Conn
-
-func InitDB() (*pgx.Conn, error) {
+// InitDB opens the connection pool shared by every repository. Pool sizing is
+// configured through the DATABASE_URL parameters, e.g. ?pool_max_conns=20.
+func InitDB(ctx context.Context) (*pgxpool.Pool, error) {
 	globalConfig := config.GetConfig()
-	newConn, err := pgx.Connect(context.Background(), globalConfig.DatabaseUrl)
+	if globalConfig.DatabaseUrl == "" {
+		return nil, errors.New("missing DATABASE_URL")
+	}
+	pool, err := pgxpool.New(ctx, globalConfig.DatabaseUrl)
 	if err != nil {
+		return nil, fmt.Errorf("failed to create database pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Assign the new connection to the global variable // TODO: remove global variable
-	dbConnection = newConn
-
-	// SQL statement to create the `media` table if it doesn't exist
-	createMediaTableSQL := `
-        CREATE TABLE IF NOT EXISTS media (
-            id TEXT PRIMARY KEY NOT NULL,         
-            title TEXT NOT NULL,                
-            description TEXT,                   
-            location TEXT,                     
-            type TEXT NOT NULL,                 
-            mimeType TEXT NOT NULL,               
-            size INTEGER NOT NULL,               
-            tags TEXT,                          
-            mediaData TEXT NOT NULL         
-        );
-    `
-	_, err = newConn.Exec(context.Background(), createMediaTableSQL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create media table: %w", err)
-	}
+	return pool, nil
+}
+
+// systemTenant is the app.tenant_id of the jobs of the system, the row level security
+// policies of the tenant tables let it reach every tenant.
+const systemTenant = "*"
 
-	return newConn, nil
+// inTenant runs fn in a transaction whose row level security reaches the records of the tenant.
+func inTenant(ctx context.Context, pool *pgxpool.Pool, tenantId string, fn func(tx pgx.Tx) error) error {
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		// the setting is local to the transaction, it never leaks to the next user of the connection
+		_, err := tx.Exec(ctx, "SELECT set_config('app.tenant_id', $1, true)", tenantId)
+		if err != nil {
+			return fmt.Errorf("failed to set the tenant: %w", err)
+		}
+		return fn(tx)
+	})
 }
 
-func GetDBConnection() *pgx.Conn {
-	return dbConnection
+// execInTenant runs a single statement on the records of the tenant.
+func execInTenant(ctx context.Context, pool *pgxpool.Pool, tenantId string, sql string, arguments ...interface{}) (pgconn.CommandTag, error) {
+	var tag pgconn.CommandTag
+	err := inTenant(ctx, pool, tenantId, func(tx pgx.Tx) error {
+		var err error
+		tag, err = tx.Exec(ctx, sql, arguments...)
+		return err
+	})
+	return tag, err
+}
+
+// scopeTenant is the tenant a scope reaches for row level security, SCOPE_ALL reaches them all.
+func scopeTenant(scope repositories.Scope) string {
+	if scope.All && scope.TenantId == "" {
+		return systemTenant
+	}
+	return scope.TenantId
 }
@@ -0,0 +1,179 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// eventsChannel is the channel every replica listens to
+	eventsChannel = "media_events"
+	// eventsLockKey is the advisory lock keeping the notifications in the order of the sequence
+	eventsLockKey = 4_263_115_002
+	// NOTIFY payloads must be shorter than 8000 bytes
+	maxEventPayload = 7999
+	// a replica that lost its listening connection waits this long before listening again
+	eventsReconnectDelay = time.Second
+)
+
+// eventPayload carries the fields of an event only the replicas need along the event itself.
+type eventPayload struct {
+	*events.Event
+	TenantId string `json:"tenantId"`
+	OwnerId  string `json:"ownerId"`
+}
+
+type eventBus struct {
+	logger    *slog.Logger
+	pool      *pgxpool.Pool
+	lock      sync.RWMutex
+	listeners []func(event *events.Event)
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewEventBus shares the events between the replicas with LISTEN/NOTIFY. The events of this
+// replica come back through the database as well, so every replica sees them in the same order.
+// Events published while a replica is reconnecting are lost to its clients, they notice the gap
+// in the sequence.
+func NewEventBus(logger *slog.Logger, pool *pgxpool.Pool) events.Bus {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &eventBus{
+		logger: logger,
+		pool:   pool,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (b *eventBus) Subscribe(listener func(event *events.Event)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.listeners = append(b.listeners, listener)
+}
+
+func (b *eventBus) Publish(ctx context.Context, event *events.Event) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	return pgx.BeginFunc(ctx, b.pool, func(tx pgx.Tx) error {
+		// notifications are delivered in the order their transactions commit, which nextval alone
+		// doesn't follow. Clients take a sequence out of order for a gap and reload what they show,
+		// so the lock is held until the commit. Postgres already serializes the commits of the
+		// transactions that notify, the lock only adds the nextval of this short transaction.
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", eventsLockKey); err != nil {
+			return fmt.Errorf("failed to lock the event sequence: %w", err)
+		}
+		var sequence int64
+		if err := tx.QueryRow(ctx, "SELECT nextval('event_sequence')").Scan(&sequence); err != nil {
+			return fmt.Errorf("failed to number event: %w", err)
+		}
+		event.Sequence = uint64(sequence)
+
+		payload, err := encodeEvent(event)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", eventsChannel, payload); err != nil {
+			return fmt.Errorf("failed to notify event: %w", err)
+		}
+		return nil
+	})
+}
+
+func (b *eventBus) Start() {
+	b.wg.Add(1)
+	go b.listen()
+}
+
+func (b *eventBus) Stop() {
+	b.cancel()
+	b.wg.Wait()
+}
+
+func (b *eventBus) listen() {
+	defer b.wg.Done()
+	for {
+		err := b.receive()
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.logger.Error("stopped receiving events, listening again", slog.Any("error", err))
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-time.After(eventsReconnectDelay):
+		}
+	}
+}
+
+// receive hands the notifications over to the listeners until the connection breaks.
+func (b *eventBus) receive() error {
+	conn, err := b.pool.Acquire(b.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	// a listening connection must not go back to the pool
+	listening := conn.Hijack()
+	defer listening.Close(context.Background())
+
+	if _, err := listening.Exec(b.ctx, "LISTEN "+eventsChannel); err != nil {
+		return fmt.Errorf("failed to listen for events: %w", err)
+	}
+	for {
+		notification, err := listening.WaitForNotification(b.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to wait for events: %w", err)
+		}
+		event, err := decodeEvent(notification.Payload)
+		if err != nil {
+			b.logger.Error("failed to decode event", slog.String("payload", notification.Payload), slog.Any("error", err))
+			continue
+		}
+		b.deliver(event)
+	}
+}
+
+// encodeEvent is the NOTIFY payload of the event.
+func encodeEvent(event *events.Event) (string, error) {
+	payload, err := json.Marshal(eventPayload{Event: event, TenantId: event.TenantId, OwnerId: event.OwnerId})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode event: %w", err)
+	}
+	if len(payload) > maxEventPayload {
+		return "", fmt.Errorf("event of %d bytes is too large to be notified", len(payload))
+	}
+	return string(payload), nil
+}
+
+// decodeEvent reads a NOTIFY payload back, the data of the event is left as decoded JSON.
+func decodeEvent(payload string) (*events.Event, error) {
+	var decoded eventPayload
+	if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+		return nil, err
+	}
+	if decoded.Event == nil {
+		return nil, errors.New("missing event")
+	}
+	decoded.Event.TenantId = decoded.TenantId
+	decoded.Event.OwnerId = decoded.OwnerId
+	return decoded.Event, nil
+}
+
+func (b *eventBus) deliver(event *events.Event) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, listener := range b.listeners {
+		listener(event)
+	}
+}
@@ -0,0 +1,250 @@
+package postgresql
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestEventPayload(t *testing.T) {
+	event := &events.Event{
+		Type:      events.ANALYSIS_COMPLETED,
+		Sequence:  42,
+		MediaId:   "a",
+		Actor:     events.ACTOR_SYSTEM,
+		Timestamp: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+		Data:      map[string]any{"status": "completed", "score": 0.75},
+		TenantId:  "acme",
+		OwnerId:   "alice",
+	}
+	payload, err := encodeEvent(event)
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+	decoded, err := decodeEvent(payload)
+	if err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	// the tenant and the owner are hidden from the clients, the replicas still need them
+	if decoded.TenantId != "acme" || decoded.OwnerId != "alice" {
+		t.Errorf("expected the tenant and the owner to come along, got %q and %q", decoded.TenantId, decoded.OwnerId)
+	}
+	data, ok := decoded.Data.(map[string]any)
+	if decoded.Type != event.Type || decoded.Sequence != 42 || decoded.MediaId != "a" || decoded.Actor != events.ACTOR_SYSTEM ||
+		!decoded.Timestamp.Equal(event.Timestamp) || !ok || data["status"] != "completed" || data["score"] != 0.75 {
+		t.Errorf("expected the event back, got %+v", decoded)
+	}
+
+	for _, invalid := range []string{``, `not json`, `{}`, `{"tenantId": "acme"}`} {
+		if _, err := decodeEvent(invalid); err == nil {
+			t.Errorf("expected an error decoding %q", invalid)
+		}
+	}
+}
+
+func TestEventPayloadTooLarge(t *testing.T) {
+	event := &events.Event{Type: events.MEDIA_UPDATED, MediaId: "a", Data: map[string]string{"title": strings.Repeat("x", maxEventPayload)}}
+	if _, err := encodeEvent(event); err == nil {
+		t.Error("expected a payload over the NOTIFY limit to be refused")
+	}
+
+	event.Data = map[string]string{"title": strings.Repeat("x", maxEventPayload-200)}
+	if payload, err := encodeEvent(event); err != nil || len(payload) > maxEventPayload {
+		t.Errorf("expected a payload of %d bytes at most, got %d (%v)", maxEventPayload, len(payload), err)
+	}
+}
+
+// testPool connects to the database of TEST_DATABASE_URL, the tests needing one are skipped without it.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if err := MigrateUp(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), pool); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// eventRecorder keeps the events a listener of the bus received.
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []*events.Event
+}
+
+func (r *eventRecorder) record(event *events.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) received() []*events.Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*events.Event{}, r.events...)
+}
+
+// newTestBus starts a bus and waits until it listens, the events published before are lost to it.
+func newTestBus(t *testing.T, pool *pgxpool.Pool) (events.Bus, *eventRecorder) {
+	t.Helper()
+	bus := NewEventBus(slog.New(slog.NewTextHandler(io.Discard, nil)), pool)
+	recorder := &eventRecorder{}
+	bus.Subscribe(recorder.record)
+	bus.Start()
+	t.Cleanup(bus.Stop)
+	waitForEvent(t, bus, recorder)
+	return bus, recorder
+}
+
+// waitForEvent publishes probes until the recorder receives one of them.
+func waitForEvent(t *testing.T, bus events.Bus, recorder *eventRecorder) {
+	t.Helper()
+	probe := "probe-" + uuid.NewString()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		for _, event := range recorder.received() {
+			if event.MediaId == probe {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the bus never received an event")
+		}
+		if err := bus.Publish(context.Background(), &events.Event{Type: events.MEDIA_UPDATED, MediaId: probe}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// sequencesOf waits for the count events of the media and returns their sequences in the order received.
+func sequencesOf(t *testing.T, recorder *eventRecorder, mediaId string, count int) []uint64 {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var sequences []uint64
+		for _, event := range recorder.received() {
+			if event.MediaId != mediaId {
+				continue
+			}
+			if event.TenantId != "acme" || event.OwnerId != "alice" {
+				t.Errorf("expected the tenant and the owner to come along, got %+v", event)
+			}
+			sequences = append(sequences, event.Sequence)
+		}
+		if len(sequences) >= count {
+			return sequences
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d events, got %d", count, len(sequences))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestEventBusSequence(t *testing.T) {
+	pool := testPool(t)
+	// two replicas sharing the database
+	first, firstRecorder := newTestBus(t, pool)
+	second, secondRecorder := newTestBus(t, pool)
+
+	var wg sync.WaitGroup
+	for _, bus := range []events.Bus{first, second} {
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 25 {
+					event := &events.Event{Type: events.ANALYSIS_PROGRESS, MediaId: "a", TenantId: "acme", OwnerId: "alice"}
+					if err := bus.Publish(context.Background(), event); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	var orders [][]uint64
+	for _, recorder := range []*eventRecorder{firstRecorder, secondRecorder} {
+		order := sequencesOf(t, recorder, "a", 200)
+		// the advisory lock keeps the notifications in the order of the sequence
+		for i := 1; i < len(order); i++ {
+			if order[i] <= order[i-1] {
+				t.Fatalf("event %d came after event %d", order[i], order[i-1])
+			}
+		}
+		orders = append(orders, order)
+	}
+	if len(orders[0]) != len(orders[1]) {
+		t.Fatalf("the replicas received %d and %d events", len(orders[0]), len(orders[1]))
+	}
+	for i := range orders[0] {
+		if orders[0][i] != orders[1][i] {
+			t.Fatalf("the replicas received the events in different orders at %d: %d and %d", i, orders[0][i], orders[1][i])
+		}
+	}
+}
+
+// publishAll publishes count events split between the given number of publishers, and returns
+// how long they took.
+func publishAll(t *testing.T, bus events.Bus, publishers int, count int) time.Duration {
+	t.Helper()
+	started := time.Now()
+	var wg sync.WaitGroup
+	for range publishers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range count / publishers {
+				event := &events.Event{Type: events.ANALYSIS_PROGRESS, MediaId: "load", TenantId: "acme", OwnerId: "alice"}
+				if err := bus.Publish(context.Background(), event); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return time.Since(started)
+}
+
+func TestEventBusConcurrentPublishers(t *testing.T) {
+	pool := testPool(t)
+	bus, _ := newTestBus(t, pool)
+
+	// the lock spans a transaction of two statements, publishers waiting on it must not be
+	// slower than a single one publishing everything
+	serial := publishAll(t, bus, 1, 400)
+	concurrent := publishAll(t, bus, 16, 400)
+	if concurrent > serial*3/2 {
+		t.Errorf("16 publishers took %s to publish what a single one published in %s", concurrent, serial)
+	}
+}
+
+func TestEventBusReconnect(t *testing.T) {
+	pool := testPool(t)
+	bus, recorder := newTestBus(t, pool)
+
+	// drop the listening connection as a failover would
+	_, err := pool.Exec(context.Background(), "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE query = 'LISTEN "+eventsChannel+"' AND pid <> pg_backend_pid()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, bus, recorder)
+}
@@ -0,0 +1,124 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// legacyBatchSize bounds the legacy media held in memory at once.
+const legacyBatchSize = 20
+
+type legacyMedia struct {
+	id        string
+	mediaData string
+}
+
+// HasLegacyMediaData reports whether the database was created before the blob store existed and
+// still has the `mediaData` column, MoveLegacyMediaData moves its content.
+func HasLegacyMediaData(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	var legacyColumnExists bool
+	err := pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM information_schema.columns WHERE table_name = 'media' AND column_name = 'mediadata')").Scan(&legacyColumnExists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up legacy media column: %w", err)
+	}
+	return legacyColumnExists, nil
+}
+
+// MoveLegacyMediaData moves the base64 content out of the `mediaData` column a batch at a time,
+// every media is committed once its content is stored so an interrupted run resumes where it
+// stopped. The column is dropped once no media is left in it.
+func MoveLegacyMediaData(ctx context.Context, logger *slog.Logger, pool *pgxpool.Pool, blobStore repositories.BlobStore) error {
+	legacyColumnExists, err := HasLegacyMediaData(ctx, pool)
+	if err != nil || !legacyColumnExists {
+		return err
+	}
+
+	// the legacy media of every tenant are moved, their rows are only visible to the system
+	after := ""
+	for {
+		batch, err := legacyMediaBatch(ctx, pool, after)
+		if err != nil {
+			return err
+		}
+		for _, media := range batch {
+			if err := moveLegacyMedia(ctx, logger, pool, blobStore, media); err != nil {
+				return err
+			}
+			after = media.id
+		}
+		if len(batch) < legacyBatchSize {
+			break
+		}
+	}
+
+	return inTenant(ctx, pool, systemTenant, func(tx pgx.Tx) error {
+		var remaining int
+		if err := tx.QueryRow(ctx, "SELECT count(*) FROM media WHERE contentKey = ''").Scan(&remaining); err != nil {
+			return fmt.Errorf("failed to count legacy media: %w", err)
+		}
+		if remaining > 0 {
+			return fmt.Errorf("%d legacy media are left, the legacy media column is kept", remaining)
+		}
+		if _, err := tx.Exec(ctx, "ALTER TABLE media DROP COLUMN mediaData"); err != nil {
+			return fmt.Errorf("failed to drop legacy media column: %w", err)
+		}
+		return nil
+	})
+}
+
+// legacyMediaBatch returns the next legacy media after the given id, in the order of their ids.
+func legacyMediaBatch(ctx context.Context, pool *pgxpool.Pool, after string) ([]legacyMedia, error) {
+	var batch []legacyMedia
+	err := inTenant(ctx, pool, systemTenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT id, mediaData FROM media WHERE contentKey = '' AND id > $1 ORDER BY id LIMIT $2", after, legacyBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to get legacy media: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var media legacyMedia
+			if err := rows.Scan(&media.id, &media.mediaData); err != nil {
+				return fmt.Errorf("failed to scan legacy media row: %w", err)
+			}
+			batch = append(batch, media)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error occurred during rows iteration: %w", err)
+		}
+		return nil
+	})
+	return batch, err
+}
+
+// moveLegacyMedia stores the content of a media and points the media at it, the blob is deleted
+// again when the media can't be updated.
+func moveLegacyMedia(ctx context.Context, logger *slog.Logger, pool *pgxpool.Pool, blobStore repositories.BlobStore, media legacyMedia) error {
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(media.mediaData))
+	info, err := blobStore.Put(ctx, repositories.NewContentKey(), decoder)
+	if err != nil {
+		return fmt.Errorf("failed to move content of media %s: %w", media.id, err)
+	}
+	tag, err := execInTenant(ctx, pool, systemTenant, "UPDATE media SET contentKey = $1, checksum = $2, size = $3 WHERE id = $4 AND contentKey = ''", info.Key, info.Checksum, info.Size, media.id)
+	if err != nil || tag.RowsAffected() == 0 {
+		if deleteErr := blobStore.Delete(context.WithoutCancel(ctx), info.Key); deleteErr != nil {
+			logger.Error("failed to delete moved legacy content", slog.String("id", media.id), slog.Any("error", deleteErr))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update media %s: %w", media.id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		// deleted or moved by another run meanwhile
+		logger.Warn("legacy media changed while its content was moved", slog.String("id", media.id))
+		return nil
+	}
+	logger.Info("moved legacy media content to blob store", slog.String("id", media.id))
+	return nil
+}
@@ -0,0 +1,103 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/filesystem"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// failingBlobStore fails the Put calls once the given number of them went through.
+type failingBlobStore struct {
+	repositories.BlobStore
+	allowed atomic.Int32
+	keys    []string
+}
+
+func (f *failingBlobStore) Put(ctx context.Context, key string, content io.Reader) (*repositories.BlobInfo, error) {
+	if f.allowed.Add(-1) < 0 {
+		return nil, errors.New("bucket unreachable")
+	}
+	f.keys = append(f.keys, key)
+	return f.BlobStore.Put(ctx, key, content)
+}
+
+func TestMoveLegacyMediaData(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// a database created before the blob store, with more media than a batch
+	prefix := "legacy-" + uuid.NewString()
+	count := legacyBatchSize*2 + 5
+	err := inTenant(ctx, pool, systemTenant, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "ALTER TABLE media ADD COLUMN IF NOT EXISTS mediaData TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		for i := range count {
+			content := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("content %d", i)))
+			_, err := tx.Exec(ctx, "INSERT INTO media (id, title, type, mimeType, size, mediaData) VALUES ($1, 'Legacy', 'image', 'image/png', 0, $2)", fmt.Sprintf("%s-%03d", prefix, i), content)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		execInTenant(ctx, pool, systemTenant, "DELETE FROM media WHERE id LIKE $1", prefix+"%")
+	})
+
+	filesystemStore, err := filesystem.NewBlobStore(logger, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the run stops in the second batch, what was moved stays moved
+	blobStore := &failingBlobStore{BlobStore: filesystemStore}
+	blobStore.allowed.Store(int32(legacyBatchSize + 3))
+	if err := MoveLegacyMediaData(ctx, logger, pool, blobStore); err == nil {
+		t.Fatal("expected the run to fail with the blob store")
+	}
+	if legacy, err := HasLegacyMediaData(ctx, pool); err != nil || !legacy {
+		t.Fatalf("expected the legacy column to be kept while media are left in it (%v)", err)
+	}
+
+	// the next run resumes, no content is uploaded twice
+	blobStore.allowed.Store(int32(count))
+	if err := MoveLegacyMediaData(ctx, logger, pool, blobStore); err != nil {
+		t.Fatalf("failed to move legacy media: %v", err)
+	}
+	if len(blobStore.keys) != count {
+		t.Errorf("expected %d blobs, got %d", count, len(blobStore.keys))
+	}
+	if legacy, err := HasLegacyMediaData(ctx, pool); err != nil || legacy {
+		t.Fatalf("expected the legacy column to be dropped (%v)", err)
+	}
+
+	var key string
+	err = inTenant(ctx, pool, systemTenant, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SELECT contentKey FROM media WHERE id = $1", prefix+"-007").Scan(&key)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := filesystemStore.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("failed to read moved content: %v", err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); string(data) != "content 7" {
+		t.Errorf("expected the content of the media, got %q", data)
+	}
+}
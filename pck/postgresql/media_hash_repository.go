@@ -0,0 +1,93 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type mediaHashRepository struct {
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+}
+
+// NewMediaHashRepository stores the unsigned hashes in BIGINT columns, bit for bit.
+func NewMediaHashRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.MediaHashRepository {
+	return &mediaHashRepository{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+func (hr *mediaHashRepository) Save(ctx context.Context, mediaId string, hashes []models.MediaHash) error {
+	err := pgx.BeginFunc(ctx, hr.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DELETE FROM media_hashes WHERE mediaId = $1", mediaId); err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			_, err := tx.Exec(ctx, "INSERT INTO media_hashes (mediaId, frame, pHash, dHash) VALUES ($1, $2, $3, $4)",
+				mediaId, hash.Frame, int64(hash.PHash), int64(hash.DHash))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == foreignKeyViolation {
+			return utils.ErrMediaNotFound
+		}
+		hr.logger.Error("failed to save media hashes", slog.Any("error", err))
+		return fmt.Errorf("failed to save media hashes: %w", err)
+	}
+	return nil
+}
+
+func (hr *mediaHashRepository) GetByMediaID(ctx context.Context, mediaId string) ([]models.MediaHash, error) {
+	return hr.query(ctx, "WHERE h.mediaId = $1", mediaId)
+}
+
+func (hr *mediaHashRepository) List(ctx context.Context) ([]models.MediaHash, error) {
+	return hr.query(ctx, "")
+}
+
+// query joins the hashes with their media, under the system tenant to reach every tenant.
+func (hr *mediaHashRepository) query(ctx context.Context, where string, args ...any) ([]models.MediaHash, error) {
+	hashes := []models.MediaHash{}
+	err := inTenant(ctx, hr.pool, systemTenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT h.mediaId, m.tenantId, m.ownerId, h.frame, h.pHash, h.dHash
+			FROM media_hashes h JOIN media m ON m.id = h.mediaId `+where+`
+			ORDER BY h.mediaId, h.frame`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var hash models.MediaHash
+			var pHash, dHash int64
+			if err := rows.Scan(&hash.MediaId, &hash.TenantId, &hash.OwnerId, &hash.Frame, &pHash, &dHash); err != nil {
+				return err
+			}
+			hash.PHash = uint64(pHash)
+			hash.DHash = uint64(dHash)
+			hashes = append(hashes, hash)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		hr.logger.Error("failed to get media hashes", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get media hashes: %w", err)
+	}
+	return hashes, nil
+}
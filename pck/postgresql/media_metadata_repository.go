@@ -0,0 +1,65 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type mediaMetadataRepository struct {
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+}
+
+func NewMediaMetadataRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.MediaMetadataRepository {
+	return &mediaMetadataRepository{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+func (mr *mediaMetadataRepository) GetByMediaID(ctx context.Context, mediaId string) (*models.MediaMetadata, error) {
+	var data []byte
+	err := mr.pool.QueryRow(ctx, "SELECT metadata FROM media_metadata WHERE mediaId = $1", mediaId).Scan(&data)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrMetadataNotFound
+		}
+		mr.logger.Error("failed to get metadata by media id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get metadata by media id: %w", err)
+	}
+	var metadata models.MediaMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+func (mr *mediaMetadataRepository) Save(ctx context.Context, metadata *models.MediaMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	_, err = mr.pool.Exec(ctx, `
+		INSERT INTO media_metadata (mediaId, metadata, extractedAt) VALUES ($1, $2, $3)
+		ON CONFLICT (mediaId) DO UPDATE SET metadata = $2, extractedAt = $3`,
+		metadata.MediaId, data, metadata.ExtractedAt)
+	if err != nil {
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == foreignKeyViolation {
+			return utils.ErrMediaNotFound
+		}
+		mr.logger.Error("failed to save metadata", slog.Any("error", err))
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
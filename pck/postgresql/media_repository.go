@@ -4,34 +4,39 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type mediaRespository struct {
 	logger *slog.Logger
+	pool   *pgxpool.Pool
 }
 
-func NewMediaRepository(logger *slog.Logger) repositories.MediaRepository {
+func NewMediaRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.MediaRepository {
 
 	return &mediaRespository{
 		logger: logger,
+		pool:   pool,
 	}
 }
 
-func (mr *mediaRespository) GetByID(id string) (*models.Media, error) {
-	dbConnection := GetDBConnection()
-	if dbConnection == nil {
-		mr.logger.Error("failed to get db connection")
-		return nil, fmt.Errorf("failed to get db connection")
-	}
+func (mr *mediaRespository) GetByID(ctx context.Context, scope repositories.Scope, id string, fields []string) (*models.Media, error) {
 	var media models.Media
-	err := dbConnection.QueryRow(context.Background(), "SELECT id, title, description, location, type, mimeType, size, tags, mediaData FROM media WHERE id = $1", id).Scan(&media.Id, &media.Title, &media.Description, &media.Location, &media.Type, &media.MimeType, &media.Size, &media.Tags, &media.MediaData)
+	condition, values := scopeCondition(scope, []interface{}{id})
+	columns, dest := projection(fields)
+	err := inTenant(ctx, mr.pool, scopeTenant(scope), func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SELECT "+columns+" FROM media m WHERE m.id = $1 AND "+condition, values...).Scan(dest(&media)...)
+	})
 	if err != nil {
 		mr.logger.Error("failed to get media by id", slog.Any("error", err))
 		return nil, utils.ErrMediaNotFound
@@ -39,42 +44,49 @@ func (mr *mediaRespository) GetByID(id string) (*models.Media, error) {
 	return &media, nil
 }
 
-func (mr *mediaRespository) Create(media *repositories.MediaPayload) (*models.Media, error) {
-	dbConnection := GetDBConnection()
-	if dbConnection == nil {
-		mr.logger.Error("failed to get db connection")
-		return nil, fmt.Errorf("failed to get db connection")
-	}
-	generatedId := uuid.NewString()
-	_, err := dbConnection.Exec(context.Background(), "INSERT INTO media (id, title, description, location, type, mimeType, size, tags, mediaData) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", generatedId, media.Title, media.Description, media.Location, media.Type, media.MimeType, media.Size, media.Tags, media.MediaData)
-	if err != nil {
-		mr.logger.Error("failed to create media", slog.Any("error", err))
-		return nil, fmt.Errorf("failed to create media: %w", err)
-	}
-
-	// Retrieve the inserted media
+func (mr *mediaRespository) Create(ctx context.Context, media *repositories.MediaPayload) (*models.Media, error) {
 	var createdMedia models.Media
-	err = dbConnection.QueryRow(context.Background(),
-		"SELECT id, title, description, location, type, mimeType, size, tags, mediaData FROM media WHERE id = $1",
-		generatedId).Scan(&createdMedia.Id, &createdMedia.Title, &createdMedia.Description, &createdMedia.Location, &createdMedia.Type, &createdMedia.MimeType, &createdMedia.Size, &createdMedia.Tags, &createdMedia.MediaData)
+	err := inTenant(ctx, mr.pool, media.TenantId, func(tx pgx.Tx) error {
+		generatedId := uuid.NewString()
+		_, err := tx.Exec(ctx, "INSERT INTO media (id, title, description, location, type, mimeType, size, tags, contentKey, checksum, tenantId, ownerId) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)", generatedId, media.Title, media.Description, media.Location, media.Type, media.MimeType, media.Size, media.Tags, media.ContentKey, media.Checksum, media.TenantId, media.OwnerId)
+		if err != nil {
+			mr.logger.Error("failed to create media", slog.Any("error", err))
+			return fmt.Errorf("failed to create media: %w", err)
+		}
 
+		// Retrieve the inserted media
+		err = tx.QueryRow(ctx,
+			"SELECT "+mediaColumns+" FROM media m WHERE m.id = $1",
+			generatedId).Scan(mediaFields(&createdMedia)...)
+
+		if err != nil {
+			mr.logger.Error("failed to retrieve created media", slog.Any("error", err))
+			return fmt.Errorf("failed to retrieve created media: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		mr.logger.Error("failed to retrieve created media", slog.Any("error", err))
-		return nil, fmt.Errorf("failed to retrieve created media: %w", err)
+		return nil, err
 	}
 
 	return &createdMedia, nil
 }
 
-func (mr *mediaRespository) Update(id string, media *repositories.MediaPayload) (*models.Media, error) {
-	dbConnection := GetDBConnection()
-	if dbConnection == nil {
-		mr.logger.Error("failed to get db connection")
-		return nil, fmt.Errorf("failed to get db connection")
-	}
+func (mr *mediaRespository) Update(ctx context.Context, scope repositories.Scope, id string, media *repositories.MediaPayload) (*models.Media, error) {
+	var result *models.Media
+	err := inTenant(ctx, mr.pool, scopeTenant(scope), func(tx pgx.Tx) error {
+		var err error
+		result, err = mr.update(ctx, tx, scope, id, media)
+		return err
+	})
+	return result, err
+}
+
+func (mr *mediaRespository) update(ctx context.Context, tx pgx.Tx, scope repositories.Scope, id string, media *repositories.MediaPayload) (*models.Media, error) {
 	// look if the media exists
 	var mediaExists bool
-	err := dbConnection.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM media WHERE id = $1)", id).Scan(&mediaExists)
+	condition, scopeValues := scopeCondition(scope, []interface{}{id})
+	err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM media m WHERE m.id = $1 AND "+condition+")", scopeValues...).Scan(&mediaExists)
 	if err != nil {
 		mr.logger.Error("failed to check if media exists", slog.Any("error", err))
 		return nil, fmt.Errorf("failed to check if media exists: %w", err)
@@ -116,9 +128,11 @@ func (mr *mediaRespository) Update(id string, media *repositories.MediaPayload)
 		updateFields = append(updateFields, "tags = $"+strconv.Itoa(len(values)+1))
 		values = append(values, media.Tags)
 	}
-	if media.MediaData != "" {
-		updateFields = append(updateFields, "mediaData = $"+strconv.Itoa(len(values)+1))
-		values = append(values, media.MediaData)
+	if media.ContentKey != "" {
+		updateFields = append(updateFields, "contentKey = $"+strconv.Itoa(len(values)+1))
+		values = append(values, media.ContentKey)
+		updateFields = append(updateFields, "checksum = $"+strconv.Itoa(len(values)+1))
+		values = append(values, media.Checksum)
 	}
 
 	// Construct the full SQL query
@@ -126,7 +140,7 @@ func (mr *mediaRespository) Update(id string, media *repositories.MediaPayload)
 	values = append(values, id)
 
 	// Execute the update
-	_, err = dbConnection.Exec(context.Background(), updateQuery, values...)
+	_, err = tx.Exec(ctx, updateQuery, values...)
 	if err != nil {
 		mr.logger.Error("failed to update media", slog.Any("error", err))
 		return nil, fmt.Errorf("failed to update media: %w", err)
@@ -134,9 +148,9 @@ func (mr *mediaRespository) Update(id string, media *repositories.MediaPayload)
 
 	// Retrieve the updated media
 	var updatedMedia models.Media
-	err = dbConnection.QueryRow(context.Background(),
-		"SELECT id, title, description, location, type, mimeType, size, tags, mediaData FROM media WHERE id = $1",
-		id).Scan(&updatedMedia.Id, &updatedMedia.Title, &updatedMedia.Description, &updatedMedia.Location, &updatedMedia.Type, &updatedMedia.MimeType, &updatedMedia.Size, &updatedMedia.Tags, &updatedMedia.MediaData)
+	err = tx.QueryRow(ctx,
+		"SELECT "+mediaColumns+" FROM media m WHERE m.id = $1",
+		id).Scan(mediaFields(&updatedMedia)...)
 
 	if err != nil {
 		mr.logger.Error("failed to retrieve updated media", slog.Any("error", err))
@@ -146,16 +160,21 @@ func (mr *mediaRespository) Update(id string, media *repositories.MediaPayload)
 	return &updatedMedia, nil
 }
 
-func (mr *mediaRespository) Delete(id string) (bool, error) {
-	dbConnection := GetDBConnection()
-	if dbConnection == nil {
-		mr.logger.Error("failed to get db connection")
-		return false, fmt.Errorf("failed to get db connection")
-	}
+func (mr *mediaRespository) Delete(ctx context.Context, scope repositories.Scope, id string) (bool, error) {
+	var result bool
+	err := inTenant(ctx, mr.pool, scopeTenant(scope), func(tx pgx.Tx) error {
+		var err error
+		result, err = mr.delete(ctx, tx, scope, id)
+		return err
+	})
+	return result, err
+}
 
+func (mr *mediaRespository) delete(ctx context.Context, tx pgx.Tx, scope repositories.Scope, id string) (bool, error) {
 	// look if the media exists
 	var mediaExists bool
-	err := dbConnection.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM media WHERE id = $1)", id).Scan(&mediaExists)
+	condition, scopeValues := scopeCondition(scope, []interface{}{id})
+	err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM media m WHERE m.id = $1 AND "+condition+")", scopeValues...).Scan(&mediaExists)
 	if err != nil {
 		mr.logger.Error("failed to check if media exists", slog.Any("error", err))
 		return false, fmt.Errorf("failed to check if media exists: %w", err)
@@ -165,7 +184,7 @@ func (mr *mediaRespository) Delete(id string) (bool, error) {
 		return false, utils.ErrMediaNotFound
 	}
 
-	_, err = dbConnection.Exec(context.Background(), "DELETE FROM media WHERE id = $1", id)
+	_, err = tx.Exec(ctx, "DELETE FROM media WHERE id = $1", id)
 	if err != nil {
 		mr.logger.Error("failed to delete media by id", slog.Any("error", err))
 		return false, fmt.Errorf("failed to delete media by id: %w", err)
@@ -173,23 +192,96 @@ func (mr *mediaRespository) Delete(id string) (bool, error) {
 	return true, nil
 }
 
-func (mr *mediaRespository) GetAll() ([]models.Media, error) {
-	dbConnection := GetDBConnection()
-	if dbConnection == nil {
-		mr.logger.Error("failed to get db connection")
-		return nil, fmt.Errorf("failed to get db connection")
+func (mr *mediaRespository) List(ctx context.Context, scope repositories.Scope, options repositories.ListOptions) (*repositories.MediaPage, error) {
+	var result *repositories.MediaPage
+	err := inTenant(ctx, mr.pool, scopeTenant(scope), func(tx pgx.Tx) error {
+		var err error
+		result, err = mr.list(ctx, tx, scope, options)
+		return err
+	})
+	return result, err
+}
+
+func (mr *mediaRespository) list(ctx context.Context, tx pgx.Tx, scope repositories.Scope, options repositories.ListOptions) (*repositories.MediaPage, error) {
+	sortColumn, ok := sortColumns[options.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", options.SortBy)
 	}
-	rows, err := dbConnection.Query(context.Background(), "SELECT id, title, description, location, type, mimeType, size, tags, mediaData FROM media")
+
+	var cursor *repositories.MediaCursor
+	if options.Cursor != "" {
+		decoded, err := repositories.DecodeCursor(options.Cursor, &options)
+		if err != nil {
+			return nil, err
+		}
+		cursor = decoded
+	}
+
+	conditions := []string{}
+	values := []interface{}{}
+	addCondition := func(condition string, value interface{}) {
+		values = append(values, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(values))))
+	}
+
+	scoped, values := scopeCondition(scope, values)
+	conditions = append(conditions, scoped)
+	if options.Type != "" {
+		addCondition("m.type = $?", options.Type)
+	}
+	if options.MimeType != "" {
+		addCondition("m.mimeType = $?", options.MimeType)
+	}
+	if options.Tag != "" {
+		// tags are stored as a comma separated list
+		addCondition(`$? = ANY(regexp_split_to_array(m.tags, '\s*,\s*'))`, options.Tag)
+	}
+	if options.MinSize != nil {
+		addCondition("m.size >= $?", *options.MinSize)
+	}
+	if options.MaxSize != nil {
+		addCondition("m.size <= $?", *options.MaxSize)
+	}
+	if options.Verdict != "" {
+		// media that were never analysed have no row to join, they are inconclusive
+		addCondition("COALESCE(a.verdict, 'inconclusive') = $?", options.Verdict)
+	}
+
+	// walking backwards flips both the ordering and the keyset comparison, the rows are reversed afterwards
+	backwards := cursor != nil && cursor.Before
+	descending := options.Descending != backwards
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+	if cursor != nil {
+		value, err := cursorValue(options.SortBy, cursor.Value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value, cursor.Id)
+		conditions = append(conditions, fmt.Sprintf("(%s, m.id) %s ($%d, $%d)", sortColumn, comparison, len(values)-1, len(values)))
+	}
+
+	// the page cursors are built from the sort field
+	columns, fields := projection(options.Fields, string(options.SortBy))
+	query := "SELECT " + columns + " FROM media m LEFT JOIN media_analysis a ON a.mediaId = m.id"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, m.id %s LIMIT %d", sortColumn, direction, direction, options.Limit+1)
+
+	rows, err := tx.Query(ctx, query, values...)
 	if err != nil {
-		mr.logger.Error("failed to get all media", slog.Any("error", err))
-		return nil, fmt.Errorf("failed to get all media: %w", err)
+		mr.logger.Error("failed to list media", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to list media: %w", err)
 	}
 	defer rows.Close()
 
-	var mediaList []models.Media
+	mediaList := []models.Media{}
 	for rows.Next() {
 		var media models.Media
-		err := rows.Scan(&media.Id, &media.Title, &media.Description, &media.Location, &media.Type, &media.MimeType, &media.Size, &media.Tags, &media.MediaData)
+		err := rows.Scan(fields(&media)...)
 		if err != nil {
 			mr.logger.Error("failed to scan media row", slog.Any("error", err))
 			return nil, fmt.Errorf("failed to scan media row: %w", err)
@@ -202,5 +294,101 @@ func (mr *mediaRespository) GetAll() ([]models.Media, error) {
 		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
 	}
 
-	return mediaList, nil
+	return repositories.NewMediaPage(mediaList, &options, cursor), nil
+}
+
+// scopeCondition restricts a query on the media aliased m to the scope, the tenant and owner are
+// bound after the given values. Row level security filters the tenants again, the condition
+// lets the planner use the tenant indexes.
+func scopeCondition(scope repositories.Scope, values []interface{}) (string, []interface{}) {
+	if scope.All && scope.TenantId == "" {
+		return "TRUE", values
+	}
+	if scope.TenantId == "" || (!scope.All && scope.OwnerId == "") {
+		return "FALSE", values
+	}
+	values = append(values, scope.TenantId)
+	condition := "m.tenantId = $" + strconv.Itoa(len(values))
+	if !scope.All {
+		values = append(values, scope.OwnerId)
+		condition += " AND m.ownerId = $" + strconv.Itoa(len(values))
+	}
+	return condition, values
+}
+
+var sortColumns = map[repositories.SortField]string{
+	repositories.SORT_CREATED_AT: "m.createdAt",
+	repositories.SORT_SIZE:       "m.size",
+	repositories.SORT_TITLE:      "m.title",
+}
+
+func cursorValue(sortBy repositories.SortField, value string) (interface{}, error) {
+	switch sortBy {
+	case repositories.SORT_CREATED_AT:
+		createdAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		return createdAt, nil
+	case repositories.SORT_SIZE:
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		return size, nil
+	default:
+		return value, nil
+	}
+}
+
+const mediaColumns = "m.id, m.title, m.description, m.location, m.type, m.mimeType, m.size, m.tags, m.contentKey, m.checksum, m.tenantId, m.ownerId, m.createdAt"
+
+// mediaFields returns the scan destinations matching mediaColumns.
+func mediaFields(media *models.Media) []interface{} {
+	return []interface{}{&media.Id, &media.Title, &media.Description, &media.Location, &media.Type, &media.MimeType, &media.Size, &media.Tags, &media.ContentKey, &media.Checksum, &media.TenantId, &media.OwnerId, &media.CreatedAt}
+}
+
+// mediaFieldColumns maps the selectable fields of repositories.MediaFields to their column and scan destination.
+var mediaFieldColumns = map[string]struct {
+	column string
+	dest   func(media *models.Media) interface{}
+}{
+	"id":          {"m.id", func(media *models.Media) interface{} { return &media.Id }},
+	"title":       {"m.title", func(media *models.Media) interface{} { return &media.Title }},
+	"description": {"m.description", func(media *models.Media) interface{} { return &media.Description }},
+	"location":    {"m.location", func(media *models.Media) interface{} { return &media.Location }},
+	"type":        {"m.type", func(media *models.Media) interface{} { return &media.Type }},
+	"mimeType":    {"m.mimeType", func(media *models.Media) interface{} { return &media.MimeType }},
+	"size":        {"m.size", func(media *models.Media) interface{} { return &media.Size }},
+	"tags":        {"m.tags", func(media *models.Media) interface{} { return &media.Tags }},
+	"checksum":    {"m.checksum", func(media *models.Media) interface{} { return &media.Checksum }},
+	"tenantId":    {"m.tenantId", func(media *models.Media) interface{} { return &media.TenantId }},
+	"ownerId":     {"m.ownerId", func(media *models.Media) interface{} { return &media.OwnerId }},
+	"createdAt":   {"m.createdAt", func(media *models.Media) interface{} { return &media.CreatedAt }},
+}
+
+// projection narrows the SELECT to the requested fields and the required ones, the id is always loaded.
+func projection(fields []string, required ...string) (string, func(media *models.Media) []interface{}) {
+	if len(fields) == 0 {
+		return mediaColumns, mediaFields
+	}
+	selected := []string{"id"}
+	for _, field := range slices.Concat(fields, required) {
+		if _, ok := mediaFieldColumns[field]; ok && !slices.Contains(selected, field) {
+			selected = append(selected, field)
+		}
+	}
+
+	columns := make([]string, len(selected))
+	for i, field := range selected {
+		columns[i] = mediaFieldColumns[field].column
+	}
+	dest := func(media *models.Media) []interface{} {
+		destinations := make([]interface{}, len(selected))
+		for i, field := range selected {
+			destinations[i] = mediaFieldColumns[field].dest(media)
+		}
+		return destinations
+	}
+	return strings.Join(columns, ", "), dest
 }
@@ -0,0 +1,22 @@
+-- databases created before migrations existed already have the table, possibly without the newer columns
+CREATE TABLE IF NOT EXISTS media (
+    id TEXT PRIMARY KEY NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    location TEXT,
+    type TEXT NOT NULL,
+    mimeType TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    tags TEXT,
+    contentKey TEXT NOT NULL DEFAULT '',
+    checksum TEXT NOT NULL DEFAULT '',
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS contentKey TEXT NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS checksum TEXT NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS createdAt TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS media_createdAt_idx ON media (createdAt, id);
+CREATE INDEX IF NOT EXISTS media_size_idx ON media (size, id);
+CREATE INDEX IF NOT EXISTS media_title_idx ON media (title, id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS detector_results;
+DROP TABLE IF EXISTS media_analysis;
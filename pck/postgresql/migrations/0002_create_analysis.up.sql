@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS media_analysis (
+    mediaId TEXT PRIMARY KEY NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    verdict TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    createdAt TIMESTAMPTZ NOT NULL,
+    updatedAt TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS detector_results (
+    mediaId TEXT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    detector TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    verdict TEXT NOT NULL,
+    signals JSONB NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (mediaId, detector)
+);
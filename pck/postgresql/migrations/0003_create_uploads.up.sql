@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS uploads (
+    id TEXT PRIMARY KEY NOT NULL,
+    length BIGINT NOT NULL,
+    uploadOffset BIGINT NOT NULL DEFAULT 0,
+    metadata JSONB NOT NULL,
+    mediaId TEXT NOT NULL DEFAULT '',
+    expiresAt TIMESTAMPTZ NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS uploads_expiresAt_idx ON uploads (expiresAt);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS media_ownerId_createdAt_idx;
+ALTER TABLE uploads DROP COLUMN IF EXISTS ownerId;
+ALTER TABLE media DROP COLUMN IF EXISTS ownerId;
@@ -0,0 +1,6 @@
+-- media created before authentication existed have no owner, only admins reach them
+ALTER TABLE media ADD COLUMN ownerId TEXT NOT NULL DEFAULT '';
+ALTER TABLE uploads ADD COLUMN ownerId TEXT NOT NULL DEFAULT '';
+
+-- users list their own library, the keyset columns follow the owner
+CREATE INDEX media_ownerId_createdAt_idx ON media (ownerId, createdAt, id);
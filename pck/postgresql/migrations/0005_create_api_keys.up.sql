@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    salt BYTEA NOT NULL,
+    hash BYTEA NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL,
+    lastUsedAt TIMESTAMPTZ,
+    revokedAt TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_createdAt_idx ON api_keys (createdAt);
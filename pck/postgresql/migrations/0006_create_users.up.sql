@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS users (
+    subject TEXT PRIMARY KEY NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('viewer', 'analyst', 'reviewer', 'admin')),
+    createdAt TIMESTAMPTZ NOT NULL,
+    updatedAt TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS media_reviews (
+    mediaId TEXT PRIMARY KEY NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    verdict TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    reviewerId TEXT NOT NULL,
+    reviewedAt TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,18 @@
+DROP POLICY IF EXISTS media_tenant_isolation ON media;
+ALTER TABLE media NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE media DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS api_keys_tenantId_createdAt_idx;
+DROP INDEX IF EXISTS media_tenantId_createdAt_idx;
+DROP INDEX IF EXISTS media_tenantId_ownerId_createdAt_idx;
+CREATE INDEX IF NOT EXISTS media_ownerId_createdAt_idx ON media (ownerId, createdAt, id);
+
+-- subjects can only keep one role, the one they have in the default tenant
+DELETE FROM users WHERE tenantId <> 'default';
+ALTER TABLE users DROP CONSTRAINT users_pkey;
+ALTER TABLE users DROP COLUMN tenantId;
+ALTER TABLE users ADD PRIMARY KEY (subject);
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenantId;
+ALTER TABLE uploads DROP COLUMN IF EXISTS tenantId;
+ALTER TABLE media DROP COLUMN IF EXISTS tenantId;
@@ -0,0 +1,25 @@
+-- every record created before organizations existed belongs to the default tenant
+ALTER TABLE media ADD COLUMN tenantId TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE uploads ADD COLUMN tenantId TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN tenantId TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE users ADD COLUMN tenantId TEXT NOT NULL DEFAULT 'default';
+
+-- a subject has a separate role in every tenant
+ALTER TABLE users DROP CONSTRAINT users_pkey;
+ALTER TABLE users ADD PRIMARY KEY (tenantId, subject);
+
+-- libraries are listed per tenant, the keyset columns follow
+DROP INDEX IF EXISTS media_ownerId_createdAt_idx;
+CREATE INDEX media_tenantId_ownerId_createdAt_idx ON media (tenantId, ownerId, createdAt, id);
+CREATE INDEX media_tenantId_createdAt_idx ON media (tenantId, createdAt, id);
+CREATE INDEX api_keys_tenantId_createdAt_idx ON api_keys (tenantId, createdAt);
+
+-- row level security keeps the tenants apart even when a query forgets its condition. Every
+-- transaction on media sets app.tenant_id, '*' is reserved to the jobs of the system and
+-- sessions setting nothing see no media. FORCE applies the policy to the owner of the table,
+-- the role the API connects as, only superusers and BYPASSRLS roles escape it.
+ALTER TABLE media ENABLE ROW LEVEL SECURITY;
+ALTER TABLE media FORCE ROW LEVEL SECURITY;
+CREATE POLICY media_tenant_isolation ON media
+    USING (current_setting('app.tenant_id', true) IN ('*', tenantId))
+    WITH CHECK (current_setting('app.tenant_id', true) IN ('*', tenantId));
@@ -0,0 +1,9 @@
+-- token buckets shared by the replicas, rows are forgotten once full again
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key TEXT PRIMARY KEY NOT NULL,
+    tokens DOUBLE PRECISION NOT NULL,
+    updatedAt TIMESTAMPTZ NOT NULL,
+    fullAt TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_fullAt_idx ON rate_limit_buckets (fullAt);
@@ -0,0 +1,2 @@
+-- numbers the events of every replica, see postgresql.NewEventBus
+CREATE SEQUENCE IF NOT EXISTS event_sequence;
@@ -0,0 +1,8 @@
+-- perceptual hashes, one row per image or per keyframe of a video
+CREATE TABLE IF NOT EXISTS media_hashes (
+    mediaId TEXT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    frame INTEGER NOT NULL,
+    pHash BIGINT NOT NULL,
+    dHash BIGINT NOT NULL,
+    PRIMARY KEY (mediaId, frame)
+);
@@ -0,0 +1,6 @@
+-- metadata read from the content of the media, as the JSON of models.MediaMetadata
+CREATE TABLE IF NOT EXISTS media_metadata (
+    mediaId TEXT PRIMARY KEY NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    metadata JSONB NOT NULL,
+    extractedAt TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE media_analysis DROP COLUMN IF EXISTS provenance;
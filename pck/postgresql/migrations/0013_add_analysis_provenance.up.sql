@@ -0,0 +1,2 @@
+-- verification of the C2PA manifests as the JSON of models.Provenance, NULL when they weren't looked for
+ALTER TABLE media_analysis ADD COLUMN provenance JSONB;
@@ -0,0 +1 @@
+ALTER TABLE detector_results DROP COLUMN IF EXISTS artifacts;
@@ -0,0 +1,2 @@
+-- files produced by the detectors as a JSON array of name, content type and blob key
+ALTER TABLE detector_results ADD COLUMN artifacts JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,8 @@
+-- frame by frame analyses of the videos, the segments as the JSON of models.TimelineSegment
+CREATE TABLE IF NOT EXISTS media_timelines (
+    mediaId TEXT PRIMARY KEY NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    sampling TEXT NOT NULL,
+    duration DOUBLE PRECISION NOT NULL,
+    segments JSONB NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,11 @@
+DROP POLICY IF EXISTS users_tenant_isolation ON users;
+ALTER TABLE users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS api_keys_tenant_isolation ON api_keys;
+ALTER TABLE api_keys NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE api_keys DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS uploads_tenant_isolation ON uploads;
+ALTER TABLE uploads NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE uploads DISABLE ROW LEVEL SECURITY;
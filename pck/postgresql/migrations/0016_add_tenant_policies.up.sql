@@ -0,0 +1,22 @@
+-- the tables carrying a tenantId are kept apart by the same policy as media, their queries
+-- set app.tenant_id as well. Looking up an API key by id and expiring uploads run as the
+-- system, the tenant is only known from the row there. The tables keyed by mediaId
+-- (analysis, media_reviews, media_hashes, media_metadata, media_timelines) have no policy,
+-- they are only reached through a media the caller was allowed to read.
+ALTER TABLE uploads ENABLE ROW LEVEL SECURITY;
+ALTER TABLE uploads FORCE ROW LEVEL SECURITY;
+CREATE POLICY uploads_tenant_isolation ON uploads
+    USING (current_setting('app.tenant_id', true) IN ('*', tenantId))
+    WITH CHECK (current_setting('app.tenant_id', true) IN ('*', tenantId));
+
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys FORCE ROW LEVEL SECURITY;
+CREATE POLICY api_keys_tenant_isolation ON api_keys
+    USING (current_setting('app.tenant_id', true) IN ('*', tenantId))
+    WITH CHECK (current_setting('app.tenant_id', true) IN ('*', tenantId));
+
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+CREATE POLICY users_tenant_isolation ON users
+    USING (current_setting('app.tenant_id', true) IN ('*', tenantId))
+    WITH CHECK (current_setting('app.tenant_id', true) IN ('*', tenantId));
@@ -0,0 +1,77 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// rateLimitSweepInterval is how often a replica forgets the buckets that filled up again.
+const rateLimitSweepInterval = time.Minute
+
+type rateLimitStore struct {
+	logger    *slog.Logger
+	pool      *pgxpool.Pool
+	sweepLock sync.Mutex
+	lastSweep time.Time
+}
+
+// NewRateLimitStore shares the buckets between every replica using the database.
+func NewRateLimitStore(logger *slog.Logger, pool *pgxpool.Pool) repositories.RateLimitStore {
+	return &rateLimitStore{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+func (s *rateLimitStore) Take(ctx context.Context, key string, limit repositories.RateLimit, now time.Time) (*repositories.RateLimitResult, error) {
+	s.sweep(ctx, now)
+
+	var result repositories.RateLimitResult
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		// the row lock serializes the requests of a client across replicas
+		bucket := repositories.NewRateLimitBucket(limit, now)
+		_, err := tx.Exec(ctx, "INSERT INTO rate_limit_buckets (key, tokens, updatedAt, fullAt) VALUES ($1, $2, $3, $3) ON CONFLICT (key) DO NOTHING", key, bucket.Tokens, bucket.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create rate limit bucket: %w", err)
+		}
+		err = tx.QueryRow(ctx, "SELECT tokens, updatedAt FROM rate_limit_buckets WHERE key = $1 FOR UPDATE", key).Scan(&bucket.Tokens, &bucket.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to get rate limit bucket: %w", err)
+		}
+
+		result = bucket.Take(limit, now)
+		_, err = tx.Exec(ctx, "UPDATE rate_limit_buckets SET tokens = $1, updatedAt = $2, fullAt = $3 WHERE key = $4", bucket.Tokens, bucket.UpdatedAt, bucket.FullAt(limit), key)
+		if err != nil {
+			return fmt.Errorf("failed to update rate limit bucket: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("failed to take rate limit token", slog.Any("error", err))
+		return nil, err
+	}
+	return &result, nil
+}
+
+// sweep forgets the buckets that filled up again, a new bucket would be full as well.
+func (s *rateLimitStore) sweep(ctx context.Context, now time.Time) {
+	s.sweepLock.Lock()
+	if now.Sub(s.lastSweep) < rateLimitSweepInterval {
+		s.sweepLock.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.sweepLock.Unlock()
+
+	_, err := s.pool.Exec(ctx, "DELETE FROM rate_limit_buckets WHERE fullAt <= $1", now)
+	if err != nil {
+		s.logger.Error("failed to sweep rate limit buckets", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,59 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// foreignKeyViolation is the Postgres error code of a reference to a missing row.
+const foreignKeyViolation = "23503"
+
+type reviewRepository struct {
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+}
+
+func NewReviewRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.ReviewRepository {
+	return &reviewRepository{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+func (rr *reviewRepository) GetByMediaID(ctx context.Context, mediaId string) (*models.Review, error) {
+	var review models.Review
+	err := rr.pool.QueryRow(ctx, "SELECT mediaId, verdict, note, reviewerId, reviewedAt FROM media_reviews WHERE mediaId = $1", mediaId).Scan(&review.MediaId, &review.Verdict, &review.Note, &review.ReviewerId, &review.ReviewedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrReviewNotFound
+		}
+		rr.logger.Error("failed to get review by media id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get review by media id: %w", err)
+	}
+	return &review, nil
+}
+
+func (rr *reviewRepository) Save(ctx context.Context, review *models.Review) error {
+	_, err := rr.pool.Exec(ctx, `
+		INSERT INTO media_reviews (mediaId, verdict, note, reviewerId, reviewedAt) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (mediaId) DO UPDATE SET verdict = $2, note = $3, reviewerId = $4, reviewedAt = $5`,
+		review.MediaId, review.Verdict, review.Note, review.ReviewerId, review.ReviewedAt)
+	if err != nil {
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == foreignKeyViolation {
+			return utils.ErrMediaNotFound
+		}
+		rr.logger.Error("failed to save review", slog.Any("error", err))
+		return fmt.Errorf("failed to save review: %w", err)
+	}
+	return nil
+}
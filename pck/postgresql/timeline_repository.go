@@ -0,0 +1,65 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type timelineRepository struct {
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+}
+
+func NewTimelineRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.TimelineRepository {
+	return &timelineRepository{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+func (tr *timelineRepository) GetByMediaID(ctx context.Context, mediaId string) (*models.Timeline, error) {
+	timeline := models.Timeline{MediaId: mediaId}
+	var segments []byte
+	err := tr.pool.QueryRow(ctx, "SELECT sampling, duration, segments, createdAt FROM media_timelines WHERE mediaId = $1", mediaId).Scan(&timeline.Sampling, &timeline.Duration, &segments, &timeline.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrTimelineNotFound
+		}
+		tr.logger.Error("failed to get timeline by media id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get timeline by media id: %w", err)
+	}
+	if err := json.Unmarshal(segments, &timeline.Segments); err != nil {
+		return nil, fmt.Errorf("failed to decode timeline segments: %w", err)
+	}
+	return &timeline, nil
+}
+
+func (tr *timelineRepository) Save(ctx context.Context, timeline *models.Timeline) error {
+	segments, err := json.Marshal(timeline.Segments)
+	if err != nil {
+		return fmt.Errorf("failed to encode timeline segments: %w", err)
+	}
+	_, err = tr.pool.Exec(ctx, `
+		INSERT INTO media_timelines (mediaId, sampling, duration, segments, createdAt) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (mediaId) DO UPDATE SET sampling = $2, duration = $3, segments = $4, createdAt = $5`,
+		timeline.MediaId, timeline.Sampling, timeline.Duration, segments, timeline.CreatedAt)
+	if err != nil {
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == foreignKeyViolation {
+			return utils.ErrMediaNotFound
+		}
+		tr.logger.Error("failed to save timeline", slog.Any("error", err))
+		return fmt.Errorf("failed to save timeline: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type uploadRepository struct {
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+}
+
+func NewUploadRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.UploadRepository {
+	return &uploadRepository{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+func (ur *uploadRepository) GetByID(ctx context.Context, tenantId string, id string) (*models.Upload, error) {
+	var upload models.Upload
+	var metadata []byte
+	err := inTenant(ctx, ur.pool, tenantId, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SELECT id, length, uploadOffset, metadata, mediaId, tenantId, ownerId, expiresAt, createdAt FROM uploads WHERE id = $1 AND tenantId = $2", id, tenantId).Scan(&upload.Id, &upload.Length, &upload.Offset, &metadata, &upload.MediaId, &upload.TenantId, &upload.OwnerId, &upload.ExpiresAt, &upload.CreatedAt)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrUploadNotFound
+		}
+		ur.logger.Error("failed to get upload by id", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get upload by id: %w", err)
+	}
+	if err := json.Unmarshal(metadata, &upload.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode upload metadata: %w", err)
+	}
+	return &upload, nil
+}
+
+func (ur *uploadRepository) Create(ctx context.Context, upload *models.Upload) error {
+	metadata, err := json.Marshal(upload.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload metadata: %w", err)
+	}
+	err = inTenant(ctx, ur.pool, upload.TenantId, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO uploads (id, length, uploadOffset, metadata, mediaId, tenantId, ownerId, expiresAt, createdAt) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", upload.Id, upload.Length, upload.Offset, metadata, upload.MediaId, upload.TenantId, upload.OwnerId, upload.ExpiresAt, upload.CreatedAt)
+		return err
+	})
+	if err != nil {
+		ur.logger.Error("failed to create upload", slog.Any("error", err))
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+	return nil
+}
+
+func (ur *uploadRepository) UpdateOffset(ctx context.Context, tenantId string, id string, offset int64, expiresAt time.Time) error {
+	tag, err := execInTenant(ctx, ur.pool, tenantId, "UPDATE uploads SET uploadOffset = $1, expiresAt = $2 WHERE id = $3 AND tenantId = $4", offset, expiresAt, id, tenantId)
+	if err != nil {
+		ur.logger.Error("failed to update upload offset", slog.Any("error", err))
+		return fmt.Errorf("failed to update upload offset: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrUploadNotFound
+	}
+	return nil
+}
+
+func (ur *uploadRepository) Complete(ctx context.Context, tenantId string, id string, mediaId string) error {
+	tag, err := execInTenant(ctx, ur.pool, tenantId, "UPDATE uploads SET mediaId = $1 WHERE id = $2 AND tenantId = $3", mediaId, id, tenantId)
+	if err != nil {
+		ur.logger.Error("failed to complete upload", slog.Any("error", err))
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrUploadNotFound
+	}
+	return nil
+}
+
+func (ur *uploadRepository) Delete(ctx context.Context, tenantId string, id string) error {
+	tag, err := execInTenant(ctx, ur.pool, tenantId, "DELETE FROM uploads WHERE id = $1 AND tenantId = $2", id, tenantId)
+	if err != nil {
+		ur.logger.Error("failed to delete upload", slog.Any("error", err))
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrUploadNotFound
+	}
+	return nil
+}
+
+func (ur *uploadRepository) GetExpired(ctx context.Context, now time.Time) ([]models.Upload, error) {
+	var uploads []models.Upload
+	// the janitor expires the uploads of every tenant
+	err := inTenant(ctx, ur.pool, systemTenant, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT id, length, uploadOffset, mediaId, tenantId, ownerId, expiresAt, createdAt FROM uploads WHERE expiresAt < $1", now)
+		if err != nil {
+			return fmt.Errorf("failed to get expired uploads: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var upload models.Upload
+			err := rows.Scan(&upload.Id, &upload.Length, &upload.Offset, &upload.MediaId, &upload.TenantId, &upload.OwnerId, &upload.ExpiresAt, &upload.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("failed to scan upload row: %w", err)
+			}
+			uploads = append(uploads, upload)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error occurred during rows iteration: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		ur.logger.Error("failed to get expired uploads", slog.Any("error", err))
+		return nil, err
+	}
+	return uploads, nil
+}
@@ -0,0 +1,105 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type userRepository struct {
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+}
+
+func NewUserRepository(logger *slog.Logger, pool *pgxpool.Pool) repositories.UserRepository {
+	return &userRepository{
+		logger: logger,
+		pool:   pool,
+	}
+}
+
+const userColumns = "tenantId, subject, role, createdAt, updatedAt"
+
+// userFields returns the scan destinations matching userColumns.
+func userFields(user *models.User) []interface{} {
+	return []interface{}{&user.TenantId, &user.Subject, &user.Role, &user.CreatedAt, &user.UpdatedAt}
+}
+
+func (ur *userRepository) GetBySubject(ctx context.Context, tenantId string, subject string) (*models.User, error) {
+	var user models.User
+	err := inTenant(ctx, ur.pool, tenantId, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE tenantId = $1 AND subject = $2", tenantId, subject).Scan(userFields(&user)...)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrUserNotFound
+		}
+		ur.logger.Error("failed to get user by subject", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get user by subject: %w", err)
+	}
+	return &user, nil
+}
+
+func (ur *userRepository) List(ctx context.Context, tenantId string) ([]models.User, error) {
+	users := []models.User{}
+	err := inTenant(ctx, ur.pool, tenantId, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT "+userColumns+" FROM users WHERE tenantId = $1 ORDER BY subject", tenantId)
+		if err != nil {
+			return fmt.Errorf("failed to list users: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var user models.User
+			if err := rows.Scan(userFields(&user)...); err != nil {
+				return fmt.Errorf("failed to scan user row: %w", err)
+			}
+			users = append(users, user)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error occurred during rows iteration: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		ur.logger.Error("failed to list users", slog.Any("error", err))
+		return nil, err
+	}
+	return users, nil
+}
+
+func (ur *userRepository) Save(ctx context.Context, user *models.User) (*models.User, error) {
+	var saved models.User
+	err := inTenant(ctx, ur.pool, user.TenantId, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `
+			INSERT INTO users (tenantId, subject, role, createdAt, updatedAt) VALUES ($1, $2, $3, $4, $4)
+			ON CONFLICT (tenantId, subject) DO UPDATE SET role = $3, updatedAt = $4
+			RETURNING `+userColumns,
+			user.TenantId, user.Subject, user.Role, user.UpdatedAt).Scan(userFields(&saved)...)
+	})
+	if err != nil {
+		ur.logger.Error("failed to save user", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to save user: %w", err)
+	}
+	return &saved, nil
+}
+
+func (ur *userRepository) Delete(ctx context.Context, tenantId string, subject string) error {
+	tag, err := execInTenant(ctx, ur.pool, tenantId, "DELETE FROM users WHERE tenantId = $1 AND subject = $2", tenantId, subject)
+	if err != nil {
+		ur.logger.Error("failed to delete user", slog.Any("error", err))
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrUserNotFound
+	}
+	return nil
+}
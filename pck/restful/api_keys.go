@@ -0,0 +1,93 @@
+package restful
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxApiKeyNameLength    = 200
+	maxApiKeySubjectLength = 200
+)
+
+type apiKeyPayload struct {
+	Name string `json:"name"`
+	// Subject is who the key acts as, a dedicated "apikey:<id>" subject when empty
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+}
+
+// createdApiKey is the only response carrying the plain key.
+type createdApiKey struct {
+	*models.ApiKey
+	Key string `json:"key"`
+}
+
+func (app *restfulApi) createApiKey(w http.ResponseWriter, r *http.Request) {
+	var payload apiKeyPayload
+	err := DecodeJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.NotBlank(payload.Name), "name", "required", "must be provided")
+	v.Check(validator.MaxChars(payload.Name, maxApiKeyNameLength), "name", "too_long", fmt.Sprintf("must not be more than %d characters long", maxApiKeyNameLength))
+	v.Check(validator.MaxChars(payload.Subject, maxApiKeySubjectLength), "subject", "too_long", fmt.Sprintf("must not be more than %d characters long", maxApiKeySubjectLength))
+	v.Check(len(payload.Scopes) > 0, "scopes", "required", "must contain at least one scope")
+	for _, scope := range payload.Scopes {
+		v.Check(validator.PermittedValue(scope, auth.SCOPES...), "scopes", "unknown_scope",
+			fmt.Sprintf("%q is not one of the scopes %s", scope, strings.Join(auth.SCOPES, ", ")))
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	key, plain, err := app.apiKeys.Create(r.Context(), identityOf(r).TenantId, strings.TrimSpace(payload.Name), strings.TrimSpace(payload.Subject), payload.Scopes)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusCreated, createdApiKey{ApiKey: key, Key: plain})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *restfulApi) getAllApiKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.apiKeys.List(r.Context(), identityOf(r).TenantId)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, keys)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *restfulApi) revokeApiKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	key, err := app.apiKeys.Revoke(r.Context(), identityOf(r).TenantId, id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, key)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,105 @@
+package restful
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+)
+
+// withApiKey returns the same api sending its requests with an API key instead of a bearer token.
+func (api *testApi) withApiKey(key string) *testApi {
+	other := *api
+	other.token = ""
+	other.apiKey = key
+	return &other
+}
+
+func (api *testApi) createApiKey(t *testing.T, payload map[string]any) *createdApiKey {
+	t.Helper()
+	resp := api.as(t, "root", true).requestJSON(t, http.MethodPost, "/api/admin/v1/api-keys", payload)
+	expectStatus(t, resp, http.StatusCreated)
+	var created createdApiKey
+	decodeBody(t, resp, &created)
+	return &created
+}
+
+func TestApiKeyAdministration(t *testing.T) {
+	api := newTestApi(t)
+	admin := api.as(t, "root", true)
+
+	problem := decodeProblem(t, api.requestJSON(t, http.MethodPost, "/api/admin/v1/api-keys", map[string]any{"name": "bot", "scopes": []string{auth.SCOPE_MEDIA_READ}}), http.StatusForbidden)
+	if problem.Code != "forbidden" {
+		t.Errorf("expected the forbidden code, got %q", problem.Code)
+	}
+
+	problem = decodeProblem(t, admin.requestJSON(t, http.MethodPost, "/api/admin/v1/api-keys", map[string]any{"scopes": []string{"media:delete"}}), http.StatusUnprocessableEntity)
+	if len(problem.Errors) != 2 || problem.Errors[0].Field != "name" || problem.Errors[1].Code != "unknown_scope" {
+		t.Errorf("unexpected field errors: %+v", problem.Errors)
+	}
+
+	created := api.createApiKey(t, map[string]any{"name": "ingestion bot", "subject": testUser, "scopes": []string{auth.SCOPE_MEDIA_READ}})
+	if !strings.HasPrefix(created.Key, auth.API_KEY_PREFIX) || created.Subject != testUser {
+		t.Errorf("unexpected api key: %+v", created)
+	}
+
+	resp := admin.request(t, http.MethodGet, "/api/admin/v1/api-keys", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var keys []map[string]any
+	decodeBody(t, resp, &keys)
+	if len(keys) != 1 || keys[0]["id"] != created.Id || keys[0]["key"] != nil || keys[0]["hash"] != nil {
+		t.Errorf("listed keys must not expose secrets: %v", keys)
+	}
+
+	resp = admin.request(t, http.MethodDelete, "/api/admin/v1/api-keys/"+created.Id, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var revoked models.ApiKey
+	decodeBody(t, resp, &revoked)
+	if !revoked.Revoked() {
+		t.Errorf("expected the key to be revoked: %+v", revoked)
+	}
+	expectStatus(t, admin.request(t, http.MethodDelete, "/api/admin/v1/api-keys/missing", nil, nil), http.StatusNotFound)
+
+	problem = decodeProblem(t, api.withApiKey(created.Key).request(t, http.MethodGet, "/api/media/v1", nil, nil), http.StatusUnauthorized)
+	if problem.Code != "invalid_api_key" {
+		t.Errorf("expected a revoked key to be rejected, got %+v", problem)
+	}
+}
+
+func TestApiKeyScopes(t *testing.T) {
+	api := newTestApi(t)
+	media := api.createMedia(t, repositories.MediaPayload{Title: "Owned", MediaData: encodedContent(pngMagic, 10)})
+
+	reader := api.withApiKey(api.createApiKey(t, map[string]any{"name": "reader", "subject": testUser, "scopes": []string{auth.SCOPE_MEDIA_READ}}).Key)
+	expectStatus(t, reader.request(t, http.MethodGet, "/api/media/v1/"+media.Id, nil, nil), http.StatusOK)
+	problem := decodeProblem(t, reader.request(t, http.MethodDelete, "/api/media/v1/"+media.Id, nil, nil), http.StatusForbidden)
+	if problem.Code != "insufficient_scope" {
+		t.Errorf("expected the insufficient_scope code, got %q", problem.Code)
+	}
+	decodeProblem(t, reader.request(t, http.MethodPost, "/api/media/v1/"+media.Id+"/analysis", nil, nil), http.StatusForbidden)
+	decodeProblem(t, reader.request(t, http.MethodGet, "/api/admin/v1/api-keys", nil, nil), http.StatusForbidden)
+
+	// keys without a subject act as themselves and own what they upload
+	bot := api.withApiKey(api.createApiKey(t, map[string]any{"name": "bot", "scopes": []string{auth.SCOPE_MEDIA_WRITE, auth.SCOPE_ANALYSIS_RUN}}).Key)
+	resp := bot.requestJSON(t, http.MethodPost, "/api/media/v1", repositories.MediaPayload{Title: "Ingested", MediaData: encodedContent(jpegMagic, 10)})
+	expectStatus(t, resp, http.StatusCreated)
+	var ingested models.Media
+	decodeBody(t, resp, &ingested)
+	if !strings.HasPrefix(ingested.OwnerId, "apikey:") {
+		t.Errorf("unexpected owner %q", ingested.OwnerId)
+	}
+	expectStatus(t, bot.request(t, http.MethodGet, "/api/media/v1/"+ingested.Id, nil, nil), http.StatusForbidden)
+	expectStatus(t, bot.request(t, http.MethodPost, "/api/media/v1/"+media.Id+"/analysis", nil, nil), http.StatusNotFound)
+
+	resp = bot.request(t, http.MethodPost, "/api/media/v1/"+ingested.Id+"/analysis", nil, nil)
+	expectStatus(t, resp, http.StatusAccepted)
+	if resp.Header.Get("Location") != "/api/media/v1/"+ingested.Id+"/analysis" {
+		t.Errorf("unexpected location %q", resp.Header.Get("Location"))
+	}
+	if enqueued := api.pipeline.Enqueued(); len(enqueued) != 3 || enqueued[2] != ingested.Id {
+		t.Errorf("expected the analysis to be enqueued again, got %v", enqueued)
+	}
+}
@@ -0,0 +1,108 @@
+package restful
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+const (
+	AUTH_SCHEME_BEARER  = "Bearer"
+	AUTH_SCHEME_API_KEY = "ApiKey"
+	AUTH_REALM          = "deepfake-guardian-api"
+	// browsers can't set headers on websocket handshakes, the token comes as query parameter there
+	QUERY_ACCESS_TOKEN = "access_token"
+)
+
+// authenticate rejects requests without valid credentials, a JWT bearer token or an API key,
+// and stores the identity of the caller in the request context.
+func (app *restfulApi) authenticate(next http.Handler) http.Handler {
+	return app.authenticateWith(next, false)
+}
+
+// authenticateWebSocket also accepts a bearer token from the access_token query parameter.
+func (app *restfulApi) authenticateWebSocket(next http.Handler) http.Handler {
+	return app.authenticateWith(next, true)
+}
+
+func (app *restfulApi) authenticateWith(next http.Handler, allowQuery bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" && allowQuery && r.URL.Query().Has(QUERY_ACCESS_TOKEN) {
+			header = AUTH_SCHEME_BEARER + " " + r.URL.Query().Get(QUERY_ACCESS_TOKEN)
+		}
+		identity, err := app.identify(r, header)
+		if err != nil {
+			var customError *utils.CustomError
+			if errors.As(err, &customError) && customError.Status == http.StatusUnauthorized {
+				app.unauthorized(w, r, err)
+				return
+			}
+			app.errorResponse(w, r, err)
+			return
+		}
+		err = app.policy.Resolve(r.Context(), identity)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), identity)))
+	})
+}
+
+func (app *restfulApi) identify(r *http.Request, header string) (*auth.Identity, error) {
+	if header == "" {
+		return nil, utils.ErrMissingCredentials
+	}
+	scheme, credentials, _ := strings.Cut(header, " ")
+	credentials = strings.TrimSpace(credentials)
+	switch {
+	case credentials == "":
+	case strings.EqualFold(scheme, AUTH_SCHEME_BEARER):
+		return app.tokenVerifier.Verify(credentials)
+	case strings.EqualFold(scheme, AUTH_SCHEME_API_KEY):
+		return app.apiKeys.Verify(r.Context(), credentials)
+	}
+	return nil, fmt.Errorf("%w: the Authorization header must use the %s or %s scheme", utils.ErrInvalidToken, AUTH_SCHEME_BEARER, AUTH_SCHEME_API_KEY)
+}
+
+// scopeContextKey stores the media requireAction granted to the caller.
+type scopeContextKey struct{}
+
+// requireAction rejects the callers the policy doesn't allow the action. Every route group
+// declares the action of its routes, the handlers read the media the caller reaches with scopeOf.
+func (app *restfulApi) requireAction(action auth.Action) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope, err := app.policy.Authorize(identityOf(r), action)
+			if err != nil {
+				app.forbidden(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeContextKey{}, scope)))
+		})
+	}
+}
+
+// scopeOf is the media requireAction granted to the caller. Behind a route missing the
+// middleware the scope is empty, it reaches nothing.
+func scopeOf(r *http.Request) repositories.Scope {
+	scope, _ := r.Context().Value(scopeContextKey{}).(repositories.Scope)
+	return scope
+}
+
+// identityOf is the caller stored by authenticate. Behind a route missing the middleware the
+// identity is empty, the policy allows it nothing.
+func identityOf(r *http.Request) *auth.Identity {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok {
+		return &auth.Identity{Scopes: []string{}}
+	}
+	return identity
+}
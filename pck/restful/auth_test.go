@@ -0,0 +1,123 @@
+package restful
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+func TestAuthenticationRequired(t *testing.T) {
+	api := newTestApi(t)
+	anonymous := *api
+	anonymous.token = ""
+
+	resp := anonymous.request(t, http.MethodGet, "/api/media/v1", nil, nil)
+	problem := decodeProblem(t, resp, http.StatusUnauthorized)
+	if problem.Code != "missing_credentials" {
+		t.Errorf("expected the missing_credentials code, got %q", problem.Code)
+	}
+	if challenge := resp.Header.Get("WWW-Authenticate"); challenge != `Bearer realm="deepfake-guardian-api"` {
+		t.Errorf("unexpected challenge %q", challenge)
+	}
+
+	invalid := map[string]string{
+		"wrong scheme":  "Basic YWxpY2U6c2VjcmV0",
+		"wrong secret":  "Bearer " + mustSign(t, jwt.MapClaims{"sub": testUser}, "other-secret"),
+		"expired token": "Bearer " + signToken(t, jwt.MapClaims{"sub": testUser, "exp": time.Now().Add(-time.Hour).Unix()}),
+	}
+	for name, header := range invalid {
+		resp := anonymous.request(t, http.MethodDelete, "/api/media/v1/any", nil, map[string]string{"Authorization": header})
+		problem := decodeProblem(t, resp, http.StatusUnauthorized)
+		if problem.Code != "invalid_token" || !strings.Contains(resp.Header.Get("WWW-Authenticate"), `error="invalid_token"`) {
+			t.Errorf("%s: unexpected problem %+v, challenge %q", name, problem, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+
+	// the health check and the tus capabilities stay public
+	expectStatus(t, anonymous.request(t, http.MethodGet, "/api/health-check/v1/status", nil, nil), http.StatusOK)
+	expectStatus(t, anonymous.request(t, http.MethodOptions, "/api/media/v1/uploads/", nil, nil), http.StatusNoContent)
+
+	wsURL := "ws" + strings.TrimPrefix(api.server.URL, "http") + "/ws?client_id=anonymous"
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the websocket handshake to be refused, got %v", err)
+	}
+}
+
+func mustSign(t *testing.T, claims jwt.MapClaims, secret string) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestMediaOwnership(t *testing.T) {
+	alice := newTestApi(t)
+	bob := alice.as(t, "bob", false)
+	admin := alice.as(t, "root", true)
+
+	media := alice.createMedia(t, repositories.MediaPayload{Title: "Alice's clip", MediaData: encodedContent(pngMagic, 10)})
+	if media.OwnerId != testUser {
+		t.Errorf("expected the media to be owned by %q, got %q", testUser, media.OwnerId)
+	}
+	bob.createMedia(t, repositories.MediaPayload{Title: "Bob's clip", MediaData: encodedContent(pngMagic, 10)})
+
+	// other users can't tell the media exists
+	for _, path := range []string{"/api/media/v1/" + media.Id, "/api/media/v1/" + media.Id + "/analysis", "/api/media/v1/" + media.Id + "/content"} {
+		expectStatus(t, bob.request(t, http.MethodGet, path, nil, nil), http.StatusNotFound)
+	}
+	expectStatus(t, bob.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id, map[string]string{"title": "Mine now"}), http.StatusNotFound)
+	expectStatus(t, bob.request(t, http.MethodDelete, "/api/media/v1/"+media.Id, nil, nil), http.StatusNotFound)
+
+	listTitles := func(api *testApi) []string {
+		resp := api.request(t, http.MethodGet, "/api/media/v1?sort=title", nil, nil)
+		expectStatus(t, resp, http.StatusOK)
+		var items []map[string]any
+		decodeBody(t, resp, &items)
+		titles := []string{}
+		for _, item := range items {
+			titles = append(titles, item["title"].(string))
+		}
+		return titles
+	}
+	if titles := listTitles(bob); len(titles) != 1 || titles[0] != "Bob's clip" {
+		t.Errorf("bob should only list his media, got %v", titles)
+	}
+	if titles := listTitles(admin); len(titles) != 2 {
+		t.Errorf("admins should list every media, got %v", titles)
+	}
+
+	expectStatus(t, admin.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id, map[string]string{"title": "Moderated"}), http.StatusOK)
+	expectStatus(t, admin.request(t, http.MethodDelete, "/api/media/v1/"+media.Id, nil, nil), http.StatusOK)
+}
+
+func TestUploadOwnership(t *testing.T) {
+	alice := newTestApi(t)
+	bob := alice.as(t, "bob", false)
+	content := fakeContent(pngMagic, 20)
+
+	resp := alice.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{
+		HEADER_UPLOAD_LENGTH:   strconv.Itoa(len(content)),
+		HEADER_UPLOAD_METADATA: titleMetadata,
+	})
+	expectStatus(t, resp, http.StatusCreated)
+	location := resp.Header.Get("Location")
+
+	expectStatus(t, bob.tusRequest(t, http.MethodHead, location, "", nil), http.StatusNotFound)
+	expectStatus(t, bob.patchChunk(t, location, 0, content), http.StatusNotFound)
+	expectStatus(t, bob.tusRequest(t, http.MethodDelete, location, "", nil), http.StatusNotFound)
+
+	resp = alice.patchChunk(t, location, 0, content)
+	expectStatus(t, resp, http.StatusNoContent)
+	mediaId := resp.Header.Get(HEADER_UPLOAD_MEDIA_ID)
+	expectStatus(t, alice.request(t, http.MethodGet, "/api/media/v1/"+mediaId, nil, nil), http.StatusOK)
+	expectStatus(t, bob.request(t, http.MethodGet, "/api/media/v1/"+mediaId, nil, nil), http.StatusNotFound)
+}
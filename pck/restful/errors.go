@@ -1,13 +1,43 @@
 package restful
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"runtime/debug"
 	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// codes of the errors that do not come from a utils.CustomError
+const (
+	CODE_BAD_REQUEST            = "bad_request"
+	CODE_NOT_FOUND              = "not_found"
+	CODE_METHOD_NOT_ALLOWED     = "method_not_allowed"
+	CODE_PAYLOAD_TOO_LARGE      = "payload_too_large"
+	CODE_UNSUPPORTED_MEDIA_TYPE = "unsupported_media_type"
+	CODE_INTERNAL_ERROR         = "internal_error"
 )
 
+const problemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 body of every error response. Code identifies the error for
+// machines, Detail explains this occurrence to humans and may change at any time.
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	RequestId string              `json:"requestId,omitempty"`
+	Errors    []*utils.FieldError `json:"errors,omitempty"`
+}
+
 func (app *restfulApi) reportServerError(r *http.Request, err error) {
 	var (
 		message = err.Error()
@@ -16,52 +46,125 @@ func (app *restfulApi) reportServerError(r *http.Request, err error) {
 		trace   = string(debug.Stack())
 	)
 
-	requestAttrs := slog.Group("request", "method", method, "url", url)
+	requestAttrs := slog.Group("request", "method", method, "url", url, "requestId", middleware.GetReqID(r.Context()))
 	app.logger.Error(message, requestAttrs, "trace", trace)
 
 }
 
-func (app *restfulApi) errorMessage(w http.ResponseWriter, r *http.Request, status int, message string, headers http.Header) {
-	message = strings.ToUpper(message[:1]) + message[1:]
+func (app *restfulApi) problem(w http.ResponseWriter, r *http.Request, status int, code string, detail string, fieldErrors []*utils.FieldError, headers http.Header) {
+	if detail != "" {
+		detail = strings.ToUpper(detail[:1]) + detail[1:]
+	}
+	problem := Problem{
+		// no dedicated documentation per problem type, the code tells them apart
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestId: middleware.GetReqID(r.Context()),
+		Errors:    fieldErrors,
+	}
 
-	err := JSONWithHeaders(w, status, map[string]string{"Error": message}, headers)
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set("Content-Type", problemContentType)
+	err := JSONWithHeaders(w, status, problem, headers)
 	if err != nil {
 		app.reportServerError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// errorResponse renders a utils.CustomError, possibly wrapped, with its own status and
+// code, and a utils.ValidationError with its field errors. Any other error is unexpected
+// and reported as a server error.
+func (app *restfulApi) errorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var validationError *utils.ValidationError
+	if errors.As(err, &validationError) {
+		app.failedValidation(w, r, validationError.Errors)
+		return
+	}
+	var customError *utils.CustomError
+	if errors.As(err, &customError) {
+		app.problem(w, r, customError.Status, customError.Code, err.Error(), nil, nil)
+		return
+	}
+	app.serverError(w, r, err)
+}
+
 func (app *restfulApi) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	app.reportServerError(r, err)
 
 	message := "The server encountered a problem and could not process your request"
-	app.errorMessage(w, r, http.StatusInternalServerError, message, nil)
+	app.problem(w, r, http.StatusInternalServerError, CODE_INTERNAL_ERROR, message, nil, nil)
 }
 
 func (app *restfulApi) notFound(w http.ResponseWriter, r *http.Request) {
 	message := "The requested resource could not be found"
-	app.errorMessage(w, r, http.StatusNotFound, message, nil)
-}
-
-func (app *restfulApi) somethingWentWrong(w http.ResponseWriter, r *http.Request) {
-	message := "Something went wrong"
-	app.errorMessage(w, r, http.StatusInternalServerError, message, nil)
+	app.problem(w, r, http.StatusNotFound, CODE_NOT_FOUND, message, nil, nil)
 }
 
 func (app *restfulApi) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("The %s method is not supported for this resource", r.Method)
-	app.errorMessage(w, r, http.StatusMethodNotAllowed, message, nil)
+	app.problem(w, r, http.StatusMethodNotAllowed, CODE_METHOD_NOT_ALLOWED, message, nil, nil)
 }
 
+// badRequest keeps the code of a utils.CustomError, other errors are generic bad requests.
 func (app *restfulApi) badRequest(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorMessage(w, r, http.StatusBadRequest, err.Error(), nil)
+	var customError *utils.CustomError
+	if errors.As(err, &customError) {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.problem(w, r, http.StatusBadRequest, CODE_BAD_REQUEST, err.Error(), nil, nil)
 }
 
-func (app *restfulApi) failedValidation(w http.ResponseWriter, r *http.Request, errors []error) {
-	jsonErrors := map[string][]error{"errors": errors}
+// unauthorized challenges the client for credentials of either scheme, see RFC 6750. The
+// error attribute tells a rejected bearer token apart from a missing one.
+func (app *restfulApi) unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	customError := utils.ErrMissingCredentials
+	errors.As(err, &customError)
+	bearer := AUTH_SCHEME_BEARER + ` realm="` + AUTH_REALM + `"`
+	if errors.Is(err, utils.ErrInvalidToken) {
+		bearer += `, error="invalid_token"`
+	}
+	headers := http.Header{}
+	headers.Add("WWW-Authenticate", bearer)
+	headers.Add("WWW-Authenticate", AUTH_SCHEME_API_KEY+` realm="`+AUTH_REALM+`"`)
+	app.problem(w, r, customError.Status, customError.Code, err.Error(), nil, headers)
+}
 
-	err := JSON(w, http.StatusUnprocessableEntity, jsonErrors)
-	if err != nil {
-		app.serverError(w, r, err)
+// forbidden tells an authenticated caller they may not perform the action, either because
+// their role does not allow it or because their API key lacks the scope.
+func (app *restfulApi) forbidden(w http.ResponseWriter, r *http.Request, err error) {
+	customError := utils.ErrForbidden
+	errors.As(err, &customError)
+	app.problem(w, r, customError.Status, customError.Code, err.Error(), nil, nil)
+}
+
+// tooManyRequests tells the client to slow down, Retry-After says for how long when it is known.
+func (app *restfulApi) tooManyRequests(w http.ResponseWriter, r *http.Request, err *utils.CustomError, retryAfter time.Duration) {
+	headers := http.Header{}
+	if retryAfter > 0 {
+		headers.Set("Retry-After", ceilSeconds(retryAfter))
 	}
+	app.problem(w, r, err.Status, err.Code, err.Message, nil, headers)
+}
+
+func (app *restfulApi) payloadTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	message := fmt.Sprintf("The request body must not be larger than %d bytes", limit)
+	app.problem(w, r, http.StatusRequestEntityTooLarge, CODE_PAYLOAD_TOO_LARGE, message, nil, nil)
+}
+
+func (app *restfulApi) unsupportedMediaType(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("The %s content type is not supported for this resource", r.Header.Get("Content-Type"))
+	app.problem(w, r, http.StatusUnsupportedMediaType, CODE_UNSUPPORTED_MEDIA_TYPE, message, nil, nil)
+}
+
+func (app *restfulApi) failedValidation(w http.ResponseWriter, r *http.Request, fieldErrors []*utils.FieldError) {
+	err := utils.ErrValidationFailed
+	app.problem(w, r, err.Status, err.Code, err.Message, fieldErrors, nil)
 }
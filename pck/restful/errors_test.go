@@ -0,0 +1,90 @@
+package restful
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+func decodeProblem(t *testing.T, resp *http.Response, status int) Problem {
+	t.Helper()
+	expectStatus(t, resp, status)
+	if contentType := resp.Header.Get("Content-Type"); contentType != problemContentType {
+		t.Fatalf("expected %s, got %q", problemContentType, contentType)
+	}
+	var problem Problem
+	decodeBody(t, resp, &problem)
+	if problem.Status != status || problem.Title != http.StatusText(status) || problem.Type != "about:blank" {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+	return problem
+}
+
+func TestProblemFromCustomError(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.request(t, http.MethodGet, "/api/media/v1/missing", nil, map[string]string{"X-Request-Id": "req-42"})
+	problem := decodeProblem(t, resp, http.StatusNotFound)
+	if problem.Code != utils.ErrMediaNotFound.Code || problem.RequestId != "req-42" || problem.Instance != "/api/media/v1/missing" {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+
+	// wrapped errors keep the code of the custom error and the detail of the wrapper
+	resp = api.request(t, http.MethodPost, "/api/media/v1/upload", strings.NewReader(""), map[string]string{
+		"Content-Type":     "application/octet-stream",
+		HEADER_MEDIA_TITLE: "%zz",
+	})
+	problem = decodeProblem(t, resp, http.StatusBadRequest)
+	if problem.Code != utils.ErrInvalidUploadMetadata.Code || !strings.Contains(problem.Detail, HEADER_MEDIA_TITLE) {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1?cursor=garbage", nil, nil)
+	problem = decodeProblem(t, resp, http.StatusBadRequest)
+	if problem.Code != utils.ErrInvalidCursor.Code {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+}
+
+func TestProblemFromRouter(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.request(t, http.MethodGet, "/api/unknown", nil, nil)
+	problem := decodeProblem(t, resp, http.StatusNotFound)
+	if problem.Code != CODE_NOT_FOUND || problem.RequestId == "" {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+
+	resp = api.request(t, http.MethodPatch, "/api/media/v1", nil, nil)
+	problem = decodeProblem(t, resp, http.StatusMethodNotAllowed)
+	if problem.Code != CODE_METHOD_NOT_ALLOWED {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1?limit=1000", nil, nil)
+	problem = decodeProblem(t, resp, http.StatusBadRequest)
+	if problem.Code != CODE_BAD_REQUEST || problem.Detail == "" {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+}
+
+func TestFailedValidation(t *testing.T) {
+	api := newTestApi(t)
+
+	recorder := httptest.NewRecorder()
+	api.app.failedValidation(recorder, httptest.NewRequest(http.MethodPost, "/api/media/v1", nil), []*utils.FieldError{
+		{Field: "title", Code: "required", Message: "must be provided"},
+		{Field: "size", Code: "too_large", Message: "must be at most 10 bytes"},
+	})
+
+	problem := decodeProblem(t, recorder.Result(), http.StatusUnprocessableEntity)
+	if problem.Code != utils.ErrValidationFailed.Code || len(problem.Errors) != 2 {
+		t.Fatalf("unexpected problem: %+v", problem)
+	}
+	if *problem.Errors[0] != (utils.FieldError{Field: "title", Code: "required", Message: "must be provided"}) {
+		t.Errorf("unexpected field error: %+v", problem.Errors[0])
+	}
+}
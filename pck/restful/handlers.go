@@ -1,98 +1,24 @@
 package restful
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
-	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/forensics"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
 	"github.com/go-chi/chi/v5"
-	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
-type WebSocketMessage struct {
-	Type MessageType `json:"type"`
-}
-
-type MessageType string
-
-const (
-	MEDIA_UPDATED MessageType = "media_updated"
-)
-
-func (app *restfulApi) wsHandler(w http.ResponseWriter, r *http.Request) {
-	// Upgrade the HTTP connection to a WebSocket connection
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-	defer conn.Close()
-
-	// Extract the unique identifier for the client
-	clientID := r.URL.Query().Get("client_id")
-	if clientID == "" {
-		app.serverError(w, r, fmt.Errorf("missing client_id"))
-		conn.Close()
-		return
-	}
-
-	app.connLock.Lock()
-	if existingConn, exists := app.connections[clientID]; exists {
-		// Close the old connection for the client
-		existingConn.Close()
-	}
-	// Register the new connection
-	app.connections[clientID] = conn
-	app.connLock.Unlock()
-
-	defer func() {
-		// Unregister the connection when it is closed
-		app.connLock.Lock()
-		delete(app.connections, clientID)
-		app.connLock.Unlock()
-	}()
-
-	// Only read messages from the client and log them
-	for {
-		_, p, err := conn.ReadMessage()
-		if err != nil {
-			app.logger.Error("WebSocket: Error reading message", "error", err)
-			return
-		}
-		app.logger.Info("WebSocket: Received message -> ", "message", string(p))
-		// Echo the message back to the client
-		// if err := conn.WriteMessage(messageType, p); err != nil {
-		// 	app.logger.Error("WebSocket: Error writing message", "error", err)
-		// 	return
-		// }
-	}
-
-}
-
-func (app *restfulApi) broadcastMessage(message WebSocketMessage) {
-	app.connLock.Lock()
-	defer app.connLock.Unlock()
-
-	for clientId := range app.connections {
-		conn := app.connections[clientId]
-		if err := conn.WriteJSON(message); err != nil {
-			app.logger.Error("WebSocket: Error broadcasting message", "error", err)
-			conn.Close()
-			delete(app.connections, clientId) // Remove broken connections
-		}
-	}
-}
-
 func (app *restfulApi) serverStatus(w http.ResponseWriter, r *http.Request) {
 	data := app.healthcheck.Status()
 	err := JSON(w, http.StatusOK, data)
@@ -102,18 +28,36 @@ func (app *restfulApi) serverStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *restfulApi) getMediaById(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
 	id := chi.URLParam(r, "id")
 	if id == "" {
 		app.badRequest(w, r, utils.ErrMissingID)
 		return
 	}
-	media, err := app.mediaRepository.GetByID(id)
+	var fields []string
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		var err error
+		fields, err = repositories.ParseFields(raw)
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+	}
+	media, err := app.mediaRepository.GetByID(r.Context(), scope, id, fields)
 	if err != nil {
-		if errors.Is(err, utils.ErrMediaNotFound) {
-			app.notFound(w, r)
+		app.errorResponse(w, r, err)
+		return
+	}
+	if fields != nil {
+		projected, err := projectMedia(media, fields)
+		if err != nil {
+			app.serverError(w, r, err)
 			return
 		}
-		app.somethingWentWrong(w, r)
+		err = JSON(w, http.StatusOK, projected)
+		if err != nil {
+			app.serverError(w, r, err)
+		}
 		return
 	}
 	err = JSON(w, http.StatusOK, media)
@@ -123,22 +67,35 @@ func (app *restfulApi) getMediaById(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *restfulApi) deleteMediaById(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
 	id := chi.URLParam(r, "id")
 	if id == "" {
 		app.badRequest(w, r, utils.ErrMissingID)
 		return
 	}
-	ok, err := app.mediaRepository.Delete(id)
+	media, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil)
 	if err != nil {
-		if errors.Is(err, utils.ErrMediaNotFound) {
-			app.notFound(w, r)
-			return
+		app.errorResponse(w, r, err)
+		return
+	}
+	// the artifacts of the analysis are in the blob store too, the analysis goes with the media
+	var artifacts []models.Artifact
+	if analysis, err := app.analysisRepository.GetByMediaID(r.Context(), id); err == nil {
+		for _, result := range analysis.Results {
+			artifacts = append(artifacts, result.Artifacts...)
 		}
-		app.somethingWentWrong(w, r)
+	}
+	deleted, err := app.mediaRepository.Delete(r.Context(), scope, id)
+	if err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
-	app.broadcastMessage(WebSocketMessage{Type: MEDIA_UPDATED})
-	err = JSON(w, http.StatusOK, map[string]bool{"deleted": ok})
+	app.deleteContent(media.ContentKey)
+	for _, artifact := range artifacts {
+		app.deleteContent(artifact.Key)
+	}
+	app.publishMediaEvent(r, events.MEDIA_DELETED, media)
+	err = JSON(w, http.StatusOK, map[string]bool{"deleted": deleted})
 	if err != nil {
 		app.serverError(w, r, err)
 	}
@@ -151,12 +108,33 @@ func (app *restfulApi) addNewMedia(w http.ResponseWriter, r *http.Request) {
 		app.badRequest(w, r, err)
 		return
 	}
-	createdMedia, err := app.mediaRepository.Create(&payload)
+	v := validator.New()
+	content, err := app.storeMediaData(r, &payload)
 	if err != nil {
-		app.somethingWentWrong(w, r)
+		if !errors.Is(err, utils.ErrInvalidMediaData) {
+			app.errorResponse(w, r, err)
+			return
+		}
+		v.AddError("mediaData", utils.ErrInvalidMediaData.Code, "must be valid base64")
+	}
+	validator.ValidateMediaFields(v, &payload, nil)
+	validator.ValidateMediaContent(v, &payload, content, nil, app.mediaRules)
+	if !v.Valid() {
+		app.deleteContent(payload.ContentKey)
+		app.failedValidation(w, r, v.Errors)
 		return
 	}
-	app.broadcastMessage(WebSocketMessage{Type: MEDIA_UPDATED})
+	validator.ApplyContent(&payload, content)
+	payload.TenantId = identityOf(r).TenantId
+	payload.OwnerId = identityOf(r).Subject
+	createdMedia, err := app.mediaRepository.Create(r.Context(), &payload)
+	if err != nil {
+		app.deleteContent(payload.ContentKey)
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.analysisPipeline.Enqueue(createdMedia.Id)
+	app.publishMediaEvent(r, events.MEDIA_CREATED, createdMedia)
 	err = JSON(w, http.StatusCreated, createdMedia)
 	if err != nil {
 		app.serverError(w, r, err)
@@ -164,6 +142,7 @@ func (app *restfulApi) addNewMedia(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *restfulApi) updateMedia(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
 	var payload repositories.MediaPayload
 	err := DecodeJSON(w, r, &payload)
 	if err != nil {
@@ -175,16 +154,41 @@ func (app *restfulApi) updateMedia(w http.ResponseWriter, r *http.Request) {
 		app.badRequest(w, r, utils.ErrMissingID)
 		return
 	}
-	updatedMedia, err := app.mediaRepository.Update(id, &payload)
+	existingMedia, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil)
 	if err != nil {
-		if errors.Is(err, utils.ErrMediaNotFound) {
-			app.notFound(w, r)
+		app.errorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	content, err := app.storeMediaData(r, &payload)
+	if err != nil {
+		if !errors.Is(err, utils.ErrInvalidMediaData) {
+			app.errorResponse(w, r, err)
 			return
 		}
-		app.somethingWentWrong(w, r)
+		v.AddError("mediaData", utils.ErrInvalidMediaData.Code, "must be valid base64")
+	}
+	validator.ValidateMediaFields(v, &payload, existingMedia)
+	validator.ValidateMediaContent(v, &payload, content, existingMedia, app.mediaRules)
+	if !v.Valid() {
+		app.deleteContent(payload.ContentKey)
+		app.failedValidation(w, r, v.Errors)
 		return
 	}
-	app.broadcastMessage(WebSocketMessage{Type: MEDIA_UPDATED})
+	if content != nil {
+		validator.ApplyContent(&payload, content)
+	}
+	updatedMedia, err := app.mediaRepository.Update(r.Context(), scope, id, &payload)
+	if err != nil {
+		app.deleteContent(payload.ContentKey)
+		app.errorResponse(w, r, err)
+		return
+	}
+	if payload.ContentKey != "" {
+		app.deleteContent(existingMedia.ContentKey)
+		app.analysisPipeline.Enqueue(updatedMedia.Id)
+	}
+	app.publishMediaEvent(r, events.MEDIA_UPDATED, updatedMedia)
 	err = JSON(w, http.StatusOK, updatedMedia)
 	if err != nil {
 		app.serverError(w, r, err)
@@ -192,13 +196,225 @@ func (app *restfulApi) updateMedia(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *restfulApi) getAllMedia(w http.ResponseWriter, r *http.Request) {
-	allMedia, err := app.mediaRepository.GetAll()
+	scope := scopeOf(r)
+	options, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+	page, err := app.mediaRepository.List(r.Context(), scope, *options)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	items, err := projectMediaList(page.Items, options.Fields)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = JSONWithHeaders(w, http.StatusOK, items, linkHeader(r, page))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *restfulApi) getMediaAnalysis(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	// the analysis is only visible to whoever can see the media
+	if _, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	analysis, err := app.analysisRepository.GetByMediaID(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, analysis)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// getElaHeatmap returns the error level heatmap of the forensics detector.
+func (app *restfulApi) getElaHeatmap(w http.ResponseWriter, r *http.Request) {
+	app.serveArtifact(w, r, forensics.ELA_ARTIFACT)
+}
+
+// serveArtifact answers with a file a detector produced during the last analysis of the media.
+func (app *restfulApi) serveArtifact(w http.ResponseWriter, r *http.Request, name string) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	if _, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	analysis, err := app.analysisRepository.GetByMediaID(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	artifact := findArtifact(analysis, name)
+	if artifact == nil {
+		app.errorResponse(w, r, utils.ErrArtifactNotFound)
+		return
+	}
+	content, err := app.blobStore.Get(r.Context(), artifact.Key)
+	if err != nil {
+		if errors.Is(err, utils.ErrBlobNotFound) {
+			err = utils.ErrArtifactNotFound
+		}
+		app.errorResponse(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	// a new analysis rewrites the artifact, its time tells the caches
+	w.Header().Set("Content-Type", artifact.ContentType)
+	http.ServeContent(w, r, "", analysis.UpdatedAt, content)
+}
+
+func findArtifact(analysis *models.Analysis, name string) *models.Artifact {
+	for _, result := range analysis.Results {
+		for i := range result.Artifacts {
+			if result.Artifacts[i].Name == name {
+				return &result.Artifacts[i]
+			}
+		}
+	}
+	return nil
+}
+
+// getMediaMetadata returns what the content of a media says about itself, extracted when it was analysed.
+func (app *restfulApi) getMediaMetadata(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	if _, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	metadata, err := app.metadataRepository.GetByMediaID(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, metadata)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// getMediaTimeline returns the frame by frame analysis of a video, built when it was analysed.
+func (app *restfulApi) getMediaTimeline(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	if _, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	timeline, err := app.timelineRepository.GetByMediaID(r.Context(), id)
 	if err != nil {
-		app.somethingWentWrong(w, r)
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, timeline)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// runMediaAnalysis schedules a new analysis of a media, clients follow its progress at the Location.
+func (app *restfulApi) runMediaAnalysis(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
 		return
 	}
-	err = JSON(w, http.StatusOK, allMedia)
+	if _, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.analysisPipeline.Enqueue(id)
+	headers := http.Header{}
+	headers.Set("Location", r.URL.Path)
+	err := JSONWithHeaders(w, http.StatusAccepted, map[string]string{"mediaId": id, "status": string(models.ANALYSIS_PENDING)}, headers)
 	if err != nil {
 		app.serverError(w, r, err)
 	}
 }
+
+func (app *restfulApi) getMediaContent(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	media, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	content, err := app.blobStore.Get(r.Context(), media.ContentKey)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	// ServeContent answers Range and conditional requests, the checksum doubles as a strong ETag
+	w.Header().Set("Content-Type", media.MimeType)
+	if media.Checksum != "" {
+		w.Header().Set("ETag", strconv.Quote(media.Checksum))
+	}
+	http.ServeContent(w, r, "", time.Time{}, content)
+}
+
+// storeMediaData streams the base64 payload into the blob store and points the payload at the stored blob,
+// the returned content is nil when the payload carries none.
+func (app *restfulApi) storeMediaData(r *http.Request, payload *repositories.MediaPayload) (*validator.Content, error) {
+	if payload.MediaData == "" {
+		return nil, nil
+	}
+	sniffer := validator.NewSniffer(base64.NewDecoder(base64.StdEncoding, strings.NewReader(payload.MediaData)))
+	info, err := app.blobStore.Put(r.Context(), repositories.NewContentKey(), sniffer)
+	if err != nil {
+		var corruptInputError base64.CorruptInputError
+		if errors.As(err, &corruptInputError) {
+			return nil, utils.ErrInvalidMediaData
+		}
+		return nil, err
+	}
+	payload.MediaData = ""
+	payload.ContentKey = info.Key
+	payload.Checksum = info.Checksum
+	return &validator.Content{Size: info.Size, MimeType: sniffer.MimeType()}, nil
+}
+
+func (app *restfulApi) deleteContent(key string) {
+	if key == "" {
+		return
+	}
+	// the request may already be cancelled, the blob has to go regardless
+	if err := app.blobStore.Delete(context.Background(), key); err != nil {
+		app.logger.Error("failed to delete media content", slog.String("key", key), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,645 @@
+package restful
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/forensics"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/gorilla/websocket"
+)
+
+func (api *testApi) createMedia(t *testing.T, payload repositories.MediaPayload) *models.Media {
+	t.Helper()
+	resp := api.requestJSON(t, http.MethodPost, "/api/media/v1", payload)
+	expectStatus(t, resp, http.StatusCreated)
+	var media models.Media
+	decodeBody(t, resp, &media)
+	return &media
+}
+
+func checksum(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestCreateAndGetMedia(t *testing.T) {
+	api := newTestApi(t)
+
+	created := api.createMedia(t, repositories.MediaPayload{
+		Title:     "Press conference",
+		Type:      "video",
+		MimeType:  "video/mp4",
+		Tags:      "politics, press",
+		MediaData: encodedContent(mp4Magic, 100),
+	})
+	if created.Id == "" || created.Size != 100 || created.Checksum != checksum(fakeContent(mp4Magic, 100)) {
+		t.Fatalf("unexpected created media: %+v", created)
+	}
+	if enqueued := api.pipeline.Enqueued(); !slices.Equal(enqueued, []string{created.Id}) {
+		t.Errorf("expected the new media to be enqueued for analysis, got %v", enqueued)
+	}
+
+	resp := api.request(t, http.MethodGet, "/api/media/v1/"+created.Id, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var media models.Media
+	decodeBody(t, resp, &media)
+	if media.Title != "Press conference" || media.Tags != "politics, press" {
+		t.Errorf("unexpected media: %+v", media)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"?fields=title", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var projected map[string]any
+	decodeBody(t, resp, &projected)
+	if len(projected) != 2 || projected["id"] != created.Id || projected["title"] != "Press conference" {
+		t.Errorf("expected only the id and title, got %v", projected)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"?fields=unknown", nil, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/missing", nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestCreateMediaValidation(t *testing.T) {
+	api := newTestApi(t)
+
+	tests := []struct {
+		name    string
+		payload repositories.MediaPayload
+		// field errors expected, as field:code
+		errors []string
+	}{
+		{
+			name:    "missing fields",
+			payload: repositories.MediaPayload{},
+			errors:  []string{"title:required", "mediaData:required"},
+		},
+		{
+			name:    "invalid base64",
+			payload: repositories.MediaPayload{Title: "broken", MediaData: "not base64!"},
+			errors:  []string{"mediaData:invalid_media_data"},
+		},
+		{
+			name:    "spoofed MIME type and size",
+			payload: repositories.MediaPayload{Title: "spoofed", Type: "video", MimeType: "video/mp4", Size: 10, MediaData: encodedContent(pngMagic, 20)},
+			errors:  []string{"mimeType:mismatch", "size:mismatch", "type:mismatch"},
+		},
+		{
+			name:    "content type not allowed",
+			payload: repositories.MediaPayload{Title: "text", MediaData: base64.StdEncoding.EncodeToString([]byte("just some text"))},
+			errors:  []string{"mediaData:unsupported_type"},
+		},
+		{
+			name:    "too long",
+			payload: repositories.MediaPayload{Title: strings.Repeat("t", 201), MediaData: encodedContent(pngMagic, 20)},
+			errors:  []string{"title:too_long"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := api.requestJSON(t, http.MethodPost, "/api/media/v1", test.payload)
+			problem := decodeProblem(t, resp, http.StatusUnprocessableEntity)
+			errors := []string{}
+			for _, fieldError := range problem.Errors {
+				errors = append(errors, fieldError.Field+":"+fieldError.Code)
+			}
+			if !slices.Equal(errors, test.errors) {
+				t.Errorf("expected errors %v, got %v", test.errors, errors)
+			}
+		})
+	}
+
+	resp := api.request(t, http.MethodGet, "/api/media/v1", nil, nil)
+	var items []map[string]any
+	decodeBody(t, resp, &items)
+	if len(items) != 0 || len(api.pipeline.Enqueued()) != 0 {
+		t.Errorf("invalid media must not be stored, got %v", items)
+	}
+
+	resp = api.request(t, http.MethodPost, "/api/media/v1", strings.NewReader("{"), map[string]string{"Content-Type": "application/json"})
+	expectStatus(t, resp, http.StatusBadRequest)
+}
+
+func TestCreateMediaDetectsMimeType(t *testing.T) {
+	api := newTestApi(t)
+
+	// an alias of the detected type and no type at all are both fine, the detected type is stored
+	created := api.createMedia(t, repositories.MediaPayload{Title: "Photo", MimeType: "image/jpg", MediaData: encodedContent(jpegMagic, 20)})
+	if created.MimeType != "image/jpeg" || created.Type != "image" {
+		t.Errorf("expected the detected MIME type, got %+v", created)
+	}
+	created = api.createMedia(t, repositories.MediaPayload{Title: "Song", MediaData: encodedContent(mp3Magic, 20)})
+	if created.MimeType != "audio/mpeg" || created.Type != "audio" {
+		t.Errorf("expected the detected MIME type, got %+v", created)
+	}
+}
+
+func TestUpdateMedia(t *testing.T) {
+	api := newTestApi(t)
+	created := api.createMedia(t, repositories.MediaPayload{
+		Title:     "Original",
+		Type:      "image",
+		MimeType:  "image/png",
+		MediaData: encodedContent(pngMagic, 20),
+	})
+
+	resp := api.requestJSON(t, http.MethodPut, "/api/media/v1/"+created.Id, repositories.MediaPayload{Title: "Renamed"})
+	expectStatus(t, resp, http.StatusOK)
+	var updated models.Media
+	decodeBody(t, resp, &updated)
+	if updated.Title != "Renamed" || updated.MimeType != "image/png" || updated.Checksum != created.Checksum {
+		t.Errorf("expected only the title to change, got %+v", updated)
+	}
+	if enqueued := api.pipeline.Enqueued(); len(enqueued) != 1 {
+		t.Errorf("a metadata change must not trigger a new analysis, enqueued %v", enqueued)
+	}
+
+	resp = api.requestJSON(t, http.MethodPut, "/api/media/v1/"+created.Id, repositories.MediaPayload{MediaData: encodedContent(jpegMagic, 30)})
+	expectStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &updated)
+	if updated.Checksum != checksum(fakeContent(jpegMagic, 30)) || updated.MimeType != "image/jpeg" {
+		t.Errorf("expected the content to be replaced, got %+v", updated)
+	}
+	if enqueued := api.pipeline.Enqueued(); len(enqueued) != 2 {
+		t.Errorf("replaced content must be analysed again, enqueued %v", enqueued)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/content", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	if body, _ := io.ReadAll(resp.Body); string(body) != fakeContent(jpegMagic, 30) {
+		t.Errorf("expected the new content, got %q", body)
+	}
+
+	resp = api.requestJSON(t, http.MethodPut, "/api/media/v1/"+created.Id, repositories.MediaPayload{MimeType: "image/png", Type: "video"})
+	problem := decodeProblem(t, resp, http.StatusUnprocessableEntity)
+	if len(problem.Errors) != 2 || problem.Errors[0].Field != "mimeType" || problem.Errors[1].Field != "type" {
+		t.Errorf("expected the MIME type and type to be rejected, got %+v", problem.Errors)
+	}
+
+	resp = api.requestJSON(t, http.MethodPut, "/api/media/v1/missing", repositories.MediaPayload{Title: "Renamed"})
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestDeleteMedia(t *testing.T) {
+	api := newTestApi(t)
+	created := api.createMedia(t, repositories.MediaPayload{Title: "Doomed", MediaData: encodedContent(pngMagic, 20)})
+
+	resp := api.request(t, http.MethodDelete, "/api/media/v1/"+created.Id, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var deleted map[string]bool
+	decodeBody(t, resp, &deleted)
+	if !deleted["deleted"] {
+		t.Errorf("expected deleted to be true, got %v", deleted)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id, nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+	resp = api.request(t, http.MethodDelete, "/api/media/v1/"+created.Id, nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestListMedia(t *testing.T) {
+	api := newTestApi(t)
+	ids := map[string]string{}
+	for i, media := range []repositories.MediaPayload{
+		{Title: "a", Type: "image", MimeType: "image/png", Tags: "cats"},
+		{Title: "b", Type: "video", MimeType: "video/mp4", Tags: "cats, dogs"},
+		{Title: "c", Type: "image", MimeType: "image/jpeg", Tags: "dogs"},
+		{Title: "d", Type: "audio", MimeType: "audio/mpeg"},
+		{Title: "e", Type: "image", MimeType: "image/png", Tags: "cats"},
+	} {
+		magic := map[string]string{"image/png": pngMagic, "video/mp4": mp4Magic, "image/jpeg": jpegMagic, "audio/mpeg": mp3Magic}[media.MimeType]
+		media.MediaData = encodedContent(magic, (i+1)*100)
+		ids[media.Title] = api.createMedia(t, media).Id
+	}
+
+	list := func(t *testing.T, path string) ([]map[string]any, map[string]string) {
+		t.Helper()
+		resp := api.request(t, http.MethodGet, path, nil, nil)
+		expectStatus(t, resp, http.StatusOK)
+		var items []map[string]any
+		decodeBody(t, resp, &items)
+		return items, parseLinks(t, resp.Header.Get("Link"))
+	}
+	titles := func(items []map[string]any) []string {
+		result := []string{}
+		for _, item := range items {
+			result = append(result, item["title"].(string))
+		}
+		return result
+	}
+
+	items, links := list(t, "/api/media/v1?sort=size&limit=2")
+	if got := titles(items); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("first page: expected [a b], got %v", got)
+	}
+	if _, ok := links["prev"]; ok {
+		t.Errorf("the first page must not link to a previous one")
+	}
+	items, links = list(t, links["next"])
+	if got := titles(items); !slices.Equal(got, []string{"c", "d"}) {
+		t.Fatalf("second page: expected [c d], got %v", got)
+	}
+	last, _ := list(t, links["next"])
+	if got := titles(last); !slices.Equal(got, []string{"e"}) {
+		t.Fatalf("last page: expected [e], got %v", got)
+	}
+	items, _ = list(t, links["prev"])
+	if got := titles(items); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("previous page: expected [a b], got %v", got)
+	}
+
+	items, _ = list(t, "/api/media/v1?sort=-size&type=image&tag=cats")
+	if got := titles(items); !slices.Equal(got, []string{"e", "a"}) {
+		t.Errorf("filtered: expected [e a], got %v", got)
+	}
+	items, _ = list(t, "/api/media/v1?sort=title&minSize=200&maxSize=400")
+	if got := titles(items); !slices.Equal(got, []string{"b", "c", "d"}) {
+		t.Errorf("size range: expected [b c d], got %v", got)
+	}
+	items, _ = list(t, "/api/media/v1?mimeType=image/png&fields=title")
+	if len(items) != 2 || len(items[0]) != 2 {
+		t.Errorf("expected two media with only the id and title, got %v", items)
+	}
+
+	err := api.app.analysisRepository.Save(context.Background(), &models.Analysis{MediaId: ids["c"], Status: models.ANALYSIS_COMPLETED, Verdict: models.VERDICT_MANIPULATED})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, _ = list(t, "/api/media/v1?verdict=manipulated")
+	if got := titles(items); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("verdict: expected [c], got %v", got)
+	}
+	// the media never analysed are inconclusive
+	items, _ = list(t, "/api/media/v1?verdict=inconclusive&sort=title")
+	if got := titles(items); !slices.Equal(got, []string{"a", "b", "d", "e"}) {
+		t.Errorf("inconclusive: expected [a b d e], got %v", got)
+	}
+
+	for _, query := range []string{"limit=0", "limit=abc", "sort=owner", "verdict=fake", "minSize=-1", "cursor=garbage", "fields=secret"} {
+		resp := api.request(t, http.MethodGet, "/api/media/v1?"+query, nil, nil)
+		expectStatus(t, resp, http.StatusBadRequest)
+	}
+	// a cursor only works with the ordering it was issued for
+	resp := api.request(t, http.MethodGet, "/api/media/v1?sort=title&cursor="+url.QueryEscape(cursorOf(t, links["prev"])), nil, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+}
+
+// parseLinks maps the rel of every link in a Link header to its target.
+func parseLinks(t *testing.T, header string) map[string]string {
+	t.Helper()
+	links := map[string]string{}
+	if header == "" {
+		return links
+	}
+	for _, link := range strings.Split(header, ", ") {
+		target, params, ok := strings.Cut(link, ">; ")
+		if !ok || !strings.HasPrefix(target, "<") {
+			t.Fatalf("invalid link %q", link)
+		}
+		rel := strings.Trim(strings.TrimPrefix(params, "rel="), `"`)
+		links[rel] = strings.TrimPrefix(target, "<")
+	}
+	return links
+}
+
+func cursorOf(t *testing.T, link string) string {
+	t.Helper()
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Query().Get("cursor")
+}
+
+func TestGetMediaAnalysis(t *testing.T) {
+	api := newTestApi(t)
+	created := api.createMedia(t, repositories.MediaPayload{Title: "Analysed", MediaData: encodedContent(pngMagic, 20)})
+
+	resp := api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/analysis", nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	err := api.app.analysisRepository.Save(context.Background(), &models.Analysis{
+		MediaId: created.Id,
+		Status:  models.ANALYSIS_COMPLETED,
+		Score:   0.9,
+		Verdict: models.VERDICT_MANIPULATED,
+		Results: []models.DetectorResult{{Detector: "test", Score: 0.9, Verdict: models.VERDICT_MANIPULATED, Signals: []models.Signal{}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/analysis", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var analysis models.Analysis
+	decodeBody(t, resp, &analysis)
+	if analysis.Verdict != models.VERDICT_MANIPULATED || len(analysis.Results) != 1 {
+		t.Errorf("unexpected analysis: %+v", analysis)
+	}
+
+	// the analysis goes away with its media
+	api.request(t, http.MethodDelete, "/api/media/v1/"+created.Id, nil, nil)
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/analysis", nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestGetMediaMetadata(t *testing.T) {
+	api := newTestApi(t)
+	created := api.createMedia(t, repositories.MediaPayload{Title: "Photo", MediaData: encodedContent(pngMagic, 20)})
+	hidden := api.as(t, "bob", false).createMedia(t, repositories.MediaPayload{Title: "Bob's", MediaData: encodedContent(pngMagic, 20)})
+
+	// nothing is extracted before the analysis
+	problem := decodeProblem(t, api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/metadata", nil, nil), http.StatusNotFound)
+	if problem.Code != utils.ErrMetadataNotFound.Code {
+		t.Errorf("expected %s, got %+v", utils.ErrMetadataNotFound.Code, problem)
+	}
+
+	captured := time.Date(2024, time.May, 4, 10, 30, 0, 0, time.UTC)
+	for _, id := range []string{created.Id, hidden.Id} {
+		err := api.app.metadataRepository.Save(context.Background(), &models.MediaMetadata{
+			MediaId:    id,
+			Format:     "png",
+			Sources:    []string{"exif"},
+			Software:   "Adobe Photoshop 25.0",
+			CapturedAt: &models.MetadataTime{Time: captured, Local: true},
+			GPS:        &models.GPSPosition{Latitude: 46.77, Longitude: 23.59},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/metadata", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var metadata map[string]any
+	decodeBody(t, resp, &metadata)
+	// dates without time zone are written without an offset
+	if metadata["software"] != "Adobe Photoshop 25.0" || metadata["capturedAt"] != "2024-05-04T10:30:00" || metadata["gps"] == nil {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+
+	problem = decodeProblem(t, api.request(t, http.MethodGet, "/api/media/v1/"+hidden.Id+"/metadata", nil, nil), http.StatusNotFound)
+	if problem.Code != utils.ErrMediaNotFound.Code {
+		t.Errorf("expected %s, got %+v", utils.ErrMediaNotFound.Code, problem)
+	}
+
+	// the metadata goes away with its media
+	api.request(t, http.MethodDelete, "/api/media/v1/"+created.Id, nil, nil)
+	if _, err := api.app.metadataRepository.GetByMediaID(context.Background(), created.Id); !errors.Is(err, utils.ErrMetadataNotFound) {
+		t.Errorf("expected the metadata to be deleted, got %v", err)
+	}
+}
+
+func TestGetElaHeatmap(t *testing.T) {
+	api := newTestApi(t)
+	created := api.createMedia(t, repositories.MediaPayload{Title: "Photo", MediaData: encodedContent(pngMagic, 20)})
+	path := "/api/media/v1/" + created.Id + "/analysis/ela.png"
+
+	// the heatmap is produced by the analysis
+	problem := decodeProblem(t, api.request(t, http.MethodGet, path, nil, nil), http.StatusNotFound)
+	if problem.Code != utils.ErrAnalysisNotFound.Code {
+		t.Errorf("expected %s, got %+v", utils.ErrAnalysisNotFound.Code, problem)
+	}
+	analysis := &models.Analysis{MediaId: created.Id, Status: models.ANALYSIS_COMPLETED, Verdict: models.VERDICT_INCONCLUSIVE, UpdatedAt: time.Now().UTC()}
+	if err := api.app.analysisRepository.Save(context.Background(), analysis); err != nil {
+		t.Fatal(err)
+	}
+	problem = decodeProblem(t, api.request(t, http.MethodGet, path, nil, nil), http.StatusNotFound)
+	if problem.Code != utils.ErrArtifactNotFound.Code {
+		t.Errorf("expected %s, got %+v", utils.ErrArtifactNotFound.Code, problem)
+	}
+
+	heatmap := []byte("\x89PNG heatmap")
+	key := repositories.ArtifactKey(created.Id, "forensics", forensics.ELA_ARTIFACT)
+	if _, err := api.app.blobStore.Put(context.Background(), key, bytes.NewReader(heatmap)); err != nil {
+		t.Fatal(err)
+	}
+	analysis.Results = []models.DetectorResult{{
+		Detector:  "forensics",
+		Verdict:   models.VERDICT_INCONCLUSIVE,
+		Artifacts: []models.Artifact{{Name: forensics.ELA_ARTIFACT, ContentType: "image/png", Key: key}},
+	}}
+	if err := api.app.analysisRepository.Save(context.Background(), analysis); err != nil {
+		t.Fatal(err)
+	}
+	resp := api.request(t, http.MethodGet, path, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("expected a PNG, got %q", contentType)
+	}
+	if body, _ := io.ReadAll(resp.Body); !bytes.Equal(body, heatmap) {
+		t.Errorf("expected the stored heatmap, got %q", body)
+	}
+
+	// the analysis lists the artifact without its key
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/analysis", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var listed struct {
+		Results []struct {
+			Artifacts []map[string]any `json:"artifacts"`
+		} `json:"results"`
+	}
+	decodeBody(t, resp, &listed)
+	if len(listed.Results) != 1 || len(listed.Results[0].Artifacts) != 1 || listed.Results[0].Artifacts[0]["name"] != forensics.ELA_ARTIFACT || listed.Results[0].Artifacts[0]["key"] != nil {
+		t.Errorf("unexpected artifacts: %+v", listed.Results)
+	}
+
+	// the heatmap goes away with its media
+	api.request(t, http.MethodDelete, "/api/media/v1/"+created.Id, nil, nil)
+	if _, err := api.app.blobStore.Get(context.Background(), key); !errors.Is(err, utils.ErrBlobNotFound) {
+		t.Errorf("expected the heatmap to be deleted, got %v", err)
+	}
+}
+
+func TestGetMediaTimeline(t *testing.T) {
+	api := newTestApi(t)
+	created := api.createMedia(t, repositories.MediaPayload{Title: "Clip", MediaData: encodedContent(mp4Magic, 100)})
+	hidden := api.as(t, "bob", false).createMedia(t, repositories.MediaPayload{Title: "Bob's", MediaData: encodedContent(mp4Magic, 100)})
+	path := "/api/media/v1/" + created.Id + "/analysis/timeline"
+
+	// the timeline is built by the analysis
+	problem := decodeProblem(t, api.request(t, http.MethodGet, path, nil, nil), http.StatusNotFound)
+	if problem.Code != utils.ErrTimelineNotFound.Code {
+		t.Errorf("expected %s, got %+v", utils.ErrTimelineNotFound.Code, problem)
+	}
+
+	for _, id := range []string{created.Id, hidden.Id} {
+		err := api.app.timelineRepository.Save(context.Background(), &models.Timeline{
+			MediaId:  id,
+			Sampling: models.SAMPLING_KEYFRAMES,
+			Duration: 6,
+			Segments: []models.TimelineSegment{
+				{Start: 0, End: 2.5, Frame: 0, Score: 0.1, Verdict: models.VERDICT_AUTHENTIC},
+				{Start: 2.5, End: 6, Frame: 2.5, Score: 0.7, Verdict: models.VERDICT_SUSPICIOUS, Results: []models.DetectorResult{{Detector: "forensics", Score: 0.7, Verdict: models.VERDICT_SUSPICIOUS}}},
+			},
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := api.request(t, http.MethodGet, path, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var timeline models.Timeline
+	decodeBody(t, resp, &timeline)
+	if timeline.MediaId != created.Id || timeline.Duration != 6 || len(timeline.Segments) != 2 {
+		t.Fatalf("unexpected timeline: %+v", timeline)
+	}
+	if suspicious := timeline.Segments[1]; suspicious.Start != 2.5 || suspicious.Verdict != models.VERDICT_SUSPICIOUS || len(suspicious.Results) != 1 {
+		t.Errorf("unexpected segment: %+v", suspicious)
+	}
+
+	problem = decodeProblem(t, api.request(t, http.MethodGet, "/api/media/v1/"+hidden.Id+"/analysis/timeline", nil, nil), http.StatusNotFound)
+	if problem.Code != utils.ErrMediaNotFound.Code {
+		t.Errorf("expected %s, got %+v", utils.ErrMediaNotFound.Code, problem)
+	}
+
+	// the timeline goes away with its media
+	api.request(t, http.MethodDelete, "/api/media/v1/"+created.Id, nil, nil)
+	if _, err := api.app.timelineRepository.GetByMediaID(context.Background(), created.Id); !errors.Is(err, utils.ErrTimelineNotFound) {
+		t.Errorf("expected the timeline to be deleted, got %v", err)
+	}
+}
+
+func TestGetMediaContent(t *testing.T) {
+	api := newTestApi(t)
+	created := api.createMedia(t, repositories.MediaPayload{Title: "Clip", MimeType: "video/mp4", MediaData: encodedContent(mp4Magic, 40)})
+
+	resp := api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/content", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "video/mp4" {
+		t.Errorf("expected the media MIME type, got %q", contentType)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag != strconv.Quote(checksum(fakeContent(mp4Magic, 40))) {
+		t.Errorf("expected the checksum as ETag, got %q", etag)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/content", nil, map[string]string{"Range": "bytes=4-7"})
+	expectStatus(t, resp, http.StatusPartialContent)
+	if body, _ := io.ReadAll(resp.Body); string(body) != "ftyp" {
+		t.Errorf("expected the requested range, got %q", body)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/content", nil, map[string]string{"If-None-Match": etag})
+	expectStatus(t, resp, http.StatusNotModified)
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/missing/content", nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	// media stored without a checksum have no ETag rather than an empty one
+	stored, err := api.app.mediaRepository.GetByID(context.Background(), repositories.SCOPE_ALL, created.Id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := &repositories.MediaPayload{ContentKey: stored.ContentKey}
+	if _, err := api.app.mediaRepository.Update(context.Background(), repositories.SCOPE_ALL, created.Id, payload); err != nil {
+		t.Fatal(err)
+	}
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+created.Id+"/content", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	if _, ok := resp.Header["Etag"]; ok {
+		t.Errorf("expected no ETag, got %q", resp.Header.Get("ETag"))
+	}
+}
+
+func TestWebSocketBroadcast(t *testing.T) {
+	api := newTestApi(t)
+	conn := api.dialWebSocket(t, "test-client")
+
+	media := api.createMedia(t, repositories.MediaPayload{Title: "Broadcast", MediaData: encodedContent(pngMagic, 20)})
+	expectStatus(t, api.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id, map[string]string{"title": "Renamed"}), http.StatusOK)
+	expectStatus(t, api.request(t, http.MethodDelete, "/api/media/v1/"+media.Id, nil, nil), http.StatusOK)
+
+	var previous uint64
+	for _, expected := range []struct {
+		eventType events.Type
+		title     string
+	}{
+		{events.MEDIA_CREATED, "Broadcast"},
+		{events.MEDIA_UPDATED, "Renamed"},
+		{events.MEDIA_DELETED, "Renamed"},
+	} {
+		event := readMediaEvent(t, conn)
+		if event.Type != expected.eventType || event.MediaId != media.Id || event.Actor != testUser || event.Timestamp.IsZero() {
+			t.Errorf("unexpected %s event: %+v", expected.eventType, event)
+		}
+		if event.Data.Title != expected.title || event.Data.MimeType != "image/png" || event.Data.OwnerId != testUser {
+			t.Errorf("unexpected summary in the %s event: %+v", expected.eventType, event.Data)
+		}
+		if event.Sequence <= previous {
+			t.Errorf("expected the sequence to increase past %d, got %d", previous, event.Sequence)
+		}
+		previous = event.Sequence
+	}
+}
+
+// mediaEvent is an events.Event as clients decode it.
+type mediaEvent struct {
+	Type      events.Type         `json:"type"`
+	Sequence  uint64              `json:"sequence"`
+	MediaId   string              `json:"mediaId"`
+	Actor     string              `json:"actor"`
+	Timestamp time.Time           `json:"timestamp"`
+	Data      events.MediaSummary `json:"data"`
+}
+
+func readMediaEvent(t *testing.T, conn *websocket.Conn) *mediaEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var event mediaEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("expected an event: %v", err)
+	}
+	return &event
+}
+
+func TestEventSchema(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.request(t, http.MethodGet, "/api/events/v1/schema", nil, map[string]string{"Authorization": ""})
+	expectStatus(t, resp, http.StatusOK)
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	decodeBody(t, resp, &schema)
+	// the schema documents every field of the envelope
+	js, err := json.Marshal(&events.Event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(js, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	for field := range envelope {
+		if _, ok := schema.Properties[field]; !ok {
+			t.Errorf("the schema misses the %s field", field)
+		}
+	}
+	if len(schema.Properties) != len(envelope) {
+		t.Errorf("expected %d properties in the schema, got %d", len(envelope), len(schema.Properties))
+	}
+}
@@ -0,0 +1,117 @@
+package restful
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var verdicts = map[models.Verdict]bool{
+	models.VERDICT_AUTHENTIC:    true,
+	models.VERDICT_SUSPICIOUS:   true,
+	models.VERDICT_MANIPULATED:  true,
+	models.VERDICT_INCONCLUSIVE: true,
+}
+
+// parseListOptions reads the paging, filtering and sorting query parameters, e.g.
+// ?limit=50&type=video&tag=politics&minSize=1024&verdict=suspicious&sort=-createdAt&fields=title,tags
+func parseListOptions(query url.Values) (*repositories.ListOptions, error) {
+	options := &repositories.ListOptions{
+		Limit:      defaultPageSize,
+		Cursor:     query.Get("cursor"),
+		Type:       query.Get("type"),
+		MimeType:   query.Get("mimeType"),
+		Tag:        query.Get("tag"),
+		Verdict:    models.Verdict(query.Get("verdict")),
+		SortBy:     repositories.SORT_CREATED_AT,
+		Descending: true,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxPageSize {
+			return nil, fmt.Errorf("limit must be an integer between 1 and %d", maxPageSize)
+		}
+		options.Limit = value
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  **int
+	}{
+		{"minSize", &options.MinSize},
+		{"maxSize", &options.MaxSize},
+	} {
+		raw := query.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("%s must be a non negative integer", bound.name)
+		}
+		*bound.dst = &value
+	}
+
+	options.Fields = repositories.SummaryFields
+	if fields := query.Get("fields"); fields != "" {
+		selected, err := repositories.ParseFields(fields)
+		if err != nil {
+			return nil, err
+		}
+		options.Fields = selected
+	}
+
+	if options.Verdict != "" && !verdicts[options.Verdict] {
+		return nil, fmt.Errorf("unknown verdict %q", options.Verdict)
+	}
+
+	// a leading "-" sorts in descending order
+	if sort := query.Get("sort"); sort != "" {
+		field, descending := strings.CutPrefix(sort, "-")
+		switch repositories.SortField(field) {
+		case repositories.SORT_CREATED_AT, repositories.SORT_SIZE, repositories.SORT_TITLE:
+			options.SortBy = repositories.SortField(field)
+			options.Descending = descending
+		default:
+			return nil, fmt.Errorf("cannot sort by %q, use one of createdAt, size or title", field)
+		}
+	}
+
+	return options, nil
+}
+
+// linkHeader builds an RFC 8288 Link header pointing at the neighbouring pages,
+// keeping every other query parameter of the current request.
+func linkHeader(r *http.Request, page *repositories.MediaPage) http.Header {
+	links := []string{}
+	for _, link := range []struct {
+		rel    string
+		cursor string
+	}{
+		{"next", page.NextCursor},
+		{"prev", page.PrevCursor},
+	} {
+		if link.cursor == "" {
+			continue
+		}
+		query := r.URL.Query()
+		query.Set("cursor", link.cursor)
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), link.rel))
+	}
+
+	if len(links) == 0 {
+		return nil
+	}
+	return http.Header{"Link": []string{strings.Join(links, ", ")}}
+}
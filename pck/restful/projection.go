@@ -0,0 +1,40 @@
+package restful
+
+import (
+	"encoding/json"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// projectMedia renders only the selected fields of a media, relying on its JSON
+// field names so the projection always matches the full representation.
+func projectMedia(media *models.Media, fields []string) (map[string]json.RawMessage, error) {
+	js, err := json.Marshal(media)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(js, &all); err != nil {
+		return nil, err
+	}
+
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected, nil
+}
+
+func projectMediaList(mediaList []models.Media, fields []string) ([]map[string]json.RawMessage, error) {
+	projected := make([]map[string]json.RawMessage, 0, len(mediaList))
+	for i := range mediaList {
+		media, err := projectMedia(&mediaList[i], fields)
+		if err != nil {
+			return nil, err
+		}
+		projected = append(projected, media)
+	}
+	return projected, nil
+}
@@ -0,0 +1,115 @@
+package restful
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+// route groups sharing a rate limit, a client has a separate bucket in each of them
+const (
+	RATE_LIMIT_PUBLIC = "public"
+	RATE_LIMIT_READ   = "read"
+	RATE_LIMIT_WRITE  = "write"
+	RATE_LIMIT_UPLOAD = "upload"
+	RATE_LIMIT_ADMIN  = "admin"
+	// requests checked by authenticate, counted by IP address before the credentials are
+	RATE_LIMIT_AUTH = "auth"
+)
+
+// rate limit headers of draft-ietf-httpapi-ratelimit-headers
+const (
+	HEADER_RATE_LIMIT_LIMIT     = "RateLimit-Limit"
+	HEADER_RATE_LIMIT_REMAINING = "RateLimit-Remaining"
+	HEADER_RATE_LIMIT_RESET     = "RateLimit-Reset"
+	HEADER_RATE_LIMIT_POLICY    = "RateLimit-Policy"
+)
+
+// rateLimit takes a token from the bucket the client has in the group. Behind authenticate
+// the client is the API key or the user, elsewhere the IP address resolved by RealIP.
+func (app *restfulApi) rateLimit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := app.rateLimits[group]
+			if !limit.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			result, err := app.rateLimitStore.Take(r.Context(), group+"|"+clientKey(r), limit, time.Now())
+			if err != nil {
+				// an unavailable store must not take the whole API down with it
+				app.logger.Warn("rate limit skipped", slog.String("group", group), slog.Any("error", err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			headers := w.Header()
+			headers.Set(HEADER_RATE_LIMIT_LIMIT, strconv.Itoa(limit.Burst))
+			headers.Set(HEADER_RATE_LIMIT_REMAINING, strconv.Itoa(result.Remaining))
+			headers.Set(HEADER_RATE_LIMIT_RESET, ceilSeconds(result.Reset))
+			headers.Set(HEADER_RATE_LIMIT_POLICY, fmt.Sprintf("%d;w=%s", limit.Burst, ceilSeconds(limit.Period)))
+			if !result.Allowed {
+				app.tooManyRequests(w, r, utils.ErrRateLimited, result.RetryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitConcurrentUploads rejects the uploads of a client already streaming as many as allowed.
+// Streams are only counted on this replica, they hold a connection to it anyway.
+func (app *restfulApi) limitConcurrentUploads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.maxConcurrentUploads <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := clientKey(r)
+		app.uploadsLock.Lock()
+		if app.uploadsInFlight[key] >= app.maxConcurrentUploads {
+			app.uploadsLock.Unlock()
+			app.tooManyRequests(w, r, utils.ErrTooManyUploads, 0)
+			return
+		}
+		app.uploadsInFlight[key]++
+		app.uploadsLock.Unlock()
+
+		defer func() {
+			app.uploadsLock.Lock()
+			app.uploadsInFlight[key]--
+			if app.uploadsInFlight[key] == 0 {
+				delete(app.uploadsInFlight, key)
+			}
+			app.uploadsLock.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey identifies who a request is counted against.
+func clientKey(r *http.Request) string {
+	identity, ok := auth.FromContext(r.Context())
+	switch {
+	case ok && identity.ApiKeyId != "":
+		return "apikey:" + identity.ApiKeyId
+	case ok:
+		return "user:" + identity.TenantId + ":" + identity.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(duration.Seconds())))
+}
@@ -0,0 +1,123 @@
+package restful
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+func TestRateLimit(t *testing.T) {
+	api := newTestApi(t)
+	api.app.rateLimits[RATE_LIMIT_READ] = repositories.RateLimit{Burst: 2, Period: time.Minute}
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		resp := api.request(t, http.MethodGet, "/api/media/v1", nil, nil)
+		expectStatus(t, resp, http.StatusOK)
+		if resp.Header.Get(HEADER_RATE_LIMIT_LIMIT) != "2" || resp.Header.Get(HEADER_RATE_LIMIT_REMAINING) != strconv.Itoa(remaining) ||
+			resp.Header.Get(HEADER_RATE_LIMIT_POLICY) != "2;w=60" {
+			t.Errorf("unexpected rate limit headers: %v", resp.Header)
+		}
+	}
+
+	resp := api.request(t, http.MethodGet, "/api/media/v1/missing", nil, nil)
+	problem := decodeProblem(t, resp, http.StatusTooManyRequests)
+	if problem.Code != utils.ErrRateLimited.Code {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+	// a token comes back every 30 seconds
+	if retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After")); retryAfter <= 0 || retryAfter > 30 {
+		t.Errorf("unexpected Retry-After %q", resp.Header.Get("Retry-After"))
+	}
+
+	// other route groups, users and API keys have buckets of their own
+	expectStatus(t, api.request(t, http.MethodDelete, "/api/media/v1/missing", nil, nil), http.StatusNotFound)
+	expectStatus(t, api.as(t, "bob", false).request(t, http.MethodGet, "/api/media/v1", nil, nil), http.StatusOK)
+	bot := api.withApiKey(api.createApiKey(t, map[string]any{"name": "bot", "subject": testUser, "scopes": []string{auth.SCOPE_MEDIA_READ}}).Key)
+	expectStatus(t, bot.request(t, http.MethodGet, "/api/media/v1", nil, nil), http.StatusOK)
+}
+
+func TestConcurrentUploadLimit(t *testing.T) {
+	api := newTestApi(t)
+	api.app.maxConcurrentUploads = 1
+
+	// the first upload streams until the pipe is closed
+	body, writer := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, api.server.URL+"/api/media/v1/upload", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+api.token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := api.server.Client().Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	t.Cleanup(func() {
+		writer.Close()
+		<-done
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		api.app.uploadsLock.Lock()
+		streaming := len(api.app.uploadsInFlight)
+		api.app.uploadsLock.Unlock()
+		if streaming == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the first upload never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp := api.request(t, http.MethodPost, "/api/media/v1/upload", nil, map[string]string{"Content-Type": "application/octet-stream"})
+	problem := decodeProblem(t, resp, http.StatusTooManyRequests)
+	if problem.Code != utils.ErrTooManyUploads.Code {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+
+	// other clients upload meanwhile
+	resp = api.as(t, "bob", false).request(t, http.MethodPost, "/api/media/v1/upload", nil, map[string]string{"Content-Type": "application/octet-stream"})
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.Errorf("expected the upload of another client to go through")
+	}
+
+	writer.Close()
+	<-done
+	expectStatus(t, api.request(t, http.MethodGet, "/api/media/v1", nil, nil), http.StatusOK)
+	api.app.uploadsLock.Lock()
+	defer api.app.uploadsLock.Unlock()
+	if len(api.app.uploadsInFlight) != 0 {
+		t.Errorf("expected no upload in flight, got %v", api.app.uploadsInFlight)
+	}
+}
+
+func TestRateLimitAuthentication(t *testing.T) {
+	api := newTestApi(t)
+	api.app.rateLimits[RATE_LIMIT_AUTH] = repositories.RateLimit{Burst: 3, Period: time.Minute}
+	guesser := api.withApiKey("not-a-key")
+
+	expectStatus(t, guesser.request(t, http.MethodGet, "/api/media/v1", nil, nil), http.StatusUnauthorized)
+	expectStatus(t, guesser.request(t, http.MethodGet, "/api/admin/v1/users", nil, nil), http.StatusUnauthorized)
+	expectStatus(t, guesser.request(t, http.MethodPost, "/api/media/v1/uploads/", nil, map[string]string{HEADER_TUS_RESUMABLE: TUS_VERSION}), http.StatusUnauthorized)
+
+	// the address ran out of attempts, the credentials are no longer checked
+	problem := decodeProblem(t, guesser.request(t, http.MethodGet, "/api/media/v1", nil, nil), http.StatusTooManyRequests)
+	if problem.Code != utils.ErrRateLimited.Code {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+	expectStatus(t, api.request(t, http.MethodGet, "/api/media/v1", nil, nil), http.StatusTooManyRequests)
+
+	// public routes keep their own limit
+	expectStatus(t, api.request(t, http.MethodGet, "/api/health-check/v1/status", nil, nil), http.StatusOK)
+}
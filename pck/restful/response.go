@@ -17,11 +17,12 @@ func JSONWithHeaders(w http.ResponseWriter, status int, data any, headers http.H
 
 	js = append(js, '\n')
 
+	// the given headers may override the content type, e.g. for application/problem+json
+	w.Header().Set("Content-Type", "application/json")
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	w.Write(js)
 
@@ -3,27 +3,108 @@ package restful
 import (
 	"log/slog"
 	"sync"
+	"time"
 
+	"github.com/cosmintimis/deepfake-guardian-api/internal/config"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/analysis"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
 	"github.com/cosmintimis/deepfake-guardian-api/pck/healthcheck"
-	"github.com/cosmintimis/deepfake-guardian-api/pck/postgresql"
-	"github.com/gorilla/websocket"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/similarity"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/uploads"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
 )
 
 type restfulApi struct {
-	logger          *slog.Logger
-	healthcheck     healthcheck.Service
-	mediaRepository repositories.MediaRepository
-	connections     map[string]*websocket.Conn
-	connLock        sync.Mutex
+	logger             *slog.Logger
+	healthcheck        healthcheck.Service
+	mediaRepository    repositories.MediaRepository
+	analysisRepository repositories.AnalysisRepository
+	metadataRepository repositories.MediaMetadataRepository
+	timelineRepository repositories.TimelineRepository
+	reviewRepository   repositories.ReviewRepository
+	userRepository     repositories.UserRepository
+	analysisPipeline   analysis.Pipeline
+	blobStore          repositories.BlobStore
+	uploadService      uploads.Service
+	tokenVerifier      *auth.JWTVerifier
+	apiKeys            *auth.ApiKeys
+	policy             *auth.Policy
+	rateLimitStore     repositories.RateLimitStore
+	events             events.Bus
+	similarity         *similarity.Index
+	rateLimits         map[string]repositories.RateLimit
+	mediaRules         *validator.MediaRules
+	maxUploadSize      int64
+	uploadTimeout      time.Duration
+	// uploads every client is streaming, capped at maxConcurrentUploads
+	maxConcurrentUploads int
+	uploadsInFlight      map[string]int
+	uploadsLock          sync.Mutex
+	hub                  *wsHub
 }
 
-func New(logger *slog.Logger, healthcheck healthcheck.Service) *restfulApi {
-	return &restfulApi{
-		logger:          logger,
-		healthcheck:     healthcheck,
-		mediaRepository: postgresql.NewMediaRepository(logger),
-		connections:     make(map[string]*websocket.Conn),
-		connLock:        sync.Mutex{},
+// Dependencies are the services and repositories the handlers are built on, every one is required.
+type Dependencies struct {
+	Healthcheck        healthcheck.Service
+	MediaRepository    repositories.MediaRepository
+	AnalysisRepository repositories.AnalysisRepository
+	MetadataRepository repositories.MediaMetadataRepository
+	TimelineRepository repositories.TimelineRepository
+	ReviewRepository   repositories.ReviewRepository
+	UserRepository     repositories.UserRepository
+	AnalysisPipeline   analysis.Pipeline
+	BlobStore          repositories.BlobStore
+	UploadService      uploads.Service
+	TokenVerifier      *auth.JWTVerifier
+	ApiKeys            *auth.ApiKeys
+	Policy             *auth.Policy
+	RateLimitStore     repositories.RateLimitStore
+	EventBus           events.Bus
+	SimilarityIndex    *similarity.Index
+}
+
+func New(logger *slog.Logger, deps Dependencies) *restfulApi {
+	app := &restfulApi{
+		logger:             logger,
+		healthcheck:        deps.Healthcheck,
+		mediaRepository:    deps.MediaRepository,
+		analysisRepository: deps.AnalysisRepository,
+		metadataRepository: deps.MetadataRepository,
+		timelineRepository: deps.TimelineRepository,
+		reviewRepository:   deps.ReviewRepository,
+		userRepository:     deps.UserRepository,
+		analysisPipeline:   deps.AnalysisPipeline,
+		blobStore:          deps.BlobStore,
+		uploadService:      deps.UploadService,
+		tokenVerifier:      deps.TokenVerifier,
+		apiKeys:            deps.ApiKeys,
+		policy:             deps.Policy,
+		rateLimitStore:     deps.RateLimitStore,
+		events:             deps.EventBus,
+		similarity:         deps.SimilarityIndex,
+		rateLimits: map[string]repositories.RateLimit{
+			RATE_LIMIT_PUBLIC: repositories.RateLimit(config.GetConfig().RateLimitPublic),
+			RATE_LIMIT_READ:   repositories.RateLimit(config.GetConfig().RateLimitRead),
+			RATE_LIMIT_WRITE:  repositories.RateLimit(config.GetConfig().RateLimitWrite),
+			RATE_LIMIT_UPLOAD: repositories.RateLimit(config.GetConfig().RateLimitUpload),
+			RATE_LIMIT_ADMIN:  repositories.RateLimit(config.GetConfig().RateLimitAdmin),
+			RATE_LIMIT_AUTH:   repositories.RateLimit(config.GetConfig().RateLimitAuth),
+		},
+		mediaRules:           &validator.MediaRules{AllowedMimeTypes: config.GetConfig().AllowedMimeTypes},
+		maxUploadSize:        config.GetConfig().MaxUploadSize,
+		uploadTimeout:        config.GetConfig().UploadTimeout,
+		maxConcurrentUploads: config.GetConfig().MaxConcurrentUploads,
+		uploadsInFlight:      map[string]int{},
+		hub:                  newWsHub(logger, config.GetConfig().WsSendQueueSize, config.GetConfig().WsWriteTimeout, config.GetConfig().WsPongTimeout),
 	}
+	// the hub hears of the events of every replica, whoever published them
+	deps.EventBus.Subscribe(app.hub.Broadcast)
+	return app
+}
+
+// Stop disconnects the websocket clients, the HTTP server doesn't track the connections it handed over.
+func (app *restfulApi) Stop() {
+	app.hub.Stop()
 }
@@ -0,0 +1,232 @@
+package restful
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/filesystem"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/healthcheck"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/memory"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/similarity"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/uploads"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testMaxUploadSize = 1024
+	testJWTSecret     = "test-secret"
+	// the user every request of a test api is sent as, unless switched with as
+	testUser = "alice"
+)
+
+// smallest contents the content sniffing recognises, padded to the requested size
+const (
+	pngMagic  = "\x89PNG\r\n\x1a\n"
+	jpegMagic = "\xff\xd8\xff"
+	mp3Magic  = "ID3"
+	mp4Magic  = "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"
+)
+
+func fakeContent(magic string, size int) string {
+	return magic + strings.Repeat("x", size-len(magic))
+}
+
+func encodedContent(magic string, size int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fakeContent(magic, size)))
+}
+
+// recordingPipeline stands in for the analysis pipeline, it only remembers what was enqueued.
+type recordingPipeline struct {
+	lock     sync.Mutex
+	enqueued []string
+}
+
+func (p *recordingPipeline) Enqueue(mediaId string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.enqueued = append(p.enqueued, mediaId)
+}
+
+func (p *recordingPipeline) Start(workers int) {}
+
+func (p *recordingPipeline) Stop() {}
+
+func (p *recordingPipeline) Enqueued() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return slices.Clone(p.enqueued)
+}
+
+type testApi struct {
+	app      *restfulApi
+	server   *httptest.Server
+	pipeline *recordingPipeline
+	// token is sent as bearer token unless a request sets its own Authorization header,
+	// apiKey replaces it for machine clients
+	token  string
+	apiKey string
+}
+
+// newTestApi serves the whole router backed by the in-memory repositories and a blob store in a temporary directory.
+func newTestApi(t *testing.T) *testApi {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewDatabase()
+	mediaRepository := memory.NewMediaRepository(db)
+	blobStore, err := filesystem.NewBlobStore(logger, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaRules := &validator.MediaRules{AllowedMimeTypes: []string{"image/png", "image/jpeg", "video/mp4", "audio/mpeg"}}
+	uploadService, err := uploads.New(logger, memory.NewUploadRepository(db), mediaRepository, blobStore, mediaRules, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenVerifier, err := auth.NewJWTVerifier(auth.JWTOptions{Secret: testJWTSecret, AdminClaim: "admin", TenantClaim: "org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown users upload and analyse their own media, the role tests assign the others
+	userRepository := memory.NewUserRepository(db)
+	policy, err := auth.NewPolicy(logger, userRepository, models.ROLE_ANALYST)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline := &recordingPipeline{}
+	// the pipeline hashes the media, the tests index them with hashMedia
+	eventBus := memory.NewEventBus()
+	similarityIndex := similarity.NewIndex(logger, memory.NewMediaHashRepository(db), similarity.NewHasher(nil))
+	eventBus.Subscribe(similarityIndex.HandleEvent)
+	app := New(logger, Dependencies{
+		Healthcheck:        healthcheck.New(),
+		MediaRepository:    mediaRepository,
+		AnalysisRepository: memory.NewAnalysisRepository(db),
+		MetadataRepository: memory.NewMediaMetadataRepository(db),
+		TimelineRepository: memory.NewTimelineRepository(db),
+		ReviewRepository:   memory.NewReviewRepository(db),
+		UserRepository:     userRepository,
+		AnalysisPipeline:   pipeline,
+		BlobStore:          blobStore,
+		UploadService:      uploadService,
+		TokenVerifier:      tokenVerifier,
+		ApiKeys:            auth.NewApiKeys(logger, memory.NewApiKeyRepository(db)),
+		Policy:             policy,
+		RateLimitStore:     memory.NewRateLimitStore(),
+		EventBus:           eventBus,
+		SimilarityIndex:    similarityIndex,
+	})
+	app.mediaRules = mediaRules
+	app.maxUploadSize = testMaxUploadSize
+	app.uploadTimeout = time.Minute
+	app.hub.queueSize = 16
+	app.hub.writeTimeout = time.Second
+	app.hub.pongTimeout = time.Minute
+	t.Cleanup(app.Stop)
+
+	server := httptest.NewServer(app.Routes())
+	t.Cleanup(server.Close)
+	return &testApi{app: app, server: server, pipeline: pipeline, token: signToken(t, jwt.MapClaims{"sub": testUser})}
+}
+
+// signToken signs HS256 claims with the test secret, an expiry is added unless the claims have one.
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// as returns the same api sending its requests as another user.
+func (api *testApi) as(t *testing.T, subject string, admin bool) *testApi {
+	t.Helper()
+	other := *api
+	other.token = signToken(t, jwt.MapClaims{"sub": subject, "admin": admin})
+	return &other
+}
+
+func (api *testApi) request(t *testing.T, method string, path string, body io.Reader, headers map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, api.server.URL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api.token != "" {
+		req.Header.Set("Authorization", "Bearer "+api.token)
+	}
+	if api.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+api.apiKey)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := api.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (api *testApi) requestJSON(t *testing.T, method string, path string, body any) *http.Response {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = strings.NewReader(string(js))
+	}
+	return api.request(t, method, path, reader, map[string]string{"Content-Type": "application/json"})
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		if resp.Request != nil {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode, body)
+		}
+		t.Fatalf("expected status %d, got %d: %s", status, resp.StatusCode, body)
+	}
+}
+
+func decodeBody(t *testing.T, resp *http.Response, dst any) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+}
+
+func TestServerStatus(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.request(t, http.MethodGet, "/api/health-check/v1/status", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var status healthcheck.HealthStatus
+	decodeBody(t, resp, &status)
+	if status.Status != "ok" {
+		t.Errorf("expected status ok, got %q", status.Status)
+	}
+}
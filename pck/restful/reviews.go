@@ -0,0 +1,92 @@
+package restful
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxReviewNoteLength = 5000
+
+type reviewPayload struct {
+	Verdict models.Verdict `json:"verdict"`
+	Note    string         `json:"note"`
+}
+
+func (app *restfulApi) getMediaReview(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	// the review is only visible to whoever can see the media
+	if _, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	review, err := app.reviewRepository.GetByMediaID(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, review)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// reviewMedia records the final verdict of a reviewer, it replaces any earlier review.
+func (app *restfulApi) reviewMedia(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	var payload reviewPayload
+	err := DecodeJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+	media, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(payload.Verdict != "", "verdict", "required", "must be provided")
+	v.Check(payload.Verdict == "" || validator.PermittedValue(payload.Verdict, models.VERDICTS...), "verdict", "unknown_verdict",
+		fmt.Sprintf("must be one of %s", joinValues(models.VERDICTS)))
+	v.Check(validator.MaxChars(payload.Note, maxReviewNoteLength), "note", "too_long", fmt.Sprintf("must not be more than %d characters long", maxReviewNoteLength))
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	review := &models.Review{
+		MediaId:    id,
+		Verdict:    payload.Verdict,
+		Note:       payload.Note,
+		ReviewerId: identityOf(r).Subject,
+		ReviewedAt: time.Now().UTC(),
+	}
+	err = app.reviewRepository.Save(r.Context(), review)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.publishMediaEvent(r, events.MEDIA_UPDATED, media)
+	err = JSON(w, http.StatusOK, review)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
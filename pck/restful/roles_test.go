@@ -0,0 +1,104 @@
+package restful
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+)
+
+// assignRole gives the subject a role through the admin endpoint.
+func (api *testApi) assignRole(t *testing.T, subject string, role models.Role) {
+	t.Helper()
+	resp := api.as(t, "root", true).requestJSON(t, http.MethodPut, "/api/admin/v1/users/"+subject, map[string]any{"role": role})
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestViewerCanOnlyRead(t *testing.T) {
+	api := newTestApi(t)
+	// viewers upload nothing, they read the media of their colleagues
+	media := api.as(t, "bob", false).createMedia(t, repositories.MediaPayload{Title: "Bob's clip", MediaData: encodedContent(pngMagic, 10)})
+	api.assignRole(t, testUser, models.ROLE_VIEWER)
+
+	expectStatus(t, api.request(t, http.MethodGet, "/api/media/v1/"+media.Id, nil, nil), http.StatusOK)
+	var listed []map[string]any
+	resp := api.request(t, http.MethodGet, "/api/media/v1", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &listed)
+	if len(listed) != 1 || listed[0]["id"] != media.Id {
+		t.Errorf("expected the viewer to list the media of the tenant, got %v", listed)
+	}
+
+	forbidden := []*http.Response{
+		api.requestJSON(t, http.MethodPost, "/api/media/v1", map[string]string{"title": "Another", "mediaData": encodedContent(pngMagic, 10)}),
+		api.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id, map[string]string{"title": "Renamed"}),
+		api.request(t, http.MethodDelete, "/api/media/v1/"+media.Id, nil, nil),
+		api.request(t, http.MethodPost, "/api/media/v1/"+media.Id+"/analysis", nil, nil),
+		api.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id+"/review", map[string]string{"verdict": "authentic"}),
+		api.request(t, http.MethodGet, "/api/admin/v1/users", nil, nil),
+	}
+	for _, resp := range forbidden {
+		problem := decodeProblem(t, resp, http.StatusForbidden)
+		if problem.Code != "forbidden" {
+			t.Errorf("%s %s: expected the forbidden code, got %q", resp.Request.Method, resp.Request.URL.Path, problem.Code)
+		}
+	}
+}
+
+func TestReviewerReviewsEveryMedia(t *testing.T) {
+	alice := newTestApi(t)
+	reviewer := alice.as(t, "rita", false)
+	alice.assignRole(t, "rita", models.ROLE_REVIEWER)
+	media := alice.createMedia(t, repositories.MediaPayload{Title: "Alice's clip", MediaData: encodedContent(pngMagic, 10)})
+
+	// analysts can't settle the verdict of their own media
+	decodeProblem(t, alice.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id+"/review", map[string]string{"verdict": "authentic"}), http.StatusForbidden)
+	expectStatus(t, alice.request(t, http.MethodGet, "/api/media/v1/"+media.Id+"/review", nil, nil), http.StatusNotFound)
+
+	problem := decodeProblem(t, reviewer.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id+"/review", map[string]string{"verdict": "fake", "note": strings.Repeat("x", maxReviewNoteLength+1)}), http.StatusUnprocessableEntity)
+	if len(problem.Errors) != 2 || problem.Errors[0].Code != "unknown_verdict" || problem.Errors[1].Field != "note" {
+		t.Errorf("unexpected field errors: %+v", problem.Errors)
+	}
+
+	resp := reviewer.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id+"/review", map[string]string{"verdict": "manipulated", "note": "spliced audio"})
+	expectStatus(t, resp, http.StatusOK)
+
+	resp = alice.request(t, http.MethodGet, "/api/media/v1/"+media.Id+"/review", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var review models.Review
+	decodeBody(t, resp, &review)
+	if review.Verdict != models.VERDICT_MANIPULATED || review.ReviewerId != "rita" || review.Note != "spliced audio" {
+		t.Errorf("unexpected review: %+v", review)
+	}
+
+	// reviewers read every media but only modify their own
+	expectStatus(t, reviewer.request(t, http.MethodGet, "/api/media/v1/"+media.Id, nil, nil), http.StatusOK)
+	expectStatus(t, reviewer.request(t, http.MethodDelete, "/api/media/v1/"+media.Id, nil, nil), http.StatusNotFound)
+	expectStatus(t, reviewer.request(t, http.MethodPut, "/api/media/v1/missing/review", strings.NewReader(`{"verdict":"authentic"}`), map[string]string{"Content-Type": "application/json"}), http.StatusNotFound)
+}
+
+func TestUserRoleManagement(t *testing.T) {
+	api := newTestApi(t)
+	admin := api.as(t, "root", true)
+
+	problem := decodeProblem(t, admin.requestJSON(t, http.MethodPut, "/api/admin/v1/users/bob", map[string]any{"role": "owner"}), http.StatusUnprocessableEntity)
+	if len(problem.Errors) != 1 || problem.Errors[0].Code != "unknown_role" {
+		t.Errorf("unexpected field errors: %+v", problem.Errors)
+	}
+
+	api.assignRole(t, "bob", models.ROLE_ADMIN)
+	// bob administers without the admin claim once the role is stored
+	resp := api.as(t, "bob", false).request(t, http.MethodGet, "/api/admin/v1/users", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var users []models.User
+	decodeBody(t, resp, &users)
+	if len(users) != 1 || users[0].Subject != "bob" || users[0].Role != models.ROLE_ADMIN {
+		t.Errorf("unexpected users: %+v", users)
+	}
+
+	expectStatus(t, admin.request(t, http.MethodDelete, "/api/admin/v1/users/bob", nil, nil), http.StatusOK)
+	decodeProblem(t, api.as(t, "bob", false).request(t, http.MethodGet, "/api/admin/v1/users", nil, nil), http.StatusForbidden)
+	expectStatus(t, admin.request(t, http.MethodDelete, "/api/admin/v1/users/bob", nil, nil), http.StatusNotFound)
+}
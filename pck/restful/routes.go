@@ -4,27 +4,105 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
+const requestTimeout = 60 * time.Second
+
 func (app *restfulApi) Routes() http.Handler {
 	router := createRouter()
+	router.NotFound(app.notFound)
+	router.MethodNotAllowed(app.methodNotAllowed)
 
 	router.Route("/api/health-check", func(r chi.Router) {
+		r.Use(middleware.Timeout(requestTimeout), app.rateLimit(RATE_LIMIT_PUBLIC))
 		r.Get("/v1/status", app.serverStatus)
 	})
 
+	// routes authenticate and pick the rate limit of the client, every route group declares the
+	// action its routes perform and the handlers only read the media the caller reaches. The
+	// credentials are only checked once the IP address is within its limit, guessing them is
+	// bounded as well.
 	router.Route("/api/media", func(r chi.Router) {
-		r.Get("/v1/{id}", app.getMediaById)
-		r.Get("/v1", app.getAllMedia)
-		r.Delete("/v1/{id}", app.deleteMediaById)
-		r.Post("/v1", app.addNewMedia)
-		r.Put("/v1/{id}", app.updateMedia)
+		r.Group(func(r chi.Router) {
+			r.Use(app.rateLimit(RATE_LIMIT_AUTH), app.authenticate)
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Timeout(requestTimeout), app.rateLimit(RATE_LIMIT_READ), app.requireAction(auth.ACTION_MEDIA_READ))
+				r.Get("/v1/{id}", app.getMediaById)
+				r.Get("/v1/{id}/analysis", app.getMediaAnalysis)
+				r.Get("/v1/{id}/analysis/ela.png", app.getElaHeatmap)
+				r.Get("/v1/{id}/analysis/timeline", app.getMediaTimeline)
+				r.Get("/v1/{id}/metadata", app.getMediaMetadata)
+				r.Get("/v1/{id}/content", app.getMediaContent)
+				r.Get("/v1/{id}/review", app.getMediaReview)
+				r.Get("/v1/{id}/similar", app.getSimilarMedia)
+				r.Get("/v1", app.getAllMedia)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Timeout(requestTimeout), app.rateLimit(RATE_LIMIT_WRITE))
+				r.With(app.requireAction(auth.ACTION_MEDIA_WRITE)).Delete("/v1/{id}", app.deleteMediaById)
+				r.With(app.requireAction(auth.ACTION_ANALYSIS_RUN)).Post("/v1/{id}/analysis", app.runMediaAnalysis)
+				r.With(app.requireAction(auth.ACTION_REVIEW_WRITE)).Put("/v1/{id}/review", app.reviewMedia)
+			})
+			// media content arrives in the body, those requests share the stricter upload limit
+			r.Group(func(r chi.Router) {
+				r.Use(app.rateLimit(RATE_LIMIT_UPLOAD), app.limitConcurrentUploads)
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.Timeout(requestTimeout))
+					r.With(app.requireAction(auth.ACTION_MEDIA_WRITE)).Post("/v1", app.addNewMedia)
+					r.With(app.requireAction(auth.ACTION_MEDIA_WRITE)).Put("/v1/{id}", app.updateMedia)
+					r.With(app.requireAction(auth.ACTION_MEDIA_READ)).Post("/v1/search/by-image", app.searchByImage)
+				})
+
+				// uploads stream large bodies, they only get the longer upload deadline
+				r.With(middleware.Timeout(app.uploadTimeout), app.requireAction(auth.ACTION_MEDIA_WRITE)).Post("/v1/upload", app.uploadMedia)
+			})
+		})
+
+		r.Route("/v1/uploads", func(r chi.Router) {
+			r.Use(tusResumable)
+			// tus clients discover the server capabilities before they authenticate
+			r.With(middleware.Timeout(requestTimeout), app.rateLimit(RATE_LIMIT_PUBLIC)).Options("/", app.tusOptions)
+			r.Group(func(r chi.Router) {
+				r.Use(app.rateLimit(RATE_LIMIT_AUTH), app.authenticate)
+				r.With(middleware.Timeout(requestTimeout), app.rateLimit(RATE_LIMIT_UPLOAD), app.requireAction(auth.ACTION_MEDIA_WRITE)).Post("/", app.createUpload)
+				// an upload is sent in many chunks, they count as writes
+				r.Group(func(r chi.Router) {
+					r.Use(app.rateLimit(RATE_LIMIT_WRITE), app.requireAction(auth.ACTION_MEDIA_WRITE))
+					r.Group(func(r chi.Router) {
+						r.Use(middleware.Timeout(requestTimeout))
+						r.Head("/{uploadId}", app.getUploadOffset)
+						r.Delete("/{uploadId}", app.terminateUpload)
+					})
+					r.With(middleware.Timeout(app.uploadTimeout), app.limitConcurrentUploads).Patch("/{uploadId}", app.patchUpload)
+				})
+			})
+		})
+	})
+
+	router.Route("/api/admin", func(r chi.Router) {
+		r.Use(app.rateLimit(RATE_LIMIT_AUTH), app.authenticate, app.rateLimit(RATE_LIMIT_ADMIN))
+		r.Use(middleware.Timeout(requestTimeout))
+		r.Group(func(r chi.Router) {
+			r.Use(app.requireAction(auth.ACTION_API_KEYS_MANAGE))
+			r.Post("/v1/api-keys", app.createApiKey)
+			r.Get("/v1/api-keys", app.getAllApiKeys)
+			r.Delete("/v1/api-keys/{id}", app.revokeApiKey)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(app.requireAction(auth.ACTION_USERS_MANAGE))
+			r.Get("/v1/users", app.getAllUsers)
+			r.Put("/v1/users/{subject}", app.assignUserRole)
+			r.Delete("/v1/users/{subject}", app.deleteUser)
+		})
 	})
 
-	router.Handle("/ws", http.HandlerFunc(app.wsHandler))
+	// clients check the events sent over /ws against this schema
+	router.With(middleware.Timeout(requestTimeout), app.rateLimit(RATE_LIMIT_PUBLIC)).Get("/api/events/v1/schema", app.serveEventSchema)
+	router.With(app.rateLimit(RATE_LIMIT_AUTH), app.authenticateWebSocket, app.rateLimit(RATE_LIMIT_READ), app.requireAction(auth.ACTION_MEDIA_READ)).Handle("/ws", http.HandlerFunc(app.wsHandler))
 
 	return router
 }
@@ -35,14 +113,18 @@ func createRouter() chi.Router {
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
-	router.Use(middleware.Timeout(60 * time.Second))
 
 	// Basic CORS
 	router.Use((cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins: []string{"https://*", "http://*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token",
+			HEADER_MEDIA_TITLE, HEADER_MEDIA_DESCRIPTION, HEADER_MEDIA_LOCATION, HEADER_MEDIA_TYPE, HEADER_MEDIA_TAGS, HEADER_MEDIA_MIME_TYPE,
+			HEADER_TUS_RESUMABLE, HEADER_UPLOAD_LENGTH, HEADER_UPLOAD_OFFSET, HEADER_UPLOAD_METADATA},
+		ExposedHeaders: []string{"Link", "Location", "Retry-After",
+			HEADER_RATE_LIMIT_LIMIT, HEADER_RATE_LIMIT_REMAINING, HEADER_RATE_LIMIT_RESET, HEADER_RATE_LIMIT_POLICY,
+			HEADER_TUS_RESUMABLE, HEADER_TUS_VERSION, HEADER_TUS_EXTENSION, HEADER_TUS_MAX_SIZE,
+			HEADER_UPLOAD_LENGTH, HEADER_UPLOAD_OFFSET, HEADER_UPLOAD_METADATA, HEADER_UPLOAD_EXPIRES, HEADER_UPLOAD_MEDIA_ID},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	})))
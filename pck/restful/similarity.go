@@ -0,0 +1,145 @@
+package restful
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/similarity"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// re-encoded and resized copies are usually within a few bits of the original
+	defaultMaxDistance = 10
+	// images searched for are held in memory while they are hashed
+	maxSearchImageSize = 25 * 1024 * 1024 // 25 MB
+)
+
+// SimilarMedia is a near-duplicate, Frame is its closest keyframe for videos.
+type SimilarMedia struct {
+	Distance int           `json:"distance"`
+	Frame    int           `json:"frame"`
+	Media    *models.Media `json:"media"`
+}
+
+// parseSimilarityOptions reads the largest Hamming distance of a match and the number of matches, e.g. ?maxDistance=6&limit=10
+func parseSimilarityOptions(query url.Values) (int, int, error) {
+	maxDistance := defaultMaxDistance
+	if raw := query.Get("maxDistance"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 || value > similarity.HASH_BITS {
+			return 0, 0, fmt.Errorf("maxDistance must be an integer between 0 and %d", similarity.HASH_BITS)
+		}
+		maxDistance = value
+	}
+	limit := defaultPageSize
+	if raw := query.Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 || value > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be an integer between 1 and %d", maxPageSize)
+		}
+		limit = value
+	}
+	return maxDistance, limit, nil
+}
+
+func (app *restfulApi) getSimilarMedia(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	maxDistance, limit, err := parseSimilarityOptions(r.URL.Query())
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+	if _, err := app.mediaRepository.GetByID(r.Context(), scope, id, nil); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	fingerprints, err := app.similarity.Fingerprints(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if len(fingerprints) == 0 {
+		app.errorResponse(w, r, utils.ErrMediaNotHashed)
+		return
+	}
+	app.writeSimilarMedia(w, r, scope, fingerprints, maxDistance, limit, id)
+}
+
+// searchByImage finds the near-duplicates of the image sent as the body, it is not stored.
+func (app *restfulApi) searchByImage(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	maxDistance, limit, err := parseSimilarityOptions(r.URL.Query())
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSearchImageSize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.payloadTooLarge(w, r, maxBytesError.Limit)
+			return
+		}
+		app.badRequest(w, r, err)
+		return
+	}
+
+	// the content tells what the image is, whatever the request says
+	mimeType := validator.DetectMimeType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		app.errorResponse(w, r, utils.ErrUnsupportedImage)
+		return
+	}
+	fingerprints, err := app.similarity.Hash(r.Context(), mimeType, data)
+	if err != nil {
+		if errors.Is(err, similarity.ErrUnsupported) {
+			app.errorResponse(w, r, utils.ErrUnsupportedImage)
+			return
+		}
+		app.errorResponse(w, r, utils.ErrInvalidImage)
+		return
+	}
+	app.writeSimilarMedia(w, r, scope, fingerprints, maxDistance, limit, "")
+}
+
+// writeSimilarMedia responds with the closest media of the scope other than excluded.
+func (app *restfulApi) writeSimilarMedia(w http.ResponseWriter, r *http.Request, scope repositories.Scope, fingerprints []similarity.Fingerprint, maxDistance int, limit int, excluded string) {
+	items := []SimilarMedia{}
+	for _, match := range app.similarity.Search(scope, fingerprints, maxDistance) {
+		if len(items) == limit {
+			break
+		}
+		if match.MediaId == excluded {
+			continue
+		}
+		// the index may not have heard of a deletion yet
+		media, err := app.mediaRepository.GetByID(r.Context(), scope, match.MediaId, nil)
+		if errors.Is(err, utils.ErrMediaNotFound) {
+			continue
+		}
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		items = append(items, SimilarMedia{Distance: match.Distance, Frame: match.Frame, Media: media})
+	}
+	err := JSON(w, http.StatusOK, items)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,139 @@
+package restful
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+// waves draws a grayscale PNG of a wave pattern, the same frequencies at another size or
+// brightness make a near-duplicate.
+func waves(t *testing.T, size int, fx float64, fy float64, brightness float64) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			value := 120 + brightness + 90*math.Sin(fx*float64(x)/float64(size))*math.Cos(fy*float64(y)/float64(size))
+			img.SetGray(x, y, color.Gray{Y: uint8(max(0, min(255, value)))})
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// createHashedMedia uploads an image and hashes it, as its analysis would.
+func (api *testApi) createHashedMedia(t *testing.T, title string, data []byte) *models.Media {
+	t.Helper()
+	media := api.createMedia(t, repositories.MediaPayload{Title: title, MediaData: base64.StdEncoding.EncodeToString(data)})
+	if err := api.app.similarity.Update(context.Background(), media, data); err != nil {
+		t.Fatal(err)
+	}
+	return media
+}
+
+func getSimilarMedia(t *testing.T, resp *http.Response) []SimilarMedia {
+	t.Helper()
+	expectStatus(t, resp, http.StatusOK)
+	var items []SimilarMedia
+	decodeBody(t, resp, &items)
+	return items
+}
+
+func TestSimilarMedia(t *testing.T) {
+	api := newTestApi(t)
+	original := api.createHashedMedia(t, "Original", waves(t, 64, 6, 4, 0))
+	copied := api.createHashedMedia(t, "Re-encoded", waves(t, 56, 6, 4, 10))
+	other := api.createHashedMedia(t, "Other", waves(t, 64, 5, 3, 0))
+	// media of other users are never suggested
+	api.as(t, "bob", false).createHashedMedia(t, "Bob's copy", waves(t, 64, 6, 4, 0))
+
+	items := getSimilarMedia(t, api.request(t, http.MethodGet, "/api/media/v1/"+original.Id+"/similar", nil, nil))
+	if len(items) != 1 || items[0].Media.Id != copied.Id || items[0].Distance > defaultMaxDistance {
+		t.Fatalf("expected the re-encoded copy only, got %+v", items)
+	}
+
+	items = getSimilarMedia(t, api.request(t, http.MethodGet, "/api/media/v1/"+original.Id+"/similar?maxDistance=64", nil, nil))
+	if len(items) != 2 || items[0].Media.Id != copied.Id || items[1].Media.Id != other.Id || items[0].Distance > items[1].Distance {
+		t.Fatalf("expected the copy then the other image, got %+v", items)
+	}
+	items = getSimilarMedia(t, api.request(t, http.MethodGet, "/api/media/v1/"+original.Id+"/similar?maxDistance=64&limit=1", nil, nil))
+	if len(items) != 1 || items[0].Media.Id != copied.Id {
+		t.Fatalf("expected the closest media only, got %+v", items)
+	}
+
+	// deleted media leave the index
+	expectStatus(t, api.request(t, http.MethodDelete, "/api/media/v1/"+copied.Id, nil, nil), http.StatusOK)
+	items = getSimilarMedia(t, api.request(t, http.MethodGet, "/api/media/v1/"+original.Id+"/similar", nil, nil))
+	if len(items) != 0 {
+		t.Fatalf("expected no similar media left, got %+v", items)
+	}
+}
+
+func TestSimilarMediaErrors(t *testing.T) {
+	api := newTestApi(t)
+	hashed := api.createHashedMedia(t, "Image", waves(t, 64, 6, 4, 0))
+	audio := api.createMedia(t, repositories.MediaPayload{Title: "Audio", MediaData: encodedContent(mp3Magic, 20)})
+	hidden := api.as(t, "bob", false).createHashedMedia(t, "Bob's", waves(t, 64, 6, 4, 0))
+
+	for _, test := range []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/api/media/v1/" + audio.Id + "/similar", http.StatusConflict, utils.ErrMediaNotHashed.Code},
+		{"/api/media/v1/" + hidden.Id + "/similar", http.StatusNotFound, utils.ErrMediaNotFound.Code},
+		{"/api/media/v1/" + hashed.Id + "/similar?maxDistance=65", http.StatusBadRequest, CODE_BAD_REQUEST},
+		{"/api/media/v1/" + hashed.Id + "/similar?limit=0", http.StatusBadRequest, CODE_BAD_REQUEST},
+	} {
+		problem := decodeProblem(t, api.request(t, http.MethodGet, test.path, nil, nil), test.status)
+		if problem.Code != test.code {
+			t.Errorf("%s: expected %s, got %+v", test.path, test.code, problem)
+		}
+	}
+}
+
+func TestSearchByImage(t *testing.T) {
+	api := newTestApi(t)
+	original := api.createHashedMedia(t, "Original", waves(t, 64, 6, 4, 0))
+	api.createHashedMedia(t, "Other", waves(t, 64, 5, 3, 0))
+
+	resp := api.request(t, http.MethodPost, "/api/media/v1/search/by-image", bytes.NewReader(waves(t, 48, 6, 4, -10)), map[string]string{"Content-Type": "image/png"})
+	items := getSimilarMedia(t, resp)
+	if len(items) != 1 || items[0].Media.Id != original.Id {
+		t.Fatalf("expected the original, got %+v", items)
+	}
+	// the searched image is not stored
+	if media, _ := api.app.mediaRepository.List(context.Background(), repositories.SCOPE_ALL, repositories.ListOptions{Limit: 10, SortBy: repositories.SORT_CREATED_AT}); len(media.Items) != 2 {
+		t.Errorf("expected 2 media, got %d", len(media.Items))
+	}
+
+	truncated := waves(t, 64, 6, 4, 0)
+	for _, test := range []struct {
+		body   []byte
+		status int
+		code   string
+	}{
+		{[]byte(fakeContent(mp3Magic, 20)), http.StatusUnsupportedMediaType, utils.ErrUnsupportedImage.Code},
+		{truncated[:len(truncated)/2], http.StatusBadRequest, utils.ErrInvalidImage.Code},
+	} {
+		resp := api.request(t, http.MethodPost, "/api/media/v1/search/by-image", bytes.NewReader(test.body), nil)
+		problem := decodeProblem(t, resp, test.status)
+		if problem.Code != test.code {
+			t.Errorf("%s: expected %s, got %+v", fmt.Sprintf("%.8q", test.body), test.code, problem)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+// topics are written <kind>:<media id>, or <kind>:* for every media
+const (
+	TOPIC_MEDIA    = "media"
+	TOPIC_ANALYSIS = "analysis"
+	TOPIC_ANY      = "*"
+)
+
+// commands clients send over the websocket, e.g. {"action":"subscribe","topic":"media:*","id":"1"}
+const (
+	ACTION_SUBSCRIBE   = "subscribe"
+	ACTION_UNSUBSCRIBE = "unsubscribe"
+)
+
+// replies to the commands, events are told apart by their dotted types
+const (
+	REPLY_ACK   = "ack"
+	REPLY_ERROR = "error"
+)
+
+// topics of the clients connecting without a topics query parameter
+var DEFAULT_TOPICS = []string{TOPIC_MEDIA + ":" + TOPIC_ANY, TOPIC_ANALYSIS + ":" + TOPIC_ANY}
+
+const wsMaxTopics = 100
+
+type wsCommand struct {
+	// Id is echoed in the reply, clients use it to match replies with their commands
+	Id     string `json:"id"`
+	Action string `json:"action"`
+	Topic  string `json:"topic"`
+}
+
+type wsReply struct {
+	Type    string `json:"type"`
+	Id      string `json:"id,omitempty"`
+	Action  string `json:"action,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func errorReply(id string, err error) *wsReply {
+	reply := &wsReply{Type: REPLY_ERROR, Id: id, Code: CODE_INTERNAL_ERROR, Message: "the command could not be processed"}
+	var customError *utils.CustomError
+	if errors.As(err, &customError) {
+		reply.Code = customError.Code
+		reply.Message = err.Error()
+	}
+	return reply
+}
+
+// handleCommand runs a command of the client, the hub replies once it applied the change.
+func (app *restfulApi) handleCommand(ctx context.Context, scope repositories.Scope, client *wsClient, message []byte) {
+	var command wsCommand
+	if err := json.Unmarshal(message, &command); err != nil {
+		app.hub.change(wsChange{client: client, reply: errorReply("", fmt.Errorf("%w: %s", utils.ErrInvalidCommand, err))})
+		return
+	}
+	if command.Action != ACTION_SUBSCRIBE && command.Action != ACTION_UNSUBSCRIBE {
+		err := fmt.Errorf("%w: the action must be %s or %s", utils.ErrInvalidCommand, ACTION_SUBSCRIBE, ACTION_UNSUBSCRIBE)
+		app.hub.change(wsChange{client: client, reply: errorReply(command.Id, err)})
+		return
+	}
+	// unsubscribing needs no check, a topic the client can't see was never subscribed to
+	if command.Action == ACTION_SUBSCRIBE {
+		if err := app.checkTopic(ctx, scope, command.Topic); err != nil {
+			var customError *utils.CustomError
+			if !errors.As(err, &customError) {
+				app.logger.Error("WebSocket: Error checking topic", slog.String("topic", command.Topic), slog.Any("error", err))
+			}
+			app.hub.change(wsChange{client: client, reply: errorReply(command.Id, err)})
+			return
+		}
+	}
+
+	app.hub.change(wsChange{
+		client:    client,
+		topic:     command.Topic,
+		subscribe: command.Action == ACTION_SUBSCRIBE,
+		reply:     &wsReply{Type: REPLY_ACK, Id: command.Id, Action: command.Action, Topic: command.Topic},
+	})
+}
+
+// checkTopic validates a topic, a single media must be visible to the client.
+func (app *restfulApi) checkTopic(ctx context.Context, scope repositories.Scope, topic string) error {
+	kind, mediaId, ok := strings.Cut(topic, ":")
+	if !ok || (kind != TOPIC_MEDIA && kind != TOPIC_ANALYSIS) || mediaId == "" {
+		return fmt.Errorf("%w: expected %s:<id>, %s:<id> or %s:%s", utils.ErrInvalidTopic, TOPIC_MEDIA, TOPIC_ANALYSIS, TOPIC_MEDIA, TOPIC_ANY)
+	}
+	if mediaId == TOPIC_ANY {
+		return nil
+	}
+	_, err := app.mediaRepository.GetByID(ctx, scope, mediaId, nil)
+	return err
+}
+
+func splitTopics(value string) []string {
+	topics := []string{}
+	for _, topic := range strings.Split(value, ",") {
+		if topic = strings.TrimSpace(topic); topic != "" && !slices.Contains(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// eventTopics lists the topics an event is published to.
+func eventTopics(event *events.Event) []string {
+	kind := event.Kind()
+	return []string{kind + ":" + TOPIC_ANY, kind + ":" + event.MediaId}
+}
+
+func (c *wsClient) subscribed(topics []string) bool {
+	for _, topic := range topics {
+		if c.topics[topic] {
+			return true
+		}
+	}
+	return false
+}
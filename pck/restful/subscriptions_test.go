@@ -0,0 +1,119 @@
+package restful
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/gorilla/websocket"
+)
+
+func sendCommand(t *testing.T, conn *websocket.Conn, command wsCommand) *wsReply {
+	t.Helper()
+	if err := conn.WriteJSON(command); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var reply wsReply
+	if err := conn.ReadJSON(&reply); err != nil {
+		t.Fatalf("expected a reply: %v", err)
+	}
+	return &reply
+}
+
+func TestWebSocketSubscriptions(t *testing.T) {
+	api := newTestApi(t)
+	// an empty topics parameter subscribes to nothing
+	conn := api.dialWebSocket(t, "reviewer&topics=")
+
+	watched := api.createMedia(t, repositories.MediaPayload{Title: "Watched", MediaData: encodedContent(pngMagic, 20)})
+	reply := sendCommand(t, conn, wsCommand{Id: "1", Action: ACTION_SUBSCRIBE, Topic: "media:" + watched.Id})
+	if reply.Type != REPLY_ACK || reply.Id != "1" || reply.Action != ACTION_SUBSCRIBE || reply.Topic != "media:"+watched.Id {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+
+	// events are delivered in order, the other media would have come first
+	api.createMedia(t, repositories.MediaPayload{Title: "Ignored", MediaData: encodedContent(pngMagic, 20)})
+	expectStatus(t, api.requestJSON(t, http.MethodPut, "/api/media/v1/"+watched.Id, map[string]string{"title": "Renamed"}), http.StatusOK)
+	if event := readMediaEvent(t, conn); event.Type != events.MEDIA_UPDATED || event.MediaId != watched.Id {
+		t.Errorf("expected the update of the watched media, got %+v", event)
+	}
+
+	reply = sendCommand(t, conn, wsCommand{Id: "2", Action: ACTION_UNSUBSCRIBE, Topic: "media:" + watched.Id})
+	if reply.Type != REPLY_ACK || reply.Action != ACTION_UNSUBSCRIBE {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+	reply = sendCommand(t, conn, wsCommand{Id: "3", Action: ACTION_SUBSCRIBE, Topic: "media:*"})
+	if reply.Type != REPLY_ACK {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+	created := api.createMedia(t, repositories.MediaPayload{Title: "Any", MediaData: encodedContent(pngMagic, 20)})
+	if event := readMediaEvent(t, conn); event.Type != events.MEDIA_CREATED || event.MediaId != created.Id {
+		t.Errorf("expected the new media, got %+v", event)
+	}
+}
+
+func TestWebSocketCommandErrors(t *testing.T) {
+	api := newTestApi(t)
+	bob := api.as(t, "bob", false)
+	hidden := bob.createMedia(t, repositories.MediaPayload{Title: "Bob's", MediaData: encodedContent(pngMagic, 20)})
+	conn := api.dialWebSocket(t, "client")
+
+	for _, test := range []struct {
+		command wsCommand
+		code    string
+	}{
+		{wsCommand{Id: "1", Action: "publish", Topic: "media:*"}, utils.ErrInvalidCommand.Code},
+		{wsCommand{Id: "2", Action: ACTION_SUBSCRIBE, Topic: "uploads:*"}, utils.ErrInvalidTopic.Code},
+		{wsCommand{Id: "3", Action: ACTION_SUBSCRIBE, Topic: "media:"}, utils.ErrInvalidTopic.Code},
+		// media the client can't see are not found rather than forbidden
+		{wsCommand{Id: "4", Action: ACTION_SUBSCRIBE, Topic: "analysis:" + hidden.Id}, utils.ErrMediaNotFound.Code},
+	} {
+		reply := sendCommand(t, conn, test.command)
+		if reply.Type != REPLY_ERROR || reply.Id != test.command.Id || reply.Code != test.code || reply.Message == "" {
+			t.Errorf("expected a %s error for %+v, got %+v", test.code, test.command, reply)
+		}
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var reply wsReply
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != REPLY_ERROR || reply.Code != utils.ErrInvalidCommand.Code {
+		t.Errorf("expected an invalid command error, got %+v, %v", reply, err)
+	}
+
+	// the connection outlives the errors and still hears of the media of its user only
+	bob.createMedia(t, repositories.MediaPayload{Title: "Bob's too", MediaData: encodedContent(pngMagic, 20)})
+	own := api.createMedia(t, repositories.MediaPayload{Title: "Alice's", MediaData: encodedContent(pngMagic, 20)})
+	if event := readMediaEvent(t, conn); event.MediaId != own.Id {
+		t.Errorf("expected the media of alice only, got %+v", event)
+	}
+}
+
+func TestWebSocketInitialTopics(t *testing.T) {
+	api := newTestApi(t)
+
+	wsURL := "ws" + strings.TrimPrefix(api.server.URL, "http") + "/ws?client_id=client&topics=media:*,files:*&access_token=" + api.token
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err == nil {
+		t.Fatal("expected the connection to be refused")
+	}
+	problem := decodeProblem(t, resp, http.StatusBadRequest)
+	if problem.Code != utils.ErrInvalidTopic.Code || !strings.Contains(problem.Detail, "files:*") {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+
+	conn := api.dialWebSocket(t, "analyses&topics=analysis:*")
+	api.createMedia(t, repositories.MediaPayload{Title: "Skipped", MediaData: encodedContent(pngMagic, 20)})
+	media := api.createMedia(t, repositories.MediaPayload{Title: "Watched", MediaData: encodedContent(pngMagic, 20)})
+	reply := sendCommand(t, conn, wsCommand{Action: ACTION_SUBSCRIBE, Topic: "media:" + media.Id})
+	if reply.Type != REPLY_ACK {
+		t.Errorf("unexpected reply: %+v", reply)
+	}
+}
@@ -0,0 +1,115 @@
+package restful
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/auth"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// inTenant returns the same api sending its requests as a user of another organization.
+func (api *testApi) inTenant(t *testing.T, tenantId string, subject string, admin bool) *testApi {
+	t.Helper()
+	other := *api
+	other.token = signToken(t, jwt.MapClaims{"sub": subject, "admin": admin, "org": tenantId})
+	return &other
+}
+
+// dialWebSocket connects a client, the handler registered it by the time the upgrade completes.
+func (api *testApi) dialWebSocket(t *testing.T, clientId string) *websocket.Conn {
+	t.Helper()
+	wsURL := "ws" + strings.TrimPrefix(api.server.URL, "http") + "/ws?client_id=" + clientId + "&access_token=" + api.token
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestTenantIsolation(t *testing.T) {
+	alice := newTestApi(t)
+	admin := alice.as(t, "root", true)
+	newsroom := alice.inTenant(t, "newsroom", "root", true)
+
+	media := alice.createMedia(t, repositories.MediaPayload{Title: "Alice's clip", MediaData: encodedContent(pngMagic, 10)})
+	if media.TenantId != auth.DEFAULT_TENANT {
+		t.Errorf("expected the media to belong to the default tenant, got %q", media.TenantId)
+	}
+	scoop := newsroom.createMedia(t, repositories.MediaPayload{Title: "Scoop", MediaData: encodedContent(pngMagic, 10)})
+	if scoop.TenantId != "newsroom" {
+		t.Errorf("expected the media to belong to the newsroom, got %q", scoop.TenantId)
+	}
+
+	// admins only reach the media of their own tenant
+	expectStatus(t, newsroom.request(t, http.MethodGet, "/api/media/v1/"+media.Id, nil, nil), http.StatusNotFound)
+	expectStatus(t, newsroom.request(t, http.MethodDelete, "/api/media/v1/"+media.Id, nil, nil), http.StatusNotFound)
+	expectStatus(t, admin.request(t, http.MethodGet, "/api/media/v1/"+scoop.Id, nil, nil), http.StatusNotFound)
+	resp := admin.request(t, http.MethodGet, "/api/media/v1", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var items []models.Media
+	decodeBody(t, resp, &items)
+	if len(items) != 1 || items[0].Id != media.Id {
+		t.Errorf("expected only the media of the default tenant, got %+v", items)
+	}
+
+	// so are the uploads
+	resp = alice.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{
+		HEADER_UPLOAD_LENGTH:   "10",
+		HEADER_UPLOAD_METADATA: "title " + base64.StdEncoding.EncodeToString([]byte("Draft")),
+	})
+	expectStatus(t, resp, http.StatusCreated)
+	upload := resp.Header.Get("Location")
+	expectStatus(t, newsroom.tusRequest(t, http.MethodHead, upload, "", nil), http.StatusNotFound)
+	expectStatus(t, newsroom.tusRequest(t, http.MethodDelete, upload, "", nil), http.StatusNotFound)
+	expectStatus(t, alice.tusRequest(t, http.MethodHead, upload, "", nil), http.StatusOK)
+
+	// roles and API keys are kept per tenant too
+	key := alice.createApiKey(t, map[string]any{"name": "bot", "scopes": []string{auth.SCOPE_MEDIA_READ}})
+	resp = newsroom.request(t, http.MethodGet, "/api/admin/v1/api-keys", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var keys []models.ApiKey
+	decodeBody(t, resp, &keys)
+	if len(keys) != 0 {
+		t.Errorf("expected no api key in the newsroom, got %+v", keys)
+	}
+	expectStatus(t, newsroom.request(t, http.MethodDelete, "/api/admin/v1/api-keys/"+key.Id, nil, nil), http.StatusNotFound)
+	expectStatus(t, alice.withApiKey(key.Key).request(t, http.MethodGet, "/api/media/v1/"+scoop.Id, nil, nil), http.StatusNotFound)
+
+	expectStatus(t, newsroom.requestJSON(t, http.MethodPut, "/api/admin/v1/users/"+testUser, map[string]any{"role": models.ROLE_VIEWER}), http.StatusOK)
+	resp = admin.request(t, http.MethodGet, "/api/admin/v1/users", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var users []models.User
+	decodeBody(t, resp, &users)
+	if len(users) != 0 {
+		t.Errorf("expected no user in the default tenant, got %+v", users)
+	}
+	expectStatus(t, alice.requestJSON(t, http.MethodPut, "/api/media/v1/"+media.Id, map[string]string{"title": "Still an analyst"}), http.StatusOK)
+}
+
+func TestTenantBroadcasts(t *testing.T) {
+	api := newTestApi(t)
+	newsroom := api.inTenant(t, "newsroom", testUser, false)
+
+	// the same client id may connect in both tenants
+	defaultConn := api.dialWebSocket(t, "client")
+	newsroomConn := newsroom.dialWebSocket(t, "client")
+
+	newsroom.createMedia(t, repositories.MediaPayload{Title: "Scoop", MediaData: encodedContent(pngMagic, 20)})
+
+	if event := readMediaEvent(t, newsroomConn); event.Type != events.MEDIA_CREATED || event.Data.Title != "Scoop" {
+		t.Fatalf("expected the newsroom client to be notified, got %+v", event)
+	}
+	defaultConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := defaultConn.ReadMessage(); err == nil {
+		t.Errorf("the default tenant must not hear of the newsroom media, got %s", data)
+	}
+}
@@ -0,0 +1,169 @@
+package restful
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/go-chi/chi/v5"
+)
+
+// Resumable uploads following the tus 1.0.0 core protocol with the creation,
+// termination and expiration extensions, see https://tus.io/protocols/resumable-upload
+const (
+	TUS_VERSION    = "1.0.0"
+	TUS_EXTENSIONS = "creation,termination,expiration"
+
+	HEADER_TUS_RESUMABLE   = "Tus-Resumable"
+	HEADER_TUS_VERSION     = "Tus-Version"
+	HEADER_TUS_EXTENSION   = "Tus-Extension"
+	HEADER_TUS_MAX_SIZE    = "Tus-Max-Size"
+	HEADER_UPLOAD_LENGTH   = "Upload-Length"
+	HEADER_UPLOAD_OFFSET   = "Upload-Offset"
+	HEADER_UPLOAD_METADATA = "Upload-Metadata"
+	HEADER_UPLOAD_EXPIRES  = "Upload-Expires"
+	// set once the upload turned into a media
+	HEADER_UPLOAD_MEDIA_ID = "Upload-Media-Id"
+
+	tusChunkContentType = "application/offset+octet-stream"
+)
+
+// tusResumable rejects requests speaking another protocol version, every response carries the server version.
+func tusResumable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_TUS_RESUMABLE, TUS_VERSION)
+		if r.Method != http.MethodOptions && r.Header.Get(HEADER_TUS_RESUMABLE) != TUS_VERSION {
+			w.Header().Set(HEADER_TUS_VERSION, TUS_VERSION)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *restfulApi) tusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(HEADER_TUS_VERSION, TUS_VERSION)
+	w.Header().Set(HEADER_TUS_EXTENSION, TUS_EXTENSIONS)
+	w.Header().Set(HEADER_TUS_MAX_SIZE, strconv.FormatInt(app.maxUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *restfulApi) createUpload(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get(HEADER_UPLOAD_LENGTH), 10, 64)
+	if err != nil || length <= 0 {
+		app.badRequest(w, r, fmt.Errorf("the %s header must be a positive integer", HEADER_UPLOAD_LENGTH))
+		return
+	}
+	if length > app.maxUploadSize {
+		app.payloadTooLarge(w, r, app.maxUploadSize)
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get(HEADER_UPLOAD_METADATA))
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	upload, err := app.uploadService.Create(r.Context(), identityOf(r).TenantId, identityOf(r).Subject, length, metadata)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+upload.Id)
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (app *restfulApi) getUploadOffset(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	upload, err := app.uploadService.Get(r.Context(), scope, chi.URLParam(r, "uploadId"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	w.Header().Set(HEADER_UPLOAD_LENGTH, strconv.FormatInt(upload.Length, 10))
+	if encoded := encodeUploadMetadata(upload.Metadata); encoded != "" {
+		w.Header().Set(HEADER_UPLOAD_METADATA, encoded)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *restfulApi) patchUpload(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	if r.Header.Get("Content-Type") != tusChunkContentType {
+		app.unsupportedMediaType(w, r)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get(HEADER_UPLOAD_OFFSET), 10, 64)
+	if err != nil || offset < 0 {
+		app.badRequest(w, r, fmt.Errorf("the %s header must be a non negative integer", HEADER_UPLOAD_OFFSET))
+		return
+	}
+
+	upload, media, err := app.uploadService.Append(r.Context(), scope, chi.URLParam(r, "uploadId"), offset, r.Body)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if media != nil {
+		app.analysisPipeline.Enqueue(media.Id)
+		app.publishMediaEvent(r, events.MEDIA_CREATED, media)
+	}
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *restfulApi) terminateUpload(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	err := app.uploadService.Terminate(r.Context(), scope, chi.URLParam(r, "uploadId"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setUploadHeaders(w http.ResponseWriter, upload *models.Upload) {
+	w.Header().Set(HEADER_UPLOAD_OFFSET, strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set(HEADER_UPLOAD_EXPIRES, upload.ExpiresAt.Format(http.TimeFormat))
+	if upload.Completed() {
+		w.Header().Set(HEADER_UPLOAD_MEDIA_ID, upload.MediaId)
+	}
+}
+
+// parseUploadMetadata decodes the "key base64value,key2 base64value2" format of the Upload-Metadata header.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("the %s header contains an empty key", HEADER_UPLOAD_METADATA)
+		}
+		if _, exists := metadata[key]; exists {
+			return nil, fmt.Errorf("the %s header contains the key %q more than once", HEADER_UPLOAD_METADATA, key)
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("the %s value of %q is not valid base64", HEADER_UPLOAD_METADATA, key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func encodeUploadMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,207 @@
+package restful
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+var titleMetadata = "title " + base64.StdEncoding.EncodeToString([]byte("Upload"))
+
+func (api *testApi) tusRequest(t *testing.T, method string, path string, body string, headers map[string]string) *http.Response {
+	t.Helper()
+	allHeaders := map[string]string{HEADER_TUS_RESUMABLE: TUS_VERSION}
+	for key, value := range headers {
+		allHeaders[key] = value
+	}
+	return api.request(t, method, path, strings.NewReader(body), allHeaders)
+}
+
+func (api *testApi) patchChunk(t *testing.T, location string, offset int, chunk string) *http.Response {
+	t.Helper()
+	return api.tusRequest(t, http.MethodPatch, location, chunk, map[string]string{
+		"Content-Type":       tusChunkContentType,
+		HEADER_UPLOAD_OFFSET: strconv.Itoa(offset),
+	})
+}
+
+func TestTusOptions(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.request(t, http.MethodOptions, "/api/media/v1/uploads/", nil, nil)
+	expectStatus(t, resp, http.StatusNoContent)
+	if resp.Header.Get(HEADER_TUS_VERSION) != TUS_VERSION || resp.Header.Get(HEADER_TUS_EXTENSION) != TUS_EXTENSIONS {
+		t.Errorf("unexpected tus headers: %v", resp.Header)
+	}
+	if resp.Header.Get(HEADER_TUS_MAX_SIZE) != strconv.Itoa(testMaxUploadSize) {
+		t.Errorf("expected the max size %d, got %q", testMaxUploadSize, resp.Header.Get(HEADER_TUS_MAX_SIZE))
+	}
+}
+
+func TestTusUpload(t *testing.T) {
+	api := newTestApi(t)
+	content := fakeContent(mp4Magic, 60)
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("clip.mp4")) + ",filetype " + base64.StdEncoding.EncodeToString([]byte("video/mp4"))
+
+	resp := api.request(t, http.MethodPost, "/api/media/v1/uploads/", nil, map[string]string{HEADER_UPLOAD_LENGTH: "1"})
+	expectStatus(t, resp, http.StatusPreconditionFailed)
+
+	resp = api.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{
+		HEADER_UPLOAD_LENGTH:   strconv.Itoa(len(content)),
+		HEADER_UPLOAD_METADATA: metadata,
+	})
+	expectStatus(t, resp, http.StatusCreated)
+	location := resp.Header.Get("Location")
+	if !strings.HasPrefix(location, "/api/media/v1/uploads/") {
+		t.Fatalf("unexpected location %q", location)
+	}
+
+	resp = api.patchChunk(t, location, 0, content[:30])
+	expectStatus(t, resp, http.StatusNoContent)
+	if resp.Header.Get(HEADER_UPLOAD_OFFSET) != "30" {
+		t.Errorf("expected offset 30, got %q", resp.Header.Get(HEADER_UPLOAD_OFFSET))
+	}
+
+	resp = api.tusRequest(t, http.MethodHead, location, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get(HEADER_UPLOAD_OFFSET) != "30" || resp.Header.Get(HEADER_UPLOAD_LENGTH) != strconv.Itoa(len(content)) {
+		t.Errorf("unexpected upload headers: %v", resp.Header)
+	}
+
+	resp = api.patchChunk(t, location, 3, content[3:])
+	expectStatus(t, resp, http.StatusConflict)
+
+	resp = api.patchChunk(t, location, 30, content[30:])
+	expectStatus(t, resp, http.StatusNoContent)
+	mediaId := resp.Header.Get(HEADER_UPLOAD_MEDIA_ID)
+	if mediaId == "" {
+		t.Fatal("expected the finished upload to point at its media")
+	}
+	if enqueued := api.pipeline.Enqueued(); len(enqueued) != 1 || enqueued[0] != mediaId {
+		t.Errorf("expected the media to be enqueued for analysis, got %v", enqueued)
+	}
+
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+mediaId, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var media models.Media
+	decodeBody(t, resp, &media)
+	if media.Title != "clip.mp4" || media.MimeType != "video/mp4" || media.Checksum != checksum(content) {
+		t.Errorf("unexpected media: %+v", media)
+	}
+
+	resp = api.patchChunk(t, location, len(content), "more")
+	expectStatus(t, resp, http.StatusConflict)
+}
+
+func TestTusRejectsInvalidRequests(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{HEADER_UPLOAD_LENGTH: strconv.Itoa(testMaxUploadSize + 1)})
+	expectStatus(t, resp, http.StatusRequestEntityTooLarge)
+
+	resp = api.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{HEADER_UPLOAD_LENGTH: "abc"})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = api.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{HEADER_UPLOAD_LENGTH: "4", HEADER_UPLOAD_METADATA: titleMetadata})
+	expectStatus(t, resp, http.StatusCreated)
+	location := resp.Header.Get("Location")
+
+	resp = api.tusRequest(t, http.MethodPatch, location, "data", map[string]string{"Content-Type": "application/octet-stream", HEADER_UPLOAD_OFFSET: "0"})
+	expectStatus(t, resp, http.StatusUnsupportedMediaType)
+
+	resp = api.patchChunk(t, location, 0, "too long")
+	expectStatus(t, resp, http.StatusRequestEntityTooLarge)
+
+	resp = api.patchChunk(t, "/api/media/v1/uploads/missing", 0, "data")
+	expectStatus(t, resp, http.StatusNotFound)
+
+	resp = api.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{HEADER_UPLOAD_LENGTH: "4"})
+	problem := decodeProblem(t, resp, http.StatusUnprocessableEntity)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "title" {
+		t.Errorf("expected the missing title to be reported, got %+v", problem.Errors)
+	}
+}
+
+func TestTusRejectsChunkPastLength(t *testing.T) {
+	api := newTestApi(t)
+	content := fakeContent(pngMagic, 20)
+
+	resp := api.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{
+		HEADER_UPLOAD_LENGTH:   strconv.Itoa(len(content)),
+		HEADER_UPLOAD_METADATA: titleMetadata,
+	})
+	expectStatus(t, resp, http.StatusCreated)
+	location := resp.Header.Get("Location")
+	resp = api.patchChunk(t, location, 0, content[:10])
+	expectStatus(t, resp, http.StatusNoContent)
+
+	// the chunk that would fill the upload and more is refused, nothing of it is kept
+	resp = api.patchChunk(t, location, 10, content[10:]+"extra")
+	expectStatus(t, resp, http.StatusRequestEntityTooLarge)
+	resp = api.tusRequest(t, http.MethodHead, location, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get(HEADER_UPLOAD_OFFSET) != "10" || resp.Header.Get(HEADER_UPLOAD_MEDIA_ID) != "" {
+		t.Fatalf("expected the upload to stay at offset 10, got %v", resp.Header)
+	}
+
+	// the client resumes with the right chunk and gets its media
+	resp = api.patchChunk(t, location, 10, content[10:])
+	expectStatus(t, resp, http.StatusNoContent)
+	mediaId := resp.Header.Get(HEADER_UPLOAD_MEDIA_ID)
+	if mediaId == "" {
+		t.Fatal("expected the finished upload to point at its media")
+	}
+	resp = api.request(t, http.MethodGet, "/api/media/v1/"+mediaId, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var media models.Media
+	decodeBody(t, resp, &media)
+	if media.Checksum != checksum(content) {
+		t.Errorf("expected the media to hold the declared content, got %+v", media)
+	}
+}
+
+func TestTusRejectsSpoofedContent(t *testing.T) {
+	api := newTestApi(t)
+	metadata := titleMetadata + ",filetype " + base64.StdEncoding.EncodeToString([]byte("video/mp4"))
+	content := fakeContent(pngMagic, 20)
+
+	resp := api.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{
+		HEADER_UPLOAD_LENGTH:   strconv.Itoa(len(content)),
+		HEADER_UPLOAD_METADATA: metadata,
+	})
+	expectStatus(t, resp, http.StatusCreated)
+	location := resp.Header.Get("Location")
+
+	resp = api.patchChunk(t, location, 0, content)
+	problem := decodeProblem(t, resp, http.StatusUnprocessableEntity)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "mimeType" || problem.Errors[0].Code != "mismatch" {
+		t.Errorf("expected a MIME type mismatch, got %+v", problem.Errors)
+	}
+	if enqueued := api.pipeline.Enqueued(); len(enqueued) != 0 {
+		t.Errorf("rejected uploads must not be analysed, enqueued %v", enqueued)
+	}
+
+	// the rejected upload is gone
+	resp = api.tusRequest(t, http.MethodHead, location, "", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestTusTerminate(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.tusRequest(t, http.MethodPost, "/api/media/v1/uploads/", "", map[string]string{HEADER_UPLOAD_LENGTH: "10", HEADER_UPLOAD_METADATA: titleMetadata})
+	expectStatus(t, resp, http.StatusCreated)
+	location := resp.Header.Get("Location")
+
+	resp = api.tusRequest(t, http.MethodDelete, location, "", nil)
+	expectStatus(t, resp, http.StatusNoContent)
+
+	resp = api.tusRequest(t, http.MethodHead, location, "", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+	resp = api.tusRequest(t, http.MethodDelete, location, "", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
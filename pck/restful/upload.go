@@ -0,0 +1,217 @@
+package restful
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+)
+
+const (
+	maxFormFieldSize = 64 * 1024 // 64 KB
+	uploadFilePart   = "file"
+)
+
+// metadata headers of raw uploads, values may be percent-encoded to carry non ASCII text
+const (
+	HEADER_MEDIA_TITLE       = "X-Media-Title"
+	HEADER_MEDIA_DESCRIPTION = "X-Media-Description"
+	HEADER_MEDIA_LOCATION    = "X-Media-Location"
+	HEADER_MEDIA_TYPE        = "X-Media-Type"
+	HEADER_MEDIA_TAGS        = "X-Media-Tags"
+	// the actual content type of the media, the request itself is application/octet-stream
+	HEADER_MEDIA_MIME_TYPE = "X-Media-Mime-Type"
+)
+
+func (app *restfulApi) uploadMedia(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.maxUploadSize)
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		app.unsupportedMediaType(w, r)
+		return
+	}
+
+	var payload *repositories.MediaPayload
+	var content *validator.Content
+	switch contentType {
+	case "multipart/form-data":
+		payload, content, err = app.storeMultipartUpload(r)
+	case "application/octet-stream":
+		payload, content, err = app.storeRawUpload(r)
+	default:
+		app.unsupportedMediaType(w, r)
+		return
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.payloadTooLarge(w, r, maxBytesError.Limit)
+		default:
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	validator.ValidateMediaFields(v, payload, nil)
+	validator.ValidateMediaContent(v, payload, content, nil, app.mediaRules)
+	if !v.Valid() {
+		app.deleteContent(payload.ContentKey)
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+	validator.ApplyContent(payload, content)
+	payload.TenantId = identityOf(r).TenantId
+	payload.OwnerId = identityOf(r).Subject
+
+	createdMedia, err := app.mediaRepository.Create(r.Context(), payload)
+	if err != nil {
+		app.deleteContent(payload.ContentKey)
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.analysisPipeline.Enqueue(createdMedia.Id)
+	app.publishMediaEvent(r, events.MEDIA_CREATED, createdMedia)
+	err = JSON(w, http.StatusCreated, createdMedia)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// storeMultipartUpload reads the metadata fields and streams the file part straight into the blob store.
+// Fields may come before or after the file part, the file name is the default title.
+func (app *restfulApi) storeMultipartUpload(r *http.Request) (*repositories.MediaPayload, *validator.Content, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", utils.ErrInvalidUploadMetadata, err)
+	}
+
+	payload := &repositories.MediaPayload{}
+	var content *validator.Content
+	var fileName string
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			app.deleteContent(payload.ContentKey)
+			return nil, nil, err
+		}
+
+		if part.FormName() == uploadFilePart {
+			if content != nil {
+				part.Close()
+				app.deleteContent(payload.ContentKey)
+				return nil, nil, fmt.Errorf("%w: only one %s part is allowed", utils.ErrInvalidUploadMetadata, uploadFilePart)
+			}
+			if payload.MimeType == "" {
+				payload.MimeType = part.Header.Get("Content-Type")
+			}
+			fileName = part.FileName()
+			content, err = app.storeUploadContent(r, part, payload)
+			part.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			content.Field = uploadFilePart
+			continue
+		}
+
+		value, err := readFormField(part)
+		part.Close()
+		if err != nil {
+			app.deleteContent(payload.ContentKey)
+			return nil, nil, err
+		}
+		switch part.FormName() {
+		case "title":
+			payload.Title = value
+		case "description":
+			payload.Description = value
+		case "location":
+			payload.Location = value
+		case "type":
+			payload.Type = value
+		case "mimeType":
+			payload.MimeType = value
+		case "tags":
+			payload.Tags = value
+		}
+	}
+
+	if content == nil {
+		return nil, nil, utils.ErrMissingUploadFile
+	}
+	if payload.Title == "" {
+		payload.Title = fileName
+	}
+	return payload, content, nil
+}
+
+// storeRawUpload streams an application/octet-stream body, the metadata travels in X-Media-* headers.
+func (app *restfulApi) storeRawUpload(r *http.Request) (*repositories.MediaPayload, *validator.Content, error) {
+	payload := &repositories.MediaPayload{}
+	fields := []struct {
+		header string
+		dst    *string
+	}{
+		{HEADER_MEDIA_TITLE, &payload.Title},
+		{HEADER_MEDIA_DESCRIPTION, &payload.Description},
+		{HEADER_MEDIA_LOCATION, &payload.Location},
+		{HEADER_MEDIA_TYPE, &payload.Type},
+		{HEADER_MEDIA_TAGS, &payload.Tags},
+	}
+	for _, field := range fields {
+		value, err := url.PathUnescape(r.Header.Get(field.header))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: header %s is not properly percent-encoded", utils.ErrInvalidUploadMetadata, field.header)
+		}
+		*field.dst = value
+	}
+
+	payload.MimeType = r.Header.Get(HEADER_MEDIA_MIME_TYPE)
+
+	content, err := app.storeUploadContent(r, r.Body, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if content.Size == 0 {
+		app.deleteContent(payload.ContentKey)
+		return nil, nil, utils.ErrMissingUploadFile
+	}
+	content.Field = "body"
+	return payload, content, nil
+}
+
+func (app *restfulApi) storeUploadContent(r *http.Request, reader io.Reader, payload *repositories.MediaPayload) (*validator.Content, error) {
+	sniffer := validator.NewSniffer(reader)
+	info, err := app.blobStore.Put(r.Context(), repositories.NewContentKey(), sniffer)
+	if err != nil {
+		return nil, err
+	}
+	payload.ContentKey = info.Key
+	payload.Checksum = info.Checksum
+	return &validator.Content{Size: info.Size, MimeType: sniffer.MimeType()}, nil
+}
+
+func readFormField(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(value) > maxFormFieldSize {
+		return "", fmt.Errorf("%w: field %s must not be larger than %d bytes", utils.ErrInvalidUploadMetadata, part.FormName(), maxFormFieldSize)
+	}
+	return string(value), nil
+}
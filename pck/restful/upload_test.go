@@ -0,0 +1,95 @@
+package restful
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+func TestUploadMultipart(t *testing.T) {
+	api := newTestApi(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("title", "Interview")
+	writer.WriteField("tags", "news")
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="file"; filename="interview.mp4"`},
+		"Content-Type":        {"video/mp4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(fakeContent(mp4Magic, 100)))
+	writer.Close()
+
+	resp := api.request(t, http.MethodPost, "/api/media/v1/upload", &body, map[string]string{"Content-Type": writer.FormDataContentType()})
+	expectStatus(t, resp, http.StatusCreated)
+	var media models.Media
+	decodeBody(t, resp, &media)
+	if media.Title != "Interview" || media.Tags != "news" || media.MimeType != "video/mp4" || media.Type != "video" {
+		t.Errorf("unexpected media: %+v", media)
+	}
+	if media.Size != 100 || media.Checksum != checksum(fakeContent(mp4Magic, 100)) {
+		t.Errorf("unexpected content of the uploaded media: %+v", media)
+	}
+	if enqueued := api.pipeline.Enqueued(); len(enqueued) != 1 || enqueued[0] != media.Id {
+		t.Errorf("expected the upload to be enqueued for analysis, got %v", enqueued)
+	}
+}
+
+func TestUploadRaw(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.request(t, http.MethodPost, "/api/media/v1/upload", strings.NewReader(fakeContent(jpegMagic, 50)), map[string]string{
+		"Content-Type":           "application/octet-stream",
+		HEADER_MEDIA_TITLE:       "Caf%C3%A9",
+		HEADER_MEDIA_MIME_TYPE:   "image/jpeg",
+		HEADER_MEDIA_DESCRIPTION: "shot at night",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+	var media models.Media
+	decodeBody(t, resp, &media)
+	if media.Title != "Café" || media.Description != "shot at night" || media.Type != "image" || media.Size != 50 {
+		t.Errorf("unexpected media: %+v", media)
+	}
+}
+
+func TestUploadRejectsInvalidRequests(t *testing.T) {
+	api := newTestApi(t)
+
+	resp := api.request(t, http.MethodPost, "/api/media/v1/upload", strings.NewReader(strings.Repeat("x", testMaxUploadSize+1)), map[string]string{"Content-Type": "application/octet-stream"})
+	expectStatus(t, resp, http.StatusRequestEntityTooLarge)
+
+	resp = api.request(t, http.MethodPost, "/api/media/v1/upload", strings.NewReader(""), map[string]string{"Content-Type": "application/octet-stream"})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = api.request(t, http.MethodPost, "/api/media/v1/upload", strings.NewReader("{}"), map[string]string{"Content-Type": "application/json"})
+	expectStatus(t, resp, http.StatusUnsupportedMediaType)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("title", "No file")
+	writer.Close()
+	resp = api.request(t, http.MethodPost, "/api/media/v1/upload", &body, map[string]string{"Content-Type": writer.FormDataContentType()})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = api.request(t, http.MethodPost, "/api/media/v1/upload", strings.NewReader(fakeContent(pngMagic, 20)), map[string]string{
+		"Content-Type":         "application/octet-stream",
+		HEADER_MEDIA_TITLE:     "Spoofed",
+		HEADER_MEDIA_MIME_TYPE: "video/mp4",
+	})
+	problem := decodeProblem(t, resp, http.StatusUnprocessableEntity)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "mimeType" {
+		t.Errorf("expected a MIME type mismatch, got %+v", problem.Errors)
+	}
+
+	if enqueued := api.pipeline.Enqueued(); len(enqueued) != 0 {
+		t.Errorf("rejected uploads must not be analysed, enqueued %v", enqueued)
+	}
+}
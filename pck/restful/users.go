@@ -0,0 +1,90 @@
+package restful
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+type userPayload struct {
+	Role models.Role `json:"role"`
+}
+
+func (app *restfulApi) getAllUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := app.userRepository.List(r.Context(), identityOf(r).TenantId)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, users)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// assignUserRole sets the role of a subject in the tenant of the admin, the subject does not
+// need to have called the API yet.
+func (app *restfulApi) assignUserRole(w http.ResponseWriter, r *http.Request) {
+	subject := chi.URLParam(r, "subject")
+	if subject == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	var payload userPayload
+	err := DecodeJSON(w, r, &payload)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(payload.Role != "", "role", "required", "must be provided")
+	v.Check(payload.Role == "" || validator.PermittedValue(payload.Role, models.ROLES...), "role", "unknown_role",
+		fmt.Sprintf("must be one of %s", joinValues(models.ROLES)))
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.userRepository.Save(r.Context(), &models.User{TenantId: identityOf(r).TenantId, Subject: subject, Role: payload.Role, UpdatedAt: time.Now().UTC()})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, user)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// deleteUser forgets the role of a subject, they fall back to the default role.
+func (app *restfulApi) deleteUser(w http.ResponseWriter, r *http.Request) {
+	subject := chi.URLParam(r, "subject")
+	if subject == "" {
+		app.badRequest(w, r, utils.ErrMissingID)
+		return
+	}
+	err := app.userRepository.Delete(r.Context(), identityOf(r).TenantId, subject)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	err = JSON(w, http.StatusOK, map[string]bool{"deleted": true})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func joinValues[T ~string](values []T) string {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = string(value)
+	}
+	return strings.Join(names, ", ")
+}
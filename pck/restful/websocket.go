@@ -0,0 +1,374 @@
+package restful
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// clients only talk to the server to keep the connection alive, their messages stay small
+	wsMaxMessageSize = 4096
+	// broadcasts waiting for the hub, handlers only block once that many are pending
+	wsBroadcastQueueSize = 256
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// wsClientKey identifies a websocket connection, client ids are only unique to the user
+// choosing them. A colleague reusing the id must not replace the connection.
+type wsClientKey struct {
+	tenantId string
+	subject  string
+	clientId string
+}
+
+type wsClient struct {
+	key  wsClientKey
+	conn *websocket.Conn
+	// media the client may hear of
+	scope repositories.Scope
+	// topics the client subscribed to, only touched by the run loop of the hub
+	topics map[string]bool
+	// messages waiting for the writer, the hub closes it to let go of the client
+	send chan []byte
+	// why the hub let go of the client, set before send is closed
+	closeCode int
+	closeText string
+}
+
+type wsBroadcast struct {
+	tenantId string
+	ownerId  string
+	// topics the event is published to, e.g. media:* and media:<id>
+	topics []string
+	data   []byte
+}
+
+// wsChange subscribes a client to a topic or unsubscribes it, then replies. Replies
+// without a topic only report an error.
+type wsChange struct {
+	client    *wsClient
+	topic     string
+	subscribe bool
+	reply     *wsReply
+}
+
+// wsHub owns the connected clients. Only its run loop touches them and it never waits for a
+// client: every client has a bounded queue drained by a writer of its own, and clients whose
+// queue is full are disconnected rather than slowing down everyone else.
+type wsHub struct {
+	logger       *slog.Logger
+	queueSize    int
+	writeTimeout time.Duration
+	pongTimeout  time.Duration
+	clients      map[wsClientKey]*wsClient
+	register     chan *wsClient
+	unregister   chan *wsClient
+	broadcast    chan wsBroadcast
+	changes      chan wsChange
+	stop         chan struct{}
+	stopOnce     sync.Once
+	done         chan struct{}
+	// writers still flushing their connection
+	wg sync.WaitGroup
+}
+
+func newWsHub(logger *slog.Logger, queueSize int, writeTimeout time.Duration, pongTimeout time.Duration) *wsHub {
+	hub := &wsHub{
+		logger:       logger,
+		queueSize:    queueSize,
+		writeTimeout: writeTimeout,
+		pongTimeout:  pongTimeout,
+		clients:      make(map[wsClientKey]*wsClient),
+		register:     make(chan *wsClient),
+		unregister:   make(chan *wsClient),
+		broadcast:    make(chan wsBroadcast, wsBroadcastQueueSize),
+		changes:      make(chan wsChange),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go hub.run()
+	return hub
+}
+
+func (h *wsHub) run() {
+	defer close(h.done)
+	for {
+		select {
+		case client := <-h.register:
+			if existing, exists := h.clients[client.key]; exists {
+				h.remove(existing, websocket.CloseNormalClosure, "replaced by a new connection")
+			}
+			h.clients[client.key] = client
+		case client := <-h.unregister:
+			// an evicted client may already be replaced by a new connection with the same key
+			if h.clients[client.key] == client {
+				h.remove(client, websocket.CloseNormalClosure, "")
+			}
+		case message := <-h.broadcast:
+			h.dispatch(message)
+		case change := <-h.changes:
+			// events published before the change are delivered as if it never happened
+			h.drain()
+			if h.clients[change.client.key] == change.client {
+				h.apply(change)
+			}
+		case <-h.stop:
+			for _, client := range h.clients {
+				h.remove(client, websocket.CloseGoingAway, "server shutting down")
+			}
+			return
+		}
+	}
+}
+
+func (h *wsHub) dispatch(message wsBroadcast) {
+	for _, client := range h.clients {
+		if client.scope.Allows(message.tenantId, message.ownerId) && client.subscribed(message.topics) {
+			h.deliver(client, message.data)
+		}
+	}
+}
+
+// drain dispatches the broadcasts already queued.
+func (h *wsHub) drain() {
+	for {
+		select {
+		case message := <-h.broadcast:
+			h.dispatch(message)
+		default:
+			return
+		}
+	}
+}
+
+// deliver queues a message for the client, or lets go of the client when its queue is full.
+func (h *wsHub) deliver(client *wsClient, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		h.logger.Warn("WebSocket: Disconnecting slow client", slog.String("tenantId", client.key.tenantId), slog.String("subject", client.key.subject), slog.String("clientId", client.key.clientId))
+		h.remove(client, websocket.CloseTryAgainLater, "too slow to keep up")
+	}
+}
+
+func (h *wsHub) apply(change wsChange) {
+	client := change.client
+	reply := change.reply
+	switch {
+	case change.topic == "":
+	case !change.subscribe:
+		delete(client.topics, change.topic)
+	case !client.topics[change.topic] && len(client.topics) >= wsMaxTopics:
+		reply = errorReply(reply.Id, utils.ErrTooManySubscriptions)
+	default:
+		client.topics[change.topic] = true
+	}
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		h.logger.Error("WebSocket: Error encoding reply", slog.Any("error", err))
+		return
+	}
+	h.deliver(client, data)
+}
+
+func (h *wsHub) remove(client *wsClient, code int, text string) {
+	delete(h.clients, client.key)
+	client.closeCode = code
+	client.closeText = text
+	close(client.send)
+}
+
+// add registers a client, false once the hub stopped.
+func (h *wsHub) add(client *wsClient) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+func (h *wsHub) leave(client *wsClient) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
+}
+
+// change hands a subscription change over to the run loop, only it touches the topics of the clients.
+func (h *wsHub) change(change wsChange) {
+	select {
+	case h.changes <- change:
+	case <-h.done:
+	}
+}
+
+// Broadcast queues an event for the clients subscribed to it that may see its media.
+func (h *wsHub) Broadcast(event *events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		h.logger.Error("WebSocket: Error encoding event", slog.String("type", string(event.Type)), slog.Any("error", err))
+		return
+	}
+	select {
+	case h.broadcast <- wsBroadcast{tenantId: event.TenantId, ownerId: event.OwnerId, topics: eventTopics(event), data: data}:
+	case <-h.done:
+	}
+}
+
+// Stop disconnects every client with a going away close frame and waits for the frames to be written.
+func (h *wsHub) Stop() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	<-h.done
+	h.wg.Wait()
+}
+
+// write sends the queued messages and pings the client, it owns the writes to the connection.
+func (h *wsHub) write(client *wsClient) {
+	defer h.wg.Done()
+	defer client.conn.Close()
+
+	// pings go out early enough for the pong to arrive within the timeout
+	ticker := time.NewTicker(h.pongTimeout * 9 / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case data, ok := <-client.send:
+			if !ok {
+				// tell the client why before hanging up, a dead client can't stall this for long
+				message := websocket.FormatCloseMessage(client.closeCode, client.closeText)
+				client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(h.writeTimeout))
+				return
+			}
+			client.conn.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+			if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				h.logger.Warn("WebSocket: Error writing message", slog.Any("error", err))
+				return
+			}
+		case <-ticker.C:
+			if err := client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.writeTimeout)); err != nil {
+				h.logger.Warn("WebSocket: Error sending ping", slog.Any("error", err))
+				return
+			}
+		}
+	}
+}
+
+// read hands the messages of the client over until the connection breaks or no pong arrived in time.
+func (h *wsHub) read(client *wsClient, handle func(message []byte)) {
+	defer h.leave(client)
+
+	client.conn.SetReadLimit(wsMaxMessageSize)
+	client.conn.SetReadDeadline(time.Now().Add(h.pongTimeout))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(h.pongTimeout))
+	})
+	for {
+		_, p, err := client.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.logger.Warn("WebSocket: Error reading message", slog.Any("error", err))
+			}
+			return
+		}
+		handle(p)
+	}
+}
+
+func (app *restfulApi) wsHandler(w http.ResponseWriter, r *http.Request) {
+	scope := scopeOf(r)
+	// Extract the unique identifier for the client
+	clientId := r.URL.Query().Get("client_id")
+	if clientId == "" {
+		app.badRequest(w, r, utils.ErrMissingClientId)
+		return
+	}
+	// clients that don't say otherwise hear of everything, as they did before topics existed
+	topics := DEFAULT_TOPICS
+	if r.URL.Query().Has("topics") {
+		topics = splitTopics(r.URL.Query().Get("topics"))
+	}
+	if len(topics) > wsMaxTopics {
+		app.badRequest(w, r, utils.ErrTooManySubscriptions)
+		return
+	}
+	for _, topic := range topics {
+		if err := app.checkTopic(r.Context(), scope, topic); err != nil {
+			app.errorResponse(w, r, fmt.Errorf("%w: %s", err, topic))
+			return
+		}
+	}
+
+	// the client is registered before the upgrade completes, it hears of every change made
+	// once it is connected; messages wait in its queue until the writer starts
+	client := &wsClient{
+		key:    wsClientKey{tenantId: identityOf(r).TenantId, subject: identityOf(r).Subject, clientId: clientId},
+		scope:  scope,
+		topics: make(map[string]bool, len(topics)),
+		send:   make(chan []byte, app.hub.queueSize),
+	}
+	for _, topic := range topics {
+		client.topics[topic] = true
+	}
+	app.hub.wg.Add(1)
+	if !app.hub.add(client) {
+		app.hub.wg.Done()
+		app.errorResponse(w, r, utils.ErrShuttingDown)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already told the client what went wrong
+		app.hub.wg.Done()
+		app.hub.leave(client)
+		return
+	}
+	client.conn = conn
+
+	go app.hub.write(client)
+	app.hub.read(client, func(message []byte) {
+		app.handleCommand(r.Context(), scope, client, message)
+	})
+}
+
+// publishMediaEvent tells the clients of the tenant what the caller did to the media.
+func (app *restfulApi) publishMediaEvent(r *http.Request, eventType events.Type, media *models.Media) {
+	// the change is made, a client going away doesn't stop the others from hearing of it
+	err := app.events.Publish(context.WithoutCancel(r.Context()), &events.Event{
+		Type:     eventType,
+		TenantId: media.TenantId,
+		OwnerId:  media.OwnerId,
+		MediaId:  media.Id,
+		Actor:    identityOf(r).Subject,
+		Data:     events.SummarizeMedia(media),
+	})
+	if err != nil {
+		app.logger.Error("failed to publish media event", slog.String("mediaId", media.Id), slog.String("type", string(eventType)), slog.Any("error", err))
+	}
+}
+
+func (app *restfulApi) serveEventSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(events.Schema)
+}
@@ -0,0 +1,158 @@
+package restful
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/gorilla/websocket"
+)
+
+// expectClose reads until the server closes the connection and checks the close code.
+func expectClose(t *testing.T, conn *websocket.Conn, code int) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, code) {
+			t.Fatalf("expected close code %d, got %v", code, err)
+		}
+		return
+	}
+}
+
+func TestWebSocketSlowConsumer(t *testing.T) {
+	hub := newWsHub(slog.New(slog.NewTextHandler(io.Discard, nil)), 1, time.Second, time.Minute)
+	t.Cleanup(hub.Stop)
+
+	// neither client has a writer, nothing drains their queue
+	slow := &wsClient{
+		key:    wsClientKey{tenantId: "default", clientId: "slow"},
+		scope:  repositories.TenantScope("default"),
+		topics: map[string]bool{"media:*": true},
+		send:   make(chan []byte, 1),
+	}
+	other := &wsClient{
+		key:    wsClientKey{tenantId: "newsroom", clientId: "other"},
+		scope:  repositories.TenantScope("newsroom"),
+		topics: map[string]bool{"media:*": true},
+		send:   make(chan []byte, 1),
+	}
+	hub.add(slow)
+	hub.add(other)
+
+	hub.Broadcast(&events.Event{Type: events.MEDIA_UPDATED, TenantId: "default", Sequence: 1})
+	hub.Broadcast(&events.Event{Type: events.MEDIA_UPDATED, TenantId: "default", Sequence: 2})
+	hub.Broadcast(&events.Event{Type: events.MEDIA_UPDATED, TenantId: "newsroom", Sequence: 3})
+
+	// broadcasts are handled in order, once the other tenant heard of its own the slow client was let go
+	select {
+	case _, ok := <-other.send:
+		if !ok {
+			t.Fatal("expected the other client to stay connected")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the other client was never notified")
+	}
+
+	// the queued message is still delivered before the client is disconnected
+	if data := <-slow.send; !strings.Contains(string(data), `"sequence":1`) {
+		t.Errorf("unexpected message %s", data)
+	}
+	if _, ok := <-slow.send; ok {
+		t.Fatal("expected the slow client to be disconnected")
+	}
+	if slow.closeCode != websocket.CloseTryAgainLater {
+		t.Errorf("expected close code %d, got %d", websocket.CloseTryAgainLater, slow.closeCode)
+	}
+}
+
+func TestWebSocketKeepalive(t *testing.T) {
+	api := newTestApi(t)
+	api.app.hub.pongTimeout = 200 * time.Millisecond
+
+	// the default ping handler answers every ping while the client reads
+	alive := api.dialWebSocket(t, "alive")
+	var pings atomic.Int32
+	alive.SetPingHandler(func(data string) error {
+		pings.Add(1)
+		return alive.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	received := make(chan error, 1)
+	go func() {
+		alive.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := alive.ReadMessage()
+		received <- err
+	}()
+
+	// a client that never answers is dropped once the pong timeout passed
+	silent := api.dialWebSocket(t, "silent")
+	silent.SetPingHandler(func(string) error { return nil })
+	expectClose(t, silent, websocket.CloseNormalClosure)
+
+	api.createMedia(t, repositories.MediaPayload{Title: "Still there", MediaData: encodedContent(pngMagic, 20)})
+	if err := <-received; err != nil {
+		t.Fatalf("expected the answering client to stay connected: %v", err)
+	}
+	if pings.Load() == 0 {
+		t.Error("expected the server to ping the client")
+	}
+}
+
+func TestWebSocketReplacedConnection(t *testing.T) {
+	api := newTestApi(t)
+
+	first := api.dialWebSocket(t, "client")
+	second := api.dialWebSocket(t, "client")
+	expectClose(t, first, websocket.CloseNormalClosure)
+
+	api.createMedia(t, repositories.MediaPayload{Title: "Replaced", MediaData: encodedContent(pngMagic, 20)})
+	if event := readMediaEvent(t, second); event.Type != events.MEDIA_CREATED {
+		t.Fatalf("expected the new connection to be notified, got %+v", event)
+	}
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	api := newTestApi(t)
+	conn := api.dialWebSocket(t, "client")
+
+	api.app.Stop()
+	expectClose(t, conn, websocket.CloseGoingAway)
+
+	wsURL := "ws" + strings.TrimPrefix(api.server.URL, "http") + "/ws?client_id=late&access_token=" + api.token
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected clients to be turned away after the shutdown, got %v", err)
+	}
+	// broadcasts after the shutdown are dropped rather than blocking the handlers
+	api.createMedia(t, repositories.MediaPayload{Title: "After shutdown", MediaData: encodedContent(pngMagic, 20)})
+}
+
+func TestWebSocketClientIds(t *testing.T) {
+	api := newTestApi(t)
+	bob := api.as(t, "bob", false)
+
+	// colleagues choosing the same client id keep their own connections
+	aliceConn := api.dialWebSocket(t, "client")
+	bobConn := bob.dialWebSocket(t, "client")
+	api.createMedia(t, repositories.MediaPayload{Title: "Alice's clip", MediaData: encodedContent(pngMagic, 20)})
+	if event := readMediaEvent(t, aliceConn); event.Type != events.MEDIA_CREATED || event.Data.Title != "Alice's clip" {
+		t.Fatalf("expected the first connection to be notified, got %+v", event)
+	}
+	bob.createMedia(t, repositories.MediaPayload{Title: "Bob's clip", MediaData: encodedContent(pngMagic, 20)})
+	if event := readMediaEvent(t, bobConn); event.Type != events.MEDIA_CREATED || event.Data.Title != "Bob's clip" {
+		t.Fatalf("expected the second connection to be notified, got %+v", event)
+	}
+
+	// the same user reconnecting replaces its connection
+	bob.dialWebSocket(t, "client")
+	expectClose(t, bobConn, websocket.CloseNormalClosure)
+}
@@ -0,0 +1,241 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+type Options struct {
+	// Endpoint is the base URL of the S3 compatible service, e.g. http://localhost:9000 for MinIO.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// blobStore talks to any S3 compatible object storage using path-style requests.
+type blobStore struct {
+	logger      *slog.Logger
+	endpoint    *url.URL
+	bucket      string
+	credentials *credentials
+	client      *http.Client
+}
+
+func NewBlobStore(logger *slog.Logger, options Options) (repositories.BlobStore, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", options.Endpoint)
+	}
+	if options.Bucket == "" {
+		return nil, fmt.Errorf("missing s3 bucket")
+	}
+	region := options.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &blobStore{
+		logger:   logger,
+		endpoint: endpoint,
+		bucket:   options.Bucket,
+		credentials: &credentials{
+			accessKey: options.AccessKey,
+			secretKey: options.SecretKey,
+			region:    region,
+		},
+		client: &http.Client{},
+	}, nil
+}
+
+func (bs *blobStore) objectURL(key string) (*url.URL, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return nil, utils.ErrInvalidBlobKey
+	}
+	objectURL := *bs.endpoint
+	objectURL.Path = strings.TrimSuffix(bs.endpoint.Path, "/") + "/" + bs.bucket + "/" + key
+	// keep the escaping identical to the one that gets signed
+	objectURL.RawPath = canonicalURI(&objectURL)
+	return &objectURL, nil
+}
+
+func (bs *blobStore) newRequest(ctx context.Context, method string, key string, body io.Reader, payloadHash string) (*http.Request, error) {
+	objectURL, err := bs.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, objectURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	bs.credentials.sign(req, payloadHash, time.Now())
+	return req, nil
+}
+
+func (bs *blobStore) Put(ctx context.Context, key string, content io.Reader) (*repositories.BlobInfo, error) {
+	// S3 needs the length and hash up front, spool to disk so large media never sits in memory
+	spool, err := os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), utils.ContextReader(ctx, content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to spool blob: %w", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	req, err := bs.newRequest(ctx, http.MethodPut, key, io.NopCloser(spool), checksum)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+
+	resp, err := bs.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload blob: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, bs.responseError("upload blob", resp)
+	}
+
+	return &repositories.BlobInfo{
+		Key:      key,
+		Size:     size,
+		Checksum: checksum,
+	}, nil
+}
+
+func (bs *blobStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	req, err := bs.newRequest(ctx, http.MethodHead, key, nil, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := bs.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up blob: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, utils.ErrBlobNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, bs.responseError("look up blob", resp)
+	}
+	return &objectReader{
+		ctx:   ctx,
+		store: bs,
+		key:   key,
+		size:  resp.ContentLength,
+	}, nil
+}
+
+func (bs *blobStore) Delete(ctx context.Context, key string) error {
+	req, err := bs.newRequest(ctx, http.MethodDelete, key, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp, err := bs.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	defer resp.Body.Close()
+	// S3 answers 204 even for missing keys
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return bs.responseError("delete blob", resp)
+	}
+	return nil
+}
+
+func (bs *blobStore) responseError(operation string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	bs.logger.Error("s3 request failed", slog.String("operation", operation), slog.Int("status", resp.StatusCode), slog.String("body", string(body)))
+	return fmt.Errorf("failed to %s: unexpected status %d", operation, resp.StatusCode)
+}
+
+// objectReader downloads lazily with ranged GET requests, a seek only costs a new request
+// once the reader is read from at a different offset.
+type objectReader struct {
+	ctx    context.Context
+	store  *blobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (reader *objectReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+	if reader.body == nil {
+		req, err := reader.store.newRequest(reader.ctx, http.MethodGet, reader.key, nil, emptyPayloadHash)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", reader.offset))
+		resp, err := reader.store.client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("failed to download blob: %w", err)
+		}
+		if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return 0, reader.store.responseError("download blob", resp)
+		}
+		reader.body = resp.Body
+	}
+	n, err := reader.body.Read(p)
+	reader.offset += int64(n)
+	return n, err
+}
+
+func (reader *objectReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = reader.offset + offset
+	case io.SeekEnd:
+		target = reader.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("negative position %d", target)
+	}
+	if target != reader.offset && reader.body != nil {
+		reader.body.Close()
+		reader.body = nil
+	}
+	reader.offset = target
+	return target, nil
+}
+
+func (reader *objectReader) Close() error {
+	if reader.body == nil {
+		return nil
+	}
+	err := reader.body.Close()
+	reader.body = nil
+	return err
+}
@@ -0,0 +1,222 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+const (
+	testBucket    = "media"
+	testAccessKey = "minio"
+	testSecretKey = "minio-secret"
+)
+
+// fakeS3 stands in for MinIO: it checks the signatures and keeps the objects of one bucket in memory.
+type fakeS3 struct {
+	t       *testing.T
+	lock    sync.Mutex
+	objects map[string][]byte
+	// ranges are the Range headers of the GET requests, in order
+	ranges []string
+	// failWith answers every request with this status when set
+	failWith int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if !f.validSignature(r) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+	if f.failWith != 0 {
+		w.WriteHeader(f.failWith)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchBucket</Code></Error>")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != r.Header.Get("X-Amz-Content-Sha256") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<Error><Code>XAmzContentSHA256Mismatch</Code></Error>")
+			return
+		}
+		f.objects[key] = body
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead, http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		f.ranges = append(f.ranges, r.Header.Get("Range"))
+		var start int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil || start > len(object) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(object)-1, len(object)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(object[start:])
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// validSignature signs the request again with the secret of the test account.
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	signedAt, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	expected, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		f.t.Error(err)
+		return false
+	}
+	(&credentials{accessKey: testAccessKey, secretKey: testSecretKey, region: "us-east-1"}).sign(expected, r.Header.Get("X-Amz-Content-Sha256"), signedAt)
+	return expected.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func newTestStore(t *testing.T, secretKey string) (*blobStore, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{t: t, objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := NewBlobStore(logger, Options{Endpoint: server.URL, Bucket: testBucket, AccessKey: testAccessKey, SecretKey: secretKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.(*blobStore), fake
+}
+
+func TestBlobStore(t *testing.T) {
+	ctx := context.Background()
+	store, fake := newTestStore(t, testSecretKey)
+	content := []byte("the content of a media, stored in a bucket")
+	key := "media/a b/clip+1.mp4"
+
+	info, err := store.Put(ctx, key, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("failed to put blob: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	if info.Key != key || info.Size != int64(len(content)) || info.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected blob info: %+v", info)
+	}
+	if !bytes.Equal(fake.objects[key], content) {
+		t.Fatalf("expected the object to be stored under %q, got %v", key, fake.objects)
+	}
+
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("failed to get blob: %v", err)
+	}
+	defer reader.Close()
+	read, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(read, content) {
+		t.Errorf("expected the content, got %q (%v)", read, err)
+	}
+
+	// seeking costs a ranged request once read from
+	if _, err := reader.Seek(-7, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail := make([]byte, 16)
+	n, err := io.ReadFull(reader, tail)
+	if !errors.Is(err, io.ErrUnexpectedEOF) || string(tail[:n]) != " bucket" {
+		t.Errorf("expected the last 7 bytes, got %q (%v)", tail[:n], err)
+	}
+	if _, err := reader.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	word := make([]byte, 7)
+	if _, err := io.ReadFull(reader, word); err != nil || string(word) != "content" {
+		t.Errorf("expected %q, got %q (%v)", "content", word, err)
+	}
+	expectedRanges := []string{"bytes=0-", fmt.Sprintf("bytes=%d-", len(content)-7), "bytes=4-"}
+	if strings.Join(fake.ranges, ",") != strings.Join(expectedRanges, ",") {
+		t.Errorf("expected the ranges %v, got %v", expectedRanges, fake.ranges)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("failed to delete blob: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, utils.ErrBlobNotFound) {
+		t.Errorf("expected %v, got %v", utils.ErrBlobNotFound, err)
+	}
+	// deleting a missing blob is not an error, as with S3
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("unexpected error deleting a missing blob: %v", err)
+	}
+}
+
+func TestBlobStoreErrors(t *testing.T) {
+	ctx := context.Background()
+
+	store, _ := newTestStore(t, "wrong-secret")
+	if _, err := store.Put(ctx, "media/1", strings.NewReader("content")); err == nil {
+		t.Error("expected the upload with a wrong secret to fail")
+	}
+
+	store, fake := newTestStore(t, testSecretKey)
+	fake.failWith = http.StatusInternalServerError
+	if _, err := store.Get(ctx, "media/1"); err == nil || errors.Is(err, utils.ErrBlobNotFound) {
+		t.Errorf("expected a server error, got %v", err)
+	}
+	if err := store.Delete(ctx, "media/1"); err == nil {
+		t.Error("expected the deletion to fail")
+	}
+
+	for _, key := range []string{"", "/media/1"} {
+		if _, err := store.Put(ctx, key, strings.NewReader("content")); !errors.Is(err, utils.ErrInvalidBlobKey) {
+			t.Errorf("expected %v for the key %q, got %v", utils.ErrInvalidBlobKey, key, err)
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := NewBlobStore(logger, Options{Endpoint: "not a url", Bucket: testBucket}); err == nil {
+		t.Error("expected an invalid endpoint to be refused")
+	}
+	if _, err := NewBlobStore(logger, Options{Endpoint: "http://localhost:9000"}); err == nil {
+		t.Error("expected a missing bucket to be refused")
+	}
+}
@@ -0,0 +1,91 @@
+package similarity
+
+// entry is a frame of a media, as of a generation of its hashes.
+type entry struct {
+	mediaId    string
+	frame      int
+	dHash      uint64
+	generation int
+}
+
+// bkNode groups the entries with the same pHash, its children are keyed by their distance to it.
+type bkNode struct {
+	hash     uint64
+	entries  []entry
+	children map[int]*bkNode
+}
+
+// bkTree finds the hashes within a distance of a query without comparing it to all of them:
+// by the triangle inequality, a child at distance d of a node at distance q of the query
+// can only match when |d-q| <= maxDistance.
+type bkTree struct {
+	root *bkNode
+	size int
+}
+
+func (t *bkTree) insert(hash uint64, e entry) {
+	t.size++
+	if t.root == nil {
+		t.root = &bkNode{hash: hash, entries: []entry{e}}
+		return
+	}
+	node := t.root
+	for {
+		distance := Distance(node.hash, hash)
+		if distance == 0 {
+			node.entries = append(node.entries, e)
+			return
+		}
+		child, ok := node.children[distance]
+		if !ok {
+			if node.children == nil {
+				node.children = map[int]*bkNode{}
+			}
+			node.children[distance] = &bkNode{hash: hash, entries: []entry{e}}
+			return
+		}
+		node = child
+	}
+}
+
+// search calls found with the entries within maxDistance of the hash and their distance.
+func (t *bkTree) search(hash uint64, maxDistance int, found func(e entry, distance int)) {
+	if t.root == nil {
+		return
+	}
+	pending := []*bkNode{t.root}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		distance := Distance(node.hash, hash)
+		if distance <= maxDistance {
+			for _, e := range node.entries {
+				found(e, distance)
+			}
+		}
+		for childDistance, child := range node.children {
+			if childDistance >= distance-maxDistance && childDistance <= distance+maxDistance {
+				pending = append(pending, child)
+			}
+		}
+	}
+}
+
+// walk calls fn with every entry of the tree and its pHash.
+func (t *bkTree) walk(fn func(hash uint64, e entry)) {
+	if t.root == nil {
+		return
+	}
+	pending := []*bkNode{t.root}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, e := range node.entries {
+			fn(node.hash, e)
+		}
+		for _, child := range node.children {
+			pending = append(pending, child)
+		}
+	}
+}
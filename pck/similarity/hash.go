@@ -0,0 +1,189 @@
+package similarity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+const (
+	// pHash keeps the lowest 8x8 frequencies of the DCT of a 32x32 thumbnail
+	pHashSize     = 32
+	pHashLowFreqs = 8
+	// dHash compares the neighbouring pixels of a 9x8 thumbnail
+	dHashWidth  = 9
+	dHashHeight = 8
+	// HASH_BITS is the largest distance between two hashes
+	HASH_BITS = 64
+)
+
+// ErrUnsupported is returned for media that can't be hashed, e.g. audio, or video without a keyframe extractor.
+var ErrUnsupported = errors.New("media can't be hashed")
+
+// Fingerprint holds the hashes of an image. Near-duplicates are found with the pHash, which
+// survives re-encoding and resizing, the dHash ranks the matches that are equally close.
+type Fingerprint struct {
+	PHash uint64
+	DHash uint64
+}
+
+// Distance counts the bits two hashes differ by, 0 for identical ones and HASH_BITS at most.
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// KeyframeExtractor decodes the keyframes of videos, they are hashed like images.
+type KeyframeExtractor interface {
+	Keyframes(ctx context.Context, data []byte) ([]image.Image, error)
+}
+
+type Hasher struct {
+	keyframes KeyframeExtractor
+}
+
+// NewHasher hashes images, and videos too unless keyframes is nil.
+func NewHasher(keyframes KeyframeExtractor) *Hasher {
+	return &Hasher{keyframes: keyframes}
+}
+
+// Hash fingerprints an image, or every keyframe of a video in order.
+func (h *Hasher) Hash(ctx context.Context, mimeType string, data []byte) ([]Fingerprint, error) {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		img, err := DecodeImage(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Fingerprint{{PHash: PHash(img), DHash: DHash(img)}}, nil
+	case strings.HasPrefix(mimeType, "video/") && h.keyframes != nil:
+		frames, err := h.keyframes.Keyframes(ctx, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract keyframes: %w", err)
+		}
+		return HashFrames(frames), nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// HashFrames fingerprints the frames of a video already decoded, in order.
+func HashFrames(frames []image.Image) []Fingerprint {
+	fingerprints := make([]Fingerprint, 0, len(frames))
+	for _, frame := range frames {
+		fingerprints = append(fingerprints, Fingerprint{PHash: PHash(frame), DHash: DHash(frame)})
+	}
+	return fingerprints
+}
+
+// DecodeImage decodes the JPEG, PNG and GIF images, the other formats are unsupported.
+func DecodeImage(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// PHash sets the bits of the low frequencies above their median.
+func PHash(img image.Image) uint64 {
+	pixels := grayscale(img, pHashSize, pHashSize)
+	coefficients := dct(pixels, pHashSize)
+
+	low := make([]float64, 0, pHashLowFreqs*pHashLowFreqs)
+	for y := range pHashLowFreqs {
+		low = append(low, coefficients[y*pHashSize:y*pHashSize+pHashLowFreqs]...)
+	}
+	// the DC term only tells how bright the image is, it would skew the median
+	sorted := slices.Clone(low[1:])
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, coefficient := range low {
+		if coefficient > median {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+// DHash sets a bit for every pixel darker than its right neighbour.
+func DHash(img image.Image) uint64 {
+	pixels := grayscale(img, dHashWidth, dHashHeight)
+	var hash uint64
+	for y := range dHashHeight {
+		for x := range dHashWidth - 1 {
+			if pixels[y*dHashWidth+x] < pixels[y*dHashWidth+x+1] {
+				hash |= 1 << (y*(dHashWidth-1) + x)
+			}
+		}
+	}
+	return hash
+}
+
+// grayscale shrinks the image to width x height luma values, every one the average of the pixels it covers.
+func grayscale(img image.Image, width int, height int) []float64 {
+	bounds := img.Bounds()
+	pixels := make([]float64, width*height)
+	if bounds.Empty() {
+		return pixels
+	}
+	for y := range height {
+		top := bounds.Min.Y + y*bounds.Dy()/height
+		bottom := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, top+1)
+		for x := range width {
+			left := bounds.Min.X + x*bounds.Dx()/width
+			right := max(bounds.Min.X+(x+1)*bounds.Dx()/width, left+1)
+			var sum float64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					r, g, b, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			pixels[y*width+x] = sum / float64((bottom-top)*(right-left))
+		}
+	}
+	return pixels
+}
+
+// dct computes the 2D DCT-II of a size x size block, rows then columns.
+func dct(pixels []float64, size int) []float64 {
+	cosines := make([]float64, size*size)
+	for k := range size {
+		for n := range size {
+			cosines[k*size+n] = math.Cos(math.Pi / float64(size) * (float64(n) + 0.5) * float64(k))
+		}
+	}
+	transform := func(in []float64, out []float64, offset int, stride int) {
+		for k := range size {
+			var sum float64
+			for n := range size {
+				sum += in[offset+n*stride] * cosines[k*size+n]
+			}
+			out[offset+k*stride] = sum
+		}
+	}
+
+	rows := make([]float64, len(pixels))
+	for y := range size {
+		transform(pixels, rows, y*size, 1)
+	}
+	coefficients := make([]float64, len(pixels))
+	for x := range size {
+		transform(rows, coefficients, x, size)
+	}
+	return coefficients
+}
@@ -0,0 +1,66 @@
+package similarity
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// gradient draws ramps shaded by waves, brightness shifts every pixel.
+func gradient(width int, height int, brightness float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			u, v := float64(x)/float64(width), float64(y)/float64(height)
+			value := uint8(max(0, min(255, 110+brightness+40*u-30*v+60*math.Sin(7*u)*math.Cos(5*v))))
+			img.Set(x, y, color.RGBA{R: value, G: value / 2, B: 255 - value, A: 255})
+		}
+	}
+	return img
+}
+
+func TestHashesSurviveResizing(t *testing.T) {
+	original := gradient(300, 200, 0)
+	for name, img := range map[string]image.Image{
+		"downscaled": gradient(150, 100, 0),
+		"brightened": gradient(300, 200, 15),
+		"upscaled":   gradient(640, 427, 0),
+	} {
+		if distance := Distance(PHash(original), PHash(img)); distance > 6 {
+			t.Errorf("%s: expected a close pHash, got a distance of %d", name, distance)
+		}
+		if distance := Distance(DHash(original), DHash(img)); distance > 6 {
+			t.Errorf("%s: expected a close dHash, got a distance of %d", name, distance)
+		}
+	}
+
+	// the same picture mirrored is another image
+	mirrored := image.NewRGBA(original.Bounds())
+	for y := range 200 {
+		for x := range 300 {
+			mirrored.Set(299-x, y, original.At(x, y))
+		}
+	}
+	if distance := Distance(PHash(original), PHash(mirrored)); distance < 16 {
+		t.Errorf("expected the mirrored image to be far, got a distance of %d", distance)
+	}
+}
+
+func TestHashUnsupported(t *testing.T) {
+	hasher := NewHasher(nil)
+	for _, test := range []struct {
+		mimeType string
+		data     string
+	}{
+		{"audio/mpeg", "ID3"},
+		{"video/mp4", "\x00\x00\x00\x18ftypmp42"},
+		{"image/webp", "RIFF\x00\x00\x00\x00WEBPVP8 "},
+	} {
+		if _, err := hasher.Hash(context.Background(), test.mimeType, []byte(test.data)); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, got %v", test.mimeType, err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package similarity
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+)
+
+const (
+	// the tree is rebuilt once the replaced or deleted hashes outnumber the live ones
+	minRebuild = 1024
+	// hashes reloaded after the analysis of another replica get this long
+	refreshTimeout = 10 * time.Second
+)
+
+// Match is the closest frame of a media to the query.
+type Match struct {
+	MediaId string
+	Frame   int
+	// Distance between the pHashes, DHashDistance ranks the matches equally close
+	Distance      int
+	DHashDistance int
+}
+
+// indexedMedia holds the hashes of a media as of their last generation, the entries of the
+// previous generations are left in the tree and skipped.
+type indexedMedia struct {
+	tenantId   string
+	ownerId    string
+	generation int
+	hashes     int
+}
+
+// Index keeps the hashes of every media in memory, in a BK-tree searched without scanning
+// them all. Every replica has an index of its own, kept up to date by the events of the bus:
+// the hashes of a media are reloaded once another replica analysed it.
+type Index struct {
+	logger     *slog.Logger
+	repository repositories.MediaHashRepository
+	hasher     *Hasher
+	lock       sync.RWMutex
+	tree       *bkTree
+	media      map[string]*indexedMedia
+	generation int
+	stale      int
+	// media whose hashes must be reloaded, the refresh worker is woken up for them
+	pending     map[string]bool
+	pendingLock sync.Mutex
+	wake        chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+func NewIndex(logger *slog.Logger, repository repositories.MediaHashRepository, hasher *Hasher) *Index {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Index{
+		logger:     logger,
+		repository: repository,
+		hasher:     hasher,
+		tree:       &bkTree{},
+		media:      map[string]*indexedMedia{},
+		pending:    map[string]bool{},
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Load indexes the hashes of every media stored.
+func (i *Index) Load(ctx context.Context) error {
+	hashes, err := i.repository.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load media hashes: %w", err)
+	}
+	byMedia := map[string][]models.MediaHash{}
+	for _, hash := range hashes {
+		byMedia[hash.MediaId] = append(byMedia[hash.MediaId], hash)
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for mediaId, hashes := range byMedia {
+		i.put(mediaId, hashes)
+	}
+	return nil
+}
+
+// Hash fingerprints content without indexing it, to search for it.
+func (i *Index) Hash(ctx context.Context, mimeType string, data []byte) ([]Fingerprint, error) {
+	return i.hasher.Hash(ctx, mimeType, data)
+}
+
+// Update hashes the content of a media, stores the hashes and indexes them in place of the
+// previous ones. Media that can't be hashed are left out of the index.
+func (i *Index) Update(ctx context.Context, media *models.Media, data []byte) error {
+	fingerprints, err := i.hasher.Hash(ctx, media.MimeType, data)
+	if err != nil && !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return i.save(ctx, media, fingerprints)
+}
+
+// UpdateFrames indexes the frames sampled from a video by the caller, like Update does with
+// the frames it samples itself.
+func (i *Index) UpdateFrames(ctx context.Context, media *models.Media, frames []image.Image) error {
+	return i.save(ctx, media, HashFrames(frames))
+}
+
+// save stores the hashes of a media and indexes them in place of the previous ones.
+func (i *Index) save(ctx context.Context, media *models.Media, fingerprints []Fingerprint) error {
+	hashes := make([]models.MediaHash, 0, len(fingerprints))
+	for frame, fingerprint := range fingerprints {
+		hashes = append(hashes, models.MediaHash{
+			MediaId:  media.Id,
+			TenantId: media.TenantId,
+			OwnerId:  media.OwnerId,
+			Frame:    frame,
+			PHash:    fingerprint.PHash,
+			DHash:    fingerprint.DHash,
+		})
+	}
+	if err := i.repository.Save(ctx, media.Id, hashes); err != nil {
+		return fmt.Errorf("failed to save media hashes: %w", err)
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.put(media.Id, hashes)
+	return nil
+}
+
+// Fingerprints returns the stored hashes of a media, none when it was never hashed.
+func (i *Index) Fingerprints(ctx context.Context, mediaId string) ([]Fingerprint, error) {
+	hashes, err := i.repository.GetByMediaID(ctx, mediaId)
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := make([]Fingerprint, 0, len(hashes))
+	for _, hash := range hashes {
+		fingerprints = append(fingerprints, Fingerprint{PHash: hash.PHash, DHash: hash.DHash})
+	}
+	return fingerprints, nil
+}
+
+// Search returns the media of the scope with a frame within maxDistance of one of the
+// fingerprints, closest first.
+func (i *Index) Search(scope repositories.Scope, fingerprints []Fingerprint, maxDistance int) []Match {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	best := map[string]Match{}
+	for _, fingerprint := range fingerprints {
+		i.tree.search(fingerprint.PHash, maxDistance, func(e entry, distance int) {
+			media, ok := i.media[e.mediaId]
+			if !ok || media.generation != e.generation || !scope.Allows(media.tenantId, media.ownerId) {
+				return
+			}
+			match := Match{MediaId: e.mediaId, Frame: e.frame, Distance: distance, DHashDistance: Distance(e.dHash, fingerprint.DHash)}
+			if current, found := best[e.mediaId]; !found || compareMatches(match, current) < 0 {
+				best[e.mediaId] = match
+			}
+		})
+	}
+
+	matches := make([]Match, 0, len(best))
+	for _, match := range best {
+		matches = append(matches, match)
+	}
+	slices.SortFunc(matches, compareMatches)
+	return matches
+}
+
+func compareMatches(a Match, b Match) int {
+	return cmp.Or(
+		cmp.Compare(a.Distance, b.Distance),
+		cmp.Compare(a.DHashDistance, b.DHashDistance),
+		cmp.Compare(a.MediaId, b.MediaId),
+		cmp.Compare(a.Frame, b.Frame),
+	)
+}
+
+// HandleEvent keeps the index in step with the other replicas, it is subscribed to the event bus.
+func (i *Index) HandleEvent(event *events.Event) {
+	switch event.Type {
+	case events.MEDIA_DELETED:
+		i.lock.Lock()
+		defer i.lock.Unlock()
+		i.remove(event.MediaId)
+	case events.ANALYSIS_COMPLETED:
+		// the hashes are stored before the analysis completes, they are reloaded off the bus
+		i.pendingLock.Lock()
+		i.pending[event.MediaId] = true
+		i.pendingLock.Unlock()
+		select {
+		case i.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (i *Index) Start() {
+	i.wg.Add(1)
+	go i.refresh()
+}
+
+func (i *Index) Stop() {
+	i.cancel()
+	i.wg.Wait()
+}
+
+// refresh reloads the hashes of the pending media until the index stops.
+func (i *Index) refresh() {
+	defer i.wg.Done()
+	for {
+		select {
+		case <-i.ctx.Done():
+			return
+		case <-i.wake:
+		}
+
+		i.pendingLock.Lock()
+		pending := i.pending
+		i.pending = map[string]bool{}
+		i.pendingLock.Unlock()
+
+		for mediaId := range pending {
+			ctx, cancel := context.WithTimeout(i.ctx, refreshTimeout)
+			hashes, err := i.repository.GetByMediaID(ctx, mediaId)
+			cancel()
+			if err != nil {
+				i.logger.Error("failed to refresh media hashes", slog.String("mediaId", mediaId), slog.Any("error", err))
+				continue
+			}
+			i.lock.Lock()
+			i.put(mediaId, hashes)
+			i.lock.Unlock()
+		}
+	}
+}
+
+// put replaces the hashes of a media, the caller holds the write lock.
+func (i *Index) put(mediaId string, hashes []models.MediaHash) {
+	i.remove(mediaId)
+	if len(hashes) == 0 {
+		return
+	}
+	i.generation++
+	i.media[mediaId] = &indexedMedia{
+		tenantId:   hashes[0].TenantId,
+		ownerId:    hashes[0].OwnerId,
+		generation: i.generation,
+		hashes:     len(hashes),
+	}
+	for _, hash := range hashes {
+		i.tree.insert(hash.PHash, entry{mediaId: mediaId, frame: hash.Frame, dHash: hash.DHash, generation: i.generation})
+	}
+}
+
+// remove drops a media from the index, the caller holds the write lock. Its entries stay in
+// the tree until there are enough of them to rebuild it.
+func (i *Index) remove(mediaId string) {
+	media, ok := i.media[mediaId]
+	if !ok {
+		return
+	}
+	delete(i.media, mediaId)
+	i.stale += media.hashes
+	if i.stale >= minRebuild && i.stale > i.tree.size/2 {
+		i.rebuild()
+	}
+}
+
+// rebuild drops the stale entries by inserting the live ones in a new tree.
+func (i *Index) rebuild() {
+	tree := &bkTree{}
+	i.tree.walk(func(hash uint64, e entry) {
+		if media, ok := i.media[e.mediaId]; ok && media.generation == e.generation {
+			tree.insert(hash, e)
+		}
+	})
+	i.tree = tree
+	i.stale = 0
+}
@@ -0,0 +1,133 @@
+package similarity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/events"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/memory"
+)
+
+// flip changes n distinct bits of a hash.
+func flip(random *rand.Rand, hash uint64, n int) uint64 {
+	for _, bit := range random.Perm(HASH_BITS)[:n] {
+		hash ^= 1 << bit
+	}
+	return hash
+}
+
+func TestIndexSearch(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	index := NewIndex(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil)
+
+	// clusters of near-duplicates, a third of them replaced and another third deleted to leave stale entries
+	hashes := map[string]models.MediaHash{}
+	inserted := 0
+	for i := range 3000 {
+		center := random.Uint64()
+		for j := range 3 {
+			hash := models.MediaHash{MediaId: fmt.Sprintf("media-%d-%d", i, j), TenantId: "default", OwnerId: "alice", PHash: flip(random, center, random.IntN(8)), DHash: random.Uint64()}
+			if j == 2 {
+				hash.TenantId = "newsroom"
+			}
+			hashes[hash.MediaId] = hash
+			index.put(hash.MediaId, []models.MediaHash{hash})
+			inserted++
+		}
+	}
+	for mediaId, hash := range hashes {
+		switch random.IntN(3) {
+		case 0:
+			hash.PHash = flip(random, hash.PHash, 3)
+			hashes[mediaId] = hash
+			index.put(mediaId, []models.MediaHash{hash})
+			inserted++
+		case 1:
+			delete(hashes, mediaId)
+			index.remove(mediaId)
+		}
+	}
+	if index.tree.size >= inserted {
+		t.Fatalf("expected the tree to be rebuilt without its stale entries, it has %d of %d", index.tree.size, inserted)
+	}
+
+	scope := repositories.TenantScope("default")
+	for range 50 {
+		var query Fingerprint
+		for _, hash := range hashes {
+			query = Fingerprint{PHash: flip(random, hash.PHash, 2), DHash: hash.DHash}
+			break
+		}
+		expected := map[string]int{}
+		for mediaId, hash := range hashes {
+			if distance := Distance(hash.PHash, query.PHash); distance <= 10 && scope.Allows(hash.TenantId, hash.OwnerId) {
+				expected[mediaId] = distance
+			}
+		}
+
+		matches := index.Search(scope, []Fingerprint{query}, 10)
+		if len(matches) != len(expected) {
+			t.Fatalf("expected %d matches, got %d", len(expected), len(matches))
+		}
+		for i, match := range matches {
+			if expected[match.MediaId] != match.Distance {
+				t.Errorf("unexpected match %+v, expected a distance of %d", match, expected[match.MediaId])
+			}
+			if i > 0 && compareMatches(matches[i-1], match) > 0 {
+				t.Errorf("matches out of order: %+v before %+v", matches[i-1], match)
+			}
+		}
+	}
+}
+
+func TestIndexEvents(t *testing.T) {
+	db := memory.NewDatabase()
+	mediaRepository := memory.NewMediaRepository(db)
+	hashRepository := memory.NewMediaHashRepository(db)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	media, err := mediaRepository.Create(context.Background(), &repositories.MediaPayload{Title: "Clip", TenantId: "default", OwnerId: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another replica hashed the media, this one hears of it once the analysis completed
+	index := NewIndex(logger, hashRepository, NewHasher(nil))
+	index.Start()
+	t.Cleanup(index.Stop)
+	err = hashRepository.Save(context.Background(), media.Id, []models.MediaHash{{Frame: 0, PHash: 0xF0F0, DHash: 1}, {Frame: 1, PHash: 0xFFFF, DHash: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.HandleEvent(&events.Event{Type: events.ANALYSIS_COMPLETED, MediaId: media.Id})
+
+	deadline := time.Now().Add(2 * time.Second)
+	var matches []Match
+	for len(matches) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		matches = index.Search(repositories.OwnerScope("default", "alice"), []Fingerprint{{PHash: 0xFFFE}}, 2)
+	}
+	if len(matches) != 1 || matches[0].MediaId != media.Id || matches[0].Frame != 1 || matches[0].Distance != 1 {
+		t.Fatalf("expected the second frame of the media, got %+v", matches)
+	}
+
+	// a new replica loads what was stored
+	loaded := NewIndex(logger, hashRepository, NewHasher(nil))
+	if err := loaded.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if matches := loaded.Search(repositories.SCOPE_ALL, []Fingerprint{{PHash: 0xF0F0}}, 0); len(matches) != 1 {
+		t.Fatalf("expected the stored hashes to be loaded, got %+v", matches)
+	}
+
+	index.HandleEvent(&events.Event{Type: events.MEDIA_DELETED, MediaId: media.Id})
+	if matches := index.Search(repositories.SCOPE_ALL, []Fingerprint{{PHash: 0xFFFE}}, 2); len(matches) != 0 {
+		t.Fatalf("expected the deleted media to leave the index, got %+v", matches)
+	}
+}
@@ -0,0 +1,360 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+	"github.com/google/uuid"
+)
+
+const janitorInterval = time.Minute
+
+// Service assembles resumable uploads chunk by chunk in a local directory
+// and turns every finished upload into a media.
+// The media inherits the tenant and owner of its upload, uploads outside the scope of a call are not found.
+type Service interface {
+	Create(ctx context.Context, tenantId string, ownerId string, length int64, metadata map[string]string) (*models.Upload, error)
+	Get(ctx context.Context, scope repositories.Scope, id string) (*models.Upload, error)
+	// Append writes a chunk at the given offset. The returned media is only set
+	// when this chunk completed the upload.
+	Append(ctx context.Context, scope repositories.Scope, id string, offset int64, chunk io.Reader) (*models.Upload, *models.Media, error)
+	Terminate(ctx context.Context, scope repositories.Scope, id string) error
+	// Start periodically removes the uploads that expired.
+	Start()
+	Stop()
+}
+
+type service struct {
+	logger           *slog.Logger
+	uploadRepository repositories.UploadRepository
+	mediaRepository  repositories.MediaRepository
+	blobStore        repositories.BlobStore
+	mediaRules       *validator.MediaRules
+	dir              string
+	ttl              time.Duration
+	locks            sync.Map
+	stop             chan struct{}
+	wg               sync.WaitGroup
+}
+
+func New(logger *slog.Logger, uploadRepository repositories.UploadRepository, mediaRepository repositories.MediaRepository, blobStore repositories.BlobStore, mediaRules *validator.MediaRules, dir string, ttl time.Duration) (Service, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create uploads directory: %w", err)
+	}
+	return &service{
+		logger:           logger,
+		uploadRepository: uploadRepository,
+		mediaRepository:  mediaRepository,
+		blobStore:        blobStore,
+		mediaRules:       mediaRules,
+		dir:              dir,
+		ttl:              ttl,
+		stop:             make(chan struct{}),
+	}, nil
+}
+
+func (s *service) partPath(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
+
+// uploadLock serializes the requests on one upload. It is marked removed before leaving the map,
+// the callers that were waiting on it then take the one new callers share.
+type uploadLock struct {
+	sync.Mutex
+	removed bool
+}
+
+// lock serializes the chunks of one upload, clients retrying after a timeout may race their own previous request.
+func (s *service) lock(id string) *uploadLock {
+	for {
+		value, _ := s.locks.LoadOrStore(id, &uploadLock{})
+		lock := value.(*uploadLock)
+		lock.Lock()
+		if !lock.removed {
+			return lock
+		}
+		lock.Unlock()
+	}
+}
+
+// unlockAndRemove releases the lock of an upload that is gone.
+func (s *service) unlockAndRemove(id string, lock *uploadLock) {
+	lock.removed = true
+	s.locks.CompareAndDelete(id, lock)
+	lock.Unlock()
+}
+
+func (s *service) Create(ctx context.Context, tenantId string, ownerId string, length int64, metadata map[string]string) (*models.Upload, error) {
+	// the content is checked once complete, the descriptive fields can be rejected right away
+	v := validator.New()
+	validator.ValidateMediaFields(v, payloadFromMetadata(metadata), nil)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	upload := &models.Upload{
+		Id:        uuid.NewString(),
+		Length:    length,
+		Metadata:  metadata,
+		TenantId:  tenantId,
+		OwnerId:   ownerId,
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	}
+
+	part, err := os.Create(s.partPath(upload.Id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	part.Close()
+
+	if err := s.uploadRepository.Create(ctx, upload); err != nil {
+		os.Remove(s.partPath(upload.Id))
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (s *service) Get(ctx context.Context, scope repositories.Scope, id string) (*models.Upload, error) {
+	upload, err := s.uploadRepository.GetByID(ctx, scope.TenantId, id)
+	if err != nil {
+		return nil, err
+	}
+	if !scope.Allows(upload.TenantId, upload.OwnerId) || time.Now().After(upload.ExpiresAt) {
+		return nil, utils.ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+func (s *service) Append(ctx context.Context, scope repositories.Scope, id string, offset int64, chunk io.Reader) (*models.Upload, *models.Media, error) {
+	lock := s.lock(id)
+	defer func() {
+		// a rejected upload already released its lock
+		if !lock.removed {
+			lock.Unlock()
+		}
+	}()
+
+	upload, err := s.Get(ctx, scope, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if upload.Completed() {
+		return nil, nil, utils.ErrUploadCompleted
+	}
+	if offset != upload.Offset {
+		return nil, nil, utils.ErrUploadOffsetMismatch
+	}
+
+	part, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	// drop whatever a crashed request wrote past the last acknowledged offset
+	if err := part.Truncate(upload.Offset); err != nil {
+		part.Close()
+		return nil, nil, fmt.Errorf("failed to truncate upload file: %w", err)
+	}
+	if _, err := part.Seek(upload.Offset, io.SeekStart); err != nil {
+		part.Close()
+		return nil, nil, fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	remaining := upload.Length - upload.Offset
+	written, copyErr := io.Copy(part, io.LimitReader(utils.ContextReader(ctx, chunk), remaining))
+	if copyErr == nil {
+		// anything left in the chunk goes beyond the declared length
+		var extra [1]byte
+		if n, _ := chunk.Read(extra[:]); n > 0 {
+			copyErr = utils.ErrUploadTooLarge
+		}
+	}
+	if err := part.Close(); err != nil && copyErr == nil {
+		copyErr = fmt.Errorf("failed to write upload file: %w", err)
+	}
+	// a chunk past the declared length is refused as a whole, saving its start would leave the
+	// upload full without a media, the next request truncates what it wrote
+	if errors.Is(copyErr, utils.ErrUploadTooLarge) {
+		return nil, nil, copyErr
+	}
+
+	// keep what was received even if the connection dropped, the client resumes from there,
+	// which is also why the request cancellation must not reach this update
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().UTC().Add(s.ttl)
+	if err := s.uploadRepository.UpdateOffset(context.WithoutCancel(ctx), upload.TenantId, id, upload.Offset, upload.ExpiresAt); err != nil {
+		return nil, nil, err
+	}
+	if copyErr != nil {
+		return upload, nil, copyErr
+	}
+	if upload.Offset < upload.Length {
+		return upload, nil, nil
+	}
+
+	media, err := s.finish(ctx, upload, lock)
+	if err != nil {
+		return nil, nil, err
+	}
+	return upload, media, nil
+}
+
+// finish turns a complete upload into a media, or drops it with its lock when its content is rejected.
+func (s *service) finish(ctx context.Context, upload *models.Upload, lock *uploadLock) (*models.Media, error) {
+	part, err := os.Open(s.partPath(upload.Id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer part.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read upload file: %w", err)
+	}
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	// a rejected upload cannot be fixed by sending more bytes, it is dropped
+	payload := payloadFromMetadata(upload.Metadata)
+	payload.TenantId = upload.TenantId
+	payload.OwnerId = upload.OwnerId
+	content := &validator.Content{Field: "upload", Size: upload.Length, MimeType: validator.DetectMimeType(head[:n])}
+	v := validator.New()
+	validator.ValidateMediaContent(v, payload, content, nil, s.mediaRules)
+	if err := v.Err(); err != nil {
+		if deleteErr := s.uploadRepository.Delete(ctx, upload.TenantId, upload.Id); deleteErr != nil {
+			return nil, deleteErr
+		}
+		s.unlockAndRemove(upload.Id, lock)
+		if removeErr := s.removePart(upload.Id); removeErr != nil {
+			s.logger.Error("failed to remove rejected upload file", slog.String("id", upload.Id), slog.Any("error", removeErr))
+		}
+		return nil, err
+	}
+	validator.ApplyContent(payload, content)
+
+	info, err := s.blobStore.Put(ctx, repositories.NewContentKey(), part)
+	if err != nil {
+		return nil, err
+	}
+	payload.ContentKey = info.Key
+	payload.Checksum = info.Checksum
+	media, err := s.mediaRepository.Create(ctx, payload)
+	if err != nil {
+		s.blobStore.Delete(context.WithoutCancel(ctx), info.Key)
+		return nil, err
+	}
+
+	// the upload stays incomplete, a retry must not find the media of this attempt
+	if err := s.uploadRepository.Complete(ctx, upload.TenantId, upload.Id, media.Id); err != nil {
+		cleanupCtx := context.WithoutCancel(ctx)
+		if _, deleteErr := s.mediaRepository.Delete(cleanupCtx, repositories.SCOPE_ALL, media.Id); deleteErr != nil {
+			s.logger.Error("failed to delete media of uncompleted upload", slog.String("id", upload.Id), slog.String("mediaId", media.Id), slog.Any("error", deleteErr))
+		}
+		if deleteErr := s.blobStore.Delete(cleanupCtx, info.Key); deleteErr != nil {
+			s.logger.Error("failed to delete content of uncompleted upload", slog.String("id", upload.Id), slog.Any("error", deleteErr))
+		}
+		return nil, err
+	}
+	upload.MediaId = media.Id
+	os.Remove(s.partPath(upload.Id))
+	return media, nil
+}
+
+func (s *service) Terminate(ctx context.Context, scope repositories.Scope, id string) error {
+	// the lock goes even when the upload wasn't found, it would be left in the map otherwise
+	lock := s.lock(id)
+	defer s.unlockAndRemove(id, lock)
+
+	upload, err := s.Get(ctx, scope, id)
+	if err != nil {
+		return err
+	}
+	if err := s.uploadRepository.Delete(ctx, upload.TenantId, id); err != nil {
+		return err
+	}
+	return s.removePart(id)
+}
+
+func (s *service) removePart(id string) error {
+	err := os.Remove(s.partPath(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload file: %w", err)
+	}
+	return nil
+}
+
+func (s *service) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(janitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.removeExpired()
+			}
+		}
+	}()
+}
+
+func (s *service) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *service) removeExpired() {
+	ctx := context.Background()
+	expired, err := s.uploadRepository.GetExpired(ctx, time.Now().UTC())
+	if err != nil {
+		s.logger.Error("failed to get expired uploads", slog.Any("error", err))
+		return
+	}
+	for _, upload := range expired {
+		lock := s.lock(upload.Id)
+		if err := s.uploadRepository.Delete(ctx, upload.TenantId, upload.Id); err != nil && !errors.Is(err, utils.ErrUploadNotFound) {
+			s.logger.Error("failed to delete expired upload", slog.String("id", upload.Id), slog.Any("error", err))
+		} else if err := s.removePart(upload.Id); err != nil {
+			s.logger.Error("failed to remove expired upload file", slog.String("id", upload.Id), slog.Any("error", err))
+		}
+		s.unlockAndRemove(upload.Id, lock)
+	}
+}
+
+// payloadFromMetadata maps the Upload-Metadata keys onto the media fields. The "filetype" key
+// is what most tus clients send for the MIME type.
+func payloadFromMetadata(metadata map[string]string) *repositories.MediaPayload {
+	payload := &repositories.MediaPayload{
+		Title:       metadata["title"],
+		Description: metadata["description"],
+		Location:    metadata["location"],
+		Type:        metadata["type"],
+		MimeType:    metadata["mimeType"],
+		Tags:        metadata["tags"],
+	}
+	if payload.Title == "" {
+		payload.Title = metadata["filename"]
+	}
+	if payload.MimeType == "" {
+		payload.MimeType = metadata["filetype"]
+	}
+	return payload
+}
@@ -0,0 +1,145 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/filesystem"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/memory"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/validator"
+)
+
+const pngMagic = "\x89PNG\r\n\x1a\n"
+
+// failingUploads fails the given number of Complete calls, the other calls reach the repository.
+type failingUploads struct {
+	repositories.UploadRepository
+	failures int
+}
+
+func (f *failingUploads) Complete(ctx context.Context, tenantId string, id string, mediaId string) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("connection lost")
+	}
+	return f.UploadRepository.Complete(ctx, tenantId, id, mediaId)
+}
+
+func newTestService(t *testing.T, uploadRepository repositories.UploadRepository, mediaRepository repositories.MediaRepository, blobDir string) *service {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	blobStore, err := filesystem.NewBlobStore(logger, blobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := New(logger, uploadRepository, mediaRepository, blobStore, &validator.MediaRules{AllowedMimeTypes: []string{"image/png"}}, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created.(*service)
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestAppendCompleteFailure(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDatabase()
+	mediaRepository := memory.NewMediaRepository(db)
+	uploadRepository := &failingUploads{UploadRepository: memory.NewUploadRepository(db), failures: 1}
+	blobDir := t.TempDir()
+	s := newTestService(t, uploadRepository, mediaRepository, blobDir)
+
+	content := pngMagic + strings.Repeat("x", 40)
+	upload, err := s.Create(ctx, "acme", "alice", int64(len(content)), map[string]string{"title": "Upload"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := repositories.Scope{TenantId: "acme", OwnerId: "alice"}
+	if _, _, err := s.Append(ctx, scope, upload.Id, 0, strings.NewReader(content)); err == nil {
+		t.Fatal("expected the failure to complete the upload")
+	}
+
+	// the media and the content of the failed attempt are gone
+	page, err := mediaRepository.List(ctx, repositories.SCOPE_ALL, repositories.ListOptions{Limit: 10, SortBy: repositories.SORT_CREATED_AT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 0 || countFiles(t, blobDir) != 0 {
+		t.Fatalf("expected no media and no content, got %d media and %d files", len(page.Items), countFiles(t, blobDir))
+	}
+
+	// the client retries the last chunk, a single media comes out of it
+	retried, media, err := s.Append(ctx, scope, upload.Id, int64(len(content)), strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if media == nil || retried.MediaId != media.Id {
+		t.Fatalf("expected the retry to create the media, got %+v", retried)
+	}
+	page, err = mediaRepository.List(ctx, repositories.SCOPE_ALL, repositories.ListOptions{Limit: 10, SortBy: repositories.SORT_CREATED_AT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || countFiles(t, blobDir) != 1 {
+		t.Errorf("expected a single media and its content, got %d media and %d files", len(page.Items), countFiles(t, blobDir))
+	}
+}
+
+func TestLockRemoved(t *testing.T) {
+	s := newTestService(t, memory.NewUploadRepository(memory.NewDatabase()), nil, t.TempDir())
+
+	var holders atomic.Int32
+	hold := func() {
+		lock := s.lock("upload")
+		if holders.Add(1) > 1 {
+			t.Error("two callers hold the lock of the same upload")
+		}
+		time.Sleep(5 * time.Millisecond)
+		holders.Add(-1)
+		lock.Unlock()
+	}
+
+	// a caller waiting on a removed lock must not run alongside a new caller
+	lock := s.lock("upload")
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hold()
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	s.unlockAndRemove("upload", lock)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hold()
+		}()
+	}
+	wg.Wait()
+}
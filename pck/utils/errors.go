@@ -1,9 +1,15 @@
 package utils
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
 
+// CustomError is an error the API reports to clients as is, Code is the stable
+// machine readable identifier of the error and Status the HTTP status it maps to.
 type CustomError struct {
-	Code    int    `json:"code"`
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
 	Message string `json:"message"`
 }
 
@@ -12,11 +18,239 @@ func (e *CustomError) Error() string {
 }
 
 var ErrMissingID = &CustomError{
-	Code:    http.StatusBadRequest,
+	Status:  http.StatusBadRequest,
+	Code:    "missing_id",
 	Message: "missing id parameter",
 }
 
 var ErrMediaNotFound = &CustomError{
-	Code:    http.StatusNotFound,
+	Status:  http.StatusNotFound,
+	Code:    "media_not_found",
 	Message: "media not found",
 }
+
+var ErrAnalysisNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "analysis_not_found",
+	Message: "analysis not found",
+}
+
+var ErrMetadataNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "metadata_not_found",
+	Message: "metadata not found, it is extracted when the media is analysed",
+}
+
+var ErrTimelineNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "timeline_not_found",
+	Message: "timeline not found, it is built when a video is analysed",
+}
+
+var ErrArtifactNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "artifact_not_found",
+	Message: "artifact not found, the analysis of the media didn't produce it",
+}
+
+var ErrBlobNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "blob_not_found",
+	Message: "blob not found",
+}
+
+var ErrInvalidBlobKey = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "invalid_blob_key",
+	Message: "invalid blob key",
+}
+
+var ErrInvalidMediaData = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "invalid_media_data",
+	Message: "mediaData must be valid base64",
+}
+
+var ErrMediaNotHashed = &CustomError{
+	Status:  http.StatusConflict,
+	Code:    "media_not_hashed",
+	Message: "the media has no perceptual hash, images and videos are hashed when they are analysed",
+}
+
+var ErrInvalidImage = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "invalid_image",
+	Message: "the image could not be decoded",
+}
+
+var ErrUnsupportedImage = &CustomError{
+	Status:  http.StatusUnsupportedMediaType,
+	Code:    "unsupported_image",
+	Message: "only JPEG, PNG and GIF images can be searched for",
+}
+
+var ErrMissingUploadFile = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "missing_upload_file",
+	Message: "upload must contain a non empty file",
+}
+
+var ErrInvalidUploadMetadata = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "invalid_upload_metadata",
+	Message: "invalid upload metadata",
+}
+
+var ErrUploadNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "upload_not_found",
+	Message: "upload not found",
+}
+
+var ErrUploadOffsetMismatch = &CustomError{
+	Status:  http.StatusConflict,
+	Code:    "upload_offset_mismatch",
+	Message: "upload offset does not match the current offset",
+}
+
+var ErrUploadTooLarge = &CustomError{
+	Status:  http.StatusRequestEntityTooLarge,
+	Code:    "upload_too_large",
+	Message: "upload exceeds its declared length",
+}
+
+var ErrUploadCompleted = &CustomError{
+	Status:  http.StatusConflict,
+	Code:    "upload_completed",
+	Message: "upload is already completed",
+}
+
+var ErrInvalidCursor = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "invalid_cursor",
+	Message: "invalid or expired cursor",
+}
+
+var ErrMissingCredentials = &CustomError{
+	Status:  http.StatusUnauthorized,
+	Code:    "missing_credentials",
+	Message: "authentication is required",
+}
+
+var ErrInvalidToken = &CustomError{
+	Status:  http.StatusUnauthorized,
+	Code:    "invalid_token",
+	Message: "invalid bearer token",
+}
+
+var ErrInvalidApiKey = &CustomError{
+	Status:  http.StatusUnauthorized,
+	Code:    "invalid_api_key",
+	Message: "invalid or revoked api key",
+}
+
+var ErrInsufficientScope = &CustomError{
+	Status:  http.StatusForbidden,
+	Code:    "insufficient_scope",
+	Message: "the credentials lack the scope this resource requires",
+}
+
+var ErrForbidden = &CustomError{
+	Status:  http.StatusForbidden,
+	Code:    "forbidden",
+	Message: "your role does not allow this action",
+}
+
+var ErrRateLimited = &CustomError{
+	Status:  http.StatusTooManyRequests,
+	Code:    "rate_limited",
+	Message: "too many requests, retry later",
+}
+
+var ErrTooManyUploads = &CustomError{
+	Status:  http.StatusTooManyRequests,
+	Code:    "too_many_uploads",
+	Message: "too many uploads in progress, wait for one to finish",
+}
+
+var ErrMissingClientId = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "missing_client_id",
+	Message: "missing client_id query parameter",
+}
+
+var ErrInvalidTopic = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "invalid_topic",
+	Message: "invalid topic",
+}
+
+var ErrTooManySubscriptions = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "too_many_subscriptions",
+	Message: "too many topics subscribed to, unsubscribe from some first",
+}
+
+var ErrInvalidCommand = &CustomError{
+	Status:  http.StatusBadRequest,
+	Code:    "invalid_command",
+	Message: "invalid command",
+}
+
+var ErrShuttingDown = &CustomError{
+	Status:  http.StatusServiceUnavailable,
+	Code:    "shutting_down",
+	Message: "the server is shutting down, retry on another replica",
+}
+
+var ErrUserNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "user_not_found",
+	Message: "user not found",
+}
+
+var ErrReviewNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "review_not_found",
+	Message: "review not found",
+}
+
+var ErrApiKeyNotFound = &CustomError{
+	Status:  http.StatusNotFound,
+	Code:    "api_key_not_found",
+	Message: "api key not found",
+}
+
+var ErrValidationFailed = &CustomError{
+	Status:  http.StatusUnprocessableEntity,
+	Code:    "validation_failed",
+	Message: "the request contains invalid fields",
+}
+
+// FieldError tells why a single field of a request is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError holds every invalid field of a request, it matches ErrValidationFailed.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return ErrValidationFailed.Message + ": " + strings.Join(messages, ", ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidationFailed
+}
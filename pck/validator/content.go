@@ -0,0 +1,92 @@
+package validator
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// sniffLength is the number of leading bytes content types are detected from.
+const sniffLength = 512
+
+const unknownMimeType = "application/octet-stream"
+
+// mimeTypeAliases maps the names clients commonly declare to the ones DetectContentType reports.
+var mimeTypeAliases = map[string]string{
+	"image/jpg":       "image/jpeg",
+	"image/pjpeg":     "image/jpeg",
+	"audio/wav":       "audio/wave",
+	"audio/x-wav":     "audio/wave",
+	"audio/vnd.wave":  "audio/wave",
+	"audio/mp3":       "audio/mpeg",
+	"audio/x-flac":    "audio/flac",
+	"audio/x-aiff":    "audio/aiff",
+	"video/x-msvideo": "video/avi",
+	"video/msvideo":   "video/avi",
+}
+
+// Sniffer passes a stream through while keeping its first bytes, so the content type can
+// be detected from the magic bytes of content that is streamed elsewhere.
+type Sniffer struct {
+	reader io.Reader
+	head   []byte
+}
+
+func NewSniffer(reader io.Reader) *Sniffer {
+	return &Sniffer{reader: reader, head: make([]byte, 0, sniffLength)}
+}
+
+func (s *Sniffer) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	if missing := sniffLength - len(s.head); missing > 0 {
+		s.head = append(s.head, p[:min(n, missing)]...)
+	}
+	return n, err
+}
+
+// MimeType detects the type of what was read so far.
+func (s *Sniffer) MimeType() string {
+	return DetectMimeType(s.head)
+}
+
+// DetectMimeType tells the content type from the magic bytes at the start of the content,
+// application/octet-stream when it is not recognised.
+func DetectMimeType(head []byte) string {
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if detected != unknownMimeType {
+		return detected
+	}
+
+	// formats DetectContentType does not know about
+	switch {
+	case len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) && bytes.Equal(head[8:12], []byte("qt  ")):
+		return "video/quicktime"
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "audio/flac"
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 && head[1]&0x06 != 0:
+		// an MPEG audio frame without ID3 tag, the layer bits must not be the reserved value
+		return "audio/mpeg"
+	}
+	return unknownMimeType
+}
+
+// NormalizeMimeType drops the parameters and resolves aliases, so "image/jpg; q=1"
+// compares equal to "image/jpeg". application/octet-stream makes no claim about the
+// content and normalizes to an empty string.
+func NormalizeMimeType(mimeType string) string {
+	parsed, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return mimeType
+	}
+	if alias, ok := mimeTypeAliases[parsed]; ok {
+		return alias
+	}
+	if parsed == unknownMimeType {
+		return ""
+	}
+	return parsed
+}
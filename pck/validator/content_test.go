@@ -0,0 +1,69 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"GIF89a", "image/gif"},
+		{"RIFF\x00\x00\x00\x00WEBPVP8 ", "image/webp"},
+		{"\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom", "video/mp4"},
+		{"\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00qt  ", "video/quicktime"},
+		{"\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\xf7\x81\x01\x42\xf2\x81\x04\x42\xf3\x81\x08\x42\x82\x84webm", "video/webm"},
+		{"ID3\x04\x00\x00\x00\x00\x00\x00", "audio/mpeg"},
+		{"\xff\xfb\x90\x64\x00", "audio/mpeg"},
+		{"fLaC\x00\x00\x00\x22", "audio/flac"},
+		{"RIFF\x00\x00\x00\x00WAVEfmt ", "audio/wave"},
+		{"plain text", "text/plain"},
+		{"\x00\x01\x02\x03", "application/octet-stream"},
+	}
+	for _, test := range tests {
+		if detected := DetectMimeType([]byte(test.content)); detected != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.content, test.expected, detected)
+		}
+	}
+}
+
+func TestSnifferKeepsTheHead(t *testing.T) {
+	content := "\x89PNG\r\n\x1a\n" + strings.Repeat("x", 2*sniffLength)
+	sniffer := NewSniffer(strings.NewReader(content))
+
+	buffer := make([]byte, 3)
+	read := 0
+	for {
+		n, err := sniffer.Read(buffer)
+		read += n
+		if err != nil {
+			break
+		}
+	}
+	if read != len(content) || len(sniffer.head) != sniffLength {
+		t.Fatalf("expected to pass %d bytes and keep %d, passed %d and kept %d", len(content), sniffLength, read, len(sniffer.head))
+	}
+	if sniffer.MimeType() != "image/png" {
+		t.Errorf("expected image/png, got %s", sniffer.MimeType())
+	}
+}
+
+func TestNormalizeMimeType(t *testing.T) {
+	tests := map[string]string{
+		"image/jpg":                "image/jpeg",
+		"IMAGE/PNG":                "image/png",
+		"audio/x-wav":              "audio/wave",
+		"video/mp4; codecs=avc1":   "video/mp4",
+		"application/octet-stream": "",
+		"application/json; q=0.9":  "application/json",
+	}
+	for mimeType, expected := range tests {
+		if normalized := NormalizeMimeType(mimeType); normalized != expected {
+			t.Errorf("%q: expected %q, got %q", mimeType, expected, normalized)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/repositories"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 5000
+	maxLocationLength    = 200
+	maxTagsLength        = 1000
+)
+
+// MediaRules are the constraints on the content of every media.
+type MediaRules struct {
+	// AllowedMimeTypes lists the detected content types accepted, e.g. image/png.
+	AllowedMimeTypes []string
+}
+
+// Content describes the bytes actually received for a media.
+type Content struct {
+	// Field is the request field that carried the content, mediaData when empty.
+	Field string
+	Size  int64
+	// MimeType is the type detected from the magic bytes, see DetectMimeType.
+	MimeType string
+}
+
+// ValidateMediaFields checks the descriptive fields of a payload. Existing is the media
+// being updated, where empty fields keep their current value, or nil on creation.
+func ValidateMediaFields(v *Validator, payload *repositories.MediaPayload, existing *models.Media) {
+	if existing == nil {
+		v.Check(NotBlank(payload.Title), "title", "required", "must be provided")
+	}
+	v.Check(MaxChars(payload.Title, maxTitleLength), "title", "too_long", fmt.Sprintf("must not be more than %d characters long", maxTitleLength))
+	v.Check(MaxChars(payload.Description, maxDescriptionLength), "description", "too_long", fmt.Sprintf("must not be more than %d characters long", maxDescriptionLength))
+	v.Check(MaxChars(payload.Location, maxLocationLength), "location", "too_long", fmt.Sprintf("must not be more than %d characters long", maxLocationLength))
+	v.Check(MaxChars(payload.Tags, maxTagsLength), "tags", "too_long", fmt.Sprintf("must not be more than %d characters long", maxTagsLength))
+}
+
+// ValidateMediaContent checks the declared size, MIME type and type of a payload against
+// the content received, which is nil when the request carries no content. Existing is
+// the media being updated or nil on creation, where content is required.
+func ValidateMediaContent(v *Validator, payload *repositories.MediaPayload, content *Content, existing *models.Media, rules *MediaRules) {
+	declaredMimeType := NormalizeMimeType(payload.MimeType)
+
+	var actualMimeType string
+	switch {
+	case content != nil:
+		field := content.Field
+		if field == "" {
+			field = "mediaData"
+		}
+		actualMimeType = content.MimeType
+		v.Check(content.Size > 0, field, "required", "must not be empty")
+		v.Check(PermittedValue(content.MimeType, rules.AllowedMimeTypes...), field, "unsupported_type",
+			fmt.Sprintf("content detected as %s is not one of the allowed media types: %s", content.MimeType, strings.Join(rules.AllowedMimeTypes, ", ")))
+		v.Check(declaredMimeType == "" || declaredMimeType == content.MimeType, "mimeType", "mismatch",
+			fmt.Sprintf("declared as %s but the content is %s", payload.MimeType, content.MimeType))
+		v.Check(payload.Size == 0 || int64(payload.Size) == content.Size, "size", "mismatch",
+			fmt.Sprintf("declared as %d bytes but the content has %d bytes", payload.Size, content.Size))
+	case existing == nil:
+		v.AddError("mediaData", "required", "must be provided")
+	default:
+		actualMimeType = existing.MimeType
+		v.Check(payload.MimeType == "", "mimeType", "requires_content", "can only change together with mediaData")
+		v.Check(payload.Size == 0, "size", "requires_content", "can only change together with mediaData")
+	}
+
+	// the type is the top level MIME type, e.g. "video" for video/mp4
+	if payload.Type != "" && actualMimeType != "" {
+		expected, _, _ := strings.Cut(actualMimeType, "/")
+		v.Check(payload.Type == expected, "type", "mismatch", fmt.Sprintf("must be %s for %s content", expected, actualMimeType))
+	}
+}
+
+// ApplyContent describes the received content in the payload once it was validated,
+// the detected MIME type replaces whatever the client declared.
+func ApplyContent(payload *repositories.MediaPayload, content *Content) {
+	payload.Size = int(content.Size)
+	payload.MimeType = content.MimeType
+	payload.Type = ""
+	payload.SetDefaults()
+}
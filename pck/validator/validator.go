@@ -0,0 +1,63 @@
+package validator
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/utils"
+)
+
+// Validator collects the field errors of a request so all of them are reported at once.
+type Validator struct {
+	Errors []*utils.FieldError
+}
+
+func New() *Validator {
+	return &Validator{Errors: []*utils.FieldError{}}
+}
+
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// AddError records an error, only the first error of every field is kept.
+func (v *Validator) AddError(field string, code string, message string) {
+	if v.HasError(field) {
+		return
+	}
+	v.Errors = append(v.Errors, &utils.FieldError{Field: field, Code: code, Message: message})
+}
+
+func (v *Validator) HasError(field string) bool {
+	return slices.ContainsFunc(v.Errors, func(err *utils.FieldError) bool {
+		return err.Field == field
+	})
+}
+
+// Check records the error unless ok holds.
+func (v *Validator) Check(ok bool, field string, code string, message string) {
+	if !ok {
+		v.AddError(field, code, message)
+	}
+}
+
+// Err returns nil when valid, a *utils.ValidationError holding every field error otherwise.
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+	return &utils.ValidationError{Errors: v.Errors}
+}
+
+func NotBlank(value string) bool {
+	return strings.TrimSpace(value) != ""
+}
+
+func MaxChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) <= n
+}
+
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	return slices.Contains(permittedValues, value)
+}
@@ -0,0 +1,128 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frames are decoded at most this wide, the detectors don't need more and the PNGs stay small
+const maxFrameWidth = 1280
+
+// FFmpeg decodes videos with the ffmpeg and ffprobe executables installed on the host.
+type FFmpeg struct {
+	ffmpeg  string
+	ffprobe string
+}
+
+// NewFFmpeg looks the executables up, by name in the PATH or by their path.
+func NewFFmpeg(ffmpegPath string, ffprobePath string) (*FFmpeg, error) {
+	ffmpeg, err := exec.LookPath(ffmpegPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ffmpeg: %w", err)
+	}
+	ffprobe, err := exec.LookPath(ffprobePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ffprobe: %w", err)
+	}
+	return &FFmpeg{ffmpeg: ffmpeg, ffprobe: ffprobe}, nil
+}
+
+func (f *FFmpeg) Probe(ctx context.Context, path string) (*Probe, error) {
+	// only the keyframes are decoded, their timestamps are all that is read of them
+	output, err := run(ctx, f.ffprobe,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-skip_frame", "nokey",
+		"-show_entries", "format=duration:frame=best_effort_timestamp_time",
+		"-of", "json",
+		path,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseProbe(output)
+}
+
+func (f *FFmpeg) Frame(ctx context.Context, path string, at time.Duration) (image.Image, error) {
+	// seeking before the input jumps to the keyframe before the time, then decodes up to it
+	output, err := run(ctx, f.ffmpeg,
+		"-v", "error",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-i", path,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale='min(iw,%d)':-2", maxFrameWidth),
+		"-f", "image2pipe",
+		"-c:v", "png",
+		"-",
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("no frame at %v", at)
+	}
+	frame, err := png.Decode(bytes.NewReader(output))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame at %v: %w", at, err)
+	}
+	return frame, nil
+}
+
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s failed: %w: %s", name, err, message)
+		}
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// probeOutput is the JSON written by ffprobe, its numbers are strings.
+type probeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Frames []struct {
+		Time string `json:"best_effort_timestamp_time"`
+	} `json:"frames"`
+}
+
+func parseProbe(output []byte) (*Probe, error) {
+	var parsed probeOutput
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	duration, err := strconv.ParseFloat(parsed.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		return nil, fmt.Errorf("the video has no duration")
+	}
+	probe := &Probe{Duration: seconds(duration)}
+	for _, frame := range parsed.Frames {
+		// frames without a timestamp are reported as N/A
+		at, err := strconv.ParseFloat(frame.Time, 64)
+		if err != nil || at < 0 || at > duration {
+			continue
+		}
+		if keyframe := seconds(at); len(probe.Keyframes) == 0 || keyframe > probe.Keyframes[len(probe.Keyframes)-1] {
+			probe.Keyframes = append(probe.Keyframes, keyframe)
+		}
+	}
+	return probe, nil
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
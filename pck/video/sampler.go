@@ -0,0 +1,159 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// ErrNoFrames is returned when not a single frame of a video could be decoded.
+var ErrNoFrames = errors.New("no frame could be decoded")
+
+// Probe is what the decoder tells of a video before decoding its frames.
+type Probe struct {
+	Duration time.Duration
+	// Keyframes are the times of the keyframes of the first video stream, in order
+	Keyframes []time.Duration
+}
+
+// Decoder reads videos from a file, ffmpeg in production and a fake in the tests.
+type Decoder interface {
+	Probe(ctx context.Context, path string) (*Probe, error)
+	// Frame decodes the frame shown at the given time.
+	Frame(ctx context.Context, path string, at time.Duration) (image.Image, error)
+}
+
+// Frame is a picture sampled from a video, at its time from the start.
+type Frame struct {
+	Time  time.Duration
+	Image image.Image
+}
+
+// Sample is the frames sampled from a video, in order.
+type Sample struct {
+	Sampling models.FrameSampling
+	Duration time.Duration
+	Frames   []Frame
+}
+
+type Options struct {
+	Sampling models.FrameSampling
+	// Interval separates the frames sampled at fixed intervals, and the keyframes of videos that have almost none
+	Interval time.Duration
+	// MaxFrames bounds the frames decoded from a video, longer ones are sampled further apart
+	MaxFrames int
+	// TempDir receives the videos while they are decoded, the default temporary directory when empty
+	TempDir string
+}
+
+// Sampler picks the frames of videos to analyse, the keyframes or one every interval.
+type Sampler struct {
+	decoder Decoder
+	options Options
+}
+
+func NewSampler(decoder Decoder, options Options) *Sampler {
+	return &Sampler{decoder: decoder, options: options}
+}
+
+// Sample decodes the frames of a video. The frames that fail to decode are left out, a video
+// without any decodable frame is an error.
+func (s *Sampler) Sample(ctx context.Context, data []byte) (*Sample, error) {
+	return s.SampleReader(ctx, bytes.NewReader(data))
+}
+
+// SampleReader decodes the frames of a video streamed from the reader, like Sample does.
+func (s *Sampler) SampleReader(ctx context.Context, content io.Reader) (*Sample, error) {
+	// the decoder needs a file, the index of MP4s may be at their end
+	file, err := os.CreateTemp(s.options.TempDir, "video-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary video: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temporary video: %w", err)
+	}
+
+	probe, err := s.decoder.Probe(ctx, file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe video: %w", err)
+	}
+	sampling, times := s.times(probe)
+	sample := &Sample{Sampling: sampling, Duration: probe.Duration}
+	var firstErr error
+	for _, at := range times {
+		frame, err := s.decoder.Frame(ctx, file.Name(), at)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		sample.Frames = append(sample.Frames, Frame{Time: at, Image: frame})
+	}
+	if len(sample.Frames) == 0 {
+		if firstErr != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNoFrames, firstErr)
+		}
+		return nil, ErrNoFrames
+	}
+	return sample, nil
+}
+
+// Keyframes returns the pictures of the sampled frames, for the similarity index to hash them.
+func (s *Sampler) Keyframes(ctx context.Context, data []byte) ([]image.Image, error) {
+	sample, err := s.Sample(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return sample.Images(), nil
+}
+
+// Images returns the pictures of the frames, in order.
+func (s *Sample) Images() []image.Image {
+	images := make([]image.Image, 0, len(s.Frames))
+	for _, frame := range s.Frames {
+		images = append(images, frame.Image)
+	}
+	return images
+}
+
+// times picks the times of the frames to decode, at most MaxFrames spread over the video.
+func (s *Sampler) times(probe *Probe) (models.FrameSampling, []time.Duration) {
+	maxFrames := max(s.options.MaxFrames, 1)
+	// a video with a single keyframe would be reduced to its first picture
+	if s.options.Sampling == models.SAMPLING_KEYFRAMES && len(probe.Keyframes) > 1 {
+		if len(probe.Keyframes) <= maxFrames {
+			return models.SAMPLING_KEYFRAMES, probe.Keyframes
+		}
+		times := make([]time.Duration, 0, maxFrames)
+		for i := range maxFrames {
+			times = append(times, probe.Keyframes[i*len(probe.Keyframes)/maxFrames])
+		}
+		return models.SAMPLING_KEYFRAMES, times
+	}
+
+	interval := max(s.options.Interval, time.Millisecond)
+	if probe.Duration > interval*time.Duration(maxFrames) {
+		interval = probe.Duration / time.Duration(maxFrames)
+	}
+	times := []time.Duration{0}
+	for at := interval; at < probe.Duration && len(times) < maxFrames; at += interval {
+		times = append(times, at)
+	}
+	return models.SAMPLING_INTERVAL, times
+}
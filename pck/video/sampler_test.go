@@ -0,0 +1,161 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"image"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cosmintimis/deepfake-guardian-api/pck/business/models"
+)
+
+// fakeDecoder answers with the probe it was given, and blank frames except at the broken times.
+type fakeDecoder struct {
+	probe   Probe
+	broken  map[time.Duration]bool
+	content []byte
+}
+
+func (f *fakeDecoder) Probe(ctx context.Context, path string) (*Probe, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f.content = content
+	probe := f.probe
+	return &probe, nil
+}
+
+func (f *fakeDecoder) Frame(ctx context.Context, path string, at time.Duration) (image.Image, error) {
+	if f.broken[at] {
+		return nil, errors.New("corrupted frame")
+	}
+	return image.NewGray(image.Rect(0, 0, 4, 4)), nil
+}
+
+func timesOf(values ...float64) []time.Duration {
+	var times []time.Duration
+	for _, value := range values {
+		times = append(times, seconds(value))
+	}
+	return times
+}
+
+func TestSample(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  Options
+		probe    Probe
+		sampling models.FrameSampling
+		times    []time.Duration
+	}{
+		{
+			"keyframes",
+			Options{Sampling: models.SAMPLING_KEYFRAMES, Interval: 2 * time.Second, MaxFrames: 10},
+			Probe{Duration: 10 * time.Second, Keyframes: timesOf(0, 2.5, 7)},
+			models.SAMPLING_KEYFRAMES,
+			timesOf(0, 2.5, 7),
+		},
+		{
+			"keyframes spread over long videos",
+			Options{Sampling: models.SAMPLING_KEYFRAMES, Interval: 2 * time.Second, MaxFrames: 3},
+			Probe{Duration: 10 * time.Second, Keyframes: timesOf(0, 1, 2, 3, 4, 5, 6, 7, 8)},
+			models.SAMPLING_KEYFRAMES,
+			timesOf(0, 3, 6),
+		},
+		{
+			"single keyframe",
+			Options{Sampling: models.SAMPLING_KEYFRAMES, Interval: 2 * time.Second, MaxFrames: 10},
+			Probe{Duration: 5 * time.Second, Keyframes: timesOf(0)},
+			models.SAMPLING_INTERVAL,
+			timesOf(0, 2, 4),
+		},
+		{
+			"interval",
+			Options{Sampling: models.SAMPLING_INTERVAL, Interval: 2 * time.Second, MaxFrames: 10},
+			Probe{Duration: 6 * time.Second, Keyframes: timesOf(0, 1, 3)},
+			models.SAMPLING_INTERVAL,
+			timesOf(0, 2, 4),
+		},
+		{
+			"interval widened for long videos",
+			Options{Sampling: models.SAMPLING_INTERVAL, Interval: time.Second, MaxFrames: 4},
+			Probe{Duration: 20 * time.Second},
+			models.SAMPLING_INTERVAL,
+			timesOf(0, 5, 10, 15),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := &fakeDecoder{probe: tt.probe}
+			sample, err := NewSampler(decoder, tt.options).Sample(context.Background(), []byte("video"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(decoder.content) != "video" {
+				t.Errorf("expected the decoder to read the video, got %q", decoder.content)
+			}
+			var times []time.Duration
+			for _, frame := range sample.Frames {
+				times = append(times, frame.Time)
+			}
+			if sample.Sampling != tt.sampling || sample.Duration != tt.probe.Duration || !slices.Equal(times, tt.times) {
+				t.Errorf("expected %s frames at %v, got %s frames at %v", tt.sampling, tt.times, sample.Sampling, times)
+			}
+		})
+	}
+}
+
+func TestSampleBrokenFrames(t *testing.T) {
+	probe := Probe{Duration: 6 * time.Second, Keyframes: timesOf(0, 2, 4)}
+	options := Options{Sampling: models.SAMPLING_KEYFRAMES, MaxFrames: 10}
+
+	// the frames that fail to decode are left out
+	decoder := &fakeDecoder{probe: probe, broken: map[time.Duration]bool{2 * time.Second: true}}
+	sample, err := NewSampler(decoder, options).Sample(context.Background(), []byte("video"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sample.Frames) != 2 || sample.Frames[1].Time != 4*time.Second {
+		t.Errorf("expected the frames at 0s and 4s, got %+v", sample.Frames)
+	}
+
+	decoder = &fakeDecoder{probe: probe, broken: map[time.Duration]bool{0: true, 2 * time.Second: true, 4 * time.Second: true}}
+	if _, err := NewSampler(decoder, options).Sample(context.Background(), []byte("video")); !errors.Is(err, ErrNoFrames) {
+		t.Errorf("expected %v, got %v", ErrNoFrames, err)
+	}
+
+	frames, err := NewSampler(&fakeDecoder{probe: probe}, options).Keyframes(context.Background(), []byte("video"))
+	if err != nil || len(frames) != 3 {
+		t.Errorf("expected 3 keyframes, got %d (%v)", len(frames), err)
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	output := []byte(`{
+		"frames": [
+			{"best_effort_timestamp_time": "0.000000"},
+			{"best_effort_timestamp_time": "N/A"},
+			{"best_effort_timestamp_time": "2.002000"},
+			{"best_effort_timestamp_time": "2.002000"},
+			{"best_effort_timestamp_time": "4.500000"}
+		],
+		"format": {"duration": "6.040000"}
+	}`)
+	probe, err := parseProbe(output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if probe.Duration != 6040*time.Millisecond || !slices.Equal(probe.Keyframes, timesOf(0, 2.002, 4.5)) {
+		t.Errorf("unexpected probe: %+v", probe)
+	}
+
+	for _, invalid := range []string{``, `not json`, `{"format": {"duration": "N/A"}}`, `{"format": {"duration": "0"}}`} {
+		if _, err := parseProbe([]byte(invalid)); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}